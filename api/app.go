@@ -18,16 +18,19 @@ import (
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
 	tsuruIo "github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/rec"
 	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/service"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -53,6 +56,25 @@ func getApp(name string) (*app.App, error) {
 	return a, nil
 }
 
+// getAppWithPermission returns the app in the request, checking whether the
+// token has the given permission on it.
+func getAppWithPermission(r *http.Request, t auth.Token, perm *permission.PermissionScheme) (*app.App, error) {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return nil, err
+	}
+	allowed := permission.Check(t, perm,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return nil, permission.ErrUnauthorized
+	}
+	return &a, nil
+}
+
 // title: remove app
 // path: /apps/{name}
 // method: DELETE
@@ -94,11 +116,12 @@ func appDelete(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 // miniApp is a minimal representation of the app, created to make appList
 // faster and transmit less data.
 type miniApp struct {
-	Name  string            `json:"name"`
-	Units []provision.Unit  `json:"units"`
-	CName []string          `json:"cname"`
-	Ip    string            `json:"ip"`
-	Lock  provision.AppLock `json:"lock"`
+	Name   string            `json:"name"`
+	Units  []provision.Unit  `json:"units"`
+	CName  []string          `json:"cname"`
+	Ip     string            `json:"ip"`
+	Lock   provision.AppLock `json:"lock"`
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 func minifyApp(app app.App) (miniApp, error) {
@@ -107,11 +130,12 @@ func minifyApp(app app.App) (miniApp, error) {
 		return miniApp{}, err
 	}
 	return miniApp{
-		Name:  app.GetName(),
-		Units: units,
-		CName: app.GetCname(),
-		Ip:    app.GetIp(),
-		Lock:  app.GetLock(),
+		Name:   app.GetName(),
+		Units:  units,
+		CName:  app.GetCname(),
+		Ip:     app.GetIp(),
+		Lock:   app.GetLock(),
+		Labels: app.GetLabels(),
 	}, nil
 }
 
@@ -180,6 +204,13 @@ func appList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		extra = append(extra, fmt.Sprintf("status=%s", strings.Join(status, ",")))
 		filter.Statuses = status
 	}
+	if labels, ok := r.URL.Query()["label"]; ok {
+		filter.Labels, err = label.Parse(labels)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		extra = append(extra, fmt.Sprintf("label=%s", strings.Join(labels, ",")))
+	}
 	rec.Log(u.Email, "app-list", extra...)
 	contexts := permission.ContextsForPermission(t, permission.PermAppRead)
 	if len(contexts) == 0 {
@@ -307,6 +338,9 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 					Message: "Quota exceeded",
 				}
 			}
+			if _, ok := e.Err.(*auth.TeamQuotaExceededError); ok {
+				return &errors.HTTP{Code: http.StatusForbidden, Message: e.Err.Error()}
+			}
 		}
 		if err == app.InvalidPlatformError {
 			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
@@ -804,23 +838,31 @@ func writeEnvVars(w http.ResponseWriter, a *app.App, variables ...string) error
 	if len(variables) > 0 {
 		for _, variable := range variables {
 			if v, ok := a.Env[variable]; ok {
-				result = append(result, v)
+				result = append(result, maskSecretEnv(v))
 			}
 		}
 	} else {
 		for _, v := range a.Env {
-			result = append(result, v)
+			result = append(result, maskSecretEnv(v))
 		}
 	}
 	return json.NewEncoder(w).Encode(result)
 }
 
+func maskSecretEnv(env bind.EnvVar) bind.EnvVar {
+	if env.Secret {
+		env.Value = secret.Mask
+	}
+	return env
+}
+
 // Envs represents the configuration of an environment variable data
 // for the remote API
 type Envs struct {
 	Envs      []struct{ Name, Value string }
 	NoRestart bool
 	Private   bool
+	Secret    bool
 }
 
 // title: set envs
@@ -853,6 +895,9 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
+	if e.Secret && !secret.Enabled() {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: secret.ErrNoKeys.Error()}
+	}
 	extra := fmt.Sprintf("private=%t", e.Private)
 	appName := r.URL.Query().Get(":app")
 	a, err := getAppFromContext(appName, r)
@@ -872,7 +917,10 @@ func setEnv(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	variables := []bind.EnvVar{}
 	for _, v := range e.Envs {
 		envs[v.Name] = v.Value
-		variables = append(variables, bind.EnvVar{Name: v.Name, Value: v.Value, Public: !e.Private})
+		if e.Secret {
+			envs[v.Name] = secret.Mask
+		}
+		variables = append(variables, bind.EnvVar{Name: v.Name, Value: v.Value, Public: !e.Private && !e.Secret, Secret: e.Secret})
 	}
 	rec.Log(u.Email, "set-env", "app="+appName, envs, extra)
 	w.Header().Set("Content-Type", "application/x-json-stream")
@@ -1042,7 +1090,7 @@ func unsetCName(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 // title: app log
 // path: /apps/{app}/log
 // method: GET
-// produce: application/x-json-stream
+// produce: application/x-json-stream, application/x-ndjson
 // responses:
 //   200: Ok
 //   400: Invalid data
@@ -1051,7 +1099,8 @@ func unsetCName(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	var err error
 	var lines int
-	if l := r.URL.Query().Get("lines"); l != "" {
+	params := r.URL.Query()
+	if l := params.Get("lines"); l != "" {
 		lines, err = strconv.Atoi(l)
 		if err != nil {
 			msg := `Parameter "lines" must be an integer.`
@@ -1060,30 +1109,60 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
-	w.Header().Set("Content-Type", "application/x-json-stream")
-	source := r.URL.Query().Get("source")
-	unit := r.URL.Query().Get("unit")
-	follow := r.URL.Query().Get("follow")
+	query := app.LogQuery{
+		Sources:       nonEmptyValues(params["source"]),
+		Units:         nonEmptyValues(params["unit"]),
+		Message:       params.Get("message"),
+		MessageRegexp: params.Get("regex"),
+		Limit:         lines,
+		Before:        params.Get("before"),
+	}
+	dates := []struct {
+		name string
+		date *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}}
+	for _, d := range dates {
+		if value := params.Get(d.name); value != "" {
+			*d.date, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				msg := fmt.Sprintf("Parameter %q must be a RFC 3339 timestamp.", d.name)
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+			}
+		}
+	}
+	err = query.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "jsonl" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "format" must be "json" or "jsonl".`}
+	}
+	follow := params.Get("follow")
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
-	appName := r.URL.Query().Get(":app")
+	appName := params.Get(":app")
 	extra := []interface{}{
 		"app=" + appName,
 		fmt.Sprintf("lines=%d", lines),
 	}
-	if source != "" {
-		extra = append(extra, "source="+source)
+	if len(query.Sources) > 0 {
+		extra = append(extra, "source="+strings.Join(query.Sources, ","))
 	}
 	if follow == "1" {
 		extra = append(extra, "follow=1")
 	}
-	if unit != "" {
-		extra = append(extra, "unit="+unit)
+	if len(query.Units) > 0 {
+		extra = append(extra, "unit="+strings.Join(query.Units, ","))
+	}
+	for _, name := range []string{"since", "until", "message", "regex", "before"} {
+		if value := params.Get(name); value != "" {
+			extra = append(extra, name+"="+value)
+		}
 	}
 	rec.Log(u.Email, "app-log", extra...)
-	filterLog := app.Applog{Source: source, Unit: unit}
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1097,12 +1176,34 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	logs, cursor, err := a.QueryLogs(query)
+	if err == app.ErrInvalidLogCursor {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	if err != nil {
 		return err
 	}
+	if cursor != "" {
+		w.Header().Set("Tsuru-Log-Cursor", cursor)
+	}
 	encoder := json.NewEncoder(w)
-	err = encoder.Encode(logs)
+	encode := func(logs []app.Applog) error {
+		return encoder.Encode(logs)
+	}
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encode = func(logs []app.Applog) error {
+			for i := range logs {
+				if err := encoder.Encode(logs[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/x-json-stream")
+	}
+	err = encode(logs)
 	if err != nil {
 		return err
 	}
@@ -1115,7 +1216,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
+	l, err := app.NewLogQueryListener(&a, query)
 	if err != nil {
 		return err
 	}
@@ -1135,7 +1236,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		if logMsg == (app.Applog{}) {
 			break
 		}
-		err := encoder.Encode([]app.Applog{logMsg})
+		err := encode([]app.Applog{logMsg})
 		if err != nil {
 			break
 		}
@@ -1143,6 +1244,16 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+func nonEmptyValues(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func getServiceInstance(serviceName, instanceName, appName string) (*service.ServiceInstance, *app.App, error) {
 	var app app.App
 	conn, err := db.Conn()
@@ -1420,7 +1531,7 @@ func addLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 //   401: Unauthorized
 //   404: App not found
 //   409: App locked
-//   412: Number of units or platform don't match
+//   412: Number of units or platform don't match, or apps attached to multiple routers
 func swap(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	u, err := t.User()
 	if err != nil {
@@ -1496,7 +1607,11 @@ func swap(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		}
 	}
 	rec.Log(u.Email, "swap", "app1="+app1Name, "app2="+app2Name)
-	return app.Swap(app1, app2, cnameOnly)
+	err = app.Swap(app1, app2, cnameOnly)
+	if err == router.ErrSwapMultipleRouters {
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
 }
 
 // title: app start
@@ -6,6 +6,7 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
@@ -2410,6 +2412,74 @@ func (s *S) TestSetEnvHandlerShouldSetAPrivateEnvironmentVariableInTheApp(c *che
 `)
 }
 
+func (s *S) TestSetEnvHandlerShouldSetASecretEnvironmentVariableInTheApp(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/apps/%s/env", a.Name)
+	d := Envs{
+		Envs: []struct{ Name, Value string }{
+			{"API_TOKEN", "s3cr3t"},
+		},
+		Secret: true,
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", url, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	env := dbApp.Env["API_TOKEN"]
+	c.Assert(env.Secret, check.Equals, true)
+	c.Assert(env.Public, check.Equals, false)
+	c.Assert(env.Value, check.Not(check.Equals), "s3cr3t")
+	action := rectest.Action{
+		Action: "set-env",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=" + a.Name, map[string]string{"API_TOKEN": "*****"}, "private=false"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	request, err = http.NewRequest("GET", url+"?env=API_TOKEN", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []bind.EnvVar
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []bind.EnvVar{{Name: "API_TOKEN", Value: "*****", Secret: true}})
+}
+
+func (s *S) TestSetEnvHandlerSecretWithoutKeys(c *check.C) {
+	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	d := Envs{
+		Envs:   []struct{ Name, Value string }{{"API_TOKEN", "s3cr3t"}},
+		Secret: true,
+	}
+	v, err := form.EncodeToValues(&d)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/black-dog/env", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, secret.ErrNoKeys.Error()+"\n")
+}
+
 func (s *S) TestSetEnvHandlerShouldSetADoublePrivateEnvironmentVariableInTheApp(c *check.C) {
 	a := app.App{Name: "black-dog", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -3416,6 +3486,91 @@ func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	c.Assert(logs[2].Message, check.Equals, "14")
 }
 
+func (s *S) TestAppLogQuery(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC().Truncate(time.Second)
+	coll := s.logConn.Logs(a.Name)
+	defer coll.DropCollection()
+	for i := 0; i < 10; i++ {
+		l := app.Applog{
+			Date:    now.Add(time.Duration(i) * time.Minute),
+			Message: fmt.Sprintf("request %d", i),
+			Source:  []string{"web", "worker", "tsuru"}[i%3],
+			AppName: a.Name,
+		}
+		coll.Insert(l)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	params := url.Values{}
+	params.Set("lines", "2")
+	params.Add("source", "web")
+	params.Add("source", "worker")
+	params.Set("since", now.Add(time.Minute).Format(time.RFC3339))
+	params.Set("until", now.Add(8*time.Minute).Format(time.RFC3339))
+	params.Set("regex", "request [0-9]")
+	params.Set("format", "jsonl")
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/log?:app="+a.Name+"&"+params.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-ndjson")
+	var messages []string
+	decoder := json.NewDecoder(recorder.Body)
+	for decoder.More() {
+		var l app.Applog
+		err = decoder.Decode(&l)
+		c.Assert(err, check.IsNil)
+		messages = append(messages, l.Message)
+	}
+	c.Assert(messages, check.DeepEquals, []string{"request 6", "request 7"})
+	cursor := recorder.Header().Get("Tsuru-Log-Cursor")
+	c.Assert(cursor, check.Not(check.Equals), "")
+	params.Set("before", cursor)
+	params.Set("lines", "3")
+	params.Del("format")
+	request, err = http.NewRequest("GET", "/apps/"+a.Name+"/log?:app="+a.Name+"&"+params.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Header().Get("Tsuru-Log-Cursor"), check.Equals, "")
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "request 1")
+	c.Assert(logs[2].Message, check.Equals, "request 4")
+}
+
+func (s *S) TestAppLogInvalidQuery(c *check.C) {
+	tests := []struct {
+		query   string
+		message string
+	}{
+		{"since=yesterday", `Parameter "since" must be a RFC 3339 timestamp.`},
+		{"until=2016-01-01", `Parameter "until" must be a RFC 3339 timestamp.`},
+		{"regex=(", "invalid message regular expression: .*"},
+		{"format=xml", `Parameter "format" must be "json" or "jsonl".`},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/apps/something/log/?:app=doesntmatter&lines=10&"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appLog(recorder, request, s.token)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, check.Matches, tt.message)
+	}
+}
+
 func (s *S) TestAppLogShouldReturnLogByApp(c *check.C) {
 	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&app1, s.user)
@@ -0,0 +1,96 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+	"github.com/tsuru/tsuru/router"
+)
+
+// title: app router list
+// path: /apps/{app}/routers
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App not found
+func appRouterList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppRead)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.RoutersAddresses())
+}
+
+// title: attach app to router
+// path: /apps/{app}/routers
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: App attached to router
+//   400: Invalid router
+//   401: Unauthorized
+//   404: App not found
+//   409: App already attached to router
+func appRouterAdd(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateRouterAdd)
+	if err != nil {
+		return err
+	}
+	name := r.FormValue("name")
+	if name == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "router name is required"}
+	}
+	if _, err = router.Get(name); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	rec.Log(t.GetUserName(), "add-app-router", "app="+a.Name, "router="+name)
+	err = a.AddRouter(name)
+	if err == app.ErrRouterAlreadyAttached {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err == app.ErrRouterSwappedApp {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: detach app from router
+// path: /apps/{app}/routers/{router}
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Router of the app plan
+//   401: Unauthorized
+//   404: App or router not found
+func appRouterRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateRouterRemove)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":router")
+	rec.Log(t.GetUserName(), "remove-app-router", "app="+a.Name, "router="+name)
+	err = a.RemoveRouter(name)
+	if err == app.ErrRouterNotAttached {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err == app.ErrRouterFromPlan {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/rec/rectest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppRouterAdd(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	defer routertest.HCRouter.Reset()
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=fake-hc")
+	request, err := http.NewRequest("POST", "/apps/myapp/routers", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, true)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 1)
+	c.Assert(dbApp.Routers[0].Name, check.Equals, "fake-hc")
+	action := rectest.Action{
+		Action: "add-app-router",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "router=fake-hc"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	body = strings.NewReader("name=fake-hc")
+	request, err = http.NewRequest("POST", "/apps/myapp/routers", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAppRouterAddUnknownRouter(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=unknown")
+	request, err := http.NewRequest("POST", "/apps/myapp/routers", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, "(?s).*config key 'routers:unknown:type' not found.*")
+}
+
+func (s *S) TestAppRouterList(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	defer routertest.HCRouter.Reset()
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/routers", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var routers []app.AppRouter
+	err = json.NewDecoder(recorder.Body).Decode(&routers)
+	c.Assert(err, check.IsNil)
+	c.Assert(routers, check.HasLen, 2)
+	c.Assert(routers[0].Name, check.Equals, "fake")
+	c.Assert(routers[1].Name, check.Equals, "fake-hc")
+}
+
+func (s *S) TestAppRouterRemove(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	defer routertest.HCRouter.Reset()
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/routers/fake-hc", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+	action := rectest.Action{
+		Action: "remove-app-router",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "router=fake-hc"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	request, err = http.NewRequest("DELETE", "/apps/myapp/routers/fake-hc", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	request, err = http.NewRequest("DELETE", "/apps/myapp/routers/fake", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/rec"
@@ -273,11 +274,13 @@ func teamList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		return err
 	}
 	teamsMap := map[string][]string{}
+	labelsMap := map[string]label.Labels{}
 	perms, err := t.Permissions()
 	if err != nil {
 		return err
 	}
 	for _, team := range teams {
+		labelsMap[team.Name] = team.Labels
 		teamCtx := permission.Context(permission.CtxTeam, team.Name)
 		var parent *permission.PermissionScheme
 		for _, p := range permsForTeam {
@@ -296,10 +299,14 @@ func teamList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	var result []map[string]interface{}
 	for name, permissions := range teamsMap {
-		result = append(result, map[string]interface{}{
+		entry := map[string]interface{}{
 			"name":        name,
 			"permissions": permissions,
-		})
+		}
+		if len(labelsMap[name]) > 0 {
+			entry["labels"] = labelsMap[name]
+		}
+		result = append(result, entry)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(result)
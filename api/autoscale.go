@@ -0,0 +1,128 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// title: app autoscale policies
+// path: /apps/{app}/autoscale
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func autoScalePolicyList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppRead)
+	if err != nil {
+		return err
+	}
+	if len(a.AutoScale) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.AutoScale)
+}
+
+// title: set app autoscale policy
+// path: /apps/{app}/autoscale
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func autoScalePolicySet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateUnitAutoscale)
+	if err != nil {
+		return err
+	}
+	policy, err := autoScalePolicyFromRequest(r)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if current, _ := a.GetAutoScalePolicy(policy.Process); current != nil {
+		policy.LastScale = current.LastScale
+	}
+	rec.Log(t.GetUserName(), "set-autoscale", "app="+a.Name, "process="+policy.Process)
+	err = a.SetAutoScalePolicy(*policy)
+	if _, ok := err.(app.AutoScaleValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func autoScalePolicyFromRequest(r *http.Request) (*app.AutoScalePolicy, error) {
+	policy := app.AutoScalePolicy{
+		Process: r.FormValue("process"),
+		Metric:  r.FormValue("metric"),
+	}
+	min, err := strconv.ParseUint(r.FormValue("min"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for min units: %s", r.FormValue("min"))
+	}
+	max, err := strconv.ParseUint(r.FormValue("max"), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for max units: %s", r.FormValue("max"))
+	}
+	policy.MinUnits, policy.MaxUnits = uint(min), uint(max)
+	policy.TargetPercent, err = strconv.ParseFloat(r.FormValue("target"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for target percent: %s", r.FormValue("target"))
+	}
+	if value := r.FormValue("scaleUpCooldown"); value != "" {
+		var seconds int
+		seconds, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for scale up cooldown: %s", value)
+		}
+		policy.ScaleUpCooldown = time.Duration(seconds) * time.Second
+	}
+	if value := r.FormValue("scaleDownCooldown"); value != "" {
+		var seconds int
+		seconds, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for scale down cooldown: %s", value)
+		}
+		policy.ScaleDownCooldown = time.Duration(seconds) * time.Second
+	}
+	return &policy, nil
+}
+
+// title: remove app autoscale policy
+// path: /apps/{app}/autoscale/{process}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or policy not found
+func autoScalePolicyRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateUnitAutoscale)
+	if err != nil {
+		return err
+	}
+	process := r.URL.Query().Get(":process")
+	rec.Log(t.GetUserName(), "remove-autoscale", "app="+a.Name, "process="+process)
+	err = a.RemoveAutoScalePolicy(process)
+	if err == app.ErrAutoScalePolicyNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
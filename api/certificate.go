@@ -0,0 +1,89 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// title: app certificate list
+// path: /apps/{app}/certificates
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func certificateList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppRead)
+	if err != nil {
+		return err
+	}
+	if len(a.Certificates) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.Certificates)
+}
+
+// title: set app certificate
+// path: /apps/{app}/certificates
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid certificate
+//   401: Unauthorized
+//   404: App not found
+func certificateSet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateCertificateSet)
+	if err != nil {
+		return err
+	}
+	cname := r.FormValue("cname")
+	if cname == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "cname is required"}
+	}
+	rec.Log(t.GetUserName(), "set-certificate", "app="+a.Name, "cname="+cname)
+	err = a.SetCertificate(cname, r.FormValue("certificate"), r.FormValue("key"))
+	if _, ok := err.(app.CertificateValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err == app.ErrTLSNotSupported || err == secret.ErrNoKeys {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: remove app certificate
+// path: /apps/{app}/certificates/{cname}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or certificate not found
+func certificateRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateCertificateRemove)
+	if err != nil {
+		return err
+	}
+	cname := r.URL.Query().Get(":cname")
+	rec.Log(t.GetUserName(), "remove-certificate", "app="+a.Name, "cname="+cname)
+	err = a.RemoveCertificate(cname)
+	if err == app.ErrCertificateNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
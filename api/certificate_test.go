@@ -0,0 +1,150 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/rec/rectest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createAppWithCertificate(c *check.C) (*app.App, string) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(10*24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	return &a, cert
+}
+
+func (s *S) TestCertificateSet(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	v := url.Values{"cname": {"myapp.example.com"}, "certificate": {cert}, "key": {key}}
+	request, err := http.NewRequest("PUT", "/apps/myapp/certificates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, cert)
+	action := rectest.Action{
+		Action: "set-certificate",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "cname=myapp.example.com"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestCertificateSetInvalid(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("other.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	v := url.Values{"cname": {"myapp.example.com"}, "certificate": {cert}, "key": {key}}
+	request, err := http.NewRequest("PUT", "/apps/myapp/certificates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "x509: certificate is valid for other.example.com, not myapp.example.com\n")
+}
+
+func (s *S) TestCertificateList(c *check.C) {
+	defer config.Unset("secrets")
+	_, cert := s.createAppWithCertificate(c)
+	request, err := http.NewRequest("GET", "/apps/myapp/certificates", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0]["cname"], check.Equals, "myapp.example.com")
+	c.Assert(result[0]["certificate"], check.Equals, cert)
+	_, hasKey := result[0]["key"]
+	c.Assert(hasKey, check.Equals, false)
+}
+
+func (s *S) TestCertificateRemove(c *check.C) {
+	defer config.Unset("secrets")
+	s.createAppWithCertificate(c)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/certificates/myapp.example.com", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, "")
+	action := rectest.Action{
+		Action: "remove-certificate",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "cname=myapp.example.com"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	request, err = http.NewRequest("DELETE", "/apps/myapp/certificates/myapp.example.com", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAppInfoCertificateWarnings(c *check.C) {
+	defer config.Unset("secrets")
+	s.createAppWithCertificate(c)
+	request, err := http.NewRequest("GET", "/apps/myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	warnings, ok := result["certificateWarnings"].([]interface{})
+	c.Assert(ok, check.Equals, true)
+	c.Assert(warnings, check.HasLen, 1)
+	c.Assert(warnings[0], check.Matches, "certificate of cname myapp.example.com expires at .*")
+}
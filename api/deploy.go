@@ -27,9 +27,11 @@ import (
 // consume: application/x-www-form-urlencoded
 // responses:
 //   200: OK
+//   202: Deploy waiting for approval
 //   400: Invalid data
 //   403: Forbidden
 //   404: Not found
+//   409: Deploys are frozen
 func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	var file multipart.File
 	var fileSize int64
@@ -108,15 +110,21 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 		Build:      build,
 	}
 	if t.GetAppName() != app.InternalAppName {
-		canDeploy := permission.Check(t, permSchemeForDeploy(opts),
-			append(permission.Contexts(permission.CtxTeam, instance.Teams),
-				permission.Context(permission.CtxApp, appName),
-				permission.Context(permission.CtxPool, instance.Pool),
-			)...,
+		contexts := append(permission.Contexts(permission.CtxTeam, instance.Teams),
+			permission.Context(permission.CtxApp, appName),
+			permission.Context(permission.CtxPool, instance.Pool),
 		)
+		canDeploy := permission.Check(t, permSchemeForDeploy(opts), contexts...)
 		if !canDeploy {
 			return &errors.HTTP{Code: http.StatusForbidden, Message: "User does not have permission to do this action in this app"}
 		}
+		opts.IgnoreFreeze = canIgnoreFreeze(t, contexts...)
+	}
+	if instance.DeployApproval {
+		return requestDeploy(w, opts)
+	}
+	if err = checkDeployFreeze(&opts); err != nil {
+		return err
 	}
 	writer := io.NewKeepAliveWriter(w, 30*time.Second, "please wait...")
 	defer writer.Stop()
@@ -128,6 +136,41 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return err
 }
 
+// canIgnoreFreeze returns whether deploys and rollbacks requested with the
+// token bypass deploy freezes. App tokens never bypass them.
+func canIgnoreFreeze(t auth.Token, contexts ...permission.PermissionContext) bool {
+	return !t.IsAppToken() && permission.Check(t, permission.PermAppDeployOverrideFreeze, contexts...)
+}
+
+// checkDeployFreeze returns a conflict error when the deploy described by
+// opts would be refused by a deploy freeze, allowing the handlers to fail
+// before streaming the deploy output.
+func checkDeployFreeze(opts *app.DeployOptions) error {
+	if opts.IgnoreFreeze {
+		return nil
+	}
+	err := opts.App.ActiveDeployFreeze(time.Now())
+	if _, ok := err.(*app.DeployFrozenError); ok {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+// requestDeploy queues the deploy described by opts as a deploy request,
+// waiting for the approval of another user.
+func requestDeploy(w http.ResponseWriter, opts app.DeployOptions) error {
+	req, err := app.RequestDeploy(opts)
+	if err == app.ErrDeployRequestUpload {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Deploys of app %s require approval, deploy request %s is pending.\n", opts.App.Name, req.ID.Hex())
+	return nil
+}
+
 func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 	switch opts.Kind() {
 	case app.DeployGit:
@@ -190,9 +233,11 @@ func diffDeploy(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 // produce: application/x-json-stream
 // responses:
 //   200: OK
+//   202: Rollback waiting for approval
 //   400: Invalid data
 //   403: Forbidden
 //   404: Not found
+//   409: Deploys are frozen
 func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	appName := r.URL.Query().Get(":appname")
 	instance, err := app.GetByName(appName)
@@ -215,26 +260,34 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 			}
 		}
 	}
-	canRollback := permission.Check(t, permission.PermAppDeployRollback,
-		append(permission.Contexts(permission.CtxTeam, instance.Teams),
-			permission.Context(permission.CtxApp, instance.Name),
-			permission.Context(permission.CtxPool, instance.Pool),
-		)...,
+	contexts := append(permission.Contexts(permission.CtxTeam, instance.Teams),
+		permission.Context(permission.CtxApp, instance.Name),
+		permission.Context(permission.CtxPool, instance.Pool),
 	)
+	canRollback := permission.Check(t, permission.PermAppDeployRollback, contexts...)
 	if !canRollback {
 		return &errors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
 	}
-	w.Header().Set("Content-Type", "application/x-json-stream")
-	keepAliveWriter := io.NewKeepAliveWriter(w, 30*time.Second, "")
-	defer keepAliveWriter.Stop()
-	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	err = app.Rollback(app.DeployOptions{
+	opts := app.DeployOptions{
 		App:          instance,
-		OutputStream: writer,
 		Image:        image,
 		User:         t.GetUserName(),
 		Origin:       origin,
-	})
+		IgnoreFreeze: canIgnoreFreeze(t, contexts...),
+	}
+	if instance.DeployApproval {
+		opts.Rollback = true
+		return requestDeploy(w, opts)
+	}
+	if err = checkDeployFreeze(&opts); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := io.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	opts.OutputStream = writer
+	err = app.Rollback(opts)
 	if err != nil {
 		writer.Encode(io.SimpleJsonMessage{Error: err.Error()})
 	}
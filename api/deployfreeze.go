@@ -0,0 +1,187 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/rec"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// title: deploy freeze list
+// path: /deploy-freezes
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func deployFreezeList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	freezes, err := app.ListDeployFreezes(r.URL.Query().Get("app"), r.URL.Query().Get("pool"))
+	if err != nil {
+		return err
+	}
+	apps := map[string]*app.App{}
+	var visible []app.DeployFreeze
+	for _, f := range freezes {
+		contexts := []permission.PermissionContext{permission.Context(permission.CtxPool, f.Pool)}
+		if f.App != "" {
+			a, ok := apps[f.App]
+			if !ok {
+				a, _ = app.GetByName(f.App)
+				apps[f.App] = a
+			}
+			if a == nil {
+				continue
+			}
+			contexts = append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)
+		}
+		if permission.Check(t, permission.PermAppReadDeploy, contexts...) {
+			visible = append(visible, f)
+		}
+	}
+	if len(visible) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(visible)
+}
+
+// title: add deploy freeze
+// path: /deploy-freezes
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Deploy freeze created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or pool not found
+func deployFreezeAdd(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	freeze, err := deployFreezeFromRequest(r)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err = checkDeployFreezePermission(t, freeze); err != nil {
+		return err
+	}
+	freeze.Owner = t.GetUserName()
+	rec.Log(t.GetUserName(), "add-deploy-freeze", "app="+freeze.App, "pool="+freeze.Pool)
+	err = app.AddDeployFreeze(freeze)
+	if _, ok := err.(app.DeployFreezeValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(freeze)
+}
+
+func deployFreezeFromRequest(r *http.Request) (*app.DeployFreeze, error) {
+	freeze := app.DeployFreeze{
+		App:      r.FormValue("app"),
+		Pool:     r.FormValue("pool"),
+		Schedule: r.FormValue("schedule"),
+		Reason:   r.FormValue("reason"),
+	}
+	if value := r.FormValue("duration"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for duration: %s", value)
+		}
+		freeze.Duration = time.Duration(seconds) * time.Second
+	}
+	for _, field := range []struct {
+		name   string
+		target *time.Time
+	}{{"start", &freeze.Start}, {"end", &freeze.End}} {
+		value := r.FormValue(field.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s, it must be a RFC 3339 date: %s", field.name, value)
+		}
+		*field.target = parsed.UTC()
+	}
+	return &freeze, nil
+}
+
+// checkDeployFreezePermission checks whether the user is allowed to manage
+// the freeze, which depends on the app or pool it targets.
+func checkDeployFreezePermission(t auth.Token, freeze *app.DeployFreeze) error {
+	var allowed bool
+	if freeze.App != "" {
+		a, err := getApp(freeze.App)
+		if err != nil {
+			return err
+		}
+		allowed = permission.Check(t, permission.PermAppUpdateDeployFreeze,
+			append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)...,
+		)
+	} else if freeze.Pool != "" {
+		pools, err := provision.ListPools(bson.M{"_id": freeze.Pool})
+		if err != nil {
+			return err
+		}
+		if len(pools) == 0 {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: provision.ErrPoolNotFound.Error()}
+		}
+		allowed = permission.Check(t, permission.PermPoolUpdateDeployFreeze,
+			permission.Context(permission.CtxPool, freeze.Pool),
+		)
+	}
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	return nil
+}
+
+// title: remove deploy freeze
+// path: /deploy-freezes/{id}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Deploy freeze not found
+func deployFreezeRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	id := r.URL.Query().Get(":id")
+	freeze, err := app.GetDeployFreeze(id)
+	if err == app.ErrDeployFreezeNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	if err = checkDeployFreezePermission(t, freeze); err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "remove-deploy-freeze", "id="+id)
+	err = app.RemoveDeployFreeze(id)
+	if err == app.ErrDeployFreezeNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *DeploySuite) addActiveFreeze(c *check.C, a *app.App) *app.DeployFreeze {
+	freeze := app.DeployFreeze{
+		App:    a.Name,
+		Start:  time.Now().Add(-time.Hour),
+		End:    time.Now().Add(time.Hour),
+		Reason: "end of quarter",
+	}
+	err := app.AddDeployFreeze(&freeze)
+	c.Assert(err, check.IsNil)
+	return &freeze
+}
+
+func (s *DeploySuite) TestDeployFrozen(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	s.addActiveFreeze(c, &a)
+	request, err := http.NewRequest("POST", "/apps/otherapp/repository/clone", strings.NewReader("archive-url=http://something.tar.gz"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	c.Assert(recorder.Body.String(), check.Matches, "deploys to app otherapp are frozen until .*: end of quarter\n")
+}
+
+func (s *DeploySuite) TestDeployFrozenOverride(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	s.addActiveFreeze(c, &a)
+	token := customUserWithPermission(c, "releasemanager", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppDeployOverrideFreeze,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request, err := http.NewRequest("POST", "/apps/otherapp/repository/clone", strings.NewReader("archive-url=http://something.tar.gz"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Archive deploy called\nOK\n")
+}
+
+func (s *DeploySuite) TestDeployFreezeAddListRemove(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	token := customUserWithPermission(c, "compliance", permission.Permission{
+		Scheme:  permission.PermAppUpdateDeployFreeze,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppReadDeploy,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	body := url.Values{
+		"app":      {a.Name},
+		"schedule": {"0 18 * * fri"},
+		"duration": {"223200"},
+		"reason":   {"weekend"},
+	}
+	request, err := http.NewRequest("POST", "/deploy-freezes", strings.NewReader(body.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var created app.DeployFreeze
+	err = json.NewDecoder(recorder.Body).Decode(&created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Duration, check.Equals, 62*time.Hour)
+	c.Assert(created.Owner, check.Equals, "compliance@groundcontrol.com")
+	request, err = http.NewRequest("GET", "/deploy-freezes", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var freezes []app.DeployFreeze
+	err = json.NewDecoder(recorder.Body).Decode(&freezes)
+	c.Assert(err, check.IsNil)
+	c.Assert(freezes, check.HasLen, 1)
+	c.Assert(freezes[0].ID, check.Equals, created.ID)
+	request, err = http.NewRequest("DELETE", "/deploy-freezes/"+created.ID.Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	freezes, err = app.ListDeployFreezes(a.Name, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(freezes, check.HasLen, 0)
+}
+
+func (s *DeploySuite) TestDeployFreezeAddInvalid(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	token := customUserWithPermission(c, "compliance", permission.Permission{
+		Scheme:  permission.PermAppUpdateDeployFreeze,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request, err := http.NewRequest("POST", "/deploy-freezes", strings.NewReader("app=otherapp&schedule=invalid&duration=60"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *DeploySuite) TestDeployFreezeAddPoolUnauthorized(c *check.C) {
+	request, err := http.NewRequest("POST", "/deploy-freezes", strings.NewReader("pool=pool1&schedule=@daily&duration=3600"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *DeploySuite) TestCanIgnoreFreeze(c *check.C) {
+	token := customUserWithPermission(c, "releasemanager", permission.Permission{
+		Scheme:  permission.PermAppDeployOverrideFreeze,
+		Context: permission.Context(permission.CtxApp, "otherapp"),
+	})
+	ctx := permission.Context(permission.CtxApp, "otherapp")
+	c.Assert(canIgnoreFreeze(token, ctx), check.Equals, true)
+	c.Assert(canIgnoreFreeze(token, permission.Context(permission.CtxApp, "anotherapp")), check.Equals, false)
+	appToken, err := nativeScheme.AppLogin("otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(canIgnoreFreeze(appToken, ctx), check.Equals, false)
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// title: set app deploy approval
+// path: /apps/{app}/deploy-approval
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func deployApprovalSet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateDeployApproval)
+	if err != nil {
+		return err
+	}
+	value := r.FormValue("required")
+	required, err := strconv.ParseBool(value)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid value for required: %q", value)}
+	}
+	rec.Log(t.GetUserName(), "set-deploy-approval", "app="+a.Name, "required="+value)
+	return a.SetDeployApproval(required)
+}
+
+// title: deploy request list
+// path: /apps/{app}/deploy-requests
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func deployRequestList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadDeploy)
+	if err != nil {
+		return err
+	}
+	reqs, err := app.ListDeployRequests(a.Name, r.URL.Query().Get("status"))
+	if err != nil {
+		return err
+	}
+	if len(reqs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(reqs)
+}
+
+func getDeployRequest(r *http.Request, a *app.App) (*app.DeployRequest, error) {
+	req, err := app.GetDeployRequest(a.Name, r.URL.Query().Get(":id"))
+	if err == app.ErrDeployRequestNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return req, err
+}
+
+// title: approve deploy request
+// path: /apps/{app}/deploy-requests/{id}/approve
+// method: POST
+// produce: text/plain
+// responses:
+//   200: Deploy approved and executed
+//   401: Unauthorized
+//   403: Requester can't approve
+//   404: App or deploy request not found
+//   409: Request not pending or deploys frozen
+func deployRequestApprove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppDeployApprove)
+	if err != nil {
+		return err
+	}
+	req, err := getDeployRequest(r, a)
+	if err != nil {
+		return err
+	}
+	opts := req.DeployOptions(a)
+	opts.IgnoreFreeze = canIgnoreFreeze(t,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if err = checkDeployFreeze(&opts); err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "approve-deploy", "app="+a.Name, "request="+req.ID.Hex())
+	err = req.Approve(t.GetUserName())
+	switch err {
+	case nil:
+	case app.ErrDeployRequestSelfApproval:
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	case app.ErrDeployRequestNotPending:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "text")
+	writer := io.NewKeepAliveWriter(w, 30*time.Second, "please wait...")
+	defer writer.Stop()
+	opts.OutputStream = writer
+	if opts.Rollback {
+		err = app.Rollback(opts)
+	} else {
+		err = app.Deploy(opts)
+	}
+	if err == nil {
+		fmt.Fprintln(w, "\nOK")
+	}
+	return err
+}
+
+// title: reject deploy request
+// path: /apps/{app}/deploy-requests/{id}/reject
+// method: POST
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or deploy request not found
+//   409: Request not pending
+func deployRequestReject(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadDeploy)
+	if err != nil {
+		return err
+	}
+	req, err := getDeployRequest(r, a)
+	if err != nil {
+		return err
+	}
+	canReject := req.User == t.GetUserName() || permission.Check(t, permission.PermAppDeployApprove,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !canReject {
+		return permission.ErrUnauthorized
+	}
+	rec.Log(t.GetUserName(), "reject-deploy", "app="+a.Name, "request="+req.ID.Hex())
+	err = req.Reject(t.GetUserName())
+	if err == app.ErrDeployRequestNotPending {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *DeploySuite) TestDeployWithApprovalCreatesRequest(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	err = a.SetDeployApproval(true)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/otherapp/repository/clone", strings.NewReader("archive-url=http://something.tar.gz"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	c.Assert(recorder.Body.String(), check.Matches, "Deploys of app otherapp require approval, deploy request [0-9a-f]+ is pending.\n")
+	reqs, err := app.ListDeployRequests(a.Name, app.DeployRequestPending)
+	c.Assert(err, check.IsNil)
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].ArchiveURL, check.Equals, "http://something.tar.gz")
+	c.Assert(reqs[0].User, check.Equals, user.Email)
+}
+
+func (s *DeploySuite) TestDeployRequestApprove(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	req, err := app.RequestDeploy(app.DeployOptions{App: &a, ArchiveURL: "http://something.tar.gz", User: user.Email})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy-requests/"+req.ID.Hex()+"/approve", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	token := customUserWithPermission(c, "approver", permission.Permission{
+		Scheme:  permission.PermAppDeployApprove,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "Archive deploy called\nOK\n")
+	dbReq, err := app.GetDeployRequest(a.Name, req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, app.DeployRequestApproved)
+	c.Assert(dbReq.Reviewer, check.Equals, "approver@groundcontrol.com")
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *DeploySuite) TestDeployRequestReject(c *check.C) {
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	user, _ := s.token.User()
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	defer app.Delete(&a, nil)
+	req, err := app.RequestDeploy(app.DeployOptions{App: &a, Image: "tsuru/otherapp:v2", User: user.Email})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("POST", "/apps/otherapp/deploy-requests/"+req.ID.Hex()+"/reject", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbReq, err := app.GetDeployRequest(a.Name, req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, app.DeployRequestRejected)
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+var eventLogPollInterval = 2 * time.Second
+
+func eventFilterFromRequest(r *http.Request) (*event.Filter, error) {
+	query := r.URL.Query()
+	filter := &event.Filter{
+		Target: event.Target{
+			Name:  query.Get("target.name"),
+			Value: query.Get("target.value"),
+		},
+		KindName:  query.Get("kind"),
+		OwnerName: query.Get("owner"),
+	}
+	var err error
+	if running := query.Get("running"); running != "" {
+		var isRunning bool
+		isRunning, err = strconv.ParseBool(running)
+		if err != nil {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for running: " + running}
+		}
+		filter.Running = &isRunning
+	}
+	if errorOnly := query.Get("erroronly"); errorOnly != "" {
+		filter.ErrorOnly, err = strconv.ParseBool(errorOnly)
+		if err != nil {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for erroronly: " + errorOnly}
+		}
+	}
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for since: " + err.Error()}
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		filter.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for until: " + err.Error()}
+		}
+	}
+	if skip := query.Get("skip"); skip != "" {
+		filter.Skip, err = strconv.Atoi(skip)
+		if err != nil || filter.Skip < 0 {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for skip: " + skip}
+		}
+	}
+	filter.Limit = defaultEventsLimit
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit <= 0 {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for limit: " + limit}
+		}
+		if filter.Limit > maxEventsLimit {
+			filter.Limit = maxEventsLimit
+		}
+	}
+	return filter, nil
+}
+
+// title: event list
+// path: /events
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   403: Forbidden
+func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventRead) {
+		return permission.ErrUnauthorized
+	}
+	filter, err := eventFilterFromRequest(r)
+	if err != nil {
+		return err
+	}
+	events, err := event.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+// title: event info
+// path: /events/{uuid}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid uuid
+//   403: Forbidden
+//   404: Not found
+func eventInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventRead) {
+		return permission.ErrUnauthorized
+	}
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "uuid parameter must be a valid ObjectId"}
+	}
+	e, err := event.GetByID(bson.ObjectIdHex(uuid))
+	if err == event.ErrEventNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(e)
+}
+
+// title: event log
+// path: /events/{uuid}/log
+// method: GET
+// produce: text/plain
+// responses:
+//   200: OK
+//   400: Invalid uuid
+//   403: Forbidden
+//   404: Not found
+func eventLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventRead) {
+		return permission.ErrUnauthorized
+	}
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "uuid parameter must be a valid ObjectId"}
+	}
+	id := bson.ObjectIdHex(uuid)
+	e, err := event.GetByID(id)
+	if err == event.ErrEventNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if r.URL.Query().Get("follow") != "1" {
+		_, err = w.Write([]byte(e.Log))
+		return err
+	}
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	var written int
+	for {
+		if len(e.Log) > written {
+			_, err = w.Write([]byte(e.Log[written:]))
+			if err != nil {
+				return nil
+			}
+			written = len(e.Log)
+		}
+		if !e.Running {
+			return nil
+		}
+		select {
+		case <-closeChan:
+			return nil
+		case <-time.After(eventLogPollInterval):
+		}
+		e, err = event.GetByID(id)
+		if err != nil {
+			fmt.Fprintf(w, "error reading event log: %s\n", err)
+			return nil
+		}
+	}
+}
+
+// title: event cancel
+// path: /events/{uuid}/cancel
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data or event not cancelable
+//   403: Forbidden
+//   404: Not found
+func eventCancel(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermEventCancel) {
+		return permission.ErrUnauthorized
+	}
+	uuid := r.URL.Query().Get(":uuid")
+	if !bson.IsObjectIdHex(uuid) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "uuid parameter must be a valid ObjectId"}
+	}
+	reason := r.FormValue("reason")
+	if reason == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "reason is mandatory"}
+	}
+	e, err := event.GetByID(bson.ObjectIdHex(uuid))
+	if err == event.ErrEventNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	err = e.TryCancel(reason, t.GetUserName())
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case event.ErrNotCancelable:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case event.ErrEventNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestEventList(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(errors.New("my error"))
+	c.Assert(err, check.IsNil)
+	_, err = event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "otherapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events?target.name=app&erroronly=true", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0]["UniqueID"], check.Equals, evt.UniqueID.Hex())
+	c.Assert(result[0]["Error"], check.Equals, "my error")
+}
+
+func (s *S) TestEventListNoContent(c *check.C) {
+	request, err := http.NewRequest("GET", "/events?running=true", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestEventListInvalidFilter(c *check.C) {
+	request, err := http.NewRequest("GET", "/events?since=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestEventFilterFromRequestLimit(c *check.C) {
+	tests := []struct {
+		query       string
+		skip, limit int
+	}{
+		{"", 0, defaultEventsLimit},
+		{"skip=10&limit=20", 10, 20},
+		{"limit=100000", 0, maxEventsLimit},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/events?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		filter, err := eventFilterFromRequest(request)
+		c.Assert(err, check.IsNil)
+		c.Check(filter.Skip, check.Equals, tt.skip, check.Commentf("query %q", tt.query))
+		c.Check(filter.Limit, check.Equals, tt.limit, check.Commentf("query %q", tt.query))
+	}
+}
+
+func (s *S) TestEventFilterFromRequestInvalidLimit(c *check.C) {
+	for _, query := range []string{"skip=abc", "skip=-1", "limit=abc", "limit=0", "limit=-5"} {
+		request, err := http.NewRequest("GET", "/events?"+query, nil)
+		c.Assert(err, check.IsNil)
+		_, err = eventFilterFromRequest(request)
+		e, ok := err.(*tsuruErrors.HTTP)
+		c.Assert(ok, check.Equals, true, check.Commentf("query %q", query))
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *S) TestEventListForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/events", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestEventInfo(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("some log")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermEventRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/events/"+evt.UniqueID.Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["UniqueID"], check.Equals, evt.UniqueID.Hex())
+	c.Assert(result["Log"], check.Equals, "some log\n")
+}
+
+func (s *S) TestEventInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/"+bson.NewObjectId().Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestEventInfoInvalidID(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/xyz", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestEventLog(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("some log")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/"+evt.UniqueID.Hex()+"/log", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/plain")
+	c.Assert(recorder.Body.String(), check.Equals, "some log\n")
+}
+
+func (s *S) TestEventLogFollow(c *check.C) {
+	oldInterval := eventLogPollInterval
+	eventLogPollInterval = 10 * time.Millisecond
+	defer func() { eventLogPollInterval = oldInterval }()
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("first")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(100 * time.Millisecond)
+		evt.Logf("second")
+		evt.Done(nil)
+	}()
+	request, err := http.NewRequest("GET", "/events/"+evt.UniqueID.Hex()+"/log?follow=1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	<-done
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "first\nsecond\n")
+}
+
+func (s *S) TestEventLogNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/"+bson.NewObjectId().Hex()+"/log", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestEventCancel(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Name: "app", Value: "myapp"},
+		Kind:       permission.PermAppUpdateEnvSet,
+		Owner:      s.token.GetUserName(),
+		Cancelable: true,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	body := strings.NewReader("reason=we ain't gonna take it")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/events/%s/cancel", evt.UniqueID.Hex()), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	result, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.CancelInfo.Asked, check.Equals, true)
+	c.Assert(result.CancelInfo.Reason, check.Equals, "we ain't gonna take it")
+	c.Assert(result.CancelInfo.Owner, check.Equals, s.token.GetUserName())
+}
+
+func (s *S) TestEventCancelNotCancelable(c *check.C) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token.GetUserName(),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	body := strings.NewReader("reason=because")
+	request, err := http.NewRequest("POST", fmt.Sprintf("/events/%s/cancel", evt.UniqueID.Hex()), body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, event.ErrNotCancelable.Error()+"\n")
+}
+
+func (s *S) TestEventCancelWithoutReason(c *check.C) {
+	request, err := http.NewRequest("POST", fmt.Sprintf("/events/%s/cancel", bson.NewObjectId().Hex()), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
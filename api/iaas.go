@@ -28,25 +28,86 @@ func machinesList(w http.ResponseWriter, r *http.Request, token auth.Token) erro
 	if err != nil {
 		return err
 	}
-	contexts := permission.ContextsForPermission(token, permission.PermMachineRead)
+	allowedIaaS := allowedIaaSForPermission(token, permission.PermMachineRead)
+	for i := 0; allowedIaaS != nil && i < len(machines); i++ {
+		if _, ok := allowedIaaS[machines[i].Iaas]; !ok {
+			machines = append(machines[:i], machines[i+1:]...)
+			i--
+		}
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(machines)
+}
+
+// allowedIaaSForPermission returns the IaaSs in which the permission is
+// granted to the token, or nil if it's granted globally.
+func allowedIaaSForPermission(token auth.Token, scheme *permission.PermissionScheme) map[string]struct{} {
+	contexts := permission.ContextsForPermission(token, scheme)
 	allowedIaaS := map[string]struct{}{}
 	for _, c := range contexts {
 		if c.CtxType == permission.CtxGlobal {
-			allowedIaaS = nil
-			break
+			return nil
 		}
 		if c.CtxType == permission.CtxIaaS {
 			allowedIaaS[c.Value] = struct{}{}
 		}
 	}
-	for i := 0; allowedIaaS != nil && i < len(machines); i++ {
-		if _, ok := allowedIaaS[machines[i].Iaas]; !ok {
-			machines = append(machines[:i], machines[i+1:]...)
-			i--
+	return allowedIaaS
+}
+
+// title: machines drift report
+// path: /iaas/machines/drift
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func machinesDrift(w http.ResponseWriter, r *http.Request, token auth.Token) error {
+	allowedIaaS := allowedIaaSForPermission(token, permission.PermMachineRead)
+	if allowedIaaS != nil && len(allowedIaaS) == 0 {
+		return permission.ErrUnauthorized
+	}
+	report, err := iaas.LastReconcileReport()
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	iaasName := r.URL.Query().Get("iaas")
+	kind := r.URL.Query().Get("kind")
+	drifts := []iaas.MachineDrift{}
+	for _, d := range report.Drifts {
+		if allowedIaaS != nil {
+			if _, ok := allowedIaaS[d.Iaas]; !ok {
+				continue
+			}
+		}
+		if (iaasName == "" || d.Iaas == iaasName) && (kind == "" || d.Kind == kind) {
+			drifts = append(drifts, d)
 		}
 	}
-	w.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(machines)
+	report.Drifts = drifts
+	if allowedIaaS != nil {
+		checked := []string{}
+		for _, name := range report.CheckedIaaSs {
+			if _, ok := allowedIaaS[name]; ok {
+				checked = append(checked, name)
+			}
+		}
+		report.CheckedIaaSs = checked
+		var errs []iaas.ReconcileError
+		for _, e := range report.Errors {
+			if _, ok := allowedIaaS[e.Iaas]; ok {
+				errs = append(errs, e)
+			}
+		}
+		report.Errors = errs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
 }
 
 // title: machine destroy
@@ -139,7 +200,7 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) er
 	}
 	err = paramTemplate.Save()
 	if err != nil {
-		return err
+		return templateError(err)
 	}
 	w.WriteHeader(http.StatusCreated)
 	return nil
@@ -150,6 +211,7 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) er
 // method: DELETE
 // responses:
 //   200: OK
+//   400: Invalid data
 //   401: Unauthorized
 //   404: Not found
 func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) error {
@@ -167,7 +229,7 @@ func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) e
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	return iaas.DestroyTemplate(templateName)
+	return templateError(iaas.DestroyTemplate(templateName))
 }
 
 // title: template update
@@ -205,5 +267,15 @@ func templateUpdate(w http.ResponseWriter, r *http.Request, token auth.Token) er
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	return dbTpl.Update(&paramTemplate)
+	return templateError(dbTpl.Update(&paramTemplate))
+}
+
+// templateError turns errors caused by invalid templates or params into bad
+// requests.
+func templateError(err error) error {
+	switch err.(type) {
+	case *iaas.TemplateError, *iaas.InvalidParamsError:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
 }
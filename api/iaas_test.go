@@ -13,6 +13,7 @@ import (
 
 	"github.com/cezarsa/form"
 	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/check.v1"
 )
 
@@ -95,6 +96,96 @@ func (s *S) TestMachinesDestroyError(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "machine not found\n")
 }
 
+type TestStatusIaaS struct {
+	TestIaaS
+}
+
+func (TestStatusIaaS) GetMachine(id string) (*iaas.Machine, error) {
+	return nil, iaas.ErrMachineNotFound
+}
+
+func (TestStatusIaaS) ListMachines() ([]iaas.Machine, error) {
+	return nil, nil
+}
+
+func newTestStatusIaaS(string) iaas.IaaS {
+	return TestStatusIaaS{}
+}
+
+func (s *S) TestMachinesDrift(c *check.C) {
+	iaas.RegisterIaasProvider("status-iaas", newTestStatusIaaS)
+	_, err := iaas.CreateMachineForIaaS("status-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	err = iaas.NewReconcilerConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/iaas/machines/drift?kind=deleted", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report iaas.ReconcileReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedMachines, check.Equals, 1)
+	c.Assert(report.Drifts, check.DeepEquals, []iaas.MachineDrift{{
+		Id:        "myid1",
+		Iaas:      "status-iaas",
+		Address:   "myid1.somewhere.com",
+		Kind:      iaas.DriftDeleted,
+		OldStatus: "running",
+	}})
+}
+
+func (s *S) TestMachinesDriftFilteredByIaaSPermission(c *check.C) {
+	iaas.RegisterIaasProvider("status-iaas", newTestStatusIaaS)
+	_, err := iaas.CreateMachineForIaaS("status-iaas", map[string]string{"id": "myid1"})
+	c.Assert(err, check.IsNil)
+	defer (&iaas.Machine{Id: "myid1"}).Destroy()
+	err = iaas.NewReconcilerConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineRead,
+		Context: permission.Context(permission.CtxIaaS, "other-iaas"),
+	})
+	request, err := http.NewRequest("GET", "/iaas/machines/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var report iaas.ReconcileReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Drifts, check.DeepEquals, []iaas.MachineDrift{})
+	c.Assert(report.CheckedIaaSs, check.DeepEquals, []string{})
+	c.Assert(report.Errors, check.IsNil)
+}
+
+func (s *S) TestMachinesDriftNoReport(c *check.C) {
+	request, err := http.NewRequest("GET", "/iaas/machines/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestMachinesDriftUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/iaas/machines/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestTemplateList(c *check.C) {
 	iaas.RegisterIaasProvider("ec2", newTestIaaS)
 	iaas.RegisterIaasProvider("other", newTestIaaS)
@@ -288,3 +379,124 @@ func (s *S) TestTemplateUpdateBadRequest(c *check.C) {
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
 }
+
+func (s *S) TestTemplateCreateWithParent(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{
+		Name:     "base",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "x", Value: "y"}},
+	}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	data := iaas.Template{
+		Name:   "my-tpl",
+		Parent: "base",
+		Data:   iaas.TemplateDataList{{Name: "a", Value: "b"}},
+		Params: []iaas.ParamSpec{{Name: "a", Required: true, Values: []string{"b", "c"}}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer iaas.DestroyTemplate("my-tpl")
+	tpl, err := iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.IsNil)
+	c.Assert(tpl.IaaSName, check.Equals, "my-iaas")
+	c.Assert(tpl.Parent, check.Equals, "base")
+	c.Assert(tpl.Params, check.DeepEquals, []iaas.ParamSpec{{Name: "a", Required: true, Values: []string{"b", "c"}}})
+}
+
+func (s *S) TestTemplateCreateInvalidData(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	data := iaas.Template{
+		Name:     "my-tpl",
+		IaaSName: "my-iaas",
+		Data:     iaas.TemplateDataList{{Name: "a", Value: "z"}},
+		Params:   []iaas.ParamSpec{{Name: "a", Values: []string{"b", "c"}}},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid params for IaaS \"my-iaas\": param \"a\" must be one of: b, c, got \"z\"\n")
+	templates, err := iaas.ListTemplates()
+	c.Assert(err, check.IsNil)
+	c.Assert(templates, check.HasLen, 0)
+}
+
+func (s *S) TestTemplateUpdateParentNotFound(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	tpl1 := iaas.Template{Name: "my-tpl", IaaSName: "my-iaas"}
+	err := tpl1.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("my-tpl")
+	v, err := form.EncodeToValues(&iaas.Template{Parent: "unknown"})
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/iaas/templates/my-tpl", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "template \"my-tpl\": parent template \"unknown\" not found\n")
+}
+
+func (s *S) TestTemplateUpdateClearParent(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{Name: "base", IaaSName: "my-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	tpl1 := iaas.Template{Name: "my-tpl", Parent: "base"}
+	err = tpl1.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("my-tpl")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("PUT", "/iaas/templates/my-tpl", strings.NewReader("ClearParent=true"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	tpl, err := iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.IsNil)
+	c.Assert(tpl.Parent, check.Equals, "")
+	c.Assert(tpl.IaaSName, check.Equals, "my-iaas")
+}
+
+func (s *S) TestTemplateDestroyWithChildren(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{Name: "base", IaaSName: "my-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("base")
+	child := iaas.Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("child")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/iaas/templates/base", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "template \"base\": can't be removed, it's the parent of: child\n")
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// title: set app idle policy
+// path: /apps/{app}/idle-policy
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func idlePolicySet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateSleep)
+	if err != nil {
+		return err
+	}
+	value := r.FormValue("timeout")
+	minutes, err := strconv.Atoi(value)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid value for timeout: %q", value)}
+	}
+	rec.Log(t.GetUserName(), "set-idle-policy", "app="+a.Name, "timeout="+value)
+	err = a.SetIdlePolicy(time.Duration(minutes) * time.Minute)
+	if err == app.ErrInvalidIdleTimeout {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: remove app idle policy
+// path: /apps/{app}/idle-policy
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or policy not found
+func idlePolicyRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateSleep)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "remove-idle-policy", "app="+a.Name)
+	err = a.RemoveIdlePolicy()
+	if err == app.ErrIdlePolicyNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
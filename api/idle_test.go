@@ -0,0 +1,83 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/rec/rectest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestIdlePolicySet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("timeout=30")
+	request, err := http.NewRequest("PUT", "/apps/myapp/idle-policy", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy, check.NotNil)
+	c.Assert(dbApp.IdlePolicy.Timeout, check.Equals, 30*time.Minute)
+	action := rectest.Action{
+		Action: "set-idle-policy",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "timeout=30"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestIdlePolicySetInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	for _, timeout := range []string{"", "abc", "0"} {
+		body := strings.NewReader("timeout=" + timeout)
+		request, err := http.NewRequest("PUT", "/apps/myapp/idle-policy", body)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("timeout %q", timeout))
+	}
+}
+
+func (s *S) TestIdlePolicyRemove(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(30 * time.Minute)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/idle-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy, check.IsNil)
+	action := rectest.Action{
+		Action: "remove-idle-policy",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+const defaultJobRunsLimit = 20
+
+// title: app job list
+// path: /apps/{app}/jobs
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func jobList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadJob)
+	if err != nil {
+		return err
+	}
+	jobs := a.AllJobs()
+	if len(jobs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(jobs)
+}
+
+// title: set app job
+// path: /apps/{app}/jobs
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func jobSet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateJob)
+	if err != nil {
+		return err
+	}
+	job := app.Job{
+		Name:              r.FormValue("name"),
+		Schedule:          r.FormValue("schedule"),
+		Command:           r.FormValue("command"),
+		ConcurrencyPolicy: r.FormValue("concurrencyPolicy"),
+	}
+	if value := r.FormValue("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for timeout: " + value}
+		}
+		job.Timeout = time.Duration(seconds) * time.Second
+	}
+	rec.Log(t.GetUserName(), "set-job", "app="+a.Name, "job="+job.Name, "schedule="+job.Schedule)
+	err = a.SetJob(job)
+	if _, ok := err.(app.JobValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: remove app job
+// path: /apps/{app}/jobs/{job}
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Job declared in tsuru.yaml
+//   401: Unauthorized
+//   404: App or job not found
+func jobRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateJob)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":job")
+	rec.Log(t.GetUserName(), "remove-job", "app="+a.Name, "job="+name)
+	err = a.RemoveJob(name)
+	switch err {
+	case app.ErrJobNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case app.ErrJobDeclared:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: app job runs
+// path: /apps/{app}/jobs/{job}/runs
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func jobRunList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadJob)
+	if err != nil {
+		return err
+	}
+	limit := defaultJobRunsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for limit: " + value}
+		}
+	}
+	runs, err := app.ListJobRuns(a.Name, r.URL.Query().Get(":job"), limit)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(runs)
+}
+
+// title: app job run info
+// path: /apps/{app}/jobs/{job}/runs/{id}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func jobRunInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadJob)
+	if err != nil {
+		return err
+	}
+	run, err := app.GetJobRun(a.Name, r.URL.Query().Get(":id"))
+	if err == nil && run.Job != r.URL.Query().Get(":job") {
+		err = app.ErrJobNotFound
+	}
+	if err == app.ErrJobNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "job run not found"}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/label"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// labelsFromRequest returns the labels to be set, sent in the format
+// key=value, the keys of the labels to be removed and the extra data used in
+// the audit log.
+func labelsFromRequest(r *http.Request) (label.Labels, []string, []interface{}, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	set, err := label.Parse(r.Form["set"])
+	if err != nil {
+		return nil, nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	unset := r.Form["unset"]
+	if len(set) == 0 && len(unset) == 0 {
+		msg := "You must provide the labels to set or unset"
+		return nil, nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+	}
+	extra := []interface{}{
+		fmt.Sprintf("set=%s", strings.Join(r.Form["set"], ",")),
+		fmt.Sprintf("unset=%s", strings.Join(unset, ",")),
+	}
+	return set, unset, extra, nil
+}
+
+// title: update app labels
+// path: /apps/{app}/labels
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Labels updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppLabels(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateLabels,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	set, unset, extra, err := labelsFromRequest(r)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "set-app-labels", append([]interface{}{"app=" + appName}, extra...)...)
+	return a.SetLabels(set, unset)
+}
+
+// title: update app node selector
+// path: /apps/{app}/node-selector
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Node selector updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func setAppNodeSelector(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateNodeSelector,
+		append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	selector, err := label.Parse(r.Form["selector"])
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	rec.Log(t.GetUserName(), "set-app-node-selector", "app="+appName,
+		fmt.Sprintf("selector=%s", strings.Join(r.Form["selector"], ",")))
+	return a.SetNodeSelector(selector)
+}
+
+// title: update team labels
+// path: /teams/{name}/labels
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Labels updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func setTeamLabels(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateLabels,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	set, unset, extra, err := labelsFromRequest(r)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "set-team-labels", append([]interface{}{"team=" + name}, extra...)...)
+	return team.SetLabels(set, unset)
+}
+
+// title: update service instance labels
+// path: /services/{service}/instances/{instance}/labels
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Labels updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Service instance not found
+func setServiceInstanceLabels(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	serviceName := r.URL.Query().Get(":service")
+	instanceName := r.URL.Query().Get(":instance")
+	si, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateLabels,
+		append(permission.Contexts(permission.CtxTeam, si.Teams),
+			permission.Context(permission.CtxServiceInstance, serviceName+"/"+instanceName),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	set, unset, extra, err := labelsFromRequest(r)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "set-service-instance-labels", append([]interface{}{"instance=" + serviceName + "/" + instanceName}, extra...)...)
+	return si.SetLabels(set, unset)
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/label"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec/rectest"
+	"github.com/tsuru/tsuru/service"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSetAppLabels(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLabels(label.Labels{"team": "admin"}, nil)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("set=tier=frontend&set=tsuru.io/env=prod&unset=team")
+	request, err := http.NewRequest("PUT", "/apps/myapp/labels", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Labels, check.DeepEquals, label.Labels{"tier": "frontend", "tsuru.io/env": "prod"})
+	action := rectest.Action{
+		Action: "set-app-labels",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "set=tier=frontend,tsuru.io/env=prod", "unset=team"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *S) TestSetAppLabelsInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	bodies := []string{"", "set=tier", "set=tier=front+end", "set=-tier=frontend"}
+	for _, body := range bodies {
+		request, err := http.NewRequest("PUT", "/apps/myapp/labels", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("body %q", body))
+	}
+}
+
+func (s *S) TestSetAppLabelsNoPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request, err := http.NewRequest("PUT", "/apps/myapp/labels", strings.NewReader("set=tier=frontend"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestSetAppNodeSelector(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("selector=zone=a&selector=disk=ssd")
+	request, err := http.NewRequest("PUT", "/apps/myapp/node-selector", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.NodeSelector, check.DeepEquals, label.Labels{"zone": "a", "disk": "ssd"})
+	action := rectest.Action{
+		Action: "set-app-node-selector",
+		User:   s.user.Email,
+		Extra:  []interface{}{"app=myapp", "selector=zone=a,disk=ssd"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+	request, err = http.NewRequest("PUT", "/apps/myapp/node-selector", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	dbApp, err = app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.NodeSelector, check.HasLen, 0)
+}
+
+func (s *S) TestSetAppNodeSelectorInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("PUT", "/apps/myapp/node-selector", strings.NewReader("selector=zone"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAppListFilteringByLabel(c *check.C) {
+	app1 := app.App{Name: "app1", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&app1, s.user)
+	c.Assert(err, check.IsNil)
+	err = app1.SetLabels(label.Labels{"tier": "frontend"}, nil)
+	c.Assert(err, check.IsNil)
+	app2 := app.App{Name: "app2", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&app2, s.user)
+	c.Assert(err, check.IsNil)
+	err = app2.SetLabels(label.Labels{"tier": "backend"}, nil)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps?label=tier=frontend", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var apps []miniApp
+	err = json.Unmarshal(recorder.Body.Bytes(), &apps)
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, "app1")
+	c.Assert(apps[0].Labels, check.DeepEquals, map[string]string{"tier": "frontend"})
+	request, err = http.NewRequest("GET", "/apps?label=tier", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestSetTeamLabels(c *check.C) {
+	body := strings.NewReader("set=tsuru.io/area=sales")
+	request, err := http.NewRequest("PUT", "/teams/"+s.team.Name+"/labels", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Labels, check.DeepEquals, label.Labels{"tsuru.io/area": "sales"})
+	request, err = http.NewRequest("GET", "/teams", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var teams []map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &teams)
+	c.Assert(err, check.IsNil)
+	var found bool
+	for _, t := range teams {
+		if t["name"] == s.team.Name {
+			found = true
+			c.Assert(t["labels"], check.DeepEquals, map[string]interface{}{"tsuru.io/area": "sales"})
+		}
+	}
+	c.Assert(found, check.Equals, true)
+}
+
+func (s *S) TestSetTeamLabelsNotFound(c *check.C) {
+	request, err := http.NewRequest("PUT", "/teams/unknown/labels", strings.NewReader("set=tier=frontend"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *ConsumptionSuite) TestSetServiceInstanceLabels(c *check.C) {
+	se := service.Service{Name: "mysql", Teams: []string{s.team.Name}, Endpoint: map[string]string{"production": s.ts.URL}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "labeler", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdateLabels,
+		Context: permission.Context(permission.CtxServiceInstance, "mysql/brainSQL"),
+	})
+	body := strings.NewReader("set=tier=db")
+	request, err := http.NewRequest("PUT", "/services/mysql/instances/brainSQL/labels", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var instance service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL", "service_name": "mysql"}).One(&instance)
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.Labels, check.DeepEquals, label.Labels{"tier": "db"})
+	action := rectest.Action{
+		Action: "set-service-instance-labels",
+		User:   "labeler@groundcontrol.com",
+		Extra:  []interface{}{"instance=mysql/brainSQL", "set=tier=db", "unset="},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
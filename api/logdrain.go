@@ -0,0 +1,93 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+// title: app log drain list
+// path: /apps/{app}/log-drains
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func logDrainList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppReadLogDrain)
+	if err != nil {
+		return err
+	}
+	if len(a.LogDrains) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(a.LogDrainsStatus())
+}
+
+// title: add app log drain
+// path: /apps/{app}/log-drains
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Log drain created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+//   409: Log drain already exists
+func logDrainAdd(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateLogDrainAdd)
+	if err != nil {
+		return err
+	}
+	drain := app.LogDrain{
+		Name: r.FormValue("name"),
+		URL:  r.FormValue("url"),
+	}
+	rec.Log(t.GetUserName(), "add-log-drain", "app="+a.Name, "name="+drain.Name)
+	err = a.AddLogDrain(drain)
+	if _, ok := err.(app.LogDrainValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if err == app.ErrLogDrainAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: remove app log drain
+// path: /apps/{app}/log-drains/{name}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: App or log drain not found
+func logDrainRemove(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppWithPermission(r, t, permission.PermAppUpdateLogDrainRemove)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	rec.Log(t.GetUserName(), "remove-log-drain", "app="+a.Name, "name="+name)
+	err = a.RemoveLogDrain(name)
+	if err == app.ErrLogDrainNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -6,6 +6,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
 )
 
 // title: user quota
@@ -136,3 +138,133 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamReadQuota,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	reports, err := auth.TeamsQuotaReport([]auth.Team{*team})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(reports[0])
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateQuota,
+		permission.Context(permission.CtxTeam, name),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	quota := team.GetQuota()
+	if value := r.FormValue("memory"); value != "" {
+		quota.Memory, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid memory limit"}
+		}
+	}
+	limits := []struct {
+		field string
+		value *int
+	}{
+		{"cpushare", &quota.CPUShare},
+		{"apps", &quota.Apps},
+		{"serviceinstances", &quota.ServiceInstances},
+	}
+	for _, limit := range limits {
+		value := r.FormValue(limit.field)
+		if value == "" {
+			continue
+		}
+		*limit.value, err = strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid " + limit.field + " limit"}
+		}
+	}
+	rec.Log(t.GetUserName(), "change-team-quota", "team="+name,
+		fmt.Sprintf("memory=%d", quota.Memory),
+		fmt.Sprintf("cpushare=%d", quota.CPUShare),
+		fmt.Sprintf("apps=%d", quota.Apps),
+		fmt.Sprintf("serviceinstances=%d", quota.ServiceInstances),
+	)
+	err = auth.ChangeTeamQuota(team, quota)
+	switch err {
+	case auth.ErrTeamQuotaBelowUsage:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case auth.ErrTeamNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: teams quota usage
+// path: /teams/usage
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func teamsQuotaUsage(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teams, err := auth.ListTeams()
+	if err != nil {
+		return err
+	}
+	var allowedTeams []auth.Team
+	for _, team := range teams {
+		allowed := permission.Check(t, permission.PermTeamReadQuota,
+			permission.Context(permission.CtxTeam, team.Name),
+		)
+		if allowed {
+			allowedTeams = append(allowedTeams, team)
+		}
+	}
+	if len(allowedTeams) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	reports, err := auth.TeamsQuotaReport(allowedTeams)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(reports)
+}
@@ -51,6 +51,12 @@ func (s *QuotaSuite) SetUpTest(c *check.C) {
 	}, permission.Permission{
 		Scheme:  permission.PermUserUpdateQuota,
 		Context: permission.Context(permission.CtxGlobal, ""),
+	}, permission.Permission{
+		Scheme:  permission.PermTeamReadQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
 	})
 	s.user, err = s.token.User()
 	c.Assert(err, check.IsNil)
@@ -348,3 +354,124 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	teamQuota := auth.TeamQuota{Memory: 1024, CPUShare: 10, Apps: 2, ServiceInstances: -1}
+	err = conn.Teams().UpdateId(s.team.Name, bson.M{"$set": bson.M{"quota": teamQuota}})
+	c.Assert(err, check.IsNil)
+	err = conn.Apps().Insert(bson.M{
+		"name":      "myapp",
+		"teamowner": s.team.Name,
+		"plan":      bson.M{"memory": 256, "cpushare": 2},
+		"quota":     bson.M{"limit": -1, "inuse": 2},
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report auth.TeamQuotaReport
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.DeepEquals, auth.TeamQuotaReport{
+		Team:  s.team.Name,
+		Quota: teamQuota,
+		Usage: auth.TeamUsage{Memory: 512, CPUShare: 4, Apps: 1},
+	})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	body := bytes.NewBufferString("memory=2048&apps=3")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(*team.Quota, check.DeepEquals, auth.TeamQuota{Memory: 2048, CPUShare: -1, Apps: 3, ServiceInstances: -1})
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaInvalidValue(c *check.C) {
+	body := bytes.NewBufferString("cpushare=lots")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid cpushare limit\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaBelowUsage(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(bson.M{"name": "myapp", "teamowner": s.team.Name})
+	c.Assert(err, check.IsNil)
+	body := bytes.NewBufferString("apps=0")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrTeamQuotaBelowUsage.Error()+"\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	body := bytes.NewBufferString("apps=3")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestTeamsQuotaUsage(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Teams().Insert(auth.Team{Name: "hiddenteam"})
+	c.Assert(err, check.IsNil)
+	err = conn.ServiceInstances().Insert(bson.M{"name": "mydb", "teamowner": s.team.Name})
+	c.Assert(err, check.IsNil)
+	request, _ := http.NewRequest("GET", "/teams/usage", nil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var reports []auth.TeamQuotaReport
+	err = json.NewDecoder(recorder.Body).Decode(&reports)
+	c.Assert(err, check.IsNil)
+	c.Assert(reports, check.DeepEquals, []auth.TeamQuotaReport{
+		{Team: s.team.Name, Quota: auth.UnlimitedTeamQuota, Usage: auth.TeamUsage{ServiceInstances: 1}},
+	})
+}
+
+func (s *QuotaSuite) TestTeamsQuotaUsageNoContent(c *check.C) {
+	token := userWithPermission(c)
+	request, _ := http.NewRequest("GET", "/teams/usage", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app/reconciler"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// title: routers drift report
+// path: /routers/drift
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+func routersDrift(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermAppAdminRoutes) {
+		return permission.ErrUnauthorized
+	}
+	report, err := reconciler.LastReport()
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	routerName := r.URL.Query().Get("router")
+	appName := r.URL.Query().Get("app")
+	drifts := []reconciler.Drift{}
+	for _, d := range report.Drifts {
+		if (routerName == "" || d.Router == routerName) && (appName == "" || d.App == appName) {
+			drifts = append(drifts, d)
+		}
+	}
+	report.Drifts = drifts
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(report)
+}
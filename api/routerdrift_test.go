@@ -0,0 +1,67 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/reconciler"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestRoutersDrift(c *check.C) {
+	for _, name := range []string{"myapp", "otherapp"} {
+		a := app.App{Name: name, Platform: "zend", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+		err := app.CreateApp(&a, s.user)
+		c.Assert(err, check.IsNil)
+		err = routertest.FakeRouter.AddRoute(a.Name, &url.URL{Scheme: "http", Host: "10.1.1.1:8080"})
+		c.Assert(err, check.IsNil)
+	}
+	err := reconciler.NewConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/routers/drift?app=myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var report reconciler.Report
+	err = json.NewDecoder(recorder.Body).Decode(&report)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedApps, check.Equals, 2)
+	c.Assert(report.Drifts, check.DeepEquals, []reconciler.Drift{{
+		RoutesDrift: app.RoutesDrift{App: "myapp", Router: "fake", ExtraRoutes: []string{"http://10.1.1.1:8080"}},
+	}})
+}
+
+func (s *S) TestRoutersDriftNoReport(c *check.C) {
+	request, err := http.NewRequest("GET", "/routers/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestRoutersDriftUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, err := http.NewRequest("GET", "/routers/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
@@ -19,12 +19,18 @@ import (
 	apiRouter "github.com/tsuru/tsuru/api/router"
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/autoscale"
+	"github.com/tsuru/tsuru/app/idle"
+	"github.com/tsuru/tsuru/app/jobs"
+	"github.com/tsuru/tsuru/app/reconciler"
 	"github.com/tsuru/tsuru/auth"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router"
@@ -108,6 +114,8 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Put", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(bindServiceInstance))
 	m.Add("1.0", "Delete", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(unbindServiceInstance))
 	m.Add("1.0", "Get", "/services/{service}/instances/{instance}/status", AuthorizationRequiredHandler(serviceInstanceStatus))
+	m.Add("1.0", "Post", "/services/{service}/instances/{instance}/rotate", AuthorizationRequiredHandler(rotateServiceInstanceCredentials))
+	m.Add("1.0", "Put", "/services/{service}/instances/{instance}/labels", AuthorizationRequiredHandler(setServiceInstanceLabels))
 	m.Add("1.0", "Put", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceGrantTeam))
 	m.Add("1.0", "Delete", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceRevokeTeam))
 
@@ -129,6 +137,12 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}", AuthorizationRequiredHandler(appInfo))
 	m.Add("1.0", "Post", "/apps/{app}/cname", AuthorizationRequiredHandler(setCName))
 	m.Add("1.0", "Delete", "/apps/{app}/cname", AuthorizationRequiredHandler(unsetCName))
+	m.Add("1.0", "Get", "/apps/{app}/routers", AuthorizationRequiredHandler(appRouterList))
+	m.Add("1.0", "Post", "/apps/{app}/routers", AuthorizationRequiredHandler(appRouterAdd))
+	m.Add("1.0", "Delete", "/apps/{app}/routers/{router}", AuthorizationRequiredHandler(appRouterRemove))
+	m.Add("1.0", "Get", "/apps/{app}/certificates", AuthorizationRequiredHandler(certificateList))
+	m.Add("1.0", "Put", "/apps/{app}/certificates", AuthorizationRequiredHandler(certificateSet))
+	m.Add("1.0", "Delete", "/apps/{app}/certificates/{cname}", AuthorizationRequiredHandler(certificateRemove))
 	runHandler := AuthorizationRequiredHandler(runCommand)
 	m.Add("1.0", "Post", "/apps/{app}/run", runHandler)
 	m.Add("1.0", "Post", "/apps/{app}/restart", AuthorizationRequiredHandler(restart))
@@ -141,12 +155,31 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/env", AuthorizationRequiredHandler(getEnv))
 	m.Add("1.0", "Post", "/apps/{app}/env", AuthorizationRequiredHandler(setEnv))
 	m.Add("1.0", "Delete", "/apps/{app}/env", AuthorizationRequiredHandler(unsetEnv))
+	m.Add("1.0", "Put", "/apps/{app}/labels", AuthorizationRequiredHandler(setAppLabels))
+	m.Add("1.0", "Put", "/apps/{app}/node-selector", AuthorizationRequiredHandler(setAppNodeSelector))
 	m.Add("1.0", "Get", "/apps", AuthorizationRequiredHandler(appList))
 	m.Add("1.0", "Post", "/apps", AuthorizationRequiredHandler(createApp))
 	forceDeleteLockHandler := AuthorizationRequiredHandler(forceDeleteLock)
 	m.Add("1.0", "Delete", "/apps/{app}/lock", forceDeleteLockHandler)
 	m.Add("1.0", "Put", "/apps/{app}/units", AuthorizationRequiredHandler(addUnits))
 	m.Add("1.0", "Delete", "/apps/{app}/units", AuthorizationRequiredHandler(removeUnits))
+	m.Add("1.0", "Get", "/apps/{app}/autoscale", AuthorizationRequiredHandler(autoScalePolicyList))
+	m.Add("1.0", "Put", "/apps/{app}/autoscale", AuthorizationRequiredHandler(autoScalePolicySet))
+	m.Add("1.0", "Delete", "/apps/{app}/autoscale/{process}", AuthorizationRequiredHandler(autoScalePolicyRemove))
+	m.Add("1.0", "Put", "/apps/{app}/deploy-approval", AuthorizationRequiredHandler(deployApprovalSet))
+	m.Add("1.0", "Get", "/apps/{app}/deploy-requests", AuthorizationRequiredHandler(deployRequestList))
+	m.Add("1.0", "Post", "/apps/{app}/deploy-requests/{id}/approve", AuthorizationRequiredHandler(deployRequestApprove))
+	m.Add("1.0", "Post", "/apps/{app}/deploy-requests/{id}/reject", AuthorizationRequiredHandler(deployRequestReject))
+	m.Add("1.0", "Put", "/apps/{app}/idle-policy", AuthorizationRequiredHandler(idlePolicySet))
+	m.Add("1.0", "Delete", "/apps/{app}/idle-policy", AuthorizationRequiredHandler(idlePolicyRemove))
+	m.Add("1.0", "Get", "/apps/{app}/jobs", AuthorizationRequiredHandler(jobList))
+	m.Add("1.0", "Put", "/apps/{app}/jobs", AuthorizationRequiredHandler(jobSet))
+	m.Add("1.0", "Delete", "/apps/{app}/jobs/{job}", AuthorizationRequiredHandler(jobRemove))
+	m.Add("1.0", "Get", "/apps/{app}/jobs/{job}/runs", AuthorizationRequiredHandler(jobRunList))
+	m.Add("1.0", "Get", "/apps/{app}/jobs/{job}/runs/{id}", AuthorizationRequiredHandler(jobRunInfo))
+	m.Add("1.0", "Get", "/apps/{app}/log-drains", AuthorizationRequiredHandler(logDrainList))
+	m.Add("1.0", "Post", "/apps/{app}/log-drains", AuthorizationRequiredHandler(logDrainAdd))
+	m.Add("1.0", "Delete", "/apps/{app}/log-drains/{name}", AuthorizationRequiredHandler(logDrainRemove))
 	registerUnitHandler := AuthorizationRequiredHandler(registerUnit)
 	m.Add("1.0", "Post", "/apps/{app}/units/register", registerUnitHandler)
 	setUnitStatusHandler := AuthorizationRequiredHandler(setUnitStatus)
@@ -164,6 +197,14 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.0", "Get", "/deploys", AuthorizationRequiredHandler(deploysList))
 	m.Add("1.0", "Get", "/deploys/{deploy}", AuthorizationRequiredHandler(deployInfo))
+	m.Add("1.0", "Get", "/deploy-freezes", AuthorizationRequiredHandler(deployFreezeList))
+	m.Add("1.0", "Post", "/deploy-freezes", AuthorizationRequiredHandler(deployFreezeAdd))
+	m.Add("1.0", "Delete", "/deploy-freezes/{id}", AuthorizationRequiredHandler(deployFreezeRemove))
+
+	m.Add("1.0", "Get", "/events", AuthorizationRequiredHandler(eventList))
+	m.Add("1.0", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
+	m.Add("1.0", "Get", "/events/{uuid}/log", AuthorizationRequiredHandler(eventLog))
+	m.Add("1.0", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
 
 	m.Add("1.0", "Get", "/platforms", AuthorizationRequiredHandler(platformList))
 	m.Add("1.0", "Post", "/platforms", AuthorizationRequiredHandler(platformAdd))
@@ -208,7 +249,18 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
+	m.Add("1.0", "Get", "/teams/usage", AuthorizationRequiredHandler(teamsQuotaUsage))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
+	m.Add("1.0", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.0", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
+	m.Add("1.0", "Put", "/teams/{name}/labels", AuthorizationRequiredHandler(setTeamLabels))
+
+	m.Add("1.0", "Get", "/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.0", "Post", "/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.0", "Get", "/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.0", "Put", "/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.0", "Delete", "/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.0", "Get", "/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -216,6 +268,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/healthcheck", http.HandlerFunc(healthcheck))
 
 	m.Add("1.0", "Get", "/iaas/machines", AuthorizationRequiredHandler(machinesList))
+	m.Add("1.0", "Get", "/iaas/machines/drift", AuthorizationRequiredHandler(machinesDrift))
 	m.Add("1.0", "Delete", "/iaas/machines/{machine_id}", AuthorizationRequiredHandler(machineDestroy))
 	m.Add("1.0", "Get", "/iaas/templates", AuthorizationRequiredHandler(templatesList))
 	m.Add("1.0", "Post", "/iaas/templates", AuthorizationRequiredHandler(templateCreate))
@@ -226,6 +279,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/plans", AuthorizationRequiredHandler(addPlan))
 	m.Add("1.0", "Delete", "/plans/{planname}", AuthorizationRequiredHandler(removePlan))
 	m.Add("1.0", "Get", "/plans/routers", AuthorizationRequiredHandler(listRouters))
+	m.Add("1.0", "Get", "/routers/drift", AuthorizationRequiredHandler(routersDrift))
 
 	m.Add("1.0", "Get", "/pools", AuthorizationRequiredHandler(poolList))
 	m.Add("1.0", "Post", "/pools", AuthorizationRequiredHandler(addPoolHandler))
@@ -378,6 +432,33 @@ func RunServer(dry bool) http.Handler {
 				fmt.Print(startupMessage)
 			}
 		}
+		if autoScaleConfig := autoscale.Initialize(); autoScaleConfig != nil {
+			shutdown.Register(autoScaleConfig)
+			fmt.Println("App auto scale enabled.")
+		}
+		if jobsConfig := jobs.Initialize(); jobsConfig != nil {
+			shutdown.Register(jobsConfig)
+			fmt.Println("App jobs enabled.")
+		}
+		if reconcilerConfig := reconciler.Initialize(); reconcilerConfig != nil {
+			shutdown.Register(reconcilerConfig)
+			fmt.Println("Router reconciler enabled.")
+		}
+		if machinesReconcilerConfig := iaas.InitializeReconciler(); machinesReconcilerConfig != nil {
+			shutdown.Register(machinesReconcilerConfig)
+			fmt.Println("IaaS machine reconciler enabled.")
+		}
+		idleConfig, err := idle.Initialize()
+		if err != nil {
+			fmt.Printf("Warning: unable to initialize idle apps sleeping: %s\n", err)
+		} else if idleConfig != nil {
+			shutdown.Register(idleConfig)
+			fmt.Println("Idle apps sleeping enabled.")
+		}
+		err = webhook.Initialize()
+		if err != nil {
+			fmt.Printf("Warning: unable to initialize webhooks: %s\n", err)
+		}
 		scheme, err := getAuthScheme()
 		if err != nil {
 			fmt.Printf("Warning: configuration didn't declare auth:scheme, using default scheme.\n")
@@ -13,6 +13,8 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
@@ -85,6 +87,12 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 			Message: err.Error(),
 		}
 	}
+	if _, ok := err.(*auth.TeamQuotaExceededError); ok {
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: err.Error(),
+		}
+	}
 	if err == nil {
 		w.WriteHeader(http.StatusCreated)
 	}
@@ -100,11 +108,13 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 //   400: Invalid data
 //   401: Unauthorized
 //   404: Service instance not found
+//   412: Service instance not ready
 func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	serviceName := r.URL.Query().Get(":service")
 	instanceName := r.URL.Query().Get(":instance")
 	description := r.FormValue("description")
-	if description == "" {
+	plan := r.FormValue("plan")
+	if description == "" && plan == "" {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
 			Message: "Invalid value for description",
@@ -114,21 +124,106 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if err != nil {
 		return err
 	}
-	allowed := permission.Check(t, permission.PermServiceInstanceUpdateDescription,
-		permission.Context(permission.CtxServiceInstance, si.Name),
-	)
-	if !allowed {
-		return permission.ErrUnauthorized
+	if description != "" {
+		allowed := permission.Check(t, permission.PermServiceInstanceUpdateDescription,
+			permission.Context(permission.CtxServiceInstance, si.Name),
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+	}
+	if plan != "" {
+		allowed := permission.Check(t, permission.PermServiceInstanceUpdatePlan,
+			permission.Context(permission.CtxServiceInstance, si.Name),
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
 	}
 	user, err := t.User()
 	if err != nil {
 		return err
 	}
+	if plan != "" && plan != si.PlanName {
+		rec.Log(user.Email, "update-service-instance", "plan="+plan)
+		requestIDHeader, _ := config.GetString("request-id-header")
+		err = si.UpdatePlan(plan, context.GetRequestID(r, requestIDHeader))
+		switch err {
+		case nil:
+		case service.ErrPlanUpdateNotSupported, service.ErrPlanNotInCatalog:
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		case service.ErrInstanceNotReady:
+			return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+		default:
+			if _, ok := err.(*service.BrokerOperationError); ok {
+				return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+			}
+			return err
+		}
+	}
+	if description == "" {
+		return nil
+	}
 	rec.Log(user.Email, "update-service-instance", "description="+description)
 	si.Description = description
 	return service.UpdateService(si)
 }
 
+// title: rotate service instance credentials
+// path: /services/{service}/instances/{instance}/rotate
+// method: POST
+// produce: application/x-json-stream
+// responses:
+//   200: Credentials rotated
+//   401: Unauthorized
+//   404: Service instance not found
+func rotateServiceInstanceCredentials(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	serviceName := r.URL.Query().Get(":service")
+	instanceName := r.URL.Query().Get(":instance")
+	si, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateRotate,
+		append(permission.Contexts(permission.CtxTeam, si.Teams),
+			permission.Context(permission.CtxServiceInstance, si.Name),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	apps := make([]bind.App, len(si.Apps))
+	for i, appName := range si.Apps {
+		a, err := app.GetByName(appName)
+		if err != nil {
+			return err
+		}
+		allowed = permission.Check(t, permission.PermAppUpdateBind,
+			append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)...,
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+		apps[i] = a
+	}
+	rec.Log(t.GetUserName(), "rotate-service-instance-credentials", serviceName, instanceName)
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := io.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	err = si.RotateCredentials(apps, t.GetUserName(), writer, context.GetRequestID(r, requestIDHeader))
+	if err != nil {
+		writer.Encode(io.SimpleJsonMessage{Error: err.Error()})
+		return nil
+	}
+	fmt.Fprintf(writer, "\nCredentials of instance %q rotated in %d apps.\n", instanceName, len(apps))
+	return nil
+}
+
 // title: remove service instance
 // path: /services/{name}/instances/{instance}
 // method: DELETE
@@ -344,6 +439,7 @@ type serviceInstanceInfo struct {
 	PlanName        string
 	PlanDescription string
 	CustomInfo      map[string]string
+	Labels          map[string]string
 }
 
 // title: service instance info
@@ -389,6 +485,7 @@ func serviceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) error
 		PlanName:        plan.Name,
 		PlanDescription: plan.Description,
 		CustomInfo:      info,
+		Labels:          serviceInstance.Labels,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(sInfo)
@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
@@ -466,6 +467,37 @@ func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstanceWithDescriptio
 	c.Assert(instance.Description, check.DeepEquals, "changed")
 }
 
+func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstancePlanNotSupported(c *check.C) {
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": s.ts.URL},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		Teams:       []string{s.team.Name},
+	}
+	si.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	token := customUserWithPermission(c, "myuser", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdatePlan,
+		Context: permission.Context(permission.CtxServiceInstance, si.Name),
+	})
+	params := map[string]string{"plan": "large"}
+	recorder, request := makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", token.GetValue(), c)
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrPlanUpdateNotSupported.Error()+"\n")
+	params = map[string]string{"plan": "large", "description": "changed"}
+	recorder, request = makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", token.GetValue(), c)
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstanceNoDescription(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
@@ -581,6 +613,82 @@ func (s *ConsumptionSuite) TestUpdateServiceHandlerInvalidDescription(c *check.C
 	c.Assert(recorder.Body.String(), check.Equals, "Invalid value for description\n")
 }
 
+func (s *ConsumptionSuite) TestRotateServiceInstanceCredentials(c *check.C) {
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		Apps:        []string{"painkiller"},
+		Teams:       []string{s.team.Name},
+	}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "painkiller", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	err = a.AddInstance(bind.InstanceApp{
+		ServiceName: "mysql",
+		Instance: bind.ServiceInstance{Name: si.Name, Envs: map[string]string{
+			"DATABASE_HOST":     "oldhost",
+			"DATABASE_PASSWORD": "compromised",
+		}},
+	}, nil)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "rotator", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdateRotate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	}, permission.Permission{
+		Scheme:  permission.PermAppUpdateBind,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("POST", "/services/mysql/instances/brainSQL/rotate", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Not(check.Matches), `(?s).*"Error".*`)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Env["DATABASE_HOST"], check.DeepEquals, bind.EnvVar{Name: "DATABASE_HOST", Value: "localhost", InstanceName: si.Name})
+	_, ok := dbApp.Env["DATABASE_PASSWORD"]
+	c.Assert(ok, check.Equals, false)
+	c.Assert(dbApp.Env[app.TsuruServicesEnvVar].Value, check.Equals, `{"mysql":[{"instance_name":"brainSQL","envs":{"DATABASE_HOST":"localhost"}}]}`)
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 1)
+	action := rectest.Action{
+		Action: "rotate-service-instance-credentials",
+		User:   "rotator@groundcontrol.com",
+		Extra:  []interface{}{"mysql", "brainSQL"},
+	}
+	c.Assert(action, rectest.IsRecorded)
+}
+
+func (s *ConsumptionSuite) TestRotateServiceInstanceCredentialsNoAppPermission(c *check.C) {
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		Apps:        []string{"painkiller"},
+		Teams:       []string{s.team.Name},
+	}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "painkiller", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "rotator", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdateRotate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("POST", "/services/mysql/instances/brainSQL/rotate", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 0)
+}
+
 func makeRequestToRemoveInstanceHandler(service, instance string, c *check.C) (*httptest.ResponseRecorder, *http.Request) {
 	url := fmt.Sprintf("/services/%s/instances/%s", service, instance)
 	request, err := http.NewRequest("DELETE", url, nil)
@@ -26,6 +26,9 @@ func serviceValidate(s service.Service) error {
 	if endpoint, ok := s.Endpoint["production"]; !ok || endpoint == "" {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Service production endpoint is required"}
 	}
+	if !s.ValidEndpointKind() {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: service.ErrInvalidEndpointKind.Error()}
+	}
 	return nil
 }
 
@@ -99,10 +102,11 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 //   409: Service already exists
 func serviceCreate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	s := service.Service{
-		Name:     r.FormValue("id"),
-		Username: r.FormValue("username"),
-		Endpoint: map[string]string{"production": r.FormValue("endpoint")},
-		Password: r.FormValue("password"),
+		Name:         r.FormValue("id"),
+		Username:     r.FormValue("username"),
+		Endpoint:     map[string]string{"production": r.FormValue("endpoint")},
+		EndpointKind: r.FormValue("kind"),
+		Password:     r.FormValue("password"),
 	}
 	team := r.FormValue("team")
 	if team == "" {
@@ -155,10 +159,11 @@ func serviceCreate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 //   404: Service not found
 func serviceUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	d := service.Service{
-		Username: r.FormValue("username"),
-		Endpoint: map[string]string{"production": r.FormValue("endpoint")},
-		Password: r.FormValue("password"),
-		Name:     r.URL.Query().Get(":name"),
+		Username:     r.FormValue("username"),
+		Endpoint:     map[string]string{"production": r.FormValue("endpoint")},
+		EndpointKind: r.FormValue("kind"),
+		Password:     r.FormValue("password"),
+		Name:         r.URL.Query().Get(":name"),
 	}
 	err := serviceValidate(d)
 	if err != nil {
@@ -178,6 +183,9 @@ func serviceUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	rec.Log(t.GetUserName(), "update-service", d.Name, d.Endpoint["production"])
 	s.Endpoint = d.Endpoint
+	if d.EndpointKind != "" {
+		s.EndpointKind = d.EndpointKind
+	}
 	s.Password = d.Password
 	s.Username = d.Username
 	if err = s.Update(); err != nil {
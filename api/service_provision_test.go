@@ -150,6 +150,37 @@ func (s *ProvisionSuite) TestServiceCreate(c *check.C) {
 	c.Assert(action, rectest.IsRecorded)
 }
 
+func (s *ProvisionSuite) TestServiceCreateWithEndpointKind(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("password", "xxxx")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.com")
+	v.Set("kind", "osb")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var rService service.Service
+	err := s.conn.Services().FindId("some_service").One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.EndpointKind, check.Equals, service.EndpointKindOSB)
+}
+
+func (s *ProvisionSuite) TestServiceCreateInvalidEndpointKind(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("password", "xxxx")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.com")
+	v.Set("kind", "soap")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, service.ErrInvalidEndpointKind.Error()+"\n")
+}
+
 func (s *ProvisionSuite) TestServiceCreateNameExists(c *check.C) {
 	recorder, request := s.makeRequestToCreateHandler(c)
 	s.m.ServeHTTP(recorder, request)
@@ -268,6 +299,37 @@ func (s *ProvisionSuite) TestServiceUpdate(c *check.C) {
 	c.Assert(action, rectest.IsRecorded)
 }
 
+func (s *ProvisionSuite) TestServiceUpdateKeepsEndpointKind(c *check.C) {
+	srv := service.Service{
+		Name:         "mysqlapi",
+		Endpoint:     map[string]string{"production": "sqlapi.com"},
+		EndpointKind: service.EndpointKindOSB,
+		OwnerTeams:   []string{s.team.Name},
+		Password:     "oldold",
+	}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": srv.Name})
+	v := url.Values{}
+	v.Set("password", "yyyy")
+	v.Set("endpoint", "mysqlapi.com")
+	recorder, request := s.makeRequest("PUT", "/services/mysqlapi", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = s.conn.Services().Find(bson.M{"_id": srv.Name}).One(&srv)
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.EndpointKind, check.Equals, service.EndpointKindOSB)
+	v.Set("kind", service.EndpointKindTsuru)
+	recorder, request = s.makeRequest("PUT", "/services/mysqlapi", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = s.conn.Services().Find(bson.M{"_id": srv.Name}).One(&srv)
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.EndpointKind, check.Equals, service.EndpointKindTsuru)
+}
+
 func (s *ProvisionSuite) TestUpdateHandlerReturnsBadRequestWithoutPassword(c *check.C) {
 	v := url.Values{}
 	v.Set("id", "some_service")
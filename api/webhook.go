@@ -0,0 +1,259 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/rec"
+)
+
+const defaultDeliveriesLimit = 50
+
+func getWebhook(name string, t auth.Token, perm *permission.PermissionScheme) (*webhook.Webhook, error) {
+	w, err := webhook.Get(name)
+	if err == webhook.ErrWebhookNotFound {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !permission.Check(t, perm, permission.Context(permission.CtxTeam, w.TeamOwner)) {
+		return nil, permission.ErrUnauthorized
+	}
+	return w, nil
+}
+
+// webhookFromForm updates the webhook with the fields present in the request
+// form. Headers are sent in the "Name: value" format.
+func webhookFromForm(w *webhook.Webhook, r *http.Request) error {
+	if _, ok := r.Form["url"]; ok {
+		w.URL = r.FormValue("url")
+	}
+	if _, ok := r.Form["app"]; ok {
+		w.App = r.FormValue("app")
+	}
+	if _, ok := r.Form["secret"]; ok {
+		w.Secret = r.FormValue("secret")
+	}
+	if kinds, ok := r.Form["kind"]; ok {
+		w.EventKinds = nil
+		for _, k := range kinds {
+			if k != "" {
+				w.EventKinds = append(w.EventKinds, k)
+			}
+		}
+	}
+	if headers, ok := r.Form["header"]; ok {
+		w.Headers = nil
+		for _, h := range headers {
+			if h == "" {
+				continue
+			}
+			parts := strings.SplitN(h, ":", 2)
+			if len(parts) != 2 {
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid header: %q", h)}
+			}
+			if w.Headers == nil {
+				w.Headers = map[string]string{}
+			}
+			w.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return nil
+}
+
+// title: webhook list
+// path: /webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: List webhooks
+//   204: No content
+//   401: Unauthorized
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermWebhookRead)
+	teams := []string{}
+	for _, c := range contexts {
+		if c.CtxType == permission.CtxGlobal {
+			teams = nil
+			break
+		}
+		if c.CtxType == permission.CtxTeam {
+			teams = append(teams, c.Value)
+		}
+	}
+	webhooks, err := webhook.List(teams)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(webhooks)
+}
+
+// title: webhook info
+// path: /webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := getWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hook)
+}
+
+// title: webhook create
+// path: /webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Webhook created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	hook := webhook.Webhook{
+		Name:      r.FormValue("name"),
+		TeamOwner: r.FormValue("team"),
+	}
+	if hook.TeamOwner == "" {
+		hook.TeamOwner, err = permission.TeamForPermission(t, permission.PermWebhookCreate)
+		if err != nil {
+			return err
+		}
+	}
+	allowed := permission.Check(t, permission.PermWebhookCreate,
+		permission.Context(permission.CtxTeam, hook.TeamOwner),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	err = webhookFromForm(&hook, r)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "create-webhook", "name="+hook.Name, "team="+hook.TeamOwner, "url="+hook.URL)
+	err = webhook.Create(&hook)
+	if err == webhook.ErrWebhookAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: webhook update
+// path: /webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	hook, err := getWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookUpdate)
+	if err != nil {
+		return err
+	}
+	err = webhookFromForm(hook, r)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "update-webhook", "name="+hook.Name, "url="+hook.URL)
+	err = webhook.Update(hook)
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	if err == webhook.ErrWebhookNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: webhook delete
+// path: /webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook removed
+//   401: Unauthorized
+//   404: Not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := getWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookDelete)
+	if err != nil {
+		return err
+	}
+	rec.Log(t.GetUserName(), "remove-webhook", "name="+hook.Name)
+	err = webhook.Remove(hook.Name)
+	if err == webhook.ErrWebhookNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: webhook deliveries
+// path: /webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: List deliveries
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	hook, err := getWebhook(r.URL.Query().Get(":name"), t, permission.PermWebhookRead)
+	if err != nil {
+		return err
+	}
+	limit := defaultDeliveriesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid value for limit: " + value}
+		}
+	}
+	deliveries, err := webhook.ListDeliveries(hook.Name, limit)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,266 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestWebhookCreate(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=http://example.com/hook&kind=app.deploy&kind=app.update&secret=s3cr3t&header=X-Token:%20abc")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	w, err := webhook.Get("deploys")
+	c.Assert(err, check.IsNil)
+	key, err := secret.Decrypt(w.Secret)
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "s3cr3t")
+	w.Secret = ""
+	c.Assert(*w, check.DeepEquals, webhook.Webhook{
+		Name:       "deploys",
+		TeamOwner:  s.team.Name,
+		URL:        "http://example.com/hook",
+		EventKinds: []string{"app.deploy", "app.update"},
+		Headers:    map[string]string{"X-Token": "abc"},
+	})
+}
+
+func (s *S) TestWebhookCreateSecretWithoutKeys(c *check.C) {
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=http://example.com/hook&secret=s3cr3t")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, "secrets are not enabled.*\n")
+}
+
+func (s *S) TestWebhookCreateInternalURL(c *check.C) {
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=http://169.254.169.254/latest/meta-data")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid webhook url: \"http://169.254.169.254/latest/meta-data\" points to an internal address\n")
+}
+
+func (s *S) TestWebhookCreateInvalid(c *check.C) {
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=ftp://example.com")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid webhook url: \"ftp://example.com\"\n")
+}
+
+func (s *S) TestWebhookCreateAlreadyExists(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "deploys", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=http://example.com")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestWebhookCreateWithoutPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader("name=deploys&team=tsuruteam&url=http://example.com")
+	request, err := http.NewRequest("POST", "/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookList(c *check.C) {
+	err := s.conn.Teams().Insert(bson.M{"_id": "otherteam"})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(&webhook.Webhook{Name: "hook2", TeamOwner: "otherteam", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var webhooks []webhook.Webhook
+	err = json.NewDecoder(recorder.Body).Decode(&webhooks)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.DeepEquals, []webhook.Webhook{{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"}})
+}
+
+func (s *S) TestWebhookListNoContent(c *check.C) {
+	request, err := http.NewRequest("GET", "/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestWebhookInfo(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com", Secret: "abc"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, `{"name":"hook1","teamowner":"tsuruteam","url":"http://a.com"}`+"\n")
+}
+
+func (s *S) TestWebhookInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookUpdate(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	original := webhook.Webhook{
+		Name:       "hook1",
+		TeamOwner:  s.team.Name,
+		URL:        "http://a.com",
+		Secret:     "abc",
+		EventKinds: []string{"app.deploy"},
+	}
+	err := webhook.Create(&original)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("url=https://b.com&kind=")
+	request, err := http.NewRequest("PUT", "/webhooks/hook1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	w, err := webhook.Get("hook1")
+	c.Assert(err, check.IsNil)
+	c.Assert(*w, check.DeepEquals, webhook.Webhook{
+		Name:      "hook1",
+		TeamOwner: s.team.Name,
+		URL:       "https://b.com",
+		Secret:    original.Secret,
+	})
+}
+
+func (s *S) TestWebhookDelete(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Get("hook1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+}
+
+func (s *S) TestWebhookDeleteWithoutPermission(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("DELETE", "/webhooks/hook1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookDeliveries(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	deliveries := []webhook.Delivery{
+		{ID: bson.NewObjectId(), Webhook: "hook1", Attempt: 1, Time: now.Add(-time.Minute), StatusCode: 500, Error: "invalid response status: 500"},
+		{ID: bson.NewObjectId(), Webhook: "hook1", Attempt: 2, Time: now, StatusCode: 200, Success: true},
+	}
+	for _, d := range deliveries {
+		err = s.conn.WebhookDeliveries().Insert(d)
+		c.Assert(err, check.IsNil)
+	}
+	request, err := http.NewRequest("GET", "/webhooks/hook1/deliveries?limit=1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result []webhook.Delivery
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].ID, check.Equals, deliveries[1].ID)
+	c.Assert(result[0].Success, check.Equals, true)
+}
+
+func (s *S) TestWebhookDeliveriesInvalidLimit(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "hook1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/webhooks/hook1/deliveries?limit=x", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
@@ -304,6 +304,14 @@ var reserveUnitsToAdd = action.Action{
 		if err != nil {
 			return nil, ErrAppNotFound
 		}
+		releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamUsage{
+			Memory:   app.Plan.Memory * int64(n),
+			CPUShare: app.Plan.CpuShare * n,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer releaseQuota()
 		err = reserveUnits(app, n)
 		if err != nil {
 			return nil, err
@@ -403,6 +411,9 @@ var moveRouterUnits = action.Action{
 				log.Errorf("BACKWARD ABORTED - failed to get app router: %s", err)
 				return
 			}
+			if result.app.hasExtraRouter(routerName) {
+				return
+			}
 			r, err := router.Get(routerName)
 			if err != nil {
 				log.Errorf("BACKWARD ABORTED - failed to retrieve router %q: %s", routerName, err)
@@ -485,6 +496,9 @@ var removeOldBackend = action.Action{
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
 				return nil, nil
 			}
+			if result.app.hasExtraRouter(routerName) {
+				return result, nil
+			}
 			r, err := router.Get(routerName)
 			if err != nil {
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
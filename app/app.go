@@ -17,9 +17,11 @@ import (
 
 	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
@@ -120,6 +122,16 @@ type App struct {
 	Plan           Plan
 	Pool           string
 	Description    string
+	AutoScale      []AutoScalePolicy
+	Jobs           []Job
+	DeclaredJobs   []Job
+	Labels         label.Labels `bson:",omitempty"`
+	NodeSelector   label.Labels `bson:",omitempty"`
+	LogDrains      []LogDrain   `bson:",omitempty"`
+	IdlePolicy     *IdlePolicy  `bson:",omitempty"`
+	DeployApproval bool
+	Routers        []AppRouter   `bson:",omitempty"`
+	Certificates   []Certificate `bson:",omitempty"`
 
 	quota.Quota
 }
@@ -147,10 +159,31 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["owner"] = app.Owner
 	result["pool"] = app.Pool
 	result["description"] = app.Description
+	result["labels"] = app.Labels
+	if len(app.NodeSelector) > 0 {
+		result["nodeSelector"] = app.NodeSelector
+	}
 	result["deploys"] = app.Deploys
 	result["teamowner"] = app.TeamOwner
 	result["plan"] = app.Plan
 	result["lock"] = app.Lock
+	result["autoscale"] = app.AutoScale
+	result["jobs"] = app.AllJobs()
+	if len(app.LogDrains) > 0 {
+		result["logdrains"] = app.LogDrainsStatus()
+	}
+	if app.IdlePolicy != nil {
+		result["idlepolicy"] = app.IdlePolicy
+	}
+	if app.DeployApproval {
+		result["deployApproval"] = true
+	}
+	if len(app.Routers) > 0 {
+		result["routers"] = app.RoutersAddresses()
+	}
+	if warnings := app.CertificateWarnings(time.Now()); len(warnings) > 0 {
+		result["certificateWarnings"] = warnings
+	}
 	return json.Marshal(&result)
 }
 
@@ -265,6 +298,11 @@ func CreateApp(app *App, user *auth.User) error {
 	if err != nil {
 		return err
 	}
+	releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamUsage{Apps: 1})
+	if err != nil {
+		return &AppCreationError{app: app.Name, Err: err}
+	}
+	defer releaseQuota()
 	actions := []*action.Action{
 		&reserveUserApp,
 		&insertApp,
@@ -307,6 +345,14 @@ func (app *App) Update(updateData App, w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamUsage{
+			Memory:   (plan.Memory - app.Plan.Memory) * int64(app.Quota.InUse),
+			CPUShare: (plan.CpuShare - app.Plan.CpuShare) * app.Quota.InUse,
+		})
+		if err != nil {
+			return err
+		}
+		defer releaseQuota()
 		var oldPlan Plan
 		oldPlan, app.Plan = app.Plan, *plan
 		actions := []*action.Action{
@@ -325,6 +371,17 @@ func (app *App) Update(updateData App, w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		if team.Name != app.TeamOwner {
+			releaseQuota, err := auth.ReserveTeamQuota(team.Name, auth.TeamUsage{
+				Memory:   app.Plan.Memory * int64(app.Quota.InUse),
+				CPUShare: app.Plan.CpuShare * app.Quota.InUse,
+				Apps:     1,
+			})
+			if err != nil {
+				return err
+			}
+			defer releaseQuota()
+		}
 		app.TeamOwner = team.Name
 		err = app.validateTeamOwner()
 		if err != nil {
@@ -414,14 +471,14 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
-	logConn, err := db.LogConn()
+	logStorage, err := GetLogStorage()
 	if err == nil {
-		defer logConn.Close()
-		err = logConn.Logs(appName).DropCollection()
+		err = logStorage.Remove(appName)
 	}
 	if err != nil {
-		logErr("Unable to remove logs collection", err)
+		logErr("Unable to remove logs", err)
 	}
+	logDrains.remove(appName)
 	conn, err := db.Conn()
 	if err == nil {
 		defer conn.Close()
@@ -434,6 +491,10 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to mark old deploys as removed", err)
 	}
+	err = removeJobRuns(appName)
+	if err != nil {
+		logErr("Unable to remove job runs", err)
+	}
 	return nil
 }
 
@@ -877,12 +938,7 @@ func (app *App) Sleep(w io.Writer, process string, proxyURL *url.URL) error {
 		msg = fmt.Sprintf("\n ---> Putting the app %q to sleep\n", app.Name)
 	}
 	log.Write(w, []byte(msg))
-	routerName, err := app.GetRouter()
-	if err != nil {
-		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
-		return err
-	}
-	r, err := router.Get(routerName)
+	r, err := app.allRouters()
 	if err != nil {
 		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
 		return err
@@ -970,6 +1026,9 @@ func (app *App) GetQuota() quota.Quota {
 	return app.Quota
 }
 
+// SetQuotaInUse stores the number of units in use by the app. Memory and CPU
+// shares of new units are reserved in the quota of the team owner until the
+// number is stored.
 func (app *App) SetQuotaInUse(inUse int) error {
 	if inUse < 0 {
 		return stderr.New("invalid value, cannot be lesser than 0")
@@ -980,6 +1039,19 @@ func (app *App) SetQuotaInUse(inUse int) error {
 			Available: uint(app.Quota.Limit),
 		}
 	}
+	current, err := GetByName(app.Name)
+	if err != nil {
+		return err
+	}
+	added := inUse - current.Quota.InUse
+	releaseQuota, err := auth.ReserveTeamQuota(current.TeamOwner, auth.TeamUsage{
+		Memory:   current.Plan.Memory * int64(added),
+		CPUShare: current.Plan.CpuShare * added,
+	})
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -997,6 +1069,66 @@ func (app *App) GetCname() []string {
 	return app.CName
 }
 
+// GetLabels returns the labels of the app.
+func (app *App) GetLabels() map[string]string {
+	return app.Labels
+}
+
+// SetLabels adds the labels in set to the app and removes the labels whose
+// keys are in unset.
+func (app *App) SetLabels(set label.Labels, unset []string) error {
+	err := set.Validate()
+	if err != nil {
+		return err
+	}
+	labels := app.Labels.Update(set, unset)
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"labels": labels}})
+	if err == mgo.ErrNotFound {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+	app.Labels = labels
+	return nil
+}
+
+// SetNodeSelector replaces the node selector of the app, restricting the nodes
+// where its units may run to the ones whose metadata contain all the labels in
+// the selector. An empty selector allows all nodes in the pool of the app.
+func (app *App) SetNodeSelector(selector label.Labels) error {
+	err := selector.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var update bson.M
+	if len(selector) == 0 {
+		selector = nil
+		update = bson.M{"$unset": bson.M{"nodeselector": ""}}
+	} else {
+		update = bson.M{"$set": bson.M{"nodeselector": selector}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err == mgo.ErrNotFound {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+	app.NodeSelector = selector
+	return nil
+}
+
 // GetLock returns the app lock information.
 func (app *App) GetLock() provision.AppLock {
 	return &app.Lock
@@ -1042,9 +1174,28 @@ func (app *App) SetEnvs(setEnvs bind.SetEnvApp, w io.Writer) error {
 //
 // shouldRestart defines if the server should be restarted after saving vars.
 func (app *App) setEnvsToApp(setEnvs bind.SetEnvApp, w io.Writer) error {
-	if len(setEnvs.Envs) == 0 {
+	if len(setEnvs.Envs) == 0 && len(setEnvs.UnsetVariableNames) == 0 {
 		return nil
 	}
+	for i, env := range setEnvs.Envs {
+		if !env.Secret {
+			continue
+		}
+		setEnvs.Envs[i].Public = false
+		if !secret.IsEncrypted(env.Value) {
+			value, err := secret.Encrypt(env.Value)
+			if err != nil {
+				return err
+			}
+			setEnvs.Envs[i].Value = value
+		}
+	}
+	if w != nil && len(setEnvs.UnsetVariableNames) > 0 {
+		fmt.Fprintf(w, "---- Unsetting %d environment variables ----\n", len(setEnvs.UnsetVariableNames))
+	}
+	for _, name := range setEnvs.UnsetVariableNames {
+		delete(app.Env, name)
+	}
 	if w != nil {
 		fmt.Fprintf(w, "---- Setting %d new environment variables ----\n", len(setEnvs.Envs))
 	}
@@ -1103,7 +1254,7 @@ func (app *App) unsetEnvsToApp(unsetEnvs bind.UnsetEnvApp, w io.Writer) error {
 	for _, name := range unsetEnvs.VariableNames {
 		var unset bool
 		e, err := app.getEnv(name)
-		if !unsetEnvs.PublicOnly || (err == nil && e.Public) {
+		if !unsetEnvs.PublicOnly || (err == nil && (e.Public || e.Secret)) {
 			unset = true
 		}
 		if unset {
@@ -1125,6 +1276,47 @@ func (app *App) unsetEnvsToApp(unsetEnvs bind.UnsetEnvApp, w io.Writer) error {
 	return Provisioner.Restart(app, "", w)
 }
 
+// RotateSecretEnvs encrypts the secret environment variables of all apps
+// again, using the current secret key. It returns the number of variables
+// that were encrypted with older keys.
+func RotateSecretEnvs() (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(nil).Select(bson.M{"name": 1, "env": 1}).All(&apps)
+	if err != nil {
+		return 0, err
+	}
+	var rotated int
+	for _, a := range apps {
+		update := bson.M{}
+		for name, env := range a.Env {
+			if !env.Secret {
+				continue
+			}
+			value, changed, err := secret.Rotate(env.Value)
+			if err != nil {
+				return rotated, fmt.Errorf("unable to rotate env %s of app %s: %s", name, a.Name, err)
+			}
+			if changed {
+				update["env."+name+".value"] = value
+			}
+		}
+		if len(update) == 0 {
+			continue
+		}
+		err = conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": update})
+		if err != nil {
+			return rotated, err
+		}
+		rotated += len(update)
+	}
+	return rotated, nil
+}
+
 type rollbackFunc func(provision.App, string) error
 
 func (app *App) rollbackCNames(r rollbackFunc, cnames []string, mongoCommand string) {
@@ -1169,6 +1361,7 @@ func (app *App) RemoveCName(cnames ...string) error {
 	if err != nil {
 		return err
 	}
+	app.removeCNamesCertificates(cnames)
 	return nil
 }
 
@@ -1182,6 +1375,10 @@ func (app *App) parsedTsuruServices() map[string][]bind.ServiceInstance {
 	return tsuruServices
 }
 
+// AddInstance adds the instance to the app, or replaces it if the instance is
+// already bound. Variables of a replaced instance that are not in its new
+// envs are removed, in the same write that sets the new ones.
+//
 //func (app *App) AddInstance(serviceName string, instance bind.ServiceInstance, shouldRestart bool, writer io.Writer) error {
 func (app *App) AddInstance(instanceApp bind.InstanceApp, writer io.Writer) error {
 	tsuruServices := app.parsedTsuruServices()
@@ -1191,7 +1388,13 @@ func (app *App) AddInstance(instanceApp bind.InstanceApp, writer io.Writer) erro
 	if err != nil {
 		return err
 	}
-	if len(instanceApp.Instance.Envs) == 0 {
+	var stale []string
+	for name := range app.InstanceEnv(instanceApp.Instance.Name) {
+		if _, ok := instanceApp.Instance.Envs[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+	if len(instanceApp.Instance.Envs) == 0 && len(stale) == 0 {
 		return nil
 	}
 	envVars := make([]bind.EnvVar, 0, len(instanceApp.Instance.Envs)+1)
@@ -1210,9 +1413,10 @@ func (app *App) AddInstance(instanceApp bind.InstanceApp, writer io.Writer) erro
 	})
 	return app.SetEnvs(
 		bind.SetEnvApp{
-			Envs:          envVars,
-			PublicOnly:    false,
-			ShouldRestart: instanceApp.ShouldRestart,
+			Envs:               envVars,
+			PublicOnly:         false,
+			ShouldRestart:      instanceApp.ShouldRestart,
+			UnsetVariableNames: stale,
 		}, writer)
 }
 
@@ -1320,7 +1524,8 @@ func (app *App) RemoveInstance(instanceApp bind.InstanceApp, writer io.Writer) e
 // user can filter where the message come from.
 func (app *App) Log(message, source, unit string) error {
 	messages := strings.Split(message, "\n")
-	logs := make([]interface{}, 0, len(messages))
+	logs := make([]Applog, 0, len(messages))
+	notifyMessages := make([]interface{}, 0, len(messages))
 	for _, msg := range messages {
 		if msg != "" {
 			l := Applog{
@@ -1331,16 +1536,20 @@ func (app *App) Log(message, source, unit string) error {
 				Unit:    unit,
 			}
 			logs = append(logs, l)
+			notifyMessages = append(notifyMessages, l)
 		}
 	}
 	if len(logs) > 0 {
-		notify(app.Name, logs)
-		conn, err := db.LogConn()
+		notify(app.Name, notifyMessages)
+		logStorage, err := GetLogStorage()
 		if err != nil {
 			return err
 		}
-		defer conn.Close()
-		return conn.Logs(app.Name).Insert(logs...)
+		err = logStorage.Insert(app.Name, logs)
+		if err != nil {
+			return err
+		}
+		logDrains.send(app.Name, logs)
 	}
 	return nil
 }
@@ -1348,38 +1557,31 @@ func (app *App) Log(message, source, unit string) error {
 // LastLogs returns a list of the last `lines` log of the app, matching the
 // fields in the log instance received as an example.
 func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+	query := filterLog.logQuery()
+	query.Limit = lines
+	logs, _, err := app.QueryLogs(query)
+	return logs, err
+}
+
+// QueryLogs returns the last logs of the app matching the query, in
+// chronological order, and a cursor to older logs, if there are any. See
+// LogStorage.Find for details.
+func (app *App) QueryLogs(query LogQuery) ([]Applog, string, error) {
 	logsProvisioner, ok := Provisioner.(provision.OptionalLogsProvisioner)
 	if ok {
 		enabled, doc, err := logsProvisioner.LogsEnabled(app)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		if !enabled {
-			return nil, stderr.New(doc)
+			return nil, "", stderr.New(doc)
 		}
 	}
-	conn, err := db.LogConn()
+	logStorage, err := GetLogStorage()
 	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
-	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
-	if err != nil {
-		return nil, err
-	}
-	l := len(logs)
-	for i := 0; i < l/2; i++ {
-		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+		return nil, "", err
 	}
-	return logs, nil
+	return logStorage.Find(app.Name, query)
 }
 
 type Filter struct {
@@ -1392,6 +1594,11 @@ type Filter struct {
 	Pools       []string
 	Statuses    []string
 	Locked      bool
+	AutoScaled  bool
+	WithJobs    bool
+	Idle        bool
+	Asleep      bool
+	Labels      label.Labels
 	Extra       map[string][]string
 }
 
@@ -1437,6 +1644,26 @@ func (f *Filter) Query() bson.M {
 	if f.Locked {
 		query["lock.locked"] = true
 	}
+	if f.AutoScaled {
+		query["autoscale.0"] = bson.M{"$exists": true}
+	}
+	if f.Idle {
+		query["idlepolicy.timeout"] = bson.M{"$gt": 0}
+	}
+	if f.Asleep {
+		query["idlepolicy.asleep"] = true
+	}
+	var and []bson.M
+	if f.WithJobs {
+		and = append(and, bson.M{"$or": []bson.M{
+			{"jobs.0": bson.M{"$exists": true}},
+			{"declaredjobs.0": bson.M{"$exists": true}},
+		}})
+	}
+	and = append(and, f.Labels.Query("labels")...)
+	if len(and) > 0 {
+		query["$and"] = and
+	}
 	if len(f.Pools) > 0 {
 		query["pool"] = bson.M{"$in": f.Pools}
 	}
@@ -1475,6 +1702,9 @@ func List(filter *Filter) ([]App, error) {
 // Swap calls the Provisioner.Swap.
 // And updates the app.CName in the database.
 func Swap(app1, app2 *App, cnameOnly bool) error {
+	if len(app1.Routers) > 0 || len(app2.Routers) > 0 {
+		return router.ErrSwapMultipleRouters
+	}
 	err := Provisioner.Swap(app1, app2, cnameOnly)
 	if err != nil {
 		return err
@@ -1577,32 +1807,39 @@ type RebuildRoutesResult struct {
 	Removed []string
 }
 
+// RebuildRoutes reconciles the backend, cnames and routes of the app in every
+// router it's attached to with its routable units.
 func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
-	routerName, err := app.GetRouter()
+	names, err := app.GetRouters()
 	if err != nil {
 		return nil, err
 	}
-	r, err := router.Get(routerName)
-	if err != nil {
-		return nil, err
+	var result RebuildRoutesResult
+	for _, name := range names {
+		r, err := router.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		routerResult, err := app.rebuildRoutesIn(name, r)
+		if err != nil {
+			return nil, err
+		}
+		result.Added = append(result.Added, routerResult.Added...)
+		result.Removed = append(result.Removed, routerResult.Removed...)
 	}
-	err = r.AddBackend(app.Name)
+	return &result, nil
+}
+
+func (app *App) rebuildRoutesIn(routerName string, r router.Router) (*RebuildRoutesResult, error) {
+	err := r.AddBackend(app.Name)
 	if err != nil && err != router.ErrBackendExists {
 		return nil, err
 	}
-	var newAddr string
-	if newAddr, err = r.Addr(app.GetName()); err == nil && newAddr != app.Ip {
-		var conn *db.Storage
-		conn, err = db.Conn()
-		if err != nil {
-			return nil, err
-		}
-		defer conn.Close()
-		err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"ip": newAddr}})
+	if newAddr, err := r.Addr(app.GetName()); err == nil {
+		err = app.setRouterAddress(routerName, newAddr)
 		if err != nil {
 			return nil, err
 		}
-		app.Ip = newAddr
 	}
 	for _, cname := range app.CName {
 		err = r.SetCName(cname, app.Name)
@@ -1610,6 +1847,10 @@ func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
 			return nil, err
 		}
 	}
+	err = app.setCertificatesIn(r)
+	if err != nil {
+		return nil, err
+	}
 	oldRoutes, err := r.Routes(app.GetName())
 	if err != nil {
 		return nil, err
@@ -6,6 +6,7 @@ package app
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	stderr "errors"
 	"fmt"
@@ -14,14 +15,17 @@ import (
 	"net/url"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
@@ -326,6 +330,20 @@ func (s *S) TestCreateAppUserQuotaExceeded(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 }
 
+func (s *S) TestCreateAppTeamQuotaExceeded(c *check.C) {
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name}
+	s.conn.Teams().UpdateId(s.team.Name, bson.M{"$set": bson.M{"quota": auth.TeamQuota{
+		Memory: -1, CPUShare: -1, Apps: 0, ServiceInstances: -1,
+	}}})
+	defer s.conn.Teams().UpdateId(s.team.Name, bson.M{"$unset": bson.M{"quota": ""}})
+	err := CreateApp(&app, s.user)
+	e, ok := err.(*AppCreationError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Err, check.DeepEquals, &auth.TeamQuotaExceededError{
+		Team: s.team.Name, Resource: "apps", Requested: 1, Available: 0,
+	})
+}
+
 func (s *S) TestCreateAppTeamOwner(c *check.C) {
 	app := App{Name: "america", Platform: "python", TeamOwner: "tsuruteam"}
 	err := CreateApp(&app, s.user)
@@ -611,6 +629,26 @@ func (s *S) TestAddUnitsQuotaExceeded(c *check.C) {
 	c.Assert(units, check.HasLen, 0)
 }
 
+func (s *S) TestAddUnitsTeamQuotaExceeded(c *check.C) {
+	app := App{
+		Name: "warpaint", Platform: "ruby", TeamOwner: s.team.Name,
+		Plan:  Plan{Memory: 256, CpuShare: 2},
+		Quota: quota.Unlimited,
+	}
+	s.conn.Apps().Insert(app)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.conn.Teams().UpdateId(s.team.Name, bson.M{"$set": bson.M{"quota": auth.TeamQuota{
+		Memory: 512, CPUShare: -1, Apps: -1, ServiceInstances: -1,
+	}}})
+	defer s.conn.Teams().UpdateId(s.team.Name, bson.M{"$unset": bson.M{"quota": ""}})
+	err := app.AddUnits(3, "web", nil)
+	c.Assert(err, check.DeepEquals, &auth.TeamQuotaExceededError{
+		Team: s.team.Name, Resource: "memory", Requested: 768, Available: 512,
+	})
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, check.HasLen, 0)
+}
+
 func (s *S) TestAddUnitsMultiple(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "ruby",
@@ -1198,6 +1236,80 @@ func (s *S) TestSetEnvsWhenAppHaveNoUnits(c *check.C) {
 	c.Assert(s.provisioner.Restarts(&a, ""), check.Equals, 0)
 }
 
+func (s *S) TestSetEnvsEncryptsSecretVariables(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	a := App{Name: "myapp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs:       []bind.EnvVar{{Name: "API_TOKEN", Value: "s3cr3t", Public: true, Secret: true}},
+		PublicOnly: true,
+	}, &buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(buf.String(), "s3cr3t"), check.Equals, false)
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	env := newApp.Env["API_TOKEN"]
+	c.Assert(env.Public, check.Equals, false)
+	c.Assert(env.Secret, check.Equals, true)
+	c.Assert(secret.IsEncrypted(env.Value), check.Equals, true)
+	plain, err := secret.Decrypt(env.Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "s3cr3t")
+	err = newApp.UnsetEnvs(bind.UnsetEnvApp{VariableNames: []string{"API_TOKEN"}, PublicOnly: true}, nil)
+	c.Assert(err, check.IsNil)
+	newApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Env, check.HasLen, 0)
+}
+
+func (s *S) TestSetEnvsSecretVariablesWithoutKeys(c *check.C) {
+	a := App{Name: "myapp"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.setEnvsToApp(bind.SetEnvApp{
+		Envs: []bind.EnvVar{{Name: "API_TOKEN", Value: "s3cr3t", Secret: true}},
+	}, nil)
+	c.Assert(err, check.Equals, secret.ErrNoKeys)
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(newApp.Env, check.HasLen, 0)
+}
+
+func (s *S) TestRotateSecretEnvs(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	config.Set("secrets:keys:key2", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("b"), 32)))
+	defer config.Unset("secrets")
+	value, err := secret.Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Env: map[string]bind.EnvVar{
+		"API_TOKEN": {Name: "API_TOKEN", Value: value, Secret: true},
+		"HOST":      {Name: "HOST", Value: "localhost", Public: true},
+	}}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:current-key", "key2")
+	rotated, err := RotateSecretEnvs()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 1)
+	newApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	id, err := secret.KeyID(newApp.Env["API_TOKEN"].Value)
+	c.Assert(err, check.IsNil)
+	c.Assert(id, check.Equals, "key2")
+	c.Assert(newApp.Env["API_TOKEN"].Secret, check.Equals, true)
+	c.Assert(newApp.Env["HOST"].Value, check.Equals, "localhost")
+	rotated, err = RotateSecretEnvs()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
+
 func (s *S) TestUnsetEnvRespectsThePublicOnlyFlagKeepPrivateVariablesWhenItsTrue(c *check.C) {
 	a := App{
 		Name: "myapp",
@@ -1854,6 +1966,51 @@ func (s *S) TestAddInstanceWithUnits(c *check.C) {
 	c.Assert(s.provisioner.Restarts(a, ""), check.Equals, 1)
 }
 
+func (s *S) TestAddInstanceReplacesInstanceEnvs(c *check.C) {
+	a := &App{
+		Name:  "dark",
+		Quota: quota.Quota{Limit: 10},
+		Env: map[string]bind.EnvVar{
+			"DATABASE_USER":     {Name: "DATABASE_USER", Value: "old", InstanceName: "myinstance"},
+			"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "old", InstanceName: "myinstance"},
+			TsuruServicesEnvVar: {
+				Name:  TsuruServicesEnvVar,
+				Value: `{"mysql": [{"instance_name": "myinstance", "envs": {"DATABASE_USER": "old", "DATABASE_PASSWORD": "old"}}]}`,
+			},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(a)
+	defer s.provisioner.Destroy(a)
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	instance := bind.ServiceInstance{
+		Name: "myinstance",
+		Envs: map[string]string{"DATABASE_PASSWORD": "new"},
+	}
+	err = a.AddInstance(bind.InstanceApp{ServiceName: "mysql", Instance: instance, ShouldRestart: true}, nil)
+	c.Assert(err, check.IsNil)
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.parsedTsuruServices(), check.DeepEquals, map[string][]bind.ServiceInstance{"mysql": {instance}})
+	delete(a.Env, TsuruServicesEnvVar)
+	c.Assert(a.Env, check.DeepEquals, map[string]bind.EnvVar{
+		"DATABASE_PASSWORD": {Name: "DATABASE_PASSWORD", Value: "new", InstanceName: "myinstance"},
+	})
+	c.Assert(s.provisioner.Restarts(a, ""), check.Equals, 1)
+	instance.Envs = nil
+	err = a.AddInstance(bind.InstanceApp{ServiceName: "mysql", Instance: instance, ShouldRestart: true}, nil)
+	c.Assert(err, check.IsNil)
+	a, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.parsedTsuruServices(), check.DeepEquals, map[string][]bind.ServiceInstance{"mysql": {instance}})
+	delete(a.Env, TsuruServicesEnvVar)
+	c.Assert(a.Env, check.HasLen, 0)
+	c.Assert(s.provisioner.Restarts(a, ""), check.Equals, 2)
+}
+
 func (s *S) TestAddInstanceWithUnitsNoRestart(c *check.C) {
 	a := &App{Name: "dark", Quota: quota.Quota{Limit: 10}}
 	err := s.conn.Apps().Insert(a)
@@ -2590,6 +2747,7 @@ func (s *S) TestAppMarshalJSON(c *check.C) {
 		Description: "description",
 		Plan:        Plan{Name: "myplan", Memory: 64, Swap: 128, CpuShare: 100},
 		TeamOwner:   "myteam",
+		Labels:      label.Labels{"tier": "frontend"},
 	}
 	expected := map[string]interface{}{
 		"name":        "name",
@@ -2603,8 +2761,11 @@ func (s *S) TestAppMarshalJSON(c *check.C) {
 		"deploys":     float64(7),
 		"pool":        "test",
 		"description": "description",
+		"labels":      map[string]interface{}{"tier": "frontend"},
 		"teamowner":   "myteam",
 		"lock":        s.zeroLock,
+		"autoscale":   nil,
+		"jobs":        []interface{}{},
 		"plan": map[string]interface{}{
 			"name":     "myplan",
 			"memory":   float64(64),
@@ -2646,8 +2807,11 @@ func (s *S) TestAppMarshalJSONWithoutRepository(c *check.C) {
 		"deploys":     float64(7),
 		"pool":        "pool1",
 		"description": "description",
+		"labels":      nil,
 		"teamowner":   "myteam",
 		"lock":        s.zeroLock,
+		"autoscale":   nil,
+		"jobs":        []interface{}{},
 		"plan": map[string]interface{}{
 			"name":     "myplan",
 			"memory":   float64(64),
@@ -3087,6 +3251,74 @@ func (s *S) TestListFilteringByPool(c *check.C) {
 	c.Assert(apps[0].GetPool(), check.Equals, a2.Pool)
 }
 
+func (s *S) TestListFilteringByLabels(c *check.C) {
+	a := App{
+		Name:   "testapp",
+		Teams:  []string{s.team.Name},
+		Labels: label.Labels{"tier": "frontend", "tsuru.io/env": "prod"},
+	}
+	a2 := App{
+		Name:   "othertestapp",
+		Teams:  []string{s.team.Name},
+		Labels: label.Labels{"tier": "backend", "tsuru.io/env": "prod"},
+	}
+	err := s.conn.Apps().Insert(&a, &a2)
+	c.Assert(err, check.IsNil)
+	apps, err := List(&Filter{Labels: label.Labels{"tier": "frontend", "tsuru.io/env": "prod"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	c.Assert(apps[0].Name, check.Equals, a.Name)
+	c.Assert(apps[0].Labels, check.DeepEquals, a.Labels)
+	apps, err = List(&Filter{Labels: label.Labels{"tsuru.io/env": "prod"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 2)
+	apps, err = List(&Filter{Labels: label.Labels{"tsuru.io/env": "dev"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 0)
+}
+
+func (s *S) TestSetLabels(c *check.C) {
+	a := App{Name: "testapp", Labels: label.Labels{"tier": "frontend", "team": "admin"}}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	err = a.SetLabels(label.Labels{"tier": "backend", "tsuru.io/env": "prod"}, []string{"team"})
+	c.Assert(err, check.IsNil)
+	expected := label.Labels{"tier": "backend", "tsuru.io/env": "prod"}
+	c.Assert(a.Labels, check.DeepEquals, expected)
+	c.Assert(a.GetLabels(), check.DeepEquals, map[string]string(expected))
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Labels, check.DeepEquals, expected)
+	err = a.SetLabels(label.Labels{"tier": "back end"}, nil)
+	c.Assert(err, check.ErrorMatches, `invalid value for label "tier": "back end"`)
+	other := App{Name: "unknown"}
+	err = other.SetLabels(label.Labels{"tier": "backend"}, nil)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestSetNodeSelector(c *check.C) {
+	a := App{Name: "testapp"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	err = a.SetNodeSelector(label.Labels{"zone": "a", "disk": "ssd"})
+	c.Assert(err, check.IsNil)
+	c.Assert(a.NodeSelector, check.DeepEquals, label.Labels{"zone": "a", "disk": "ssd"})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.NodeSelector, check.DeepEquals, label.Labels{"zone": "a", "disk": "ssd"})
+	err = a.SetNodeSelector(label.Labels{"zone": "a b"})
+	c.Assert(err, check.ErrorMatches, `invalid value for label "zone": "a b"`)
+	err = a.SetNodeSelector(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.NodeSelector, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.NodeSelector, check.HasLen, 0)
+	other := App{Name: "unknown"}
+	err = other.SetNodeSelector(label.Labels{"zone": "a"})
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
 func (s *S) TestListFilteringByPools(c *check.C) {
 	opts := provision.AddPoolOptions{Name: "test2", Default: false}
 	err := provision.AddPool(opts)
@@ -3269,6 +3501,33 @@ func (s *S) TestSetQuotaInUseUnlimited(c *check.C) {
 
 }
 
+func (s *S) TestSetQuotaInUseTeamQuotaExceeded(c *check.C) {
+	app := App{
+		Name: "someapp", TeamOwner: s.team.Name,
+		Plan:  Plan{Memory: 256, CpuShare: 2},
+		Quota: quota.Quota{Limit: -1, InUse: 1},
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.conn.Teams().UpdateId(s.team.Name, bson.M{"$set": bson.M{"quota": auth.TeamQuota{
+		Memory: 512, CPUShare: -1, Apps: -1, ServiceInstances: -1,
+	}}})
+	defer s.conn.Teams().UpdateId(s.team.Name, bson.M{"$unset": bson.M{"quota": ""}})
+	err = app.SetQuotaInUse(3)
+	c.Assert(err, check.DeepEquals, &auth.TeamQuotaExceededError{
+		Team: s.team.Name, Resource: "memory", Requested: 512, Available: 256,
+	})
+	err = app.SetQuotaInUse(2)
+	c.Assert(err, check.IsNil)
+	a, err := GetByName(app.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.Quota.InUse, check.Equals, 2)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.QuotaReservations, check.HasLen, 0)
+}
+
 func (s *S) TestSetQuotaInUseInvalid(c *check.C) {
 	app := App{Name: "someapp", Quota: quota.Quota{Limit: 5, InUse: 3}}
 	err := app.SetQuotaInUse(6)
@@ -0,0 +1,56 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package apptest provides the test suite shared by the packages running
+// background routines over apps.
+package apptest
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+// Suite is a gocheck suite that runs each test with a clean database, a fake
+// provisioner and the fake router. Packages embed it in their own suite,
+// setting DBName.
+type Suite struct {
+	DBName      string
+	Conn        *db.Storage
+	Provisioner *provisiontest.FakeProvisioner
+}
+
+func (s *Suite) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", s.DBName)
+	config.Set("routers:fake:type", "fake")
+	config.Set("docker:router", "fake")
+	s.Provisioner = provisiontest.NewFakeProvisioner()
+	app.Provisioner = s.Provisioner
+}
+
+func (s *Suite) SetUpTest(c *check.C) {
+	var err error
+	s.Conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	err = dbtest.ClearAllCollections(s.Conn.Apps().Database)
+	c.Assert(err, check.IsNil)
+	s.Provisioner.Reset()
+	routertest.FakeRouter.Reset()
+}
+
+func (s *Suite) TearDownTest(c *check.C) {
+	s.Conn.Close()
+}
+
+func (s *Suite) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	AutoScaleMetricCPU    = "cpu"
+	AutoScaleMetricMemory = "memory"
+)
+
+var ErrAutoScalePolicyNotFound = errors.New("auto scale policy not found")
+
+type AutoScaleValidationError struct{ field string }
+
+func (e AutoScaleValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.field)
+}
+
+// AutoScalePolicy describes how the units of one process of an app must be
+// scaled based on its resource usage. The usage is compared to
+// TargetPercent: new units are added while the average usage is above it,
+// and removed while it's below it, always respecting MinUnits and MaxUnits.
+type AutoScalePolicy struct {
+	Process           string        `json:"process"`
+	MinUnits          uint          `json:"minUnits"`
+	MaxUnits          uint          `json:"maxUnits"`
+	Metric            string        `json:"metric"`
+	TargetPercent     float64       `json:"targetPercent"`
+	ScaleUpCooldown   time.Duration `json:"scaleUpCooldown"`
+	ScaleDownCooldown time.Duration `json:"scaleDownCooldown"`
+	LastScale         time.Time     `json:"lastScale"`
+}
+
+func (p *AutoScalePolicy) validate() error {
+	if p.Process == "" {
+		return AutoScaleValidationError{"process"}
+	}
+	if p.MinUnits == 0 {
+		return AutoScaleValidationError{"min units"}
+	}
+	if p.MaxUnits < p.MinUnits {
+		return AutoScaleValidationError{"max units"}
+	}
+	if p.Metric != AutoScaleMetricCPU && p.Metric != AutoScaleMetricMemory {
+		return AutoScaleValidationError{"metric"}
+	}
+	if p.TargetPercent <= 0 || p.TargetPercent > 100 {
+		return AutoScaleValidationError{"target percent"}
+	}
+	if p.ScaleUpCooldown < 0 {
+		return AutoScaleValidationError{"scale up cooldown"}
+	}
+	if p.ScaleDownCooldown < 0 {
+		return AutoScaleValidationError{"scale down cooldown"}
+	}
+	return nil
+}
+
+// GetAutoScalePolicy returns the auto scale policy for the given process.
+func (app *App) GetAutoScalePolicy(process string) (*AutoScalePolicy, error) {
+	for i := range app.AutoScale {
+		if app.AutoScale[i].Process == process {
+			return &app.AutoScale[i], nil
+		}
+	}
+	return nil, ErrAutoScalePolicyNotFound
+}
+
+// SetAutoScalePolicy validates and stores the given policy, replacing any
+// existing policy for the same process.
+func (app *App) SetAutoScalePolicy(policy AutoScalePolicy) error {
+	err := policy.validate()
+	if err != nil {
+		return err
+	}
+	policies := make([]AutoScalePolicy, 0, len(app.AutoScale)+1)
+	for _, p := range app.AutoScale {
+		if p.Process != policy.Process {
+			policies = append(policies, p)
+		}
+	}
+	policies = append(policies, policy)
+	err = app.updateAutoScale(policies)
+	if err != nil {
+		return err
+	}
+	app.AutoScale = policies
+	return nil
+}
+
+// RemoveAutoScalePolicy removes the auto scale policy for the given process.
+func (app *App) RemoveAutoScalePolicy(process string) error {
+	var policies []AutoScalePolicy
+	for _, p := range app.AutoScale {
+		if p.Process != process {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == len(app.AutoScale) {
+		return ErrAutoScalePolicyNotFound
+	}
+	err := app.updateAutoScale(policies)
+	if err != nil {
+		return err
+	}
+	app.AutoScale = policies
+	return nil
+}
+
+// SetAutoScaleLastScale records the last time the units of the given process
+// were scaled, it's used to enforce the policy cooldowns.
+func (app *App) SetAutoScaleLastScale(process string, t time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "autoscale.process": process},
+		bson.M{"$set": bson.M{"autoscale.$.lastscale": t}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrAutoScalePolicyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if policy, _ := app.GetAutoScalePolicy(process); policy != nil {
+		policy.LastScale = t
+	}
+	return nil
+}
+
+func (app *App) updateAutoScale(policies []AutoScalePolicy) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"autoscale": policies}})
+}
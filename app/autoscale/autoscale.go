@@ -0,0 +1,275 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autoscale periodically evaluates the auto scale policies of apps,
+// adding or removing units according to the resource usage reported by a
+// MetricsSource.
+package autoscale
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+const (
+	eventOwner = "autoscale"
+
+	// tolerance is the ratio around the target usage in which no scaling
+	// happens, avoiding flapping when the usage is close to the target.
+	tolerance = 0.1
+)
+
+var ErrNoMetrics = errors.New("no metrics available")
+
+// Usage is the average resource usage of the units of a process, as a
+// percentage of the limits available to them.
+type Usage struct {
+	CPUPercent    float64
+	MemoryPercent float64
+}
+
+// MetricsSource is the source of usage information used when evaluating
+// auto scale policies.
+type MetricsSource interface {
+	Usage(a *app.App, process string) (*Usage, error)
+}
+
+// ProvisionerSource is a MetricsSource that reads usage from the app
+// provisioner, it requires the provisioner to implement
+// provision.MetricsProvisioner.
+type ProvisionerSource struct{}
+
+func (ProvisionerSource) Usage(a *app.App, process string) (*Usage, error) {
+	metricsProv, ok := app.Provisioner.(provision.MetricsProvisioner)
+	if !ok {
+		return nil, errors.New("provisioner does not support unit metrics")
+	}
+	metrics, err := metricsProv.UnitsMetrics(a, process)
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics) == 0 {
+		return nil, ErrNoMetrics
+	}
+	var usage Usage
+	for _, m := range metrics {
+		usage.CPUPercent += m.CPUPercent
+		usage.MemoryPercent += m.MemoryPercent
+	}
+	usage.CPUPercent /= float64(len(metrics))
+	usage.MemoryPercent /= float64(len(metrics))
+	return &usage, nil
+}
+
+// Config holds the settings for the auto scale worker. It must be created
+// using NewConfig or have every field filled.
+type Config struct {
+	RunInterval time.Duration
+	Source      MetricsSource
+	leader      *leader.Lease
+	done        chan bool
+}
+
+// NewConfig creates a new auto scale worker configuration reading its
+// settings from the "autoscale" section in tsuru.conf.
+func NewConfig(source MetricsSource) *Config {
+	runInterval, _ := config.GetInt("autoscale:run-interval")
+	if runInterval <= 0 {
+		runInterval = 60
+	}
+	interval := time.Duration(runInterval) * time.Second
+	return &Config{
+		RunInterval: interval,
+		Source:      source,
+		leader:      leader.NewLease("app-autoscale", 2*interval),
+		done:        make(chan bool),
+	}
+}
+
+// Initialize starts the auto scale worker if it's enabled in tsuru.conf. The
+// returned Config can be used to stop it.
+func Initialize() *Config {
+	if enabled, _ := config.GetBool("autoscale:enabled"); !enabled {
+		return nil
+	}
+	cfg := NewConfig(ProvisionerSource{})
+	go cfg.run()
+	return cfg
+}
+
+func (c *Config) run() {
+	for {
+		err := c.RunOnce()
+		if err != nil {
+			log.Errorf("[app autoscale] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.RunInterval):
+		}
+	}
+}
+
+func (c *Config) Shutdown() {
+	c.done <- true
+}
+
+func (c *Config) String() string {
+	return "app auto scale"
+}
+
+// RunOnce evaluates the auto scale policies of every app once. Only one tsuru
+// API instance is allowed to act at a time, the others skip the run while a
+// leader is active.
+func (c *Config) RunOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	isLeader, err := c.leader.Acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire leadership: %s", err)
+	}
+	if !isLeader {
+		log.Debugf("[app autoscale] skipping run, another instance is the leader")
+		return nil
+	}
+	apps, err := app.List(&app.Filter{AutoScaled: true})
+	if err != nil {
+		return fmt.Errorf("unable to list apps: %s", err)
+	}
+	for i := range apps {
+		a := &apps[i]
+		for _, policy := range a.AutoScale {
+			err = c.scaleProcess(a, policy)
+			if err != nil {
+				log.Errorf("[app autoscale] error scaling %s[%s]: %s", a.Name, policy.Process, err)
+			}
+		}
+	}
+	return nil
+}
+
+type decision struct {
+	Process       string
+	Metric        string
+	Usage         float64
+	TargetPercent float64
+	CurrentUnits  int
+	DesiredUnits  int
+}
+
+func (c *Config) scaleProcess(a *app.App, policy app.AutoScalePolicy) error {
+	units, err := a.Units()
+	if err != nil {
+		return err
+	}
+	var current int
+	for _, u := range units {
+		if u.ProcessName == policy.Process {
+			current++
+		}
+	}
+	if current == 0 {
+		log.Debugf("[app autoscale] skipping %s[%s], no units running", a.Name, policy.Process)
+		return nil
+	}
+	usage, err := c.Source.Usage(a, policy.Process)
+	if err != nil {
+		return err
+	}
+	value := usage.CPUPercent
+	if policy.Metric == app.AutoScaleMetricMemory {
+		value = usage.MemoryPercent
+	}
+	desired := desiredUnits(current, value, &policy)
+	if desired == current {
+		return nil
+	}
+	now := time.Now().UTC()
+	cooldown := policy.ScaleUpCooldown
+	if desired < current {
+		cooldown = policy.ScaleDownCooldown
+	}
+	if now.Before(policy.LastScale.Add(cooldown)) {
+		log.Debugf("[app autoscale] skipping %s[%s], in cooldown until %s", a.Name, policy.Process, policy.LastScale.Add(cooldown))
+		return nil
+	}
+	kind := permission.PermAppUpdateUnitAdd
+	if desired < current {
+		kind = permission.PermAppUpdateUnitRemove
+	}
+	data := decision{
+		Process:       policy.Process,
+		Metric:        policy.Metric,
+		Usage:         value,
+		TargetPercent: policy.TargetPercent,
+		CurrentUnits:  current,
+		DesiredUnits:  desired,
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Name: "app", Value: a.Name},
+		Kind:       kind,
+		Owner:      eventOwner,
+		CustomData: data,
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[app autoscale] skipping %s[%s]: %s", a.Name, policy.Process, err)
+			return nil
+		}
+		return err
+	}
+	defer func() { evt.DoneCustomData(err, data) }()
+	locked, err := app.AcquireApplicationLock(a.Name, eventOwner, "auto scale")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		err = fmt.Errorf("unable to lock app %s", a.Name)
+		return err
+	}
+	defer app.ReleaseApplicationLock(a.Name)
+	evt.Logf("%s usage for process %q is %.2f%% (target %.2f%%), scaling from %d to %d units",
+		policy.Metric, policy.Process, value, policy.TargetPercent, current, desired)
+	if desired > current {
+		err = a.AddUnits(uint(desired-current), policy.Process, evt)
+	} else {
+		err = a.RemoveUnits(uint(current-desired), policy.Process, evt)
+	}
+	if err != nil {
+		return err
+	}
+	err = a.SetAutoScaleLastScale(policy.Process, now)
+	return err
+}
+
+// desiredUnits returns the number of units needed to bring the usage of the
+// process close to the policy target, bounded by the policy limits.
+func desiredUnits(current int, usage float64, policy *app.AutoScalePolicy) int {
+	desired := current
+	ratio := usage / policy.TargetPercent
+	if math.Abs(ratio-1) > tolerance {
+		desired = int(math.Ceil(float64(current) * ratio))
+	}
+	if desired < int(policy.MinUnits) {
+		desired = int(policy.MinUnits)
+	}
+	if desired > int(policy.MaxUnits) {
+		desired = int(policy.MaxUnits)
+	}
+	return desired
+}
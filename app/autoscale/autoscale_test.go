@@ -0,0 +1,179 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/autoscale"
+	"github.com/tsuru/tsuru/app/autoscale/autoscaletest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newApp(c *check.C, units uint, policy app.AutoScalePolicy) *app.App {
+	a := app.App{Name: "myapp", Quota: quota.Unlimited}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	if units > 0 {
+		_, err = s.Provisioner.AddUnits(&a, units, policy.Process, nil)
+		c.Assert(err, check.IsNil)
+	}
+	err = a.SetAutoScalePolicy(policy)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) newConfig() (*autoscale.Config, *autoscaletest.FakeMetricsSource) {
+	source := autoscaletest.NewFakeMetricsSource()
+	return autoscale.NewConfig(source), source
+}
+
+func (s *S) TestRunOnceScaleUp(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 90})
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   "app.update.unit.add",
+		Owner:  "autoscale",
+		EndCustomData: map[string]interface{}{
+			"process":      "web",
+			"currentunits": 2,
+			"desiredunits": 4,
+		},
+		LogMatches: `(?s).*scaling from 2 to 4 units.*`,
+	}, eventtest.HasEvent)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale[0].LastScale.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestRunOnceScaleDown(c *check.C) {
+	a := s.newApp(c, 4, app.AutoScalePolicy{
+		Process: "web", MinUnits: 3, MaxUnits: 10, Metric: app.AutoScaleMetricMemory, TargetPercent: 80,
+	})
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 90, MemoryPercent: 10})
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 3)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   "app.update.unit.remove",
+		Owner:  "autoscale",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunOnceWithinTolerance(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 53})
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceRespectsCooldown(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+		ScaleUpCooldown: time.Hour,
+	})
+	err := a.SetAutoScaleLastScale("web", time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 100})
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceSkipsAppsWithoutUnits(c *check.C) {
+	a := s.newApp(c, 0, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 100})
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceMetricsError(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	cfg, source := s.newConfig()
+	source.PrepareFailure(errors.New("metrics are down"))
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceEventLocked(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  "someone",
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	cfg, source := s.newConfig()
+	source.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 100})
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestRunOnceOnlyLeaderActs(c *check.C) {
+	a := s.newApp(c, 2, app.AutoScalePolicy{
+		Process: "web", MinUnits: 1, MaxUnits: 10, Metric: app.AutoScaleMetricCPU, TargetPercent: 50,
+	})
+	leaderCfg, leaderSource := s.newConfig()
+	leaderSource.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 50})
+	err := leaderCfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	otherCfg, otherSource := s.newConfig()
+	otherSource.SetUsage(a.Name, "web", autoscale.Usage{CPUPercent: 100})
+	err = otherCfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autoscaletest provides an in-memory metrics source for testing
+// auto scale policies without a real provisioner.
+package autoscaletest
+
+import (
+	"sync"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/autoscale"
+)
+
+type FakeMetricsSource struct {
+	mut   sync.Mutex
+	usage map[string]autoscale.Usage
+	err   error
+}
+
+func NewFakeMetricsSource() *FakeMetricsSource {
+	return &FakeMetricsSource{usage: make(map[string]autoscale.Usage)}
+}
+
+// SetUsage sets the usage returned for the given app and process.
+func (s *FakeMetricsSource) SetUsage(appName, process string, usage autoscale.Usage) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.usage[appName+"/"+process] = usage
+}
+
+// PrepareFailure makes every call to Usage fail with the given error.
+func (s *FakeMetricsSource) PrepareFailure(err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.err = err
+}
+
+func (s *FakeMetricsSource) Reset() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.usage = make(map[string]autoscale.Usage)
+	s.err = nil
+}
+
+func (s *FakeMetricsSource) Usage(a *app.App, process string) (*autoscale.Usage, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	usage, ok := s.usage[a.Name+"/"+process]
+	if !ok {
+		return nil, autoscale.ErrNoMetrics
+	}
+	return &usage, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/tsuru/tsuru/app"
+	"gopkg.in/check.v1"
+)
+
+type InternalSuite struct{}
+
+var _ = check.Suite(&InternalSuite{})
+
+func (s *InternalSuite) TestDesiredUnits(c *check.C) {
+	policy := &app.AutoScalePolicy{MinUnits: 2, MaxUnits: 8, TargetPercent: 50}
+	tests := []struct {
+		current  int
+		usage    float64
+		expected int
+	}{
+		{4, 50, 4},
+		{4, 54, 4},
+		{4, 46, 4},
+		{4, 100, 8},
+		{4, 75, 6},
+		{4, 200, 8},
+		{4, 25, 2},
+		{4, 0, 2},
+		{1, 50, 2},
+	}
+	for _, t := range tests {
+		c.Check(desiredUnits(t.current, t.usage, policy), check.Equals, t.expected, check.Commentf("%d units at %.0f%%", t.current, t.usage))
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetAutoScalePolicy(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	policy := AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, Metric: AutoScaleMetricCPU, TargetPercent: 70}
+	err = a.SetAutoScalePolicy(policy)
+	c.Assert(err, check.IsNil)
+	policy.MaxUnits = 10
+	err = a.SetAutoScalePolicy(policy)
+	c.Assert(err, check.IsNil)
+	worker := AutoScalePolicy{Process: "worker", MinUnits: 2, MaxUnits: 3, Metric: AutoScaleMetricMemory, TargetPercent: 50}
+	err = a.SetAutoScalePolicy(worker)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.DeepEquals, []AutoScalePolicy{policy, worker})
+	c.Assert(a.AutoScale, check.DeepEquals, dbApp.AutoScale)
+	apps, err := List(&Filter{AutoScaled: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+}
+
+func (s *S) TestSetAutoScalePolicyValidation(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		policy AutoScalePolicy
+		err    string
+	}{
+		{AutoScalePolicy{MinUnits: 1, MaxUnits: 1, Metric: "cpu", TargetPercent: 50}, "invalid value for process"},
+		{AutoScalePolicy{Process: "web", MaxUnits: 1, Metric: "cpu", TargetPercent: 50}, "invalid value for min units"},
+		{AutoScalePolicy{Process: "web", MinUnits: 2, MaxUnits: 1, Metric: "cpu", TargetPercent: 50}, "invalid value for max units"},
+		{AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 1, Metric: "disk", TargetPercent: 50}, "invalid value for metric"},
+		{AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 1, Metric: "cpu", TargetPercent: 150}, "invalid value for target percent"},
+		{AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 1, Metric: "cpu", TargetPercent: 50, ScaleUpCooldown: -1}, "invalid value for scale up cooldown"},
+	}
+	for _, t := range tests {
+		err = a.SetAutoScalePolicy(t.policy)
+		c.Assert(err, check.ErrorMatches, t.err)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveAutoScalePolicy(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, Metric: AutoScaleMetricCPU, TargetPercent: 70})
+	c.Assert(err, check.IsNil)
+	err = a.RemoveAutoScalePolicy("worker")
+	c.Assert(err, check.Equals, ErrAutoScalePolicyNotFound)
+	err = a.RemoveAutoScalePolicy("web")
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale, check.HasLen, 0)
+}
+
+func (s *S) TestSetAutoScaleLastScale(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.SetAutoScalePolicy(AutoScalePolicy{Process: "web", MinUnits: 1, MaxUnits: 5, Metric: AutoScaleMetricCPU, TargetPercent: 70})
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	err = a.SetAutoScaleLastScale("web", now)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoScale[0].LastScale.Equal(now), check.Equals, true)
+	err = a.SetAutoScaleLastScale("worker", now)
+	c.Assert(err, check.Equals, ErrAutoScalePolicyNotFound)
+}
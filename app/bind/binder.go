@@ -8,11 +8,13 @@ package bind
 
 import "io"
 
-// EnvVar represents a environment variable for an app.
+// EnvVar represents a environment variable for an app. The value of secret
+// variables is stored encrypted.
 type EnvVar struct {
 	Name         string `json:"name"`
 	Value        string `json:"value"`
 	Public       bool   `json:"public"`
+	Secret       bool   `json:"secret,omitempty"`
 	InstanceName string `json:"-"`
 }
 
@@ -57,6 +59,9 @@ type SetEnvApp struct {
 	Envs          []EnvVar
 	PublicOnly    bool
 	ShouldRestart bool
+	// UnsetVariableNames are removed from the app in the same write that
+	// sets Envs.
+	UnsetVariableNames []string
 }
 
 type UnsetEnvApp struct {
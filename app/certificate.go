@@ -0,0 +1,273 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultCertificateExpirationWarning = 30 * 24 * time.Hour
+
+var (
+	ErrCertificateNotFound = errors.New("certificate not found")
+	ErrTLSNotSupported     = errors.New("none of the routers of the app support TLS certificates")
+)
+
+type CertificateValidationError struct{ msg string }
+
+func (e CertificateValidationError) Error() string {
+	return e.msg
+}
+
+// Certificate is a TLS certificate used by the routers of the app for one of
+// its cnames. The private key is stored encrypted.
+type Certificate struct {
+	CName       string    `json:"cname"`
+	Certificate string    `json:"certificate"`
+	Key         string    `json:"-"`
+	Expiration  time.Time `json:"expiration"`
+}
+
+// parseCertificate checks that the PEM encoded certificate matches the key,
+// is valid for the cname and is not expired, returning the certificate.
+func parseCertificate(cname, certificate, key string, now time.Time) (*x509.Certificate, error) {
+	pair, err := tls.X509KeyPair([]byte(certificate), []byte(key))
+	if err != nil {
+		return nil, CertificateValidationError{fmt.Sprintf("invalid certificate or key: %s", err)}
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, CertificateValidationError{fmt.Sprintf("invalid certificate: %s", err)}
+	}
+	if err = cert.VerifyHostname(cname); err != nil {
+		return nil, CertificateValidationError{err.Error()}
+	}
+	if now.Before(cert.NotBefore) {
+		return nil, CertificateValidationError{fmt.Sprintf("certificate is not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))}
+	}
+	if !now.Before(cert.NotAfter) {
+		return nil, CertificateValidationError{fmt.Sprintf("certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))}
+	}
+	return cert, nil
+}
+
+// tlsRouters returns the routers of the app able to use TLS certificates.
+func (app *App) tlsRouters() ([]router.TLSRouter, error) {
+	names, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	var routers []router.TLSRouter
+	for _, name := range names {
+		r, err := router.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if tlsRouter, ok := r.(router.TLSRouter); ok {
+			routers = append(routers, tlsRouter)
+		}
+	}
+	if len(routers) == 0 {
+		return nil, ErrTLSNotSupported
+	}
+	return routers, nil
+}
+
+// SetCertificate validates the PEM encoded certificate and key for one of the
+// cnames of the app and sets them in every router of the app supporting TLS,
+// replacing any previous certificate of the cname.
+func (app *App) SetCertificate(cname, certificate, key string) error {
+	if !app.hasCName(cname) {
+		return CertificateValidationError{fmt.Sprintf("cname %q is not set in the app", cname)}
+	}
+	cert, err := parseCertificate(cname, certificate, key, time.Now())
+	if err != nil {
+		return err
+	}
+	if !secret.Enabled() {
+		return secret.ErrNoKeys
+	}
+	encryptedKey, err := secret.Encrypt(key)
+	if err != nil {
+		return err
+	}
+	routers, err := app.tlsRouters()
+	if err != nil {
+		return err
+	}
+	for _, r := range routers {
+		err = r.AddCertificate(cname, certificate, key)
+		if err != nil {
+			return err
+		}
+	}
+	stored := Certificate{
+		CName:       cname,
+		Certificate: certificate,
+		Key:         encryptedKey,
+		Expiration:  cert.NotAfter.UTC(),
+	}
+	certificates := []Certificate{stored}
+	for _, c := range app.Certificates {
+		if c.CName != cname {
+			certificates = append(certificates, c)
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"certificates": certificates}})
+	if err != nil {
+		return err
+	}
+	app.Certificates = certificates
+	return nil
+}
+
+// RemoveCertificate removes the certificate of the cname from the app and
+// from its routers.
+func (app *App) RemoveCertificate(cname string) error {
+	index := -1
+	for i, c := range app.Certificates {
+		if c.CName == cname {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrCertificateNotFound
+	}
+	routers, err := app.tlsRouters()
+	if err != nil && err != ErrTLSNotSupported {
+		return err
+	}
+	for _, r := range routers {
+		err = r.RemoveCertificate(cname)
+		if err != nil && err != router.ErrCertificateNotFound {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"certificates": bson.M{"cname": cname}}})
+	if err != nil {
+		return err
+	}
+	app.Certificates = append(app.Certificates[:index], app.Certificates[index+1:]...)
+	return nil
+}
+
+// RotateCertificateKeys encrypts the certificate keys of all apps again, using
+// the current secret key. It returns the number of keys that were encrypted
+// with older keys.
+func RotateCertificateKeys() (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{"certificates": bson.M{"$exists": true}}).Select(bson.M{"name": 1, "certificates": 1}).All(&apps)
+	if err != nil {
+		return 0, err
+	}
+	var rotated int
+	for _, a := range apps {
+		update := bson.M{}
+		for i, c := range a.Certificates {
+			key, changed, err := secret.Rotate(c.Key)
+			if err != nil {
+				return rotated, fmt.Errorf("unable to rotate certificate key of cname %s of app %s: %s", c.CName, a.Name, err)
+			}
+			if changed {
+				update[fmt.Sprintf("certificates.%d.key", i)] = key
+			}
+		}
+		if len(update) == 0 {
+			continue
+		}
+		err = conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": update})
+		if err != nil {
+			return rotated, err
+		}
+		rotated += len(update)
+	}
+	return rotated, nil
+}
+
+// setCertificatesIn sets the certificates of the app in the router, if it
+// supports TLS.
+func (app *App) setCertificatesIn(r router.Router) error {
+	tlsRouter, ok := r.(router.TLSRouter)
+	if !ok {
+		return nil
+	}
+	for _, c := range app.Certificates {
+		key, err := secret.Decrypt(c.Key)
+		if err != nil {
+			return err
+		}
+		err = tlsRouter.AddCertificate(c.CName, c.Certificate, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCNamesCertificates removes the certificates of the given cnames,
+// called when the cnames are removed from the app.
+func (app *App) removeCNamesCertificates(cnames []string) {
+	for _, cname := range cnames {
+		err := app.RemoveCertificate(cname)
+		if err != nil && err != ErrCertificateNotFound {
+			log.Errorf("[certificates] unable to remove certificate of cname %s from app %s: %s", cname, app.Name, err)
+		}
+	}
+}
+
+// CertificateWarnings returns a warning for each certificate of the app that
+// is expired or expires within the period defined by
+// "certificates:expiration-warning" in tsuru.conf, in days (defaults to 30).
+func (app *App) CertificateWarnings(now time.Time) []string {
+	period := defaultCertificateExpirationWarning
+	if days, err := config.GetInt("certificates:expiration-warning"); err == nil {
+		period = time.Duration(days) * 24 * time.Hour
+	}
+	var warnings []string
+	for _, c := range app.Certificates {
+		if !now.Before(c.Expiration) {
+			warnings = append(warnings, fmt.Sprintf("certificate of cname %s expired at %s", c.CName, c.Expiration.UTC().Format(time.RFC3339)))
+		} else if c.Expiration.Sub(now) <= period {
+			warnings = append(warnings, fmt.Sprintf("certificate of cname %s expires at %s", c.CName, c.Expiration.UTC().Format(time.RFC3339)))
+		}
+	}
+	return warnings
+}
+
+func (app *App) hasCName(cname string) bool {
+	for _, c := range app.CName {
+		if c == cname {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) enableSecrets() {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+}
+
+func (s *S) TestSetCertificate(c *check.C) {
+	s.enableSecrets()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	expiration := time.Now().Add(90 * 24 * time.Hour).UTC().Truncate(time.Second)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", expiration)
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, cert)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 1)
+	c.Assert(dbApp.Certificates[0].CName, check.Equals, "myapp.example.com")
+	c.Assert(dbApp.Certificates[0].Certificate, check.Equals, cert)
+	c.Assert(dbApp.Certificates[0].Expiration.Equal(expiration), check.Equals, true)
+	c.Assert(secret.IsEncrypted(dbApp.Certificates[0].Key), check.Equals, true)
+	decrypted, err := secret.Decrypt(dbApp.Certificates[0].Key)
+	c.Assert(err, check.IsNil)
+	c.Assert(decrypted, check.Equals, key)
+}
+
+func (s *S) TestSetCertificateInvalid(c *check.C) {
+	s.enableSecrets()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("other.example.com", cert, key)
+	c.Assert(err, check.ErrorMatches, `cname "other.example.com" is not set in the app`)
+	otherCert, _, err := routertest.NewCertificate("other.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", otherCert, key)
+	c.Assert(err, check.ErrorMatches, "invalid certificate or key: .*")
+	otherCert, otherKey, err := routertest.NewCertificate("other.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", otherCert, otherKey)
+	c.Assert(err, check.ErrorMatches, "x509: certificate is valid for other.example.com, not myapp.example.com")
+	expiredCert, expiredKey, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(-time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", expiredCert, expiredKey)
+	c.Assert(err, check.ErrorMatches, "certificate expired at .*")
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, "")
+}
+
+func (s *S) TestSetCertificateSecretsDisabled(c *check.C) {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.Equals, secret.ErrNoKeys)
+}
+
+func (s *S) TestRemoveCertificate(c *check.C) {
+	s.enableSecrets()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveCertificate("myapp.example.com")
+	c.Assert(err, check.Equals, ErrCertificateNotFound)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveCertificate("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, "")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveCNameRemovesCertificate(c *check.C) {
+	s.enableSecrets()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveCName("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.Certificate("myapp.example.com"), check.Equals, "")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Certificates, check.HasLen, 0)
+}
+
+func (s *S) TestRotateCertificateKeys(c *check.C) {
+	s.enableSecrets()
+	defer config.Unset("secrets")
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = a.SetCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:current-key", "key2")
+	config.Set("secrets:keys:key2", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("b"), 32)))
+	rotated, err := RotateCertificateKeys()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 1)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	id, err := secret.KeyID(dbApp.Certificates[0].Key)
+	c.Assert(err, check.IsNil)
+	c.Assert(id, check.Equals, "key2")
+	decrypted, err := secret.Decrypt(dbApp.Certificates[0].Key)
+	c.Assert(err, check.IsNil)
+	c.Assert(decrypted, check.Equals, key)
+	rotated, err = RotateCertificateKeys()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
+
+func (s *S) TestCertificateWarnings(c *check.C) {
+	now := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	a := App{Name: "myapp", Certificates: []Certificate{
+		{CName: "expired.example.com", Expiration: now.Add(-time.Hour)},
+		{CName: "soon.example.com", Expiration: now.Add(10 * 24 * time.Hour)},
+		{CName: "later.example.com", Expiration: now.Add(60 * 24 * time.Hour)},
+	}}
+	c.Assert(a.CertificateWarnings(now), check.DeepEquals, []string{
+		"certificate of cname expired.example.com expired at 2016-09-30T23:00:00Z",
+		"certificate of cname soon.example.com expires at 2016-10-11T00:00:00Z",
+	})
+	config.Set("certificates:expiration-warning", 90)
+	defer config.Unset("certificates")
+	c.Assert(a.CertificateWarnings(now), check.HasLen, 3)
+}
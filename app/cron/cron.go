@@ -0,0 +1,221 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cron parses cron expressions, used to describe the schedule of app
+// jobs, and calculates their activation times.
+//
+// Expressions have five fields: minute, hour, day of month, month and day of
+// week. Each field accepts "*", single values, ranges ("1-5"), lists
+// ("1,15") and steps ("*/10" or "0-30/5"). Months and days of week also
+// accept the first three letters of their English names. The macros
+// @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are
+// supported as well.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type bounds struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{name: "minute", min: 0, max: 59}
+	hourBounds   = bounds{name: "hour", min: 0, max: 23}
+	domBounds    = bounds{name: "day of month", min: 1, max: 31}
+	monthBounds  = bounds{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// maxYears is how far in the future Next looks for an activation time before
+// giving up, protecting against expressions that never match, like
+// "0 0 30 2 *".
+const maxYears = 5
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// anyDay is true when either the day of month or the day of week is
+	// unrestricted, in which case both must match. Otherwise matching any of
+	// them is enough, as in the traditional cron.
+	anyDay bool
+}
+
+// Parse parses the cron expression, returning an error if it's invalid.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := macros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("invalid cron expression %q: unknown macro", expr)
+		}
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	s := Schedule{expr: expr}
+	var err error
+	parsers := []struct {
+		field  string
+		b      bounds
+		target *uint64
+	}{
+		{fields[0], minuteBounds, &s.minute},
+		{fields[1], hourBounds, &s.hour},
+		{fields[2], domBounds, &s.dom},
+		{fields[3], monthBounds, &s.month},
+		{fields[4], dowBounds, &s.dow},
+	}
+	for _, p := range parsers {
+		*p.target, err = parseField(p.field, p.b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %s", expr, err)
+		}
+	}
+	// Sunday may be written both as 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+		s.dow &^= 1 << 7
+	}
+	s.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		value, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= value
+	}
+	return bits, nil
+}
+
+func parseRange(part string, b bounds) (uint64, error) {
+	step := uint(1)
+	rangeExpr := part
+	if i := strings.Index(part, "/"); i >= 0 {
+		n, err := strconv.ParseUint(part[i+1:], 10, 8)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("invalid step in %s field: %q", b.name, part)
+		}
+		step = uint(n)
+		rangeExpr = part[:i]
+	}
+	var start, end uint
+	switch {
+	case rangeExpr == "*":
+		start, end = b.min, b.max
+	case strings.Contains(rangeExpr, "-"):
+		limits := strings.SplitN(rangeExpr, "-", 2)
+		var err error
+		if start, err = parseValue(limits[0], b); err != nil {
+			return 0, err
+		}
+		if end, err = parseValue(limits[1], b); err != nil {
+			return 0, err
+		}
+		if end < start {
+			return 0, fmt.Errorf("invalid range in %s field: %q", b.name, part)
+		}
+	default:
+		var err error
+		if start, err = parseValue(rangeExpr, b); err != nil {
+			return 0, err
+		}
+		end = start
+		if step > 1 {
+			end = b.max
+		}
+	}
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	if n, ok := b.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("invalid value in %s field: %q", b.name, value)
+	}
+	return uint(n), nil
+}
+
+// String returns the expression used to create the schedule.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDay {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation time of the schedule after t, using the
+// location of t. The zero time is returned if the schedule doesn't activate
+// in the next years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(maxYears, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func date(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (s *S) TestParseInvalid(c *check.C) {
+	exprs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@every-day",
+	}
+	for _, expr := range exprs {
+		_, err := Parse(expr)
+		c.Check(err, check.NotNil, check.Commentf("expression %q", expr))
+	}
+}
+
+func (s *S) TestNext(c *check.C) {
+	tests := []struct {
+		expr     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2016-03-10 10:15", "2016-03-10 10:16"},
+		{"*/15 * * * *", "2016-03-10 10:15", "2016-03-10 10:30"},
+		{"5/20 * * * *", "2016-03-10 10:30", "2016-03-10 10:45"},
+		{"0 * * * *", "2016-03-10 10:15", "2016-03-10 11:00"},
+		{"30 2 * * *", "2016-03-10 10:15", "2016-03-11 02:30"},
+		{"0 0 1 * *", "2016-12-10 10:15", "2017-01-01 00:00"},
+		{"0 9-17/4 * * *", "2016-03-10 13:00", "2016-03-10 17:00"},
+		{"0 0 * * mon", "2016-03-10 10:15", "2016-03-14 00:00"},
+		{"0 0 * * 7", "2016-03-10 10:15", "2016-03-13 00:00"},
+		{"0 0 * jun,aug *", "2016-03-10 10:15", "2016-06-01 00:00"},
+		{"0 0 29 2 *", "2016-03-10 10:15", "2020-02-29 00:00"},
+		{"0 0 13 * 5", "2016-03-10 10:15", "2016-03-11 00:00"},
+		{"@hourly", "2016-03-10 10:15", "2016-03-10 11:00"},
+		{"@daily", "2016-03-10 10:15", "2016-03-11 00:00"},
+		{"@weekly", "2016-03-10 10:15", "2016-03-13 00:00"},
+		{"@monthly", "2016-03-10 10:15", "2016-04-01 00:00"},
+		{"@yearly", "2016-03-10 10:15", "2017-01-01 00:00"},
+	}
+	for _, t := range tests {
+		schedule, err := Parse(t.expr)
+		c.Assert(err, check.IsNil, check.Commentf("expression %q", t.expr))
+		next := schedule.Next(date(t.from))
+		c.Check(next, check.DeepEquals, date(t.expected), check.Commentf("expression %q", t.expr))
+	}
+}
+
+func (s *S) TestNextIgnoresSeconds(c *check.C) {
+	schedule, err := Parse("* * * * *")
+	c.Assert(err, check.IsNil)
+	from := date("2016-03-10 10:15").Add(59 * time.Second)
+	c.Assert(schedule.Next(from), check.DeepEquals, date("2016-03-10 10:16"))
+}
+
+func (s *S) TestNextNeverActivates(c *check.C) {
+	schedule, err := Parse("0 0 30 2 *")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.Next(date("2016-03-10 10:15")).IsZero(), check.Equals, true)
+}
+
+func (s *S) TestString(c *check.C) {
+	schedule, err := Parse("@daily")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.String(), check.Equals, "@daily")
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/tsuru/tsuru/db"
@@ -43,6 +44,7 @@ type DeployData struct {
 	CanRollback bool
 	RemoveDate  time.Time `bson:",omitempty"`
 	Diff        string
+	Hooks       []provision.DeployHookResult `bson:",omitempty"`
 }
 
 // ListDeploys returns the list of deploy that match a given filter.
@@ -145,6 +147,8 @@ type DeployOptions struct {
 	Origin       string
 	Rollback     bool
 	Build        bool
+	// IgnoreFreeze allows the deploy to run inside deploy freeze windows.
+	IgnoreFreeze bool
 }
 
 func (o *DeployOptions) Kind() DeployKind {
@@ -170,20 +174,27 @@ func (o *DeployOptions) Kind() DeployKind {
 // archive based deploy (if opts.ArchiveURL is not empty), and then fallback to
 // the Git based deployment.
 func Deploy(opts DeployOptions) error {
+	if !opts.IgnoreFreeze {
+		if err := opts.App.ActiveDeployFreeze(time.Now()); err != nil {
+			return err
+		}
+	}
 	var outBuffer bytes.Buffer
 	start := time.Now()
 	logWriter := LogWriter{App: opts.App}
 	logWriter.Async()
 	defer logWriter.Close()
-	writer := io.MultiWriter(&tsuruIo.NoErrorWriter{Writer: opts.OutputStream}, &outBuffer, &logWriter)
+	writer := &deployWriter{
+		Writer: io.MultiWriter(&tsuruIo.NoErrorWriter{Writer: opts.OutputStream}, &outBuffer, &logWriter),
+	}
 	elapsed := time.Since(start)
-	saveErr := saveDeployData(&opts, "diff", "", elapsed, nil)
+	saveErr := saveDeployData(&opts, "diff", "", nil, elapsed, nil)
 	if saveErr != nil {
 		log.Errorf("WARNING: couldn't save deploy data, deploy opts: %#v", opts)
 	}
 	imageId, err := deployToProvisioner(&opts, writer)
 	elapsed = time.Since(start)
-	saveErr = saveDeployData(&opts, imageId, outBuffer.String(), elapsed, err)
+	saveErr = saveDeployData(&opts, imageId, outBuffer.String(), writer.hooks, elapsed, err)
 	if saveErr != nil {
 		log.Errorf("WARNING: couldn't save deploy data, deploy opts: %#v", opts)
 	}
@@ -197,6 +208,10 @@ func Deploy(opts DeployOptions) error {
 	if opts.App.UpdatePlatform == true {
 		opts.App.SetUpdatePlatform(false)
 	}
+	err = opts.App.updateDeclaredJobs()
+	if err != nil {
+		log.Errorf("WARNING: couldn't update jobs declared in tsuru.yaml, deploy opts: %#v: %s", opts, err)
+	}
 	_, err = opts.App.RebuildRoutes()
 	if err != nil {
 		return err
@@ -204,6 +219,20 @@ func Deploy(opts DeployOptions) error {
 	return nil
 }
 
+// deployWriter is the writer given to provisioners during deploys, it
+// collects the results of the deploy hooks.
+type deployWriter struct {
+	io.Writer
+	mu    sync.Mutex
+	hooks []provision.DeployHookResult
+}
+
+func (w *deployWriter) RecordDeployHook(result provision.DeployHookResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hooks = append(w.hooks, result)
+}
+
 func deployToProvisioner(opts *DeployOptions, writer io.Writer) (string, error) {
 	switch opts.Kind() {
 	case DeployRollback:
@@ -223,7 +252,7 @@ func deployToProvisioner(opts *DeployOptions, writer io.Writer) (string, error)
 	}
 }
 
-func saveDeployData(opts *DeployOptions, imageId, log string, duration time.Duration, deployError error) error {
+func saveDeployData(opts *DeployOptions, imageId, log string, hooks []provision.DeployHookResult, duration time.Duration, deployError error) error {
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -237,6 +266,7 @@ func saveDeployData(opts *DeployOptions, imageId, log string, duration time.Dura
 		Image:     imageId,
 		Log:       log,
 		User:      opts.User,
+		Hooks:     hooks,
 	}
 	if opts.Origin != "" {
 		deploy.Origin = opts.Origin
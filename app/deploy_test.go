@@ -258,7 +258,7 @@ func (s *S) TestDeploySaveDataAndDiff(c *check.C) {
 		Image:  "myimage",
 		Commit: "",
 	}
-	err = saveDeployData(&opts, "diff", "", time.Second, nil)
+	err = saveDeployData(&opts, "diff", "", nil, time.Second, nil)
 	c.Assert(err, check.IsNil)
 	deploys, err := ListDeploys(nil, 0, 0)
 	c.Assert(err, check.IsNil)
@@ -276,7 +276,7 @@ func (s *S) TestDeploySaveDataAndDiff(c *check.C) {
 	c.Assert(result.Image, check.Equals, "diff")
 	c.Assert(result.Log, check.Equals, "")
 	c.Assert(result.Diff, check.DeepEquals, "testDiff")
-	err = saveDeployData(&opts, "myid", "mylog", time.Second, nil)
+	err = saveDeployData(&opts, "myid", "mylog", nil, time.Second, nil)
 	c.Assert(err, check.IsNil)
 	deploys, err = ListDeploys(nil, 0, 0)
 	c.Assert(err, check.IsNil)
@@ -311,6 +311,35 @@ func (s *S) TestDeployApp(c *check.C) {
 	c.Assert(logs, check.Equals, "Image deploy called")
 }
 
+func (s *S) TestDeployAppSavesHookResults(c *check.C) {
+	a := App{
+		Name:     "someApp",
+		Plan:     Plan{Router: "fake"},
+		Platform: "django",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	hooks := []provision.DeployHookResult{
+		{Stage: provision.DeployHookPre, Command: "./migrate.sh", Output: "migrated", Duration: time.Second},
+		{Stage: provision.DeployHookPost, Command: "./notify.sh", ExitCode: 1, Error: "exit status 1"},
+	}
+	s.provisioner.PrepareDeployHooks(hooks...)
+	err = Deploy(DeployOptions{
+		App:          &a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+	})
+	c.Assert(err, check.IsNil)
+	var deploy DeployData
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&deploy)
+	c.Assert(err, check.IsNil)
+	c.Assert(deploy.Hooks, check.DeepEquals, hooks)
+}
+
 func (s *S) TestDeployAppWithUpdatePlatform(c *check.C) {
 	a := App{
 		Name:           "someApp",
@@ -678,7 +707,7 @@ func (s *S) TestMarkDeploysAsRemoved(c *check.C) {
 		Image:  "myimage",
 		Commit: "1ee1f1084927b3a5db59c9033bc5c4abefb7b93c",
 	}
-	err = saveDeployData(&opts, "myid", "mylog", time.Second, nil)
+	err = saveDeployData(&opts, "myid", "mylog", nil, time.Second, nil)
 	c.Assert(err, check.IsNil)
 	c.Assert(err, check.IsNil)
 	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
@@ -0,0 +1,206 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/tsuru/app/cron"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrDeployFreezeNotFound = errors.New("deploy freeze not found")
+
+type DeployFreezeValidationError struct{ msg string }
+
+func (e DeployFreezeValidationError) Error() string {
+	return e.msg
+}
+
+// DeployFrozenError is returned by Deploy and Rollback when the app is inside
+// a deploy freeze window.
+type DeployFrozenError struct {
+	App    string
+	Freeze DeployFreeze
+	Until  time.Time
+}
+
+func (e *DeployFrozenError) Error() string {
+	msg := fmt.Sprintf("deploys to app %s are frozen until %s", e.App, e.Until.UTC().Format(time.RFC3339))
+	if e.Freeze.Reason != "" {
+		msg += ": " + e.Freeze.Reason
+	}
+	return msg
+}
+
+// DeployFreeze is a window in which deploys and rollbacks are refused, either
+// for a single app or for every app in a pool.
+//
+// The window is either an explicit date range, from Start to End, or a
+// recurring window starting at each activation of Schedule, a cron
+// expression evaluated in UTC, and lasting for Duration.
+type DeployFreeze struct {
+	ID       bson.ObjectId `bson:"_id" json:"id"`
+	App      string        `json:"app,omitempty"`
+	Pool     string        `json:"pool,omitempty"`
+	Schedule string        `json:"schedule,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Start    time.Time     `json:"start,omitempty"`
+	End      time.Time     `json:"end,omitempty"`
+	Reason   string        `json:"reason"`
+	Owner    string        `json:"owner"`
+}
+
+func (f *DeployFreeze) validate() error {
+	if (f.App == "") == (f.Pool == "") {
+		return DeployFreezeValidationError{"a deploy freeze must target either an app or a pool"}
+	}
+	if f.Schedule != "" {
+		if !f.Start.IsZero() || !f.End.IsZero() {
+			return DeployFreezeValidationError{"a deploy freeze must have either a schedule or a date range"}
+		}
+		if _, err := cron.Parse(f.Schedule); err != nil {
+			return DeployFreezeValidationError{err.Error()}
+		}
+		if f.Duration <= 0 {
+			return DeployFreezeValidationError{"a scheduled deploy freeze must have a duration"}
+		}
+		return nil
+	}
+	if f.Start.IsZero() || f.End.IsZero() {
+		return DeployFreezeValidationError{"a deploy freeze must have either a schedule or a date range"}
+	}
+	if !f.End.After(f.Start) {
+		return DeployFreezeValidationError{"the end of a deploy freeze must be after its start"}
+	}
+	return nil
+}
+
+// ActiveUntil returns whether the freeze is active at the given time and,
+// if it is, when the current window ends.
+func (f *DeployFreeze) ActiveUntil(now time.Time) (time.Time, bool) {
+	if f.Schedule == "" {
+		if now.Before(f.Start) || !now.Before(f.End) {
+			return time.Time{}, false
+		}
+		return f.End, true
+	}
+	schedule, err := cron.Parse(f.Schedule)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now = now.UTC()
+	start := schedule.Next(now.Add(-f.Duration))
+	if start.IsZero() || start.After(now) {
+		return time.Time{}, false
+	}
+	return start.Add(f.Duration), true
+}
+
+// AddDeployFreeze validates and stores a new deploy freeze.
+func AddDeployFreeze(f *DeployFreeze) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	f.ID = bson.NewObjectId()
+	return conn.DeployFreezes().Insert(f)
+}
+
+// GetDeployFreeze returns the deploy freeze with the given id.
+func GetDeployFreeze(id string) (*DeployFreeze, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrDeployFreezeNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var f DeployFreeze
+	err = conn.DeployFreezes().FindId(bson.ObjectIdHex(id)).One(&f)
+	if err == mgo.ErrNotFound {
+		return nil, ErrDeployFreezeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// RemoveDeployFreeze removes the deploy freeze with the given id.
+func RemoveDeployFreeze(id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrDeployFreezeNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.DeployFreezes().RemoveId(bson.ObjectIdHex(id))
+	if err == mgo.ErrNotFound {
+		return ErrDeployFreezeNotFound
+	}
+	return err
+}
+
+// ListDeployFreezes returns the deploy freezes targeting the given app or
+// pool. Empty values match every app or pool.
+func ListDeployFreezes(appName, pool string) ([]DeployFreeze, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{}
+	if appName != "" {
+		query["app"] = appName
+	}
+	if pool != "" {
+		query["pool"] = pool
+	}
+	var freezes []DeployFreeze
+	err = conn.DeployFreezes().Find(query).All(&freezes)
+	return freezes, err
+}
+
+// ActiveDeployFreeze returns a DeployFrozenError if a deploy freeze of the
+// app, or of its pool, is active at the given time.
+func (app *App) ActiveDeployFreeze(now time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var freezes []DeployFreeze
+	query := bson.M{"app": app.Name}
+	if app.Pool != "" {
+		query = bson.M{"$or": []bson.M{{"app": app.Name}, {"pool": app.Pool}}}
+	}
+	err = conn.DeployFreezes().Find(query).All(&freezes)
+	if err != nil {
+		return err
+	}
+	var frozen *DeployFrozenError
+	for _, f := range freezes {
+		until, active := f.ActiveUntil(now)
+		if active && (frozen == nil || until.After(frozen.Until)) {
+			frozen = &DeployFrozenError{App: app.Name, Freeze: f, Until: until}
+		}
+	}
+	if frozen != nil {
+		return frozen
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestDeployFreezeActiveUntilRange(c *check.C) {
+	start := time.Date(2016, 12, 20, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC)
+	f := DeployFreeze{Start: start, End: end}
+	_, active := f.ActiveUntil(start.Add(-time.Second))
+	c.Assert(active, check.Equals, false)
+	until, active := f.ActiveUntil(start)
+	c.Assert(active, check.Equals, true)
+	c.Assert(until, check.Equals, end)
+	_, active = f.ActiveUntil(end)
+	c.Assert(active, check.Equals, false)
+}
+
+func (s *S) TestDeployFreezeActiveUntilSchedule(c *check.C) {
+	f := DeployFreeze{Schedule: "0 18 * * fri", Duration: 62 * time.Hour}
+	friday := time.Date(2016, 9, 30, 18, 0, 0, 0, time.UTC)
+	monday := friday.Add(62 * time.Hour)
+	_, active := f.ActiveUntil(friday.Add(-time.Minute))
+	c.Assert(active, check.Equals, false)
+	until, active := f.ActiveUntil(friday)
+	c.Assert(active, check.Equals, true)
+	c.Assert(until, check.Equals, monday)
+	until, active = f.ActiveUntil(friday.Add(30 * time.Hour))
+	c.Assert(active, check.Equals, true)
+	c.Assert(until, check.Equals, monday)
+	_, active = f.ActiveUntil(monday)
+	c.Assert(active, check.Equals, false)
+}
+
+func (s *S) TestAddDeployFreezeValidation(c *check.C) {
+	now := time.Now()
+	var tests = []struct {
+		freeze DeployFreeze
+		err    string
+	}{
+		{DeployFreeze{Schedule: "@daily", Duration: time.Hour}, "a deploy freeze must target either an app or a pool"},
+		{DeployFreeze{App: "myapp", Pool: "pool1", Schedule: "@daily", Duration: time.Hour}, "a deploy freeze must target either an app or a pool"},
+		{DeployFreeze{App: "myapp"}, "a deploy freeze must have either a schedule or a date range"},
+		{DeployFreeze{App: "myapp", Schedule: "@daily", Duration: time.Hour, Start: now}, "a deploy freeze must have either a schedule or a date range"},
+		{DeployFreeze{App: "myapp", Schedule: "@daily"}, "a scheduled deploy freeze must have a duration"},
+		{DeployFreeze{App: "myapp", Schedule: "@often", Duration: time.Hour}, `invalid cron expression "@often".*`},
+		{DeployFreeze{App: "myapp", Start: now, End: now.Add(-time.Hour)}, "the end of a deploy freeze must be after its start"},
+	}
+	for _, t := range tests {
+		err := AddDeployFreeze(&t.freeze)
+		c.Check(err, check.FitsTypeOf, DeployFreezeValidationError{})
+		c.Check(err, check.ErrorMatches, t.err)
+	}
+	freezes, err := ListDeployFreezes("", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(freezes, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveDeployFreeze(c *check.C) {
+	f := DeployFreeze{App: "myapp", Schedule: "@daily", Duration: time.Hour}
+	err := AddDeployFreeze(&f)
+	c.Assert(err, check.IsNil)
+	err = RemoveDeployFreeze(f.ID.Hex())
+	c.Assert(err, check.IsNil)
+	err = RemoveDeployFreeze(f.ID.Hex())
+	c.Assert(err, check.Equals, ErrDeployFreezeNotFound)
+	_, err = GetDeployFreeze(f.ID.Hex())
+	c.Assert(err, check.Equals, ErrDeployFreezeNotFound)
+}
+
+func (s *S) TestDeployRefusedByPoolFreeze(c *check.C) {
+	a := App{Name: "someapp", Plan: Plan{Router: "fake"}, Pool: "pool1", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.Provision(&a)
+	defer s.provisioner.Destroy(&a)
+	other := DeployFreeze{App: "otherapp", Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}
+	err = AddDeployFreeze(&other)
+	c.Assert(err, check.IsNil)
+	err = a.ActiveDeployFreeze(time.Now())
+	c.Assert(err, check.IsNil)
+	freeze := DeployFreeze{Pool: "pool1", Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour), Reason: "audit"}
+	err = AddDeployFreeze(&freeze)
+	c.Assert(err, check.IsNil)
+	writer := &bytes.Buffer{}
+	err = Deploy(DeployOptions{App: &a, Image: "myimage", OutputStream: writer})
+	c.Assert(err, check.FitsTypeOf, &DeployFrozenError{})
+	c.Assert(err, check.ErrorMatches, "deploys to app someapp are frozen until .*: audit")
+	c.Assert(writer.String(), check.Equals, "")
+	err = Rollback(DeployOptions{App: &a, Image: "myimage:v1", OutputStream: writer})
+	c.Assert(err, check.FitsTypeOf, &DeployFrozenError{})
+	err = Deploy(DeployOptions{App: &a, Image: "myimage", OutputStream: writer, IgnoreFreeze: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(writer.String(), check.Equals, "Image deploy called")
+}
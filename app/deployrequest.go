@@ -0,0 +1,178 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DeployRequestPending  = "pending"
+	DeployRequestApproved = "approved"
+	DeployRequestRejected = "rejected"
+)
+
+var (
+	ErrDeployRequestNotFound     = errors.New("deploy request not found")
+	ErrDeployRequestNotPending   = errors.New("deploy request is not pending")
+	ErrDeployRequestSelfApproval = errors.New("a deploy request can't be approved by the user who requested it")
+	ErrDeployRequestUpload       = errors.New("deploys of uploaded files can't wait for approval, deploy an archive URL or an image instead")
+)
+
+// DeployRequest is a deploy waiting for the approval of a second user, created
+// instead of running the deploy when the app requires deploy approval.
+type DeployRequest struct {
+	ID          bson.ObjectId `bson:"_id" json:"id"`
+	App         string        `json:"app"`
+	Commit      string        `json:"commit,omitempty"`
+	ArchiveURL  string        `json:"archiveURL,omitempty"`
+	Image       string        `json:"image,omitempty"`
+	Origin      string        `json:"origin,omitempty"`
+	Rollback    bool          `json:"rollback"`
+	User        string        `json:"user"`
+	Status      string        `json:"status"`
+	RequestedAt time.Time     `json:"requestedAt"`
+	Reviewer    string        `json:"reviewer,omitempty"`
+	ReviewedAt  time.Time     `json:"reviewedAt,omitempty"`
+}
+
+// SetDeployApproval sets whether deploys of the app must be approved by a
+// second user before running.
+func (app *App) SetDeployApproval(required bool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"deployapproval": required}})
+	if err != nil {
+		return err
+	}
+	app.DeployApproval = required
+	return nil
+}
+
+// RequestDeploy stores the deploy described by opts as a pending deploy
+// request. Rollbacks are requested by setting opts.Rollback.
+func RequestDeploy(opts DeployOptions) (*DeployRequest, error) {
+	if opts.File != nil {
+		return nil, ErrDeployRequestUpload
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	req := DeployRequest{
+		ID:          bson.NewObjectId(),
+		App:         opts.App.Name,
+		Commit:      opts.Commit,
+		ArchiveURL:  opts.ArchiveURL,
+		Image:       opts.Image,
+		Origin:      opts.Origin,
+		Rollback:    opts.Rollback,
+		User:        opts.User,
+		Status:      DeployRequestPending,
+		RequestedAt: time.Now().UTC(),
+	}
+	err = conn.DeployRequests().Insert(req)
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListDeployRequests returns the deploy requests of the app, newest first. An
+// empty status matches requests in any status.
+func ListDeployRequests(appName, status string) ([]DeployRequest, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{"app": appName}
+	if status != "" {
+		query["status"] = status
+	}
+	var reqs []DeployRequest
+	err = conn.DeployRequests().Find(query).Sort("-requestedat").All(&reqs)
+	return reqs, err
+}
+
+// GetDeployRequest returns the deploy request of the app with the given id.
+func GetDeployRequest(appName, id string) (*DeployRequest, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrDeployRequestNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var req DeployRequest
+	err = conn.DeployRequests().Find(bson.M{"_id": bson.ObjectIdHex(id), "app": appName}).One(&req)
+	if err == mgo.ErrNotFound {
+		return nil, ErrDeployRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Approve marks the pending request as approved by reviewer, who must not be
+// the user who requested it. The caller is responsible for running the
+// deploy, using the options returned by DeployOptions.
+func (r *DeployRequest) Approve(reviewer string) error {
+	if reviewer == r.User {
+		return ErrDeployRequestSelfApproval
+	}
+	return r.review(reviewer, DeployRequestApproved)
+}
+
+// Reject marks the pending request as rejected by reviewer.
+func (r *DeployRequest) Reject(reviewer string) error {
+	return r.review(reviewer, DeployRequestRejected)
+}
+
+func (r *DeployRequest) review(reviewer, status string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	err = conn.DeployRequests().Update(
+		bson.M{"_id": r.ID, "status": DeployRequestPending},
+		bson.M{"$set": bson.M{"status": status, "reviewer": reviewer, "reviewedat": now}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrDeployRequestNotPending
+	}
+	if err != nil {
+		return err
+	}
+	r.Status, r.Reviewer, r.ReviewedAt = status, reviewer, now
+	return nil
+}
+
+// DeployOptions returns the options used to run the requested deploy in the
+// given app. The deploy is attributed to the user who requested it.
+func (r *DeployRequest) DeployOptions(a *App) DeployOptions {
+	return DeployOptions{
+		App:        a,
+		Commit:     r.Commit,
+		ArchiveURL: r.ArchiveURL,
+		Image:      r.Image,
+		Origin:     r.Origin,
+		User:       r.User,
+		Rollback:   r.Rollback,
+	}
+}
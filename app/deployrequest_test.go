@@ -0,0 +1,63 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetDeployApproval(c *check.C) {
+	a := App{Name: "someapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.SetDeployApproval(true)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.DeployApproval, check.Equals, true)
+}
+
+func (s *S) TestRequestDeploy(c *check.C) {
+	a := App{Name: "someapp"}
+	req, err := RequestDeploy(DeployOptions{App: &a, Image: "tsuru/someapp:v2", User: "dev@tsuru.io", Rollback: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, DeployRequestPending)
+	reqs, err := ListDeployRequests(a.Name, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].ID, check.Equals, req.ID)
+	opts := reqs[0].DeployOptions(&a)
+	c.Assert(opts.Image, check.Equals, "tsuru/someapp:v2")
+	c.Assert(opts.User, check.Equals, "dev@tsuru.io")
+	c.Assert(opts.Rollback, check.Equals, true)
+	c.Assert(opts.App, check.Equals, &a)
+}
+
+func (s *S) TestRequestDeployUpload(c *check.C) {
+	a := App{Name: "someapp"}
+	_, err := RequestDeploy(DeployOptions{App: &a, File: ioutil.NopCloser(strings.NewReader("file"))})
+	c.Assert(err, check.Equals, ErrDeployRequestUpload)
+}
+
+func (s *S) TestDeployRequestApprove(c *check.C) {
+	a := App{Name: "someapp"}
+	req, err := RequestDeploy(DeployOptions{App: &a, Image: "tsuru/someapp:v2", User: "dev@tsuru.io"})
+	c.Assert(err, check.IsNil)
+	err = req.Approve("dev@tsuru.io")
+	c.Assert(err, check.Equals, ErrDeployRequestSelfApproval)
+	err = req.Approve("lead@tsuru.io")
+	c.Assert(err, check.IsNil)
+	dbReq, err := GetDeployRequest(a.Name, req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, DeployRequestApproved)
+	c.Assert(dbReq.Reviewer, check.Equals, "lead@tsuru.io")
+	err = dbReq.Reject("lead@tsuru.io")
+	c.Assert(err, check.Equals, ErrDeployRequestNotPending)
+	_, err = GetDeployRequest("otherapp", req.ID.Hex())
+	c.Assert(err, check.Equals, ErrDeployRequestNotFound)
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MinIdleTimeout is the shortest idle timeout accepted in idle policies.
+const MinIdleTimeout = time.Minute
+
+var (
+	ErrIdlePolicyNotFound = errors.New("app has no idle policy")
+	ErrInvalidIdleTimeout = fmt.Errorf("idle timeout must be at least %s", MinIdleTimeout)
+	ErrWakeTimeout        = errors.New("timeout waiting for units to start")
+)
+
+// IdlePolicy makes tsuru put the app to sleep after Timeout without
+// requests, pointing its routes to the wake-up proxy, which starts the app
+// again when the next request arrives.
+//
+// Asleep and AsleepSince describe the current state of the app, and Since is
+// the last time the policy was set or the app was woken up, used as the
+// last activity of apps that haven't received any request yet.
+type IdlePolicy struct {
+	Timeout     time.Duration `json:"timeout"`
+	Since       time.Time     `json:"since"`
+	Asleep      bool          `json:"asleep"`
+	AsleepSince time.Time     `json:"asleepSince"`
+}
+
+// IdleSince returns when the app became idle, given the time of the last
+// request it received, which may be zero when unknown.
+func (p *IdlePolicy) IdleSince(lastRequest time.Time) time.Time {
+	if lastRequest.After(p.Since) {
+		return lastRequest
+	}
+	return p.Since
+}
+
+// SetIdlePolicy enables sleeping the app after the given time without
+// requests.
+func (app *App) SetIdlePolicy(timeout time.Duration) error {
+	if timeout < MinIdleTimeout {
+		return ErrInvalidIdleTimeout
+	}
+	policy := IdlePolicy{Timeout: timeout, Since: time.Now().UTC()}
+	if app.IdlePolicy != nil {
+		policy.Asleep = app.IdlePolicy.Asleep
+		policy.AsleepSince = app.IdlePolicy.AsleepSince
+	}
+	err := app.updateIdlePolicy(bson.M{"$set": bson.M{"idlepolicy": policy}})
+	if err != nil {
+		return err
+	}
+	app.IdlePolicy = &policy
+	return nil
+}
+
+// RemoveIdlePolicy disables sleeping the app when it's idle. Apps already
+// asleep are kept asleep until the next request.
+func (app *App) RemoveIdlePolicy() error {
+	if app.IdlePolicy == nil {
+		return ErrIdlePolicyNotFound
+	}
+	if app.IdlePolicy.Asleep {
+		app.IdlePolicy.Timeout = 0
+		return app.updateIdlePolicy(bson.M{"$set": bson.M{"idlepolicy.timeout": 0}})
+	}
+	err := app.updateIdlePolicy(bson.M{"$unset": bson.M{"idlepolicy": ""}})
+	if err != nil {
+		return err
+	}
+	app.IdlePolicy = nil
+	return nil
+}
+
+func (app *App) updateIdlePolicy(update bson.M) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(bson.M{"name": app.Name}, update)
+}
+
+// SleepIdle puts the app to sleep because it's idle, pointing its routes to
+// the wake-up proxy at proxyURL.
+func (app *App) SleepIdle(w io.Writer, proxyURL *url.URL) error {
+	if app.IdlePolicy == nil {
+		return ErrIdlePolicyNotFound
+	}
+	err := app.Sleep(w, "", proxyURL)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	err = app.updateIdlePolicy(bson.M{"$set": bson.M{"idlepolicy.asleep": true, "idlepolicy.asleepsince": now}})
+	if err != nil {
+		return err
+	}
+	app.IdlePolicy.Asleep = true
+	app.IdlePolicy.AsleepSince = now
+	return nil
+}
+
+// Wake starts an app put to sleep by SleepIdle, waiting up to timeout for its
+// units to start and, when the provisioner supports it, for them to pass the
+// healthcheck of the app, before replacing the route to the wake-up proxy at
+// proxyURL with the routes to the units. The started units are returned.
+//
+// The caller must hold the lock of the app.
+func (app *App) Wake(w io.Writer, proxyURL *url.URL, timeout time.Duration) ([]provision.Unit, error) {
+	fmt.Fprintf(w, "\n ---> Waking up the app %q\n", app.Name)
+	err := Provisioner.Start(app, "")
+	if err != nil {
+		return nil, err
+	}
+	units, err := app.waitUnitsStarted(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if hcProvisioner, ok := Provisioner.(provision.HealthcheckProvisioner); ok {
+		err = hcProvisioner.RunHealthcheck(app, units, w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := app.allRouters()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range units {
+		err = r.AddRoute(app.Name, u.Address)
+		if err != nil && err != router.ErrRouteExists {
+			return nil, err
+		}
+	}
+	err = r.RemoveRoute(app.Name, proxyURL)
+	if err != nil && err != router.ErrRouteNotFound {
+		log.Errorf("[wake] unable to remove the wake-up proxy route of %s: %s", app.Name, err)
+	}
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"idlepolicy.asleep": false, "idlepolicy.since": now}}
+	if app.IdlePolicy != nil && app.IdlePolicy.Timeout == 0 {
+		update = bson.M{"$unset": bson.M{"idlepolicy": ""}}
+	}
+	err = app.updateIdlePolicy(update)
+	if err != nil {
+		return nil, err
+	}
+	if app.IdlePolicy != nil {
+		app.IdlePolicy.Asleep = false
+		app.IdlePolicy.Since = now
+	}
+	return units, nil
+}
+
+var wakePollInterval = time.Second
+
+// waitUnitsStarted waits until every unit of the app is started and has an
+// address.
+func (app *App) waitUnitsStarted(timeout time.Duration) ([]provision.Unit, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		units, err := app.Units()
+		if err != nil {
+			return nil, err
+		}
+		started := len(units) > 0
+		for _, u := range units {
+			if u.Status != provision.StatusStarted || u.Address == nil {
+				started = false
+				break
+			}
+		}
+		if started {
+			return units, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrWakeTimeout
+		}
+		time.Sleep(wakePollInterval)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package idle puts apps with an idle policy to sleep when they stop
+// receiving requests, according to a TrafficSource, and hosts the wake-up
+// proxy that starts them again.
+//
+// Sleeping apps have their routes pointed to the proxy, which starts the app
+// on the first request, waits for its units to pass the healthcheck, restores
+// the routes and then forwards the request to one of the units.
+package idle
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router"
+)
+
+const eventOwner = "idle"
+
+var ErrTrafficNotSupported = errors.New("router does not report traffic")
+
+// TrafficSource reports when apps last received requests.
+type TrafficSource interface {
+	// LastRequest returns the time of the last request received by the
+	// app, or the zero time if it's unknown.
+	LastRequest(a *app.App) (time.Time, error)
+}
+
+// RouterSource is a TrafficSource that asks the routers of the app, it
+// requires at least one of them to implement router.TrafficRouter. The most
+// recent request among them is returned. Apps whose routers don't report
+// traffic are never put to sleep.
+type RouterSource struct{}
+
+func (RouterSource) LastRequest(a *app.App) (time.Time, error) {
+	routerNames, err := a.GetRouters()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	supported := false
+	for _, routerName := range routerNames {
+		r, err := router.Get(routerName)
+		if err != nil {
+			return time.Time{}, err
+		}
+		trafficRouter, ok := r.(router.TrafficRouter)
+		if !ok {
+			continue
+		}
+		supported = true
+		t, err := trafficRouter.LastRequest(a.Name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	if !supported {
+		return time.Time{}, ErrTrafficNotSupported
+	}
+	return last, nil
+}
+
+// NewTrafficSource returns the TrafficSource set in the idle:traffic-source
+// setting in tsuru.conf, "router" by default.
+func NewTrafficSource() (TrafficSource, error) {
+	name, _ := config.GetString("idle:traffic-source")
+	switch name {
+	case "", "router":
+		return RouterSource{}, nil
+	}
+	return nil, fmt.Errorf("invalid idle:traffic-source: %q", name)
+}
+
+// Config holds the settings for the idle worker and the wake-up proxy. It
+// must be created using NewConfig.
+type Config struct {
+	RunInterval time.Duration
+	WakeTimeout time.Duration
+	ProxyURL    *url.URL
+	Source      TrafficSource
+	Proxy       *Proxy
+	leader      *leader.Lease
+	done        chan bool
+	listener    net.Listener
+}
+
+// NewConfig creates a new idle worker configuration reading its settings from
+// the "idle" section in tsuru.conf.
+func NewConfig(source TrafficSource) (*Config, error) {
+	proxyURL, err := config.GetString("idle:proxy-url")
+	if err != nil {
+		return nil, errors.New("idle:proxy-url must be set to enable idle apps sleeping")
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid idle:proxy-url: %q", proxyURL)
+	}
+	runInterval, _ := config.GetInt("idle:run-interval")
+	if runInterval <= 0 {
+		runInterval = 60
+	}
+	wakeTimeout, _ := config.GetInt("idle:wake-timeout")
+	if wakeTimeout <= 0 {
+		wakeTimeout = 120
+	}
+	interval := time.Duration(runInterval) * time.Second
+	cfg := Config{
+		RunInterval: interval,
+		WakeTimeout: time.Duration(wakeTimeout) * time.Second,
+		ProxyURL:    u,
+		Source:      source,
+		leader:      leader.NewLease("app-idle", 2*interval),
+		done:        make(chan bool),
+	}
+	cfg.Proxy = NewProxy(u, cfg.WakeTimeout)
+	return &cfg, nil
+}
+
+// Initialize starts the idle worker and the wake-up proxy if they're enabled
+// in tsuru.conf. The returned Config can be used to stop them.
+func Initialize() (*Config, error) {
+	if enabled, _ := config.GetBool("idle:enabled"); !enabled {
+		return nil, nil
+	}
+	source, err := NewTrafficSource()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := NewConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	listen, _ := config.GetString("idle:proxy-listen")
+	if listen == "" {
+		listen = ":8081"
+	}
+	cfg.listener, err = net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(cfg.listener, cfg.Proxy)
+	go cfg.run()
+	return cfg, nil
+}
+
+func (c *Config) run() {
+	for {
+		err := c.RunOnce()
+		if err != nil {
+			log.Errorf("[idle] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.RunInterval):
+		}
+	}
+}
+
+// Shutdown stops the worker and the wake-up proxy.
+func (c *Config) Shutdown() {
+	c.done <- true
+	if c.listener != nil {
+		c.listener.Close()
+	}
+}
+
+func (c *Config) String() string {
+	return "idle apps"
+}
+
+// RunOnce puts to sleep the apps that are idle for longer than the timeout
+// of their policies. Only one tsuru API instance is allowed to do it at a
+// time, the others skip the run while a leader is active.
+func (c *Config) RunOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	isLeader, err := c.leader.Acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire leadership: %s", err)
+	}
+	if !isLeader {
+		log.Debugf("[idle] skipping run, another instance is the leader")
+		return nil
+	}
+	apps, err := app.List(&app.Filter{Idle: true})
+	if err != nil {
+		return fmt.Errorf("unable to list apps: %s", err)
+	}
+	now := time.Now().UTC()
+	for i := range apps {
+		a := &apps[i]
+		if a.IdlePolicy.Asleep {
+			continue
+		}
+		lastRequest, err := c.Source.LastRequest(a)
+		if err != nil {
+			log.Errorf("[idle] unable to get last request of app %s: %s", a.Name, err)
+			continue
+		}
+		idleFor := now.Sub(a.IdlePolicy.IdleSince(lastRequest))
+		if idleFor < a.IdlePolicy.Timeout {
+			continue
+		}
+		err = c.sleep(a, idleFor)
+		if err != nil {
+			log.Errorf("[idle] unable to put app %s to sleep: %s", a.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) sleep(a *app.App, idleFor time.Duration) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   permission.PermAppUpdateSleep,
+		Owner:  eventOwner,
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[idle] skipping %s: %s", a.Name, err)
+			return nil
+		}
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	locked, err := app.AcquireApplicationLock(a.Name, eventOwner, "sleep idle app")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		err = fmt.Errorf("unable to lock app %s", a.Name)
+		return err
+	}
+	defer app.ReleaseApplicationLock(a.Name)
+	evt.Logf("app idle for %s, putting it to sleep", idleFor/time.Second*time.Second)
+	err = a.SleepIdle(evt, c.ProxyURL)
+	return err
+}
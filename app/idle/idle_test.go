@@ -0,0 +1,242 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package idle_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/idle"
+	"github.com/tsuru/tsuru/app/idle/idletest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var proxyURL = &url.URL{Scheme: "http", Host: "tsuru-idle-proxy:8081"}
+
+func (s *S) newApp(c *check.C, timeout time.Duration) *app.App {
+	a := app.App{Name: "myapp", Quota: quota.Unlimited, CName: []string{"myapp.example.com"}}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	_, err = s.Provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(timeout)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) newConfig(c *check.C) (*idle.Config, *idletest.FakeTrafficSource) {
+	config.Set("idle:proxy-url", proxyURL.String())
+	defer config.Unset("idle")
+	source := idletest.NewFakeTrafficSource()
+	cfg, err := idle.NewConfig(source)
+	c.Assert(err, check.IsNil)
+	return cfg, source
+}
+
+func (s *S) TestNewConfigRequiresProxyURL(c *check.C) {
+	_, err := idle.NewConfig(idletest.NewFakeTrafficSource())
+	c.Assert(err, check.ErrorMatches, "idle:proxy-url must be set to enable idle apps sleeping")
+}
+
+func (s *S) TestRunOnceSleepsIdleApp(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	cfg, source := s.newConfig(c)
+	source.SetLastRequest(a.Name, time.Now().Add(-time.Hour))
+	err := s.Conn.Apps().Update(bson.M{"name": a.Name}, bson.M{
+		"$set": bson.M{"idlepolicy.since": time.Now().Add(-time.Hour)},
+	})
+	c.Assert(err, check.IsNil)
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.Provisioner.Sleeps(a, ""), check.Equals, 1)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target:     event.Target{Name: "app", Value: a.Name},
+		Kind:       "app.update.sleep",
+		Owner:      "idle",
+		LogMatches: `(?s).*app idle for 1h.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunOnceKeepsActiveApp(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	cfg, source := s.newConfig(c)
+	source.SetLastRequest(a.Name, time.Now().Add(-time.Minute))
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.Provisioner.Sleeps(a, ""), check.Equals, 0)
+}
+
+func (s *S) TestRunOnceUsesPolicySinceWithoutTraffic(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	cfg, _ := s.newConfig(c)
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.Provisioner.Sleeps(a, ""), check.Equals, 0)
+}
+
+func (s *S) TestRunOnceSourceFailure(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	cfg, source := s.newConfig(c)
+	source.PrepareFailure(errors.New("no traffic data"))
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.Provisioner.Sleeps(a, ""), check.Equals, 0)
+}
+
+func (s *S) TestProxyWakesAppAndForwardsRequest(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer server.Close()
+	a := app.App{Name: "myapp", Quota: quota.Unlimited, CName: []string{"myapp.example.com"}}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	serverURL, _ := url.Parse(server.URL)
+	s.Provisioner.AddUnit(&a, provision.Unit{
+		ID: "u1", AppName: a.Name, ProcessName: "web", Status: provision.StatusStarted, Address: serverURL,
+	})
+	err = routertest.FakeRouter.AddRoute(a.Name, serverURL)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(10 * time.Minute)
+	c.Assert(err, check.IsNil)
+	err = a.SleepIdle(ioutil.Discard, proxyURL)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, serverURL.String()), check.Equals, false)
+	proxy := idle.NewProxy(proxyURL, time.Minute)
+	request, err := http.NewRequest("GET", "http://myapp.example.com/some/path", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "hello from /some/path")
+	c.Assert(s.Provisioner.Starts(&a, ""), check.Equals, 1)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, serverURL.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, false)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   "app.update.start",
+		Owner:  "idle",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestProxyUnknownHost(c *check.C) {
+	proxy := idle.NewProxy(proxyURL, time.Minute)
+	request, err := http.NewRequest("GET", "http://unknown.example.com/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestNewTrafficSource(c *check.C) {
+	defer config.Unset("idle:traffic-source")
+	source, err := idle.NewTrafficSource()
+	c.Assert(err, check.IsNil)
+	c.Assert(source, check.FitsTypeOf, idle.RouterSource{})
+	config.Set("idle:traffic-source", "router")
+	source, err = idle.NewTrafficSource()
+	c.Assert(err, check.IsNil)
+	c.Assert(source, check.FitsTypeOf, idle.RouterSource{})
+	config.Set("idle:traffic-source", "logs")
+	_, err = idle.NewTrafficSource()
+	c.Assert(err, check.ErrorMatches, `invalid idle:traffic-source: "logs"`)
+}
+
+func (s *S) TestRouterSourceLastRequest(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	lastRequest, err := idle.RouterSource{}.LastRequest(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(lastRequest.IsZero(), check.Equals, true)
+	now := time.Now().UTC()
+	routertest.FakeRouter.SetLastRequest(a.Name, now)
+	lastRequest, err = idle.RouterSource{}.LastRequest(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(lastRequest.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestProxyFindsAppByRouterAddress(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	a := app.App{Name: "myapp", Ip: "myapp.fakerouter.com", Quota: quota.Unlimited}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	serverURL, _ := url.Parse(server.URL)
+	s.Provisioner.AddUnit(&a, provision.Unit{
+		ID: "u1", AppName: a.Name, ProcessName: "web", Status: provision.StatusStarted, Address: serverURL,
+	})
+	err = a.SetIdlePolicy(10 * time.Minute)
+	c.Assert(err, check.IsNil)
+	err = a.SleepIdle(ioutil.Discard, proxyURL)
+	c.Assert(err, check.IsNil)
+	proxy := idle.NewProxy(proxyURL, time.Minute)
+	request, err := http.NewRequest("GET", "http://MyApp.fakerouter.com:80/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Equals, "hello")
+}
+
+func (s *S) TestProxyHealthcheckFailure(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	err := a.SleepIdle(ioutil.Discard, proxyURL)
+	c.Assert(err, check.IsNil)
+	s.Provisioner.PrepareFailure("RunHealthcheck", errors.New("healthcheck fail"))
+	proxy := idle.NewProxy(proxyURL, time.Minute)
+	request, err := http.NewRequest("GET", "http://myapp.example.com/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, true)
+	c.Assert(dbApp.Lock.Locked, check.Equals, false)
+}
+
+func (s *S) TestProxyAppLocked(c *check.C) {
+	a := s.newApp(c, 10*time.Minute)
+	err := a.SleepIdle(ioutil.Discard, proxyURL)
+	c.Assert(err, check.IsNil)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	defer app.ReleaseApplicationLock(a.Name)
+	proxy := idle.NewProxy(proxyURL, time.Second)
+	request, err := http.NewRequest("GET", "http://myapp.example.com/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusServiceUnavailable)
+	c.Assert(s.Provisioner.Starts(a, ""), check.Equals, 0)
+}
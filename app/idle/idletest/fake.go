@@ -0,0 +1,54 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package idletest provides an in-memory traffic source for testing idle
+// policies without a router that reports traffic.
+package idletest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+)
+
+type FakeTrafficSource struct {
+	mut          sync.Mutex
+	lastRequests map[string]time.Time
+	err          error
+}
+
+func NewFakeTrafficSource() *FakeTrafficSource {
+	return &FakeTrafficSource{lastRequests: make(map[string]time.Time)}
+}
+
+// SetLastRequest sets the time of the last request received by the app.
+func (s *FakeTrafficSource) SetLastRequest(appName string, t time.Time) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.lastRequests[appName] = t
+}
+
+// PrepareFailure makes every call to LastRequest fail with the given error.
+func (s *FakeTrafficSource) PrepareFailure(err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.err = err
+}
+
+func (s *FakeTrafficSource) Reset() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.lastRequests = make(map[string]time.Time)
+	s.err = nil
+}
+
+func (s *FakeTrafficSource) LastRequest(a *app.App) (time.Time, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.err != nil {
+		return time.Time{}, s.err
+	}
+	return s.lastRequests[a.Name], nil
+}
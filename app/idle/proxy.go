@@ -0,0 +1,153 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package idle
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+)
+
+var errAppNotAsleep = errors.New("no sleeping app found for this host")
+
+type wakeCall struct {
+	done  chan struct{}
+	units []provision.Unit
+	err   error
+}
+
+// Proxy is the wake-up proxy, the routes of sleeping apps point to it. The
+// app is found by the Host header of the request, matching either one of its
+// cnames or its address in one of its routers. Concurrent requests to the same
+// app wait for a single wake up.
+type Proxy struct {
+	url         *url.URL
+	wakeTimeout time.Duration
+	mu          sync.Mutex
+	calls       map[string]*wakeCall
+}
+
+// NewProxy returns a wake-up proxy reachable by routers at proxyURL.
+func NewProxy(proxyURL *url.URL, wakeTimeout time.Duration) *Proxy {
+	return &Proxy{
+		url:         proxyURL,
+		wakeTimeout: wakeTimeout,
+		calls:       make(map[string]*wakeCall),
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	a, err := findAsleepApp(host)
+	if err == errAppNotAsleep {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("[idle proxy] unable to find app for host %q: %s", host, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	units, err := p.wake(a)
+	if err == nil && len(units) == 0 {
+		err = errors.New("no units available")
+	}
+	if err != nil {
+		log.Errorf("[idle proxy] unable to wake app %s: %s", a.Name, err)
+		http.Error(w, fmt.Sprintf("unable to wake app %s up", a.Name), http.StatusServiceUnavailable)
+		return
+	}
+	unit := units[rand.Intn(len(units))]
+	httputil.NewSingleHostReverseProxy(unit.Address).ServeHTTP(w, r)
+}
+
+// findAsleepApp returns the sleeping app with the host as one of its cnames or
+// as its address in one of its routers.
+func findAsleepApp(host string) (*app.App, error) {
+	host = strings.ToLower(host)
+	filter := &app.Filter{Asleep: true}
+	filter.ExtraIn("cname", host)
+	filter.ExtraIn("ip", host)
+	filter.ExtraIn("routers.address", host)
+	apps, err := app.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) == 0 {
+		return nil, errAppNotAsleep
+	}
+	return &apps[0], nil
+}
+
+// wake wakes the app up, or waits for a wake up of the app already in
+// progress, returning the started units.
+func (p *Proxy) wake(a *app.App) ([]provision.Unit, error) {
+	p.mu.Lock()
+	call := p.calls[a.Name]
+	if call == nil {
+		call = &wakeCall{done: make(chan struct{})}
+		p.calls[a.Name] = call
+		go func() {
+			call.units, call.err = p.doWake(a)
+			p.mu.Lock()
+			delete(p.calls, a.Name)
+			p.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	p.mu.Unlock()
+	<-call.done
+	return call.units, call.err
+}
+
+func (p *Proxy) doWake(a *app.App) (units []provision.Unit, err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   permission.PermAppUpdateStart,
+		Owner:  eventOwner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { evt.Done(err) }()
+	locked, err := app.AcquireApplicationLockWait(a.Name, eventOwner, "wake idle app", p.wakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		err = fmt.Errorf("unable to lock app %s", a.Name)
+		return nil, err
+	}
+	defer app.ReleaseApplicationLock(a.Name)
+	// Another instance of the proxy may have woken the app up while the lock
+	// was held.
+	a, err = app.GetByName(a.Name)
+	if err != nil {
+		return nil, err
+	}
+	if a.IdlePolicy == nil || !a.IdlePolicy.Asleep {
+		evt.Logf("app %s is already awake", a.Name)
+		units, err = a.Units()
+		return units, err
+	}
+	units, err = a.Wake(evt, p.url, p.wakeTimeout)
+	return units, err
+}
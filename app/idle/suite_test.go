@@ -0,0 +1,20 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package idle_test
+
+import (
+	"testing"
+
+	"github.com/tsuru/tsuru/app/apptest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	apptest.Suite
+}
+
+var _ = check.Suite(&S{Suite: apptest.Suite{DBName: "tsuru_app_idle_tests"}})
@@ -0,0 +1,110 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetIdlePolicy(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(30 * time.Second)
+	c.Assert(err, check.Equals, ErrInvalidIdleTimeout)
+	err = a.SetIdlePolicy(15 * time.Minute)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy, check.NotNil)
+	c.Assert(dbApp.IdlePolicy.Timeout, check.Equals, 15*time.Minute)
+	c.Assert(dbApp.IdlePolicy.Since.IsZero(), check.Equals, false)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, false)
+	apps, err := List(&Filter{Idle: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	apps, err = List(&Filter{Asleep: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveIdlePolicy(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveIdlePolicy()
+	c.Assert(err, check.Equals, ErrIdlePolicyNotFound)
+	err = a.SetIdlePolicy(15 * time.Minute)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveIdlePolicy()
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy, check.IsNil)
+}
+
+func (s *S) TestIdlePolicyIdleSince(c *check.C) {
+	since := time.Date(2016, 9, 26, 10, 0, 0, 0, time.UTC)
+	p := IdlePolicy{Since: since}
+	c.Assert(p.IdleSince(time.Time{}), check.Equals, since)
+	c.Assert(p.IdleSince(since.Add(-time.Hour)), check.Equals, since)
+	c.Assert(p.IdleSince(since.Add(time.Hour)), check.Equals, since.Add(time.Hour))
+}
+
+func (s *S) TestSleepIdleAndWake(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(15 * time.Minute)
+	c.Assert(err, check.IsNil)
+	proxyURL, _ := url.Parse("http://idle-proxy:8081")
+	err = a.SleepIdle(&bytes.Buffer{}, proxyURL)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, false)
+	apps, err := List(&Filter{Asleep: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+	started, err := a.Wake(&bytes.Buffer{}, proxyURL, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(started, check.HasLen, 2)
+	c.Assert(started[0].Status, check.Equals, provision.StatusStarted)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[1].Address.String()), check.Equals, true)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, false)
+}
+
+func (s *S) TestWakeHealthcheckFailure(c *check.C) {
+	a := App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetIdlePolicy(15 * time.Minute)
+	c.Assert(err, check.IsNil)
+	proxyURL, _ := url.Parse("http://idle-proxy:8081")
+	err = a.SleepIdle(&bytes.Buffer{}, proxyURL)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("RunHealthcheck", errors.New("healthcheck fail(u1): wrong status code"))
+	_, err = a.Wake(&bytes.Buffer{}, proxyURL, time.Minute)
+	c.Assert(err, check.ErrorMatches, "healthcheck fail.*")
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.IdlePolicy.Asleep, check.Equals, true)
+}
@@ -0,0 +1,441 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/app/cron"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	JobConcurrencyAllow   = "allow"
+	JobConcurrencyForbid  = "forbid"
+	JobConcurrencyReplace = "replace"
+
+	// JobLogSource is the source of the log entries generated by the output
+	// of jobs.
+	JobLogSource = "job"
+
+	// DefaultJobTimeout is the timeout of jobs that don't define one.
+	DefaultJobTimeout = time.Hour
+
+	// maxJobOutput is the amount of output stored for each job run, only
+	// the last bytes of the output are kept. The whole output is still
+	// available in the app logs.
+	maxJobOutput = 64 * 1024
+
+	// jobRunGracePeriod is how long a run may stay running after its
+	// deadline before being considered lost.
+	jobRunGracePeriod = 5 * time.Minute
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobDeclared      = errors.New("job is declared in tsuru.yaml, it can only be removed by a new deploy")
+	ErrJobsNotSupported = errors.New("provisioner does not support jobs")
+
+	jobNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]{0,39}$`)
+)
+
+type JobValidationError struct{ field string }
+
+func (e JobValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.field)
+}
+
+// Job is a command executed periodically, according to a cron expression,
+// in a new unit created from the current image of the app. Jobs are either
+// defined through the API or declared in the tsuru.yaml of the app, in which
+// case Declared is true. Jobs defined through the API take precedence over
+// declared jobs with the same name.
+//
+// ConcurrencyPolicy controls what happens when a job is triggered while a
+// previous run is still running: "allow" runs both, "forbid" skips the new
+// run and "replace" kills the previous run before starting the new one.
+type Job struct {
+	Name              string        `json:"name"`
+	Schedule          string        `json:"schedule"`
+	Command           string        `json:"command"`
+	ConcurrencyPolicy string        `json:"concurrencyPolicy"`
+	Timeout           time.Duration `json:"timeout"`
+	Declared          bool          `json:"declared"`
+}
+
+// ParseSchedule returns the parsed cron expression of the job.
+func (j *Job) ParseSchedule() (*cron.Schedule, error) {
+	return cron.Parse(j.Schedule)
+}
+
+// GetTimeout returns the timeout of the job, using the default timeout for
+// jobs without one.
+func (j *Job) GetTimeout() time.Duration {
+	if j.Timeout <= 0 {
+		return DefaultJobTimeout
+	}
+	return j.Timeout
+}
+
+func (j *Job) validate() error {
+	if !jobNameRegexp.MatchString(j.Name) {
+		return JobValidationError{"name"}
+	}
+	if _, err := j.ParseSchedule(); err != nil {
+		return JobValidationError{"schedule"}
+	}
+	if j.Command == "" {
+		return JobValidationError{"command"}
+	}
+	switch j.ConcurrencyPolicy {
+	case "":
+		j.ConcurrencyPolicy = JobConcurrencyAllow
+	case JobConcurrencyAllow, JobConcurrencyForbid, JobConcurrencyReplace:
+	default:
+		return JobValidationError{"concurrency policy"}
+	}
+	if j.Timeout < 0 {
+		return JobValidationError{"timeout"}
+	}
+	return nil
+}
+
+// AllJobs returns the jobs defined through the API along with the jobs
+// declared in tsuru.yaml which aren't overridden by them.
+func (app *App) AllJobs() []Job {
+	jobs := make([]Job, 0, len(app.Jobs)+len(app.DeclaredJobs))
+	names := make(map[string]bool, len(app.Jobs))
+	for _, j := range app.Jobs {
+		names[j.Name] = true
+		jobs = append(jobs, j)
+	}
+	for _, j := range app.DeclaredJobs {
+		if !names[j.Name] {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// GetJob returns the job with the given name.
+func (app *App) GetJob(name string) (*Job, error) {
+	for _, j := range app.AllJobs() {
+		if j.Name == name {
+			return &j, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// SetJob validates and stores the given job, replacing any existing job
+// defined through the API with the same name.
+func (app *App) SetJob(job Job) error {
+	job.Declared = false
+	err := job.validate()
+	if err != nil {
+		return err
+	}
+	jobs := make([]Job, 0, len(app.Jobs)+1)
+	for _, j := range app.Jobs {
+		if j.Name != job.Name {
+			jobs = append(jobs, j)
+		}
+	}
+	jobs = append(jobs, job)
+	err = app.updateJobs("jobs", jobs)
+	if err != nil {
+		return err
+	}
+	app.Jobs = jobs
+	return nil
+}
+
+// RemoveJob removes the job defined through the API with the given name.
+// Jobs declared in tsuru.yaml can't be removed.
+func (app *App) RemoveJob(name string) error {
+	var jobs []Job
+	for _, j := range app.Jobs {
+		if j.Name != name {
+			jobs = append(jobs, j)
+		}
+	}
+	if len(jobs) == len(app.Jobs) {
+		for _, j := range app.DeclaredJobs {
+			if j.Name == name {
+				return ErrJobDeclared
+			}
+		}
+		return ErrJobNotFound
+	}
+	err := app.updateJobs("jobs", jobs)
+	if err != nil {
+		return err
+	}
+	app.Jobs = jobs
+	return nil
+}
+
+// updateDeclaredJobs reads the jobs declared in the tsuru.yaml of the current
+// image of the app, it's called after every deploy. Invalid jobs are logged
+// and ignored.
+func (app *App) updateDeclaredJobs() error {
+	jobProv, ok := Provisioner.(provision.JobProvisioner)
+	if !ok {
+		return nil
+	}
+	yamlJobs, err := jobProv.DeclaredJobs(app)
+	if err != nil {
+		return err
+	}
+	var jobs []Job
+	for _, yamlJob := range yamlJobs {
+		job := Job{
+			Name:              yamlJob.Name,
+			Schedule:          yamlJob.Schedule,
+			Command:           yamlJob.Command,
+			ConcurrencyPolicy: yamlJob.ConcurrencyPolicy,
+			Timeout:           time.Duration(yamlJob.Timeout) * time.Second,
+			Declared:          true,
+		}
+		if err = job.validate(); err != nil {
+			log.Errorf("[jobs] ignoring job %q declared in tsuru.yaml of app %s: %s", job.Name, app.Name, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	err = app.updateJobs("declaredjobs", jobs)
+	if err != nil {
+		return err
+	}
+	app.DeclaredJobs = jobs
+	return nil
+}
+
+func (app *App) updateJobs(field string, jobs []Job) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{field: jobs}})
+}
+
+// JobRun is a single execution of a job. The exit status and the last bytes
+// of the output of the command are stored when the run finishes.
+type JobRun struct {
+	ID        bson.ObjectId `bson:"_id" json:"id"`
+	App       string        `json:"app"`
+	Job       string        `json:"job"`
+	Command   string        `json:"command"`
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Deadline  time.Time     `json:"deadline"`
+	Running   bool          `json:"running"`
+	ExitCode  int           `json:"exitCode"`
+	Output    string        `json:"output,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Success returns whether the run finished without errors.
+func (r *JobRun) Success() bool {
+	return !r.Running && r.Error == "" && r.ExitCode == 0
+}
+
+// jobOutput keeps the last maxJobOutput bytes written to it, forwarding
+// everything to the app logs.
+type jobOutput struct {
+	mu   sync.Mutex
+	app  *App
+	job  string
+	data []byte
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data = append(o.data, p...)
+	if len(o.data) > maxJobOutput {
+		o.data = o.data[len(o.data)-maxJobOutput:]
+	}
+	err := o.app.Log(string(p), JobLogSource, o.job)
+	if err != nil {
+		log.Errorf("[jobs] unable to log output of job %q of app %s: %s", o.job, o.app.Name, err)
+	}
+	return len(p), nil
+}
+
+func (o *jobOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.data)
+}
+
+// RunJob executes the job in a new unit, waiting for it to finish. The run
+// is interrupted when it exceeds the job timeout or when the cancel channel
+// is closed. The returned error is the error of the run, which is also
+// stored in the run history.
+func (app *App) RunJob(job *Job, cancel <-chan struct{}) (*JobRun, error) {
+	jobProv, ok := Provisioner.(provision.JobProvisioner)
+	if !ok {
+		return nil, ErrJobsNotSupported
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	run := JobRun{
+		ID:        bson.NewObjectId(),
+		App:       app.Name,
+		Job:       job.Name,
+		Command:   job.Command,
+		StartTime: now,
+		Deadline:  now.Add(job.GetTimeout()),
+		Running:   true,
+	}
+	err = conn.JobRuns().Insert(&run)
+	if err != nil {
+		return nil, err
+	}
+	interrupt := make(chan struct{})
+	finished := make(chan struct{})
+	var timedOut bool
+	go func() {
+		select {
+		case <-cancel:
+		case <-time.After(job.GetTimeout()):
+			timedOut = true
+		case <-finished:
+			return
+		}
+		close(interrupt)
+	}()
+	output := jobOutput{app: app, job: job.Name}
+	exitCode, runErr := jobProv.RunJob(app, provision.JobOptions{
+		Name:    job.Name,
+		Command: job.Command,
+		Output:  &output,
+		Cancel:  interrupt,
+	})
+	close(finished)
+	if runErr == provision.ErrJobCanceled && timedOut {
+		runErr = fmt.Errorf("job timed out after %s", job.GetTimeout())
+	}
+	run.EndTime = time.Now().UTC()
+	run.Running = false
+	run.ExitCode = exitCode
+	run.Output = output.String()
+	if runErr != nil {
+		run.Error = runErr.Error()
+	} else if exitCode != 0 {
+		runErr = fmt.Errorf("job exited with status %d", exitCode)
+	}
+	err = conn.JobRuns().UpdateId(run.ID, &run)
+	if err != nil {
+		log.Errorf("[jobs] unable to store run of job %q of app %s: %s", job.Name, app.Name, err)
+	}
+	return &run, runErr
+}
+
+// ListJobRuns returns the most recent runs of the job, or of every job of the
+// app when job is empty. A limit lesser than or equal to zero means no limit.
+func ListJobRuns(appName, job string, limit int) ([]JobRun, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	filter := bson.M{"app": appName}
+	if job != "" {
+		filter["job"] = job
+	}
+	query := conn.JobRuns().Find(filter).Sort("-starttime", "-_id").Select(bson.M{"output": 0})
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var runs []JobRun
+	err = query.All(&runs)
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetJobRun returns the job run with the given id, including its output.
+func GetJobRun(appName, id string) (*JobRun, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrJobNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var run JobRun
+	err = conn.JobRuns().Find(bson.M{"_id": bson.ObjectIdHex(id), "app": appName}).One(&run)
+	if err == mgo.ErrNotFound {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// JobRunning returns whether the job has runs which are still running and
+// haven't reached their deadline.
+func JobRunning(appName, job string) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	n, err := conn.JobRuns().Find(bson.M{
+		"app":      appName,
+		"job":      job,
+		"running":  true,
+		"deadline": bson.M{"$gt": time.Now().UTC()},
+	}).Count()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func removeJobRuns(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.JobRuns().RemoveAll(bson.M{"app": appName})
+	return err
+}
+
+// ExpireLostJobRuns marks as finished the runs that are still running long
+// after their deadline, which happens when the tsuru API instance running
+// them dies.
+func ExpireLostJobRuns() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	_, err = conn.JobRuns().UpdateAll(
+		bson.M{"running": true, "deadline": bson.M{"$lt": now.Add(-jobRunGracePeriod)}},
+		bson.M{"$set": bson.M{"running": false, "endtime": now, "error": "job run lost"}},
+	)
+	return err
+}
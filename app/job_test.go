@@ -0,0 +1,226 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSetJob(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	job := Job{Name: "cleanup", Schedule: "*/5 * * * *", Command: "./cleanup.sh"}
+	err = a.SetJob(job)
+	c.Assert(err, check.IsNil)
+	job.Command = "./cleanup.sh --all"
+	job.Timeout = time.Minute
+	err = a.SetJob(job)
+	c.Assert(err, check.IsNil)
+	report := Job{Name: "report", Schedule: "@daily", Command: "./report.sh", ConcurrencyPolicy: JobConcurrencyForbid}
+	err = a.SetJob(report)
+	c.Assert(err, check.IsNil)
+	job.ConcurrencyPolicy = JobConcurrencyAllow
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Jobs, check.DeepEquals, []Job{job, report})
+	c.Assert(a.Jobs, check.DeepEquals, dbApp.Jobs)
+	apps, err := List(&Filter{WithJobs: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(apps, check.HasLen, 1)
+}
+
+func (s *S) TestSetJobValidation(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		job Job
+		err string
+	}{
+		{Job{Name: "Invalid Name", Schedule: "* * * * *", Command: "ls"}, "invalid value for name"},
+		{Job{Name: "ls", Schedule: "* * *", Command: "ls"}, "invalid value for schedule"},
+		{Job{Name: "ls", Schedule: "* * * * *"}, "invalid value for command"},
+		{Job{Name: "ls", Schedule: "* * * * *", Command: "ls", ConcurrencyPolicy: "queue"}, "invalid value for concurrency policy"},
+		{Job{Name: "ls", Schedule: "* * * * *", Command: "ls", Timeout: -1}, "invalid value for timeout"},
+	}
+	for _, t := range tests {
+		err = a.SetJob(t.job)
+		c.Assert(err, check.ErrorMatches, t.err)
+	}
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Jobs, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveJob(c *check.C) {
+	a := App{
+		Name:         "myapp",
+		TeamOwner:    s.team.Name,
+		Jobs:         []Job{{Name: "cleanup", Schedule: "@hourly", Command: "ls"}},
+		DeclaredJobs: []Job{{Name: "report", Schedule: "@daily", Command: "ls", Declared: true}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveJob("report")
+	c.Assert(err, check.Equals, ErrJobDeclared)
+	err = a.RemoveJob("unknown")
+	c.Assert(err, check.Equals, ErrJobNotFound)
+	err = a.RemoveJob("cleanup")
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Jobs, check.HasLen, 0)
+	c.Assert(dbApp.DeclaredJobs, check.HasLen, 1)
+}
+
+func (s *S) TestAllJobs(c *check.C) {
+	a := App{
+		Name: "myapp",
+		Jobs: []Job{{Name: "cleanup", Schedule: "@hourly", Command: "./cleanup.sh --all"}},
+		DeclaredJobs: []Job{
+			{Name: "cleanup", Schedule: "@daily", Command: "./cleanup.sh", Declared: true},
+			{Name: "report", Schedule: "@daily", Command: "./report.sh", Declared: true},
+		},
+	}
+	c.Assert(a.AllJobs(), check.DeepEquals, []Job{a.Jobs[0], a.DeclaredJobs[1]})
+	job, err := a.GetJob("cleanup")
+	c.Assert(err, check.IsNil)
+	c.Assert(job.Command, check.Equals, "./cleanup.sh --all")
+	_, err = a.GetJob("unknown")
+	c.Assert(err, check.Equals, ErrJobNotFound)
+}
+
+func (s *S) TestUpdateDeclaredJobs(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.SetDeclaredJobs(&a, []provision.TsuruYamlJob{
+		{Name: "report", Schedule: "0 3 * * *", Command: "./report.sh", ConcurrencyPolicy: "forbid", Timeout: 600},
+		{Name: "invalid", Schedule: "whenever", Command: "ls"},
+	})
+	c.Assert(err, check.IsNil)
+	err = a.updateDeclaredJobs()
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.DeclaredJobs, check.DeepEquals, []Job{{
+		Name:              "report",
+		Schedule:          "0 3 * * *",
+		Command:           "./report.sh",
+		ConcurrencyPolicy: JobConcurrencyForbid,
+		Timeout:           10 * time.Minute,
+		Declared:          true,
+	}})
+}
+
+func (s *S) TestRunJob(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareOutput([]byte("cleaning up\ndone\n"))
+	job := Job{Name: "cleanup", Schedule: "@hourly", Command: "./cleanup.sh"}
+	run, err := a.RunJob(&job, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(run.Success(), check.Equals, true)
+	c.Assert(run.Output, check.Equals, "cleaning up\ndone\n")
+	cmds := s.provisioner.GetCmds("./cleanup.sh", &a)
+	c.Assert(cmds, check.HasLen, 1)
+	dbRun, err := GetJobRun(a.Name, run.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbRun.Running, check.Equals, false)
+	c.Assert(dbRun.Output, check.Equals, "cleaning up\ndone\n")
+	logs, err := a.LastLogs(10, Applog{Source: JobLogSource})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Unit, check.Equals, "cleanup")
+}
+
+func (s *S) TestRunJobFailure(c *check.C) {
+	a := App{Name: "myapp", TeamOwner: s.team.Name}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareExitCode(2)
+	job := Job{Name: "cleanup", Schedule: "@hourly", Command: "./cleanup.sh"}
+	run, err := a.RunJob(&job, nil)
+	c.Assert(err, check.ErrorMatches, "job exited with status 2")
+	c.Assert(run.ExitCode, check.Equals, 2)
+	c.Assert(run.Success(), check.Equals, false)
+	s.provisioner.PrepareFailure("RunJob", errors.New("no nodes available"))
+	run, err = a.RunJob(&job, nil)
+	c.Assert(err, check.ErrorMatches, "no nodes available")
+	c.Assert(run.Error, check.Equals, "no nodes available")
+	runs, err := ListJobRuns(a.Name, "cleanup", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(runs, check.HasLen, 2)
+	c.Assert(runs[0].Error, check.Equals, "no nodes available")
+	c.Assert(runs[1].ExitCode, check.Equals, 2)
+}
+
+func (s *S) TestJobOutputKeepsLastBytes(c *check.C) {
+	a := App{Name: "myapp"}
+	output := jobOutput{app: &a, job: "cleanup"}
+	output.Write([]byte(strings.Repeat("a", maxJobOutput)))
+	output.Write([]byte("end"))
+	c.Assert(output.String(), check.HasLen, maxJobOutput)
+	c.Assert(strings.HasSuffix(output.String(), "aend"), check.Equals, true)
+}
+
+func (s *S) TestListJobRunsLimit(c *check.C) {
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		err := s.conn.JobRuns().Insert(JobRun{
+			ID:        bson.NewObjectId(),
+			App:       "myapp",
+			Job:       "cleanup",
+			StartTime: now.Add(time.Duration(i) * time.Minute),
+			Output:    "lots of output",
+		})
+		c.Assert(err, check.IsNil)
+	}
+	runs, err := ListJobRuns("myapp", "cleanup", 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(runs, check.HasLen, 2)
+	c.Assert(runs[0].StartTime.After(runs[1].StartTime), check.Equals, true)
+	c.Assert(runs[0].Output, check.Equals, "")
+	runs, err = ListJobRuns("otherapp", "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(runs, check.HasLen, 0)
+}
+
+func (s *S) TestJobRunningAndExpireLostJobRuns(c *check.C) {
+	now := time.Now().UTC()
+	active := JobRun{ID: bson.NewObjectId(), App: "myapp", Job: "cleanup", Running: true, Deadline: now.Add(time.Hour)}
+	lost := JobRun{ID: bson.NewObjectId(), App: "myapp", Job: "report", Running: true, Deadline: now.Add(-time.Hour)}
+	err := s.conn.JobRuns().Insert(active, lost)
+	c.Assert(err, check.IsNil)
+	running, err := JobRunning("myapp", "cleanup")
+	c.Assert(err, check.IsNil)
+	c.Assert(running, check.Equals, true)
+	running, err = JobRunning("myapp", "report")
+	c.Assert(err, check.IsNil)
+	c.Assert(running, check.Equals, false)
+	err = ExpireLostJobRuns()
+	c.Assert(err, check.IsNil)
+	run, err := GetJobRun("myapp", lost.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(run.Running, check.Equals, false)
+	c.Assert(run.Error, check.Equals, "job run lost")
+	run, err = GetJobRun("myapp", active.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(run.Running, check.Equals, true)
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jobs periodically triggers the scheduled jobs of apps, according to
+// their cron expressions and concurrency policies.
+//
+// Schedules have minute resolution and activations that happen while no tsuru
+// API instance is acting as the leader are not executed later.
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+)
+
+// Config holds the settings for the jobs worker. It must be created using
+// NewConfig.
+type Config struct {
+	RunInterval time.Duration
+	leader      *leader.Lease
+	done        chan bool
+	lastCheck   time.Time
+	mu          sync.Mutex
+	running     map[string][]chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewConfig creates a new jobs worker configuration reading its settings from
+// the "jobs" section in tsuru.conf.
+func NewConfig() *Config {
+	runInterval, _ := config.GetInt("jobs:run-interval")
+	if runInterval <= 0 {
+		runInterval = 30
+	}
+	interval := time.Duration(runInterval) * time.Second
+	return &Config{
+		RunInterval: interval,
+		leader:      leader.NewLease("app-jobs", 2*interval),
+		done:        make(chan bool),
+		running:     make(map[string][]chan struct{}),
+	}
+}
+
+// Initialize starts the jobs worker if it's enabled in tsuru.conf. The
+// returned Config can be used to stop it.
+func Initialize() *Config {
+	if enabled, _ := config.GetBool("jobs:enabled"); !enabled {
+		return nil
+	}
+	cfg := NewConfig()
+	go cfg.run()
+	return cfg
+}
+
+func (c *Config) run() {
+	for {
+		err := c.RunOnce()
+		if err != nil {
+			log.Errorf("[jobs] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.RunInterval):
+		}
+	}
+}
+
+// Shutdown stops the worker, killing the runs started by this instance and
+// waiting for them to finish.
+func (c *Config) Shutdown() {
+	c.done <- true
+	c.mu.Lock()
+	for key := range c.running {
+		c.cancelRuns(key)
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+func (c *Config) String() string {
+	return "app jobs"
+}
+
+// RunOnce triggers the jobs whose schedules activated since the last check.
+// Only one tsuru API instance is allowed to trigger jobs at a time, the
+// others skip the run while a leader is active.
+func (c *Config) RunOnce() error {
+	return c.runAt(time.Now().UTC())
+}
+
+func (c *Config) runAt(now time.Time) (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	isLeader, err := c.leader.Acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire leadership: %s", err)
+	}
+	if !isLeader {
+		log.Debugf("[jobs] skipping run, another instance is the leader")
+		c.lastCheck = time.Time{}
+		return nil
+	}
+	if c.lastCheck.IsZero() {
+		// Just became the leader, activations before now belong to the
+		// previous leader.
+		c.lastCheck = now
+		return nil
+	}
+	from := c.lastCheck
+	c.lastCheck = now
+	err = app.ExpireLostJobRuns()
+	if err != nil {
+		log.Errorf("[jobs] unable to expire lost job runs: %s", err)
+	}
+	apps, err := app.List(&app.Filter{WithJobs: true})
+	if err != nil {
+		return fmt.Errorf("unable to list apps: %s", err)
+	}
+	for i := range apps {
+		a := &apps[i]
+		for _, job := range a.AllJobs() {
+			schedule, err := job.ParseSchedule()
+			if err != nil {
+				log.Errorf("[jobs] invalid schedule for job %q of app %s: %s", job.Name, a.Name, err)
+				continue
+			}
+			next := schedule.Next(from)
+			if next.IsZero() || next.After(now) {
+				continue
+			}
+			err = c.trigger(a, job)
+			if err != nil {
+				log.Errorf("[jobs] unable to trigger job %q of app %s: %s", job.Name, a.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func runKey(a *app.App, job *app.Job) string {
+	return a.Name + "/" + job.Name
+}
+
+// trigger starts a new run of the job, respecting its concurrency policy.
+func (c *Config) trigger(a *app.App, job app.Job) error {
+	key := runKey(a, &job)
+	switch job.ConcurrencyPolicy {
+	case app.JobConcurrencyForbid:
+		running, err := app.JobRunning(a.Name, job.Name)
+		if err != nil {
+			return err
+		}
+		if running {
+			log.Debugf("[jobs] skipping job %q of app %s, previous run still running", job.Name, a.Name)
+			return nil
+		}
+	case app.JobConcurrencyReplace:
+		c.mu.Lock()
+		c.cancelRuns(key)
+		c.mu.Unlock()
+	}
+	cancel := make(chan struct{})
+	c.mu.Lock()
+	c.running[key] = append(c.running[key], cancel)
+	c.mu.Unlock()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.removeRun(key, cancel)
+		run, err := a.RunJob(&job, cancel)
+		if err != nil {
+			if run == nil {
+				log.Errorf("[jobs] unable to run job %q of app %s: %s", job.Name, a.Name, err)
+				return
+			}
+			log.Errorf("[jobs] run %s of job %q of app %s failed: %s", run.ID.Hex(), job.Name, a.Name, err)
+		}
+	}()
+	return nil
+}
+
+// cancelRuns interrupts the runs of the job started by this instance. It must
+// be called with c.mu locked.
+func (c *Config) cancelRuns(key string) {
+	for _, cancel := range c.running[key] {
+		close(cancel)
+	}
+	delete(c.running, key)
+}
+
+func (c *Config) removeRun(key string, cancel chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	runs := c.running[key]
+	for i, ch := range runs {
+		if ch == cancel {
+			c.running[key] = append(runs[:i], runs[i+1:]...)
+			break
+		}
+	}
+	if len(c.running[key]) == 0 {
+		delete(c.running, key)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jobs
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) newApp(c *check.C, jobs ...app.Job) *app.App {
+	a := app.App{Name: "myapp", Quota: quota.Unlimited, Jobs: jobs}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestRunOnceFirstRunOnlyStartsTracking(c *check.C) {
+	a := s.newApp(c, app.Job{Name: "cleanup", Schedule: "* * * * *", Command: "./cleanup.sh"})
+	cfg := NewConfig()
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	cfg.wg.Wait()
+	c.Assert(cfg.lastCheck.IsZero(), check.Equals, false)
+	c.Assert(s.Provisioner.GetCmds("", a), check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceTriggersDueJobs(c *check.C) {
+	a := s.newApp(c,
+		app.Job{Name: "cleanup", Schedule: "*/5 * * * *", Command: "./cleanup.sh"},
+		app.Job{Name: "report", Schedule: "0 3 * * *", Command: "./report.sh"},
+	)
+	cfg := NewConfig()
+	cfg.lastCheck = time.Date(2016, 3, 10, 10, 4, 30, 0, time.UTC)
+	err := cfg.runAt(time.Date(2016, 3, 10, 10, 5, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	cfg.wg.Wait()
+	c.Assert(s.Provisioner.GetCmds("./cleanup.sh", a), check.HasLen, 1)
+	c.Assert(s.Provisioner.GetCmds("./report.sh", a), check.HasLen, 0)
+	runs, err := app.ListJobRuns(a.Name, "cleanup", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(runs, check.HasLen, 1)
+	c.Assert(runs[0].Running, check.Equals, false)
+	err = cfg.runAt(time.Date(2016, 3, 10, 10, 5, 30, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	cfg.wg.Wait()
+	c.Assert(s.Provisioner.GetCmds("./cleanup.sh", a), check.HasLen, 1)
+}
+
+func (s *S) TestRunOnceConcurrencyForbid(c *check.C) {
+	a := s.newApp(c, app.Job{
+		Name: "cleanup", Schedule: "* * * * *", Command: "./cleanup.sh", ConcurrencyPolicy: app.JobConcurrencyForbid,
+	})
+	err := s.Conn.JobRuns().Insert(app.JobRun{
+		ID:       bson.NewObjectId(),
+		App:      a.Name,
+		Job:      "cleanup",
+		Running:  true,
+		Deadline: time.Now().UTC().Add(time.Hour),
+	})
+	c.Assert(err, check.IsNil)
+	cfg := NewConfig()
+	cfg.lastCheck = time.Now().UTC().Add(-time.Minute)
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	cfg.wg.Wait()
+	c.Assert(s.Provisioner.GetCmds("./cleanup.sh", a), check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceConcurrencyReplace(c *check.C) {
+	a := s.newApp(c, app.Job{
+		Name: "cleanup", Schedule: "* * * * *", Command: "./cleanup.sh", ConcurrencyPolicy: app.JobConcurrencyReplace,
+	})
+	cfg := NewConfig()
+	previous := make(chan struct{})
+	cfg.running["myapp/cleanup"] = []chan struct{}{previous}
+	cfg.lastCheck = time.Now().UTC().Add(-time.Minute)
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	cfg.wg.Wait()
+	select {
+	case <-previous:
+	default:
+		c.Fatal("previous run should have been canceled")
+	}
+	c.Assert(s.Provisioner.GetCmds("./cleanup.sh", a), check.HasLen, 1)
+	c.Assert(cfg.running, check.HasLen, 0)
+}
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/queue"
 )
@@ -27,6 +26,18 @@ func logQueueName(appName string) string {
 }
 
 func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
+	return NewLogQueryListener(a, filterLog.logQuery())
+}
+
+// NewLogQueryListener returns a listener to the new logs of the app matching
+// the query. Query.Since, Query.Until, Query.Limit and Query.Before are
+// ignored.
+func NewLogQueryListener(a *App, query LogQuery) (*LogListener, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	query = query.tailQuery()
 	factory, err := queue.Factory()
 	if err != nil {
 		return nil, err
@@ -49,8 +60,7 @@ func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
 				log.Errorf("Unparsable log message, ignoring: %s", string(msg))
 				continue
 			}
-			if (filterLog.Source == "" || filterLog.Source == applog.Source) &&
-				(filterLog.Unit == "" || filterLog.Unit == applog.Unit) {
+			if query.matches(&applog) {
 				c <- applog
 			}
 		}
@@ -170,7 +180,7 @@ func (d *appLogDispatcher) runFlusher() {
 	t := time.NewTimer(bulkMaxWaitTime)
 	pos := 0
 	sz := 200
-	bulkBuffer := make([]interface{}, sz)
+	bulkBuffer := make([]Applog, sz)
 	for {
 		var flush bool
 		select {
@@ -181,7 +191,7 @@ func (d *appLogDispatcher) runFlusher() {
 				flush = true
 				break
 			}
-			bulkBuffer[pos] = msg
+			bulkBuffer[pos] = *msg
 			pos++
 			flush = sz == pos
 		case <-t.C:
@@ -189,18 +199,17 @@ func (d *appLogDispatcher) runFlusher() {
 			t.Reset(bulkMaxWaitTime)
 		}
 		if flush {
-			conn, err := db.LogConn()
+			logStorage, err := GetLogStorage()
 			if err != nil {
-				log.Errorf("[log flusher] unable to connect to mongodb: %s", err)
+				log.Errorf("[log flusher] unable to get log storage: %s", err)
 				continue
 			}
-			coll := conn.Logs(d.appName)
-			err = coll.Insert(bulkBuffer[:pos]...)
-			coll.Close()
+			err = logStorage.Insert(d.appName, bulkBuffer[:pos])
 			if err != nil {
 				log.Errorf("[log flusher] unable to insert logs: %s", err)
 				continue
 			}
+			logDrains.send(d.appName, bulkBuffer[:pos])
 			pos = 0
 		}
 	}
@@ -0,0 +1,640 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLogDrainBufferSize      = 1000
+	defaultLogDrainRefreshInterval = 30 * time.Second
+	defaultLogDrainTimeout         = 10 * time.Second
+
+	logDrainBatchSize     = 100
+	logDrainFlushInterval = time.Second
+)
+
+var (
+	ErrLogDrainNotFound      = errors.New("log drain not found")
+	ErrLogDrainAlreadyExists = errors.New("there is already a log drain with this name")
+
+	logDrainNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]{0,39}$`)
+
+	logDrainSenders = map[string]func(u *url.URL, timeout time.Duration) logDrainSender{
+		"syslog":     newSyslogDrainSender,
+		"syslog+udp": newSyslogDrainSender,
+		"syslog+tcp": newSyslogDrainSender,
+		"syslog+tls": newSyslogDrainSender,
+		"http":       newHTTPDrainSender,
+		"https":      newHTTPDrainSender,
+	}
+
+	logDrains = newLogDrainManager()
+)
+
+type LogDrainValidationError struct{ field string }
+
+func (e LogDrainValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s", e.field)
+}
+
+// LogDrain is a destination where the logs of an app are forwarded to, after
+// being stored by tsuru. The scheme of the URL defines how logs are sent:
+//
+//   - syslog://host:port or syslog+udp://host:port sends each log as a
+//     RFC 5424 syslog message over UDP;
+//   - syslog+tcp://host:port and syslog+tls://host:port send the same
+//     messages over TCP and TLS, using octet counting framing;
+//   - http://host/path and https://host/path send batches of logs as JSON
+//     arrays in POST requests.
+type LogDrain struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (d *LogDrain) validate() error {
+	if !logDrainNameRegexp.MatchString(d.Name) {
+		return LogDrainValidationError{"name"}
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Host == "" || logDrainSenders[u.Scheme] == nil {
+		return LogDrainValidationError{"url"}
+	}
+	if strings.HasPrefix(u.Scheme, "syslog") {
+		_, port, err := net.SplitHostPort(u.Host)
+		if err != nil || port == "" {
+			return LogDrainValidationError{"url"}
+		}
+	}
+	// Hosts that can't be resolved now are checked again when logs are sent.
+	if !logDrainAllowInternal() && tsuruNet.CheckExternalHost(tsuruNet.URLToHost(d.URL)) == tsuruNet.ErrInternalAddress {
+		return LogDrainValidationError{"url"}
+	}
+	return nil
+}
+
+// redactedURL returns the URL of the drain without the password, if any.
+func (d *LogDrain) redactedURL() string {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.User == nil {
+		return d.URL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// LogDrainStatus reports the health of a log drain in this tsuru API
+// instance. Sent and Failed count the logs sent and the logs that could not
+// be delivered, while Dropped counts the logs discarded because the buffer
+// of the drain was full.
+type LogDrainStatus struct {
+	Name          string    `json:"name"`
+	URL           string    `json:"url"`
+	Healthy       bool      `json:"healthy"`
+	Buffered      int       `json:"buffered"`
+	Sent          uint64    `json:"sent"`
+	Failed        uint64    `json:"failed"`
+	Dropped       uint64    `json:"dropped"`
+	LastSent      time.Time `json:"lastSent"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+}
+
+// AddLogDrain validates and stores the given log drain.
+func (app *App) AddLogDrain(drain LogDrain) error {
+	err := drain.validate()
+	if err != nil {
+		return err
+	}
+	return app.updateLogDrains(
+		bson.M{"name": app.Name, "logdrains.name": bson.M{"$ne": drain.Name}},
+		bson.M{"$push": bson.M{"logdrains": drain}},
+		ErrLogDrainAlreadyExists,
+	)
+}
+
+// RemoveLogDrain removes the log drain with the given name.
+func (app *App) RemoveLogDrain(name string) error {
+	return app.updateLogDrains(
+		bson.M{"name": app.Name, "logdrains.name": name},
+		bson.M{"$pull": bson.M{"logdrains": bson.M{"name": name}}},
+		ErrLogDrainNotFound,
+	)
+}
+
+// updateLogDrains applies the update to the drains of the app, returning
+// notFoundErr if the query doesn't match, and reloads them from the
+// database, so concurrent changes are never lost.
+func (app *App) updateLogDrains(query, update bson.M, notFoundErr error) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(query, update)
+	if err == mgo.ErrNotFound {
+		return notFoundErr
+	}
+	if err != nil {
+		return err
+	}
+	drains, err := loadLogDrains(app.Name)
+	if err != nil {
+		return err
+	}
+	app.LogDrains = drains
+	logDrains.reload(app.Name, drains)
+	return nil
+}
+
+// LogDrainsStatus returns the status of the log drains of the app.
+func (app *App) LogDrainsStatus() []LogDrainStatus {
+	return logDrains.status(app.Name, app.LogDrains)
+}
+
+// logDrainSender delivers logs to a drain.
+type logDrainSender interface {
+	Send(logs []Applog) error
+	Close() error
+}
+
+type logDrainWorker struct {
+	drain   LogDrain
+	sender  logDrainSender
+	queue   chan Applog
+	done    chan struct{}
+	sent    uint64
+	failed  uint64
+	dropped uint64
+
+	mu            sync.Mutex
+	lastSent      time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func newLogDrainWorker(drain LogDrain, sender logDrainSender, bufferSize int) *logDrainWorker {
+	w := &logDrainWorker{
+		drain:  drain,
+		sender: sender,
+		queue:  make(chan Applog, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue adds the logs to the buffer of the worker, dropping the logs that
+// don't fit, so a slow drain never blocks the log dispatcher.
+func (w *logDrainWorker) enqueue(logs []Applog) {
+	for i, l := range logs {
+		select {
+		case w.queue <- l:
+		default:
+			atomic.AddUint64(&w.dropped, uint64(len(logs)-i))
+			return
+		}
+	}
+}
+
+func (w *logDrainWorker) run() {
+	defer w.sender.Close()
+	batch := make([]Applog, 0, logDrainBatchSize)
+	t := time.NewTimer(logDrainFlushInterval)
+	defer t.Stop()
+	for {
+		flush := false
+		select {
+		case <-w.done:
+			return
+		case l := <-w.queue:
+			batch = append(batch, l)
+			flush = len(batch) == logDrainBatchSize
+		case <-t.C:
+			flush = len(batch) > 0
+			t.Reset(logDrainFlushInterval)
+		}
+		if flush {
+			w.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (w *logDrainWorker) send(batch []Applog) {
+	err := w.sender.Send(batch)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		atomic.AddUint64(&w.failed, uint64(len(batch)))
+		w.lastError = err.Error()
+		w.lastErrorTime = time.Now()
+		log.Errorf("[log drain] unable to send logs of %s to drain %q: %s", batch[0].AppName, w.drain.Name, err)
+		return
+	}
+	atomic.AddUint64(&w.sent, uint64(len(batch)))
+	w.lastSent = time.Now()
+}
+
+func (w *logDrainWorker) stop() {
+	close(w.done)
+}
+
+func (w *logDrainWorker) status() LogDrainStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return LogDrainStatus{
+		Name:          w.drain.Name,
+		URL:           w.drain.redactedURL(),
+		Healthy:       w.lastError == "" || w.lastSent.After(w.lastErrorTime),
+		Buffered:      len(w.queue),
+		Sent:          atomic.LoadUint64(&w.sent),
+		Failed:        atomic.LoadUint64(&w.failed),
+		Dropped:       atomic.LoadUint64(&w.dropped),
+		LastSent:      w.lastSent,
+		LastError:     w.lastError,
+		LastErrorTime: w.lastErrorTime,
+	}
+}
+
+type appLogDrains struct {
+	loadedAt time.Time
+	workers  map[string]*logDrainWorker
+}
+
+// logDrainManager keeps a worker for each log drain of the apps that sent
+// logs through this tsuru API instance. The drains of each app are loaded
+// from the database and reloaded after log-drains:refresh-interval, so
+// changes made through other instances are eventually applied.
+type logDrainManager struct {
+	mu        sync.Mutex
+	apps      map[string]*appLogDrains
+	lastSweep time.Time
+}
+
+func newLogDrainManager() *logDrainManager {
+	return &logDrainManager{apps: make(map[string]*appLogDrains)}
+}
+
+// send forwards the logs of the app to all its drains. The drains are loaded
+// from the database without holding the lock, so logs of other apps are
+// never blocked by it.
+func (m *logDrainManager) send(appName string, logs []Applog) {
+	if len(logs) == 0 {
+		return
+	}
+	workers, stale := m.workers(appName)
+	if stale {
+		loadStart := time.Now()
+		drains, err := loadLogDrains(appName)
+		if err != nil {
+			log.Errorf("[log drain] unable to load log drains of %s: %s", appName, err)
+			return
+		}
+		m.mu.Lock()
+		entry := m.apps[appName]
+		if entry == nil || entry.loadedAt.Before(loadStart) {
+			entry = m.reloadLocked(appName, drains)
+		}
+		workers = entry.workerList()
+		m.sweepLocked()
+		m.mu.Unlock()
+	}
+	for _, w := range workers {
+		w.enqueue(logs)
+	}
+}
+
+// workers returns the workers of the app and whether its drains must be
+// loaded again.
+func (m *logDrainManager) workers(appName string) ([]*logDrainWorker, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := m.apps[appName]
+	if entry == nil || time.Since(entry.loadedAt) > logDrainRefreshInterval() {
+		return nil, true
+	}
+	return entry.workerList(), false
+}
+
+func (e *appLogDrains) workerList() []*logDrainWorker {
+	workers := make([]*logDrainWorker, 0, len(e.workers))
+	for _, w := range e.workers {
+		workers = append(workers, w)
+	}
+	return workers
+}
+
+// remove stops the workers of the app, it's called when the app is removed.
+func (m *logDrainManager) remove(appName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(appName)
+}
+
+func (m *logDrainManager) removeLocked(appName string) {
+	entry := m.apps[appName]
+	if entry == nil {
+		return
+	}
+	for _, w := range entry.workers {
+		w.stop()
+	}
+	delete(m.apps, appName)
+}
+
+// sweepLocked stops the workers of the apps that didn't send logs for two
+// refresh intervals, like apps removed through other tsuru API instances. It
+// must be called with m.mu held.
+func (m *logDrainManager) sweepLocked() {
+	interval := logDrainRefreshInterval()
+	if time.Since(m.lastSweep) < interval {
+		return
+	}
+	m.lastSweep = time.Now()
+	for appName, entry := range m.apps {
+		if time.Since(entry.loadedAt) > 2*interval {
+			m.removeLocked(appName)
+		}
+	}
+}
+
+func loadLogDrains(appName string) ([]LogDrain, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var a App
+	err = conn.Apps().Find(bson.M{"name": appName}).Select(bson.M{"logdrains": 1}).One(&a)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	return a.LogDrains, nil
+}
+
+func (m *logDrainManager) reload(appName string, drains []LogDrain) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reloadLocked(appName, drains)
+}
+
+// reloadLocked starts workers for new drains and stops the workers of
+// removed or changed drains. It must be called with m.mu held.
+func (m *logDrainManager) reloadLocked(appName string, drains []LogDrain) *appLogDrains {
+	entry := m.apps[appName]
+	if entry == nil {
+		entry = &appLogDrains{workers: make(map[string]*logDrainWorker)}
+		m.apps[appName] = entry
+	}
+	entry.loadedAt = time.Now()
+	current := make(map[string]bool, len(drains))
+	for _, d := range drains {
+		current[d.Name] = true
+		w := entry.workers[d.Name]
+		if w != nil && w.drain == d {
+			continue
+		}
+		if w != nil {
+			w.stop()
+		}
+		sender, err := newLogDrainSender(d)
+		if err != nil {
+			log.Errorf("[log drain] invalid log drain %q of %s: %s", d.Name, appName, err)
+			delete(entry.workers, d.Name)
+			continue
+		}
+		entry.workers[d.Name] = newLogDrainWorker(d, sender, logDrainBufferSize())
+	}
+	for name, w := range entry.workers {
+		if !current[name] {
+			w.stop()
+			delete(entry.workers, name)
+		}
+	}
+	return entry
+}
+
+// status returns the status of the given drains, drains without a worker in
+// this instance are reported as healthy with zeroed counters.
+func (m *logDrainManager) status(appName string, drains []LogDrain) []LogDrainStatus {
+	m.mu.Lock()
+	workers := make([]*logDrainWorker, len(drains))
+	if entry := m.apps[appName]; entry != nil {
+		for i, d := range drains {
+			if w := entry.workers[d.Name]; w != nil && w.drain == d {
+				workers[i] = w
+			}
+		}
+	}
+	m.mu.Unlock()
+	result := make([]LogDrainStatus, len(drains))
+	for i, d := range drains {
+		if workers[i] != nil {
+			result[i] = workers[i].status()
+			continue
+		}
+		result[i] = LogDrainStatus{Name: d.Name, URL: d.redactedURL(), Healthy: true}
+	}
+	return result
+}
+
+func logDrainBufferSize() int {
+	if size, err := config.GetInt("log-drains:buffer-size"); err == nil && size > 0 {
+		return size
+	}
+	return defaultLogDrainBufferSize
+}
+
+func logDrainRefreshInterval() time.Duration {
+	if interval, err := config.GetInt("log-drains:refresh-interval"); err == nil && interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return defaultLogDrainRefreshInterval
+}
+
+func logDrainAllowInternal() bool {
+	allow, _ := config.GetBool("log-drains:allow-internal-addresses")
+	return allow
+}
+
+func logDrainTimeout() time.Duration {
+	if timeout, err := config.GetInt("log-drains:timeout"); err == nil && timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defaultLogDrainTimeout
+}
+
+func newLogDrainSender(d LogDrain) (logDrainSender, error) {
+	err := d.validate()
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(d.URL)
+	return logDrainSenders[u.Scheme](u, logDrainTimeout()), nil
+}
+
+// syslogDrainSender sends logs as RFC 5424 messages, using the app name as
+// hostname, the source as app-name and the unit as procid.
+type syslogDrainSender struct {
+	network string
+	address string
+	useTLS  bool
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func newSyslogDrainSender(u *url.URL, timeout time.Duration) logDrainSender {
+	s := syslogDrainSender{address: u.Host, network: "udp", timeout: timeout}
+	switch u.Scheme {
+	case "syslog+tcp":
+		s.network = "tcp"
+	case "syslog+tls":
+		s.network = "tcp"
+		s.useTLS = true
+	}
+	return &s
+}
+
+func syslogValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.Replace(value, " ", "_", -1)
+}
+
+// formatSyslog returns the log formatted as a RFC 5424 message, with facility
+// user and severity info, or error for logs from stderr.
+func formatSyslog(l *Applog) []byte {
+	priority := 1*8 + 6
+	if l.Source == "stderr" {
+		priority = 1*8 + 3
+	}
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %s - - %s", priority,
+		l.Date.UTC().Format(time.RFC3339Nano), syslogValue(l.AppName),
+		syslogValue(l.Source), syslogValue(l.Unit), l.Message))
+}
+
+func (s *syslogDrainSender) dial() error {
+	if s.conn != nil {
+		return nil
+	}
+	dial := (&net.Dialer{Timeout: s.timeout}).Dial
+	if !logDrainAllowInternal() {
+		dial = tsuruNet.ExternalDial(s.timeout)
+	}
+	conn, err := dial(s.network, s.address)
+	if err != nil {
+		return err
+	}
+	if s.useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: tsuruNet.URLToHost(s.address)})
+		tlsConn.SetDeadline(time.Now().Add(s.timeout))
+		err = tlsConn.Handshake()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogDrainSender) Send(logs []Applog) error {
+	err := s.dial()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i := range logs {
+		msg := formatSyslog(&logs[i])
+		if s.network == "udp" {
+			_, err = s.conn.Write(msg)
+			if err != nil {
+				break
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+	}
+	if err == nil && buf.Len() > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		_, err = buf.WriteTo(s.conn)
+	}
+	if err != nil {
+		s.Close()
+	}
+	return err
+}
+
+func (s *syslogDrainSender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// httpDrainSender sends logs as a JSON array in the body of POST requests.
+type httpDrainSender struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPDrainSender(u *url.URL, timeout time.Duration) logDrainSender {
+	client := &http.Client{Timeout: timeout}
+	if !logDrainAllowInternal() {
+		client.Transport = &http.Transport{Dial: tsuruNet.ExternalDial(timeout)}
+	}
+	return &httpDrainSender{url: u.String(), client: client}
+}
+
+func (s *httpDrainSender) Send(logs []Applog) error {
+	body, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	rsp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body)
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpDrainSender) Close() error {
+	return nil
+}
@@ -0,0 +1,342 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultLogStorage = "mongodb"
+
+// ErrInvalidLogCursor is returned by Find when LogQuery.Before is not a
+// cursor returned by the same storage.
+var ErrInvalidLogCursor = stderr.New("invalid log cursor")
+
+var logStorages = map[string]func() (LogStorage, error){
+	"mongodb": newMongoLogStorage,
+	"file":    newFileLogStorage,
+}
+
+// LogQuery represents the filters used to find app logs. Empty fields are
+// ignored.
+type LogQuery struct {
+	// Sources and Units restrict the logs to any of the given sources and
+	// units.
+	Sources []string
+	Units   []string
+
+	// Message restricts the logs to the ones containing the given text,
+	// while MessageRegexp restricts them to the ones matching the given
+	// regular expression.
+	Message       string
+	MessageRegexp string
+
+	Since time.Time
+	Until time.Time
+	Limit int
+
+	// Before is a cursor returned by a previous call to Find, restricting
+	// the logs to the ones older than the last page.
+	Before string
+
+	messageRe *regexp.Regexp
+}
+
+// Validate checks the query, compiling the regular expression in
+// MessageRegexp.
+func (q *LogQuery) Validate() error {
+	if q.MessageRegexp != "" {
+		re, err := regexp.Compile(q.MessageRegexp)
+		if err != nil {
+			return &errors.ValidationError{Message: fmt.Sprintf("invalid message regular expression: %s", err)}
+		}
+		q.messageRe = re
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Before(q.Since) {
+		return &errors.ValidationError{Message: "until must not be before since"}
+	}
+	if q.Limit < 0 {
+		return &errors.ValidationError{Message: "limit must not be negative"}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *LogQuery) matches(l *Applog) bool {
+	return (len(q.Sources) == 0 || containsString(q.Sources, l.Source)) &&
+		(len(q.Units) == 0 || containsString(q.Units, l.Unit)) &&
+		(q.Message == "" || strings.Contains(l.Message, q.Message)) &&
+		(q.messageRe == nil || q.messageRe.MatchString(l.Message)) &&
+		(q.Since.IsZero() || !l.Date.Before(q.Since)) &&
+		(q.Until.IsZero() || !l.Date.After(q.Until))
+}
+
+// tailQuery returns a copy of the query keeping only the filters that apply
+// to logs as they arrive.
+func (q *LogQuery) tailQuery() LogQuery {
+	return LogQuery{
+		Sources:       q.Sources,
+		Units:         q.Units,
+		Message:       q.Message,
+		MessageRegexp: q.MessageRegexp,
+		messageRe:     q.messageRe,
+	}
+}
+
+// logQuery returns the query matching the source and unit of the log, used
+// by the functions receiving an Applog as an example.
+func (l *Applog) logQuery() LogQuery {
+	var query LogQuery
+	if l.Source != "" {
+		query.Sources = []string{l.Source}
+	}
+	if l.Unit != "" {
+		query.Units = []string{l.Unit}
+	}
+	return query
+}
+
+// LogStorage is the interface implemented by backends that store app logs.
+// The backend is selected with the app-logs:storage setting in tsuru.conf.
+type LogStorage interface {
+	// Insert stores the given logs of the app.
+	Insert(appName string, logs []Applog) error
+
+	// Find returns the last logs of the app matching the query, in
+	// chronological order. Query.Limit is the maximum number of logs
+	// returned, zero means no limit. When older logs matching the query
+	// exist, Find also returns a cursor that can be used as Query.Before to
+	// fetch them.
+	Find(appName string, query LogQuery) ([]Applog, string, error)
+
+	// Tail returns a cursor to the logs of the app matching the query that
+	// are inserted after the cursor is created. Query.Since, Query.Until,
+	// Query.Limit and Query.Before are ignored. Calls to Next on the cursor wait up to
+	// timeout for new logs.
+	Tail(appName string, query LogQuery, timeout time.Duration) (LogCursor, error)
+
+	// Remove removes all logs of the app.
+	Remove(appName string) error
+}
+
+// LogCursor iterates over logs as they're inserted, in the same way as a
+// tailable cursor in MongoDB.
+type LogCursor interface {
+	// Next stores the next log in l, returning false when no log is
+	// available before the timeout or when an error occurs.
+	Next(l *Applog) bool
+
+	// Timeout returns whether the last call to Next returned false because
+	// the timeout expired.
+	Timeout() bool
+
+	// Err returns the error that stopped the cursor, if any.
+	Err() error
+
+	// Close closes the cursor, releasing its resources.
+	Close() error
+}
+
+// GetLogStorage returns the log storage configured in tsuru.conf, defaulting
+// to MongoDB.
+func GetLogStorage() (LogStorage, error) {
+	name, _ := config.GetString("app-logs:storage")
+	if name == "" {
+		name = defaultLogStorage
+	}
+	factory, ok := logStorages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown log storage: %q", name)
+	}
+	return factory()
+}
+
+type mongoLogStorage struct{}
+
+func newMongoLogStorage() (LogStorage, error) {
+	return &mongoLogStorage{}, nil
+}
+
+func (s *mongoLogStorage) Insert(appName string, logs []Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	docs := make([]interface{}, len(logs))
+	for i := range logs {
+		docs[i] = logs[i]
+	}
+	return conn.Logs(appName).Insert(docs...)
+}
+
+func mongoLogQuery(query LogQuery) bson.M {
+	q := bson.M{}
+	if len(query.Sources) > 0 {
+		q["source"] = bson.M{"$in": query.Sources}
+	}
+	if len(query.Units) > 0 {
+		q["unit"] = bson.M{"$in": query.Units}
+	}
+	if query.Message != "" {
+		q["message"] = bson.RegEx{Pattern: regexp.QuoteMeta(query.Message)}
+	}
+	date := bson.M{}
+	if !query.Since.IsZero() {
+		date["$gte"] = query.Since
+	}
+	if !query.Until.IsZero() {
+		date["$lte"] = query.Until
+	}
+	if len(date) > 0 {
+		q["date"] = date
+	}
+	return q
+}
+
+type mongoLogEntry struct {
+	ID     bson.ObjectId `bson:"_id"`
+	Applog `bson:",inline"`
+}
+
+// Find reads the logs in reverse natural order, which is the insertion order
+// of the capped log collections, so no index or in memory sort is needed. The
+// cursor is the id of the oldest log returned. Query.MessageRegexp is matched
+// in tsuru, only literal text is matched by MongoDB.
+func (s *mongoLogStorage) Find(appName string, query LogQuery) ([]Applog, string, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, "", err
+	}
+	q := mongoLogQuery(query)
+	if query.Before != "" {
+		if !bson.IsObjectIdHex(query.Before) {
+			return nil, "", ErrInvalidLogCursor
+		}
+		q["_id"] = bson.M{"$lt": bson.ObjectIdHex(query.Before)}
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	find := conn.Logs(appName).Find(q).Sort("-$natural")
+	if query.Limit > 0 && query.messageRe == nil {
+		find = find.Limit(query.Limit + 1)
+	}
+	var entries []mongoLogEntry
+	iter := find.Iter()
+	for {
+		var entry mongoLogEntry
+		if !iter.Next(&entry) {
+			break
+		}
+		if query.messageRe != nil && !query.messageRe.MatchString(entry.Message) {
+			continue
+		}
+		entries = append(entries, entry)
+		if query.Limit > 0 && len(entries) > query.Limit {
+			break
+		}
+	}
+	err = iter.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	var cursor string
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+		cursor = entries[len(entries)-1].ID.Hex()
+	}
+	logs := make([]Applog, len(entries))
+	for i := range entries {
+		logs[len(entries)-1-i] = entries[i].Applog
+	}
+	return logs, cursor, nil
+}
+
+func (s *mongoLogStorage) Tail(appName string, query LogQuery, timeout time.Duration) (LogCursor, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Logs(appName)
+	q := mongoLogQuery(query.tailQuery())
+	var last struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	err = coll.Find(nil).Sort("-$natural").Select(bson.M{"_id": 1}).One(&last)
+	if err != nil && err != mgo.ErrNotFound {
+		conn.Close()
+		return nil, err
+	}
+	if last.ID != "" {
+		q["_id"] = bson.M{"$gt": last.ID}
+	}
+	iter := coll.Find(q).Sort("$natural").Tail(timeout)
+	return &mongoLogCursor{iter: iter, conn: conn, messageRe: query.messageRe}, nil
+}
+
+func (s *mongoLogStorage) Remove(appName string) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Logs(appName).DropCollection()
+}
+
+type mongoLogCursor struct {
+	iter      *mgo.Iter
+	conn      *db.LogStorage
+	messageRe *regexp.Regexp
+}
+
+func (c *mongoLogCursor) Next(l *Applog) bool {
+	for c.iter.Next(l) {
+		if c.messageRe == nil || c.messageRe.MatchString(l.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *mongoLogCursor) Timeout() bool {
+	return c.iter.Timeout()
+}
+
+func (c *mongoLogCursor) Err() error {
+	return c.iter.Err()
+}
+
+func (c *mongoLogCursor) Close() error {
+	defer c.conn.Close()
+	return c.iter.Close()
+}
@@ -0,0 +1,484 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	defaultLogSegmentSize = 10 << 20
+	defaultLogSegments    = 5
+	logSegmentSuffix      = ".log"
+	maxLogLineSize        = 1 << 20
+)
+
+var (
+	fileLogLocksMut sync.Mutex
+	fileLogLocks    = map[string]*sync.Mutex{}
+
+	fileLogPollInterval = 100 * time.Millisecond
+)
+
+// fileLogStorage stores the logs of each app in a directory, as a sequence of
+// segment files containing one JSON encoded log per line. A new segment is
+// started when the current one reaches app-logs:file:max-segment-size, and
+// old segments are removed according to app-logs:file:max-segments and
+// app-logs:file:max-age.
+type fileLogStorage struct {
+	dir         string
+	segmentSize int64
+	maxSegments int
+	maxAge      time.Duration
+}
+
+func newFileLogStorage() (LogStorage, error) {
+	dir, err := config.GetString("app-logs:file:dir")
+	if err != nil || dir == "" {
+		return nil, fmt.Errorf("app-logs:file:dir must be set to use the file log storage")
+	}
+	s := fileLogStorage{
+		dir:         dir,
+		segmentSize: defaultLogSegmentSize,
+		maxSegments: defaultLogSegments,
+	}
+	if size, err := config.GetInt("app-logs:file:max-segment-size"); err == nil && size > 0 {
+		s.segmentSize = int64(size)
+	}
+	if segments, err := config.GetInt("app-logs:file:max-segments"); err == nil && segments > 0 {
+		s.maxSegments = segments
+	}
+	if age, err := config.GetInt("app-logs:file:max-age"); err == nil && age > 0 {
+		s.maxAge = time.Duration(age) * time.Second
+	}
+	return &s, nil
+}
+
+func (s *fileLogStorage) appDir(appName string) string {
+	return filepath.Join(s.dir, appName)
+}
+
+func (s *fileLogStorage) lock(appName string) *sync.Mutex {
+	fileLogLocksMut.Lock()
+	defer fileLogLocksMut.Unlock()
+	dir := s.appDir(appName)
+	if fileLogLocks[dir] == nil {
+		fileLogLocks[dir] = &sync.Mutex{}
+	}
+	return fileLogLocks[dir]
+}
+
+func segmentName(seq int) string {
+	return fmt.Sprintf("%020d%s", seq, logSegmentSuffix)
+}
+
+// segments returns the sequence numbers of the segments of the app, in
+// ascending order.
+func (s *fileLogStorage) segments(appName string) ([]int, error) {
+	files, err := filepath.Glob(filepath.Join(s.appDir(appName), "*"+logSegmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, f := range files {
+		seq, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(f), logSegmentSuffix))
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func (s *fileLogStorage) segmentPath(appName string, seq int) string {
+	return filepath.Join(s.appDir(appName), segmentName(seq))
+}
+
+func (s *fileLogStorage) Insert(appName string, logs []Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range logs {
+		err := encoder.Encode(&logs[i])
+		if err != nil {
+			return err
+		}
+	}
+	mut := s.lock(appName)
+	mut.Lock()
+	defer mut.Unlock()
+	err := os.MkdirAll(s.appDir(appName), 0755)
+	if err != nil {
+		return err
+	}
+	seqs, err := s.segments(appName)
+	if err != nil {
+		return err
+	}
+	seq := 0
+	if len(seqs) > 0 {
+		seq = seqs[len(seqs)-1]
+		info, statErr := os.Stat(s.segmentPath(appName, seq))
+		if statErr == nil && info.Size() >= s.segmentSize {
+			seq++
+			seqs = append(seqs, seq)
+		}
+	} else {
+		seqs = []int{seq}
+	}
+	f, err := os.OpenFile(s.segmentPath(appName, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	s.applyRetention(appName, seqs)
+	return nil
+}
+
+// applyRetention removes the oldest segments of the app, keeping at most
+// maxSegments segments, and the segments last written before maxAge. The
+// current segment is never removed.
+func (s *fileLogStorage) applyRetention(appName string, seqs []int) {
+	now := time.Now()
+	for i, seq := range seqs[:len(seqs)-1] {
+		path := s.segmentPath(appName, seq)
+		remove := len(seqs)-i > s.maxSegments
+		if !remove && s.maxAge > 0 {
+			info, err := os.Stat(path)
+			remove = err == nil && now.Sub(info.ModTime()) > s.maxAge
+		}
+		if !remove {
+			continue
+		}
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("[file log storage] unable to remove log segment %s: %s", path, err)
+		}
+	}
+}
+
+// fileLogEntry is a log read from a segment, along with its line in the
+// segment.
+type fileLogEntry struct {
+	Applog
+	line int
+}
+
+// fileCursor encodes the position of a log as its segment and line.
+func fileCursor(seq, line int) string {
+	return fmt.Sprintf("%d:%d", seq, line)
+}
+
+func parseFileCursor(cursor string) (int, int, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, ErrInvalidLogCursor
+	}
+	seq, err := strconv.Atoi(parts[0])
+	if err != nil || seq < 0 {
+		return 0, 0, ErrInvalidLogCursor
+	}
+	line, err := strconv.Atoi(parts[1])
+	if err != nil || line < 0 {
+		return 0, 0, ErrInvalidLogCursor
+	}
+	return seq, line, nil
+}
+
+// readSegment returns the logs in the segment matching the query and written
+// before the given line, and the date of the first log in the segment. A
+// negative line means the whole segment.
+func (s *fileLogStorage) readSegment(appName string, seq, before int, query *LogQuery) ([]fileLogEntry, time.Time, error) {
+	var first time.Time
+	f, err := os.Open(s.segmentPath(appName, seq))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, first, nil
+		}
+		return nil, first, err
+	}
+	defer f.Close()
+	var logs []fileLogEntry
+	reader := bufio.NewReader(f)
+	for line := 0; before < 0 || line < before; line++ {
+		data, err := readLogLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, first, err
+		}
+		var l Applog
+		if err := json.Unmarshal(data, &l); err != nil {
+			continue
+		}
+		if first.IsZero() {
+			first = l.Date
+		}
+		if query.matches(&l) {
+			logs = append(logs, fileLogEntry{Applog: l, line: line})
+		}
+	}
+	return logs, first, nil
+}
+
+// readLogLine reads a line of a segment. Lines longer than maxLogLineSize are
+// consumed and returned empty, so they're skipped like other invalid lines.
+func readLogLine(r *bufio.Reader) ([]byte, error) {
+	var data []byte
+	tooLong := false
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(data)+len(chunk) > maxLogLineSize {
+			tooLong = true
+		} else if !tooLong {
+			data = append(data, chunk...)
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if tooLong {
+		return nil, nil
+	}
+	return data, nil
+}
+
+func (s *fileLogStorage) Find(appName string, query LogQuery) ([]Applog, string, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, "", err
+	}
+	beforeSeq, beforeLine := -1, -1
+	if query.Before != "" {
+		beforeSeq, beforeLine, err = parseFileCursor(query.Before)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	seqs, err := s.segments(appName)
+	if err != nil {
+		return nil, "", err
+	}
+	var entries []fileLogEntry
+	var entriesSeq []int
+	for i := len(seqs) - 1; i >= 0; i-- {
+		seq := seqs[i]
+		if beforeSeq >= 0 && seq > beforeSeq {
+			continue
+		}
+		before := -1
+		if seq == beforeSeq {
+			before = beforeLine
+		}
+		segmentLogs, first, err := s.readSegment(appName, seq, before, &query)
+		if err != nil {
+			return nil, "", err
+		}
+		segmentSeqs := make([]int, len(segmentLogs))
+		for j := range segmentSeqs {
+			segmentSeqs[j] = seq
+		}
+		entries = append(segmentLogs, entries...)
+		entriesSeq = append(segmentSeqs, entriesSeq...)
+		if query.Limit > 0 && len(entries) > query.Limit {
+			break
+		}
+		if !query.Since.IsZero() && !first.IsZero() && first.Before(query.Since) {
+			break
+		}
+	}
+	var cursor string
+	if query.Limit > 0 && len(entries) > query.Limit {
+		offset := len(entries) - query.Limit
+		entries = entries[offset:]
+		cursor = fileCursor(entriesSeq[offset], entries[0].line)
+	}
+	logs := make([]Applog, len(entries))
+	for i := range entries {
+		logs[i] = entries[i].Applog
+	}
+	return logs, cursor, nil
+}
+
+func (s *fileLogStorage) Tail(appName string, query LogQuery, timeout time.Duration) (LogCursor, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	cursor := fileLogCursor{
+		storage: s,
+		appName: appName,
+		query:   query.tailQuery(),
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+	seqs, err := s.segments(appName)
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) > 0 {
+		cursor.seq = seqs[len(seqs)-1]
+		info, err := os.Stat(s.segmentPath(appName, cursor.seq))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			cursor.offset = info.Size()
+		}
+	}
+	return &cursor, nil
+}
+
+func (s *fileLogStorage) Remove(appName string) error {
+	mut := s.lock(appName)
+	mut.Lock()
+	defer mut.Unlock()
+	return os.RemoveAll(s.appDir(appName))
+}
+
+type fileLogCursor struct {
+	storage  *fileLogStorage
+	appName  string
+	query    LogQuery
+	timeout  time.Duration
+	seq      int
+	offset   int64
+	pending  []byte
+	timedOut bool
+	err      error
+	done     chan struct{}
+	once     sync.Once
+}
+
+// readLine returns the next complete line of the current segment, moving to
+// the next segment when the current one ends and a newer one exists.
+func (c *fileLogCursor) readLine() ([]byte, error) {
+	for {
+		if i := bytes.IndexByte(c.pending, '\n'); i >= 0 {
+			line := c.pending[:i]
+			c.pending = c.pending[i+1:]
+			return line, nil
+		}
+		n, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			continue
+		}
+		seqs, err := c.storage.segments(c.appName)
+		if err != nil {
+			return nil, err
+		}
+		next := -1
+		for _, seq := range seqs {
+			if seq > c.seq {
+				next = seq
+				break
+			}
+		}
+		if next < 0 || len(c.pending) > 0 {
+			return nil, nil
+		}
+		c.seq = next
+		c.offset = 0
+	}
+}
+
+func (c *fileLogCursor) read() (int, error) {
+	f, err := os.Open(c.storage.segmentPath(c.appName, c.seq))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 32*1024)
+	n, err := f.ReadAt(buf, c.offset)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	c.offset += int64(n)
+	c.pending = append(c.pending, buf[:n]...)
+	return n, nil
+}
+
+func (c *fileLogCursor) Next(l *Applog) bool {
+	c.timedOut = false
+	if c.err != nil {
+		return false
+	}
+	deadline := time.Now().Add(c.timeout)
+	for {
+		select {
+		case <-c.done:
+			return false
+		default:
+		}
+		line, err := c.readLine()
+		if err != nil {
+			c.err = err
+			return false
+		}
+		if line != nil {
+			var entry Applog
+			if json.Unmarshal(line, &entry) == nil && c.query.matches(&entry) {
+				*l = entry
+				return true
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			c.timedOut = true
+			return false
+		}
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(fileLogPollInterval):
+		}
+	}
+}
+
+func (c *fileLogCursor) Timeout() bool {
+	return c.timedOut
+}
+
+func (c *fileLogCursor) Err() error {
+	return c.err
+}
+
+func (c *fileLogCursor) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
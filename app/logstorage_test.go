@@ -0,0 +1,381 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGetLogStorage(c *check.C) {
+	storage, err := GetLogStorage()
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &mongoLogStorage{})
+	config.Set("app-logs:storage", "unknown")
+	defer config.Unset("app-logs")
+	_, err = GetLogStorage()
+	c.Assert(err, check.ErrorMatches, `unknown log storage: "unknown"`)
+	config.Set("app-logs:storage", "file")
+	_, err = GetLogStorage()
+	c.Assert(err, check.ErrorMatches, "app-logs:file:dir must be set to use the file log storage")
+}
+
+func (s *S) TestMongoLogStorageFindTimeRange(c *check.C) {
+	storage := &mongoLogStorage{}
+	defer storage.Remove("myapp")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	var logs []Applog
+	for i := 0; i < 5; i++ {
+		logs = append(logs, Applog{
+			Date:    now.Add(time.Duration(i) * time.Minute),
+			Message: fmt.Sprintf("msg %d", i),
+			Source:  "web",
+			AppName: "myapp",
+		})
+	}
+	err := storage.Insert("myapp", logs)
+	c.Assert(err, check.IsNil)
+	result, _, err := storage.Find("myapp", LogQuery{Since: now.Add(time.Minute), Until: now.Add(3 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 3)
+	c.Assert(result[0].Message, check.Equals, "msg 1")
+	c.Assert(result[2].Message, check.Equals, "msg 3")
+	result, _, err = storage.Find("myapp", LogQuery{Since: now.Add(time.Minute), Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 2)
+	c.Assert(result[0].Message, check.Equals, "msg 3")
+	c.Assert(result[1].Message, check.Equals, "msg 4")
+}
+
+func (s *S) TestMongoLogStorageFindMessageAndPagination(c *check.C) {
+	storage := &mongoLogStorage{}
+	defer storage.Remove("myapp")
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	var logs []Applog
+	for i := 0; i < 5; i++ {
+		logs = append(logs, Applog{
+			Date:    now,
+			Message: fmt.Sprintf("msg %d", i),
+			Source:  []string{"web", "worker", "tsuru"}[i%3],
+			AppName: "myapp",
+		})
+	}
+	err := storage.Insert("myapp", logs)
+	c.Assert(err, check.IsNil)
+	result, _, err := storage.Find("myapp", LogQuery{Sources: []string{"web", "worker"}, MessageRegexp: "[0-3]$"})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 3)
+	c.Assert(result[0].Message, check.Equals, "msg 0")
+	c.Assert(result[2].Message, check.Equals, "msg 3")
+	result, _, err = storage.Find("myapp", LogQuery{Message: "msg 4"})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	result, cursor, err := storage.Find("myapp", LogQuery{Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 2)
+	c.Assert(result[0].Message, check.Equals, "msg 3")
+	c.Assert(cursor, check.Not(check.Equals), "")
+	result, cursor, err = storage.Find("myapp", LogQuery{Limit: 3, Before: cursor})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 3)
+	c.Assert(result[0].Message, check.Equals, "msg 0")
+	c.Assert(result[2].Message, check.Equals, "msg 2")
+	c.Assert(cursor, check.Equals, "")
+	_, _, err = storage.Find("myapp", LogQuery{Before: "invalid"})
+	c.Assert(err, check.Equals, ErrInvalidLogCursor)
+}
+
+func (s *S) TestMongoLogStorageTail(c *check.C) {
+	storage := &mongoLogStorage{}
+	defer storage.Remove("myapp")
+	err := storage.Insert("myapp", []Applog{{Date: time.Now(), Message: "old", Source: "web", AppName: "myapp"}})
+	c.Assert(err, check.IsNil)
+	cursor, err := storage.Tail("myapp", LogQuery{Sources: []string{"web"}}, 100*time.Millisecond)
+	c.Assert(err, check.IsNil)
+	defer cursor.Close()
+	err = storage.Insert("myapp", []Applog{
+		{Date: time.Now(), Message: "ignored", Source: "tsuru", AppName: "myapp"},
+		{Date: time.Now(), Message: "new", Source: "web", AppName: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	var l Applog
+	c.Assert(cursor.Next(&l), check.Equals, true)
+	c.Assert(l.Message, check.Equals, "new")
+	c.Assert(cursor.Next(&l), check.Equals, false)
+	c.Assert(cursor.Timeout(), check.Equals, true)
+	c.Assert(cursor.Err(), check.IsNil)
+}
+
+func (s *S) TestMongoLogStorageTailMessageRegexp(c *check.C) {
+	storage := &mongoLogStorage{}
+	defer storage.Remove("myapp")
+	err := storage.Insert("myapp", []Applog{{Date: time.Now(), Message: "old", Source: "web", AppName: "myapp"}})
+	c.Assert(err, check.IsNil)
+	cursor, err := storage.Tail("myapp", LogQuery{MessageRegexp: "^new [0-9]+$"}, 100*time.Millisecond)
+	c.Assert(err, check.IsNil)
+	defer cursor.Close()
+	err = storage.Insert("myapp", []Applog{
+		{Date: time.Now(), Message: "new request", Source: "web", AppName: "myapp"},
+		{Date: time.Now(), Message: "new 42", Source: "web", AppName: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	var l Applog
+	c.Assert(cursor.Next(&l), check.Equals, true)
+	c.Assert(l.Message, check.Equals, "new 42")
+	c.Assert(cursor.Next(&l), check.Equals, false)
+	c.Assert(cursor.Timeout(), check.Equals, true)
+}
+
+type FileLogStorageSuite struct {
+	dir     string
+	storage *fileLogStorage
+}
+
+var _ = check.Suite(&FileLogStorageSuite{})
+
+func (s *FileLogStorageSuite) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+	config.Set("app-logs:storage", "file")
+	config.Set("app-logs:file:dir", s.dir)
+	storage, err := GetLogStorage()
+	c.Assert(err, check.IsNil)
+	s.storage = storage.(*fileLogStorage)
+}
+
+func (s *FileLogStorageSuite) TearDownTest(c *check.C) {
+	config.Unset("app-logs")
+}
+
+func (s *FileLogStorageSuite) logs(start time.Time, n int, source string) []Applog {
+	var logs []Applog
+	for i := 0; i < n; i++ {
+		logs = append(logs, Applog{
+			Date:    start.Add(time.Duration(i) * time.Second),
+			Message: fmt.Sprintf("msg %d", i),
+			Source:  source,
+			AppName: "myapp",
+			Unit:    "unit1",
+		})
+	}
+	return logs
+}
+
+func (s *FileLogStorageSuite) TestNewFileLogStorageConfig(c *check.C) {
+	c.Assert(s.storage.dir, check.Equals, s.dir)
+	c.Assert(s.storage.segmentSize, check.Equals, int64(defaultLogSegmentSize))
+	c.Assert(s.storage.maxSegments, check.Equals, defaultLogSegments)
+	c.Assert(s.storage.maxAge, check.Equals, time.Duration(0))
+	config.Set("app-logs:file:max-segment-size", 1024)
+	config.Set("app-logs:file:max-segments", 2)
+	config.Set("app-logs:file:max-age", 3600)
+	storage, err := newFileLogStorage()
+	c.Assert(err, check.IsNil)
+	fileStorage := storage.(*fileLogStorage)
+	c.Assert(fileStorage.segmentSize, check.Equals, int64(1024))
+	c.Assert(fileStorage.maxSegments, check.Equals, 2)
+	c.Assert(fileStorage.maxAge, check.Equals, time.Hour)
+}
+
+func (s *FileLogStorageSuite) TestInsertAndFind(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Second)
+	err := s.storage.Insert("myapp", s.logs(now, 3, "web"))
+	c.Assert(err, check.IsNil)
+	err = s.storage.Insert("myapp", s.logs(now.Add(time.Minute), 2, "tsuru"))
+	c.Assert(err, check.IsNil)
+	logs, _, err := s.storage.Find("myapp", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 5)
+	c.Assert(logs[0].Date.Equal(now), check.Equals, true)
+	c.Assert(logs[0].Message, check.Equals, "msg 0")
+	c.Assert(logs[4].Source, check.Equals, "tsuru")
+	logs, _, err = s.storage.Find("myapp", LogQuery{Sources: []string{"web"}, Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "msg 1")
+	c.Assert(logs[1].Message, check.Equals, "msg 2")
+	logs, _, err = s.storage.Find("myapp", LogQuery{Since: now.Add(time.Second), Until: now.Add(time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "msg 1")
+	c.Assert(logs[2].Source, check.Equals, "tsuru")
+	logs, _, err = s.storage.Find("otherapp", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+}
+
+func (s *FileLogStorageSuite) TestFindMessage(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Second)
+	err := s.storage.Insert("myapp", s.logs(now, 12, "web"))
+	c.Assert(err, check.IsNil)
+	err = s.storage.Insert("myapp", s.logs(now, 2, "tsuru"))
+	c.Assert(err, check.IsNil)
+	logs, _, err := s.storage.Find("myapp", LogQuery{Message: "msg 1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 4)
+	logs, _, err = s.storage.Find("myapp", LogQuery{MessageRegexp: "^msg 1$", Sources: []string{"web", "tsuru"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Source, check.Equals, "web")
+	c.Assert(logs[1].Source, check.Equals, "tsuru")
+	_, _, err = s.storage.Find("myapp", LogQuery{MessageRegexp: "("})
+	c.Assert(err, check.ErrorMatches, "invalid message regular expression: .*")
+}
+
+func (s *FileLogStorageSuite) TestFindPagination(c *check.C) {
+	s.storage.segmentSize = 300
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, l := range s.logs(now, 7, "web") {
+		err := s.storage.Insert("myapp", []Applog{l})
+		c.Assert(err, check.IsNil)
+	}
+	seqs, err := s.storage.segments("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(len(seqs) > 1, check.Equals, true)
+	var messages []string
+	query := LogQuery{Limit: 3}
+	for {
+		logs, cursor, err := s.storage.Find("myapp", query)
+		c.Assert(err, check.IsNil)
+		for i := len(logs) - 1; i >= 0; i-- {
+			messages = append(messages, logs[i].Message)
+		}
+		if cursor == "" {
+			break
+		}
+		query.Before = cursor
+	}
+	c.Assert(messages, check.DeepEquals, []string{"msg 6", "msg 5", "msg 4", "msg 3", "msg 2", "msg 1", "msg 0"})
+	_, _, err = s.storage.Find("myapp", LogQuery{Before: "x"})
+	c.Assert(err, check.Equals, ErrInvalidLogCursor)
+}
+
+func (s *FileLogStorageSuite) TestInsertRotatesSegments(c *check.C) {
+	s.storage.segmentSize = 1
+	s.storage.maxSegments = 3
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		err := s.storage.Insert("myapp", s.logs(now.Add(time.Duration(i)*time.Minute), 1, "web"))
+		c.Assert(err, check.IsNil)
+	}
+	seqs, err := s.storage.segments("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(seqs, check.DeepEquals, []int{2, 3, 4})
+	logs, _, err := s.storage.Find("myapp", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Date.Equal(now.Add(2*time.Minute)), check.Equals, true)
+	logs, _, err = s.storage.Find("myapp", LogQuery{Limit: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[1].Date.Equal(now.Add(4*time.Minute)), check.Equals, true)
+}
+
+func (s *FileLogStorageSuite) TestInsertRemovesOldSegments(c *check.C) {
+	s.storage.segmentSize = 1
+	s.storage.maxAge = time.Hour
+	err := s.storage.Insert("myapp", s.logs(time.Now(), 1, "web"))
+	c.Assert(err, check.IsNil)
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(s.storage.segmentPath("myapp", 0), old, old)
+	c.Assert(err, check.IsNil)
+	err = s.storage.Insert("myapp", s.logs(time.Now(), 1, "web"))
+	c.Assert(err, check.IsNil)
+	seqs, err := s.storage.segments("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(seqs, check.DeepEquals, []int{1})
+}
+
+func (s *FileLogStorageSuite) TestRemove(c *check.C) {
+	err := s.storage.Insert("myapp", s.logs(time.Now(), 2, "web"))
+	c.Assert(err, check.IsNil)
+	err = s.storage.Remove("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(s.dir, "myapp"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	err = s.storage.Remove("myapp")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *FileLogStorageSuite) TestFindIgnoresInvalidLines(c *check.C) {
+	err := s.storage.Insert("myapp", s.logs(time.Now(), 1, "web"))
+	c.Assert(err, check.IsNil)
+	path := s.storage.segmentPath("myapp", 0)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	tooLong := `{"Message": "` + strings.Repeat("x", maxLogLineSize) + "\"}\n"
+	err = ioutil.WriteFile(path, append([]byte("not json\n"+tooLong), data...), 0644)
+	c.Assert(err, check.IsNil)
+	logs, _, err := s.storage.Find("myapp", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "msg 0")
+}
+
+func (s *FileLogStorageSuite) TestFindLongLines(c *check.C) {
+	logs := s.logs(time.Now(), 2, "web")
+	logs[0].Message = strings.Repeat("x", 100*1024)
+	err := s.storage.Insert("myapp", logs)
+	c.Assert(err, check.IsNil)
+	logs, _, err = s.storage.Find("myapp", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.HasLen, 100*1024)
+	c.Assert(logs[1].Message, check.Equals, "msg 1")
+}
+
+func (s *FileLogStorageSuite) TestTail(c *check.C) {
+	s.storage.segmentSize = 200
+	err := s.storage.Insert("myapp", s.logs(time.Now(), 1, "web"))
+	c.Assert(err, check.IsNil)
+	cursor, err := s.storage.Tail("myapp", LogQuery{Sources: []string{"web"}}, 50*time.Millisecond)
+	c.Assert(err, check.IsNil)
+	defer cursor.Close()
+	var l Applog
+	c.Assert(cursor.Next(&l), check.Equals, false)
+	c.Assert(cursor.Timeout(), check.Equals, true)
+	for i := 0; i < 3; i++ {
+		err = s.storage.Insert("myapp", s.logs(time.Now(), 1, "tsuru"))
+		c.Assert(err, check.IsNil)
+		err = s.storage.Insert("myapp", s.logs(time.Now(), 1, "web"))
+		c.Assert(err, check.IsNil)
+	}
+	seqs, err := s.storage.segments("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(len(seqs) > 1, check.Equals, true)
+	for i := 0; i < 3; i++ {
+		c.Assert(cursor.Next(&l), check.Equals, true)
+		c.Assert(l.Source, check.Equals, "web")
+	}
+	c.Assert(cursor.Next(&l), check.Equals, false)
+	c.Assert(cursor.Timeout(), check.Equals, true)
+	c.Assert(cursor.Err(), check.IsNil)
+}
+
+func (s *FileLogStorageSuite) TestTailClose(c *check.C) {
+	cursor, err := s.storage.Tail("myapp", LogQuery{}, time.Minute)
+	c.Assert(err, check.IsNil)
+	done := make(chan bool)
+	go func() {
+		var l Applog
+		done <- cursor.Next(&l)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	err = cursor.Close()
+	c.Assert(err, check.IsNil)
+	select {
+	case ok := <-done:
+		c.Assert(ok, check.Equals, false)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for cursor to close")
+	}
+	c.Assert(cursor.Close(), check.IsNil)
+}
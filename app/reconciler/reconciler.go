@@ -0,0 +1,214 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package reconciler periodically compares the state of the routers with the
+// routable units and cnames of all apps, storing a report with the drift found
+// in each router and optionally fixing it.
+//
+// Locked apps are skipped, as their routes are expected to change while the
+// operation holding the lock runs.
+package reconciler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	eventOwner       = "router-reconciler"
+	reportCollection = "routers_drift"
+	reportID         = "last"
+)
+
+// Drift is the drift of an app in one of its routers, along with the result
+// of the attempt to fix it.
+type Drift struct {
+	app.RoutesDrift `bson:",inline"`
+	Fixed           bool   `json:"fixed"`
+	FixError        string `json:"fixError,omitempty"`
+}
+
+// Report is the result of a reconciliation run.
+type Report struct {
+	ID          string    `bson:"_id" json:"-"`
+	Timestamp   time.Time `json:"timestamp"`
+	CheckedApps int       `json:"checkedApps"`
+	Drifts      []Drift   `json:"drifts"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// LastReport returns the report of the last reconciliation run, or nil if
+// there's none.
+func LastReport() (*Report, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var report Report
+	err = conn.Collection(reportCollection).FindId(reportID).One(&report)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func saveReport(report *Report) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	report.ID = reportID
+	_, err = conn.Collection(reportCollection).UpsertId(reportID, report)
+	return err
+}
+
+// Config holds the settings for the router reconciler. It must be created
+// using NewConfig.
+type Config struct {
+	RunInterval time.Duration
+	AutoFix     bool
+	leader      *leader.Lease
+	done        chan bool
+}
+
+// NewConfig creates a new router reconciler configuration reading its
+// settings from the "router-reconciler" section in tsuru.conf.
+func NewConfig() *Config {
+	runInterval, _ := config.GetInt("router-reconciler:run-interval")
+	if runInterval <= 0 {
+		runInterval = 300
+	}
+	autoFix, _ := config.GetBool("router-reconciler:auto-fix")
+	interval := time.Duration(runInterval) * time.Second
+	return &Config{
+		RunInterval: interval,
+		AutoFix:     autoFix,
+		leader:      leader.NewLease("app-router-reconciler", 2*interval),
+		done:        make(chan bool),
+	}
+}
+
+// Initialize starts the router reconciler if it's enabled in tsuru.conf. The
+// returned Config can be used to stop it.
+func Initialize() *Config {
+	if enabled, _ := config.GetBool("router-reconciler:enabled"); !enabled {
+		return nil
+	}
+	cfg := NewConfig()
+	go cfg.run()
+	return cfg
+}
+
+func (c *Config) run() {
+	for {
+		err := c.RunOnce()
+		if err != nil {
+			log.Errorf("[router-reconciler] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.RunInterval):
+		}
+	}
+}
+
+// Shutdown stops the reconciler.
+func (c *Config) Shutdown() {
+	c.done <- true
+}
+
+func (c *Config) String() string {
+	return "router reconciler"
+}
+
+// RunOnce checks the routes of all apps, fixing the drift found when AutoFix
+// is set, and stores the report. Only one tsuru API instance is allowed to do
+// it at a time, the others skip the run while a leader is active.
+func (c *Config) RunOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	isLeader, err := c.leader.Acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire leadership: %s", err)
+	}
+	if !isLeader {
+		log.Debugf("[router-reconciler] skipping run, another instance is the leader")
+		return nil
+	}
+	apps, err := app.List(nil)
+	if err != nil {
+		return fmt.Errorf("unable to list apps: %s", err)
+	}
+	report := Report{Timestamp: time.Now().UTC(), Drifts: []Drift{}}
+	for i := range apps {
+		a := &apps[i]
+		if a.Lock.Locked {
+			continue
+		}
+		report.CheckedApps++
+		drifts, err := a.RoutesDrift()
+		if err != nil {
+			log.Errorf("[router-reconciler] unable to check routes of app %s: %s", a.Name, err)
+			report.Errors = append(report.Errors, fmt.Sprintf("app %s: %s", a.Name, err))
+			continue
+		}
+		for _, d := range drifts {
+			drift := Drift{RoutesDrift: d}
+			log.Errorf("[router-reconciler] app %s drifted in router %s: %+v", a.Name, d.Router, d)
+			if c.AutoFix {
+				err = c.fix(a, d)
+				if err != nil {
+					log.Errorf("[router-reconciler] unable to fix routes of app %s in router %s: %s", a.Name, d.Router, err)
+					drift.FixError = err.Error()
+				} else {
+					drift.Fixed = true
+				}
+			}
+			report.Drifts = append(report.Drifts, drift)
+		}
+	}
+	return saveReport(&report)
+}
+
+func (c *Config) fix(a *app.App, drift app.RoutesDrift) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   permission.PermAppAdminRoutes,
+		Owner:  eventOwner,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	locked, err := app.AcquireApplicationLock(a.Name, eventOwner, "fix routes drift")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		err = fmt.Errorf("unable to lock app %s", a.Name)
+		return err
+	}
+	defer app.ReleaseApplicationLock(a.Name)
+	evt.Logf("fixing routes drift in router %s: %+v", drift.Router, drift)
+	err = a.FixRoutesDrift(drift)
+	return err
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package reconciler
+
+import (
+	"net/url"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/quota"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+var extraRoute = &url.URL{Scheme: "http", Host: "10.1.1.1:8080"}
+
+func (s *S) newApp(c *check.C, name string) *app.App {
+	a := app.App{Name: name, Quota: quota.Unlimited, Plan: app.Plan{Router: "fake"}}
+	err := s.Conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.Provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	_, err = s.Provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestNewConfig(c *check.C) {
+	config.Set("router-reconciler:run-interval", 60)
+	config.Set("router-reconciler:auto-fix", true)
+	defer config.Unset("router-reconciler")
+	cfg := NewConfig()
+	c.Assert(cfg.RunInterval.Seconds(), check.Equals, float64(60))
+	c.Assert(cfg.AutoFix, check.Equals, true)
+}
+
+func (s *S) TestLastReportWithoutRuns(c *check.C) {
+	report, err := LastReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.IsNil)
+}
+
+func (s *S) TestRunOnceReportsDrift(c *check.C) {
+	a := s.newApp(c, "myapp")
+	s.newApp(c, "otherapp")
+	err := routertest.FakeRouter.AddRoute(a.Name, extraRoute)
+	c.Assert(err, check.IsNil)
+	err = NewConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err := LastReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.NotNil)
+	c.Assert(report.CheckedApps, check.Equals, 2)
+	c.Assert(report.Drifts, check.DeepEquals, []Drift{{
+		RoutesDrift: app.RoutesDrift{App: "myapp", Router: "fake", ExtraRoutes: []string{extraRoute.String()}},
+	}})
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, extraRoute.String()), check.Equals, true)
+}
+
+func (s *S) TestRunOnceAutoFix(c *check.C) {
+	a := s.newApp(c, "myapp")
+	err := routertest.FakeRouter.AddRoute(a.Name, extraRoute)
+	c.Assert(err, check.IsNil)
+	cfg := NewConfig()
+	cfg.AutoFix = true
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err := LastReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Drifts, check.HasLen, 1)
+	c.Assert(report.Drifts[0].Fixed, check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, extraRoute.String()), check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Name: "app", Value: a.Name},
+		Kind:   "app.admin.routes",
+		Owner:  "router-reconciler",
+	}, eventtest.HasEvent)
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err = LastReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Drifts, check.HasLen, 0)
+}
+
+func (s *S) TestRunOnceSkipsLockedApps(c *check.C) {
+	a := s.newApp(c, "myapp")
+	err := routertest.FakeRouter.AddRoute(a.Name, extraRoute)
+	c.Assert(err, check.IsNil)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	err = NewConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err := LastReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedApps, check.Equals, 0)
+	c.Assert(report.Drifts, check.HasLen, 0)
+}
@@ -0,0 +1,216 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrRouterAlreadyAttached = errors.New("router already attached to the app")
+	ErrRouterNotAttached     = errors.New("router not attached to the app")
+	ErrRouterFromPlan        = errors.New("the router of the app plan can't be detached, change the plan instead")
+	ErrRouterSwappedApp      = errors.New("routers can't be attached to swapped apps")
+)
+
+// AppRouter is a router the app is attached to in addition to the router of
+// its plan, with the address of the app in it.
+type AppRouter struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// GetRouters returns the names of all routers the app is attached to, the
+// router of the plan comes first.
+func (app *App) GetRouters() ([]string, error) {
+	planRouter, err := app.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{planRouter}
+	for _, r := range app.Routers {
+		if r.Name != planRouter {
+			names = append(names, r.Name)
+		}
+	}
+	return names, nil
+}
+
+// RoutersAddresses returns every router the app is attached to with the
+// address of the app in it, starting with the router of the plan.
+func (app *App) RoutersAddresses() []AppRouter {
+	planRouter, _ := app.GetRouter()
+	result := []AppRouter{{Name: planRouter, Address: app.Ip}}
+	for _, r := range app.Routers {
+		if r.Name != planRouter {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func (app *App) hasRouter(name string) bool {
+	names, err := app.GetRouters()
+	if err != nil {
+		return false
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExtraRouter returns whether the app is attached to the named router in
+// addition to the router of its plan.
+func (app *App) hasExtraRouter(name string) bool {
+	for _, r := range app.Routers {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allRouters returns a router fanning changes out to every router the app is
+// attached to.
+func (app *App) allRouters() (router.Router, error) {
+	names, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	return router.GetMulti(names)
+}
+
+// AddRouter attaches the app to the named router, in addition to the router
+// of its plan, creating the backend of the app in it and rebuilding its
+// routes.
+func (app *App) AddRouter(name string) error {
+	if app.hasRouter(name) {
+		return ErrRouterAlreadyAttached
+	}
+	r, err := router.Get(name)
+	if err != nil {
+		return err
+	}
+	swapped, _, err := router.IsSwapped(app.Name)
+	if err != nil && err != router.ErrBackendNotFound {
+		return err
+	}
+	if swapped {
+		return ErrRouterSwappedApp
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	appRouter := AppRouter{Name: name}
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "routers.name": bson.M{"$ne": name}},
+		bson.M{"$push": bson.M{"routers": appRouter}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrRouterAlreadyAttached
+	}
+	if err != nil {
+		return err
+	}
+	app.Routers = append(app.Routers, appRouter)
+	_, err = app.rebuildRoutesIn(name, r)
+	if err != nil {
+		app.Routers = app.Routers[:len(app.Routers)-1]
+		conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"routers": bson.M{"name": name}}})
+		r.RemoveBackend(app.Name)
+		return err
+	}
+	return nil
+}
+
+// RemoveRouter detaches the app from the named router, removing the backend
+// of the app from it. The router of the plan can't be detached.
+func (app *App) RemoveRouter(name string) error {
+	planRouter, err := app.GetRouter()
+	if err != nil {
+		return err
+	}
+	if name == planRouter {
+		return ErrRouterFromPlan
+	}
+	index := -1
+	for i, r := range app.Routers {
+		if r.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrRouterNotAttached
+	}
+	r, err := router.Get(name)
+	if err != nil {
+		return err
+	}
+	err = r.RemoveBackend(app.Name)
+	if err != nil && err != router.ErrBackendNotFound {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"routers": bson.M{"name": name}}})
+	if err != nil {
+		return err
+	}
+	app.Routers = append(app.Routers[:index], app.Routers[index+1:]...)
+	return nil
+}
+
+// setRouterAddress stores the address of the app in the named router, the
+// address in the router of the plan is kept in the Ip field.
+func (app *App) setRouterAddress(name, addr string) error {
+	planRouter, err := app.GetRouter()
+	if err != nil {
+		return err
+	}
+	query := bson.M{"name": app.Name}
+	update := bson.M{"$set": bson.M{"ip": addr}}
+	current := &app.Ip
+	if name != planRouter {
+		current = nil
+		for i := range app.Routers {
+			if app.Routers[i].Name == name {
+				current = &app.Routers[i].Address
+			}
+		}
+		if current == nil {
+			return ErrRouterNotAttached
+		}
+		query["routers.name"] = name
+		update = bson.M{"$set": bson.M{"routers.$.address": addr}}
+	}
+	if *current == addr {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(query, update)
+	if err != nil {
+		return err
+	}
+	*current = addr
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGetRouters(c *check.C) {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, Routers: []AppRouter{{Name: "fake-hc"}, {Name: "fake"}}}
+	names, err := a.GetRouters()
+	c.Assert(err, check.IsNil)
+	c.Assert(names, check.DeepEquals, []string{"fake", "fake-hc"})
+}
+
+func (s *S) TestAddRouter(c *check.C) {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	units, err := s.provisioner.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasCName("myapp.example.com"), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(a.Name, units[1].Address.String()), check.Equals, true)
+	addr, err := routertest.HCRouter.Addr(a.Name)
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.DeepEquals, []AppRouter{{Name: "fake-hc", Address: addr}})
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.Equals, ErrRouterAlreadyAttached)
+	err = a.AddRouter("fake")
+	c.Assert(err, check.Equals, ErrRouterAlreadyAttached)
+}
+
+func (s *S) TestRemoveRouter(c *check.C) {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	err = a.RemoveRouter("fake")
+	c.Assert(err, check.Equals, ErrRouterFromPlan)
+	err = a.RemoveRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 0)
+	err = a.RemoveRouter("fake-hc")
+	c.Assert(err, check.Equals, ErrRouterNotAttached)
+}
+
+func (s *S) TestRemoveRouterSameType(c *check.C) {
+	config.Set("routers:ind1:type", "fake-independent")
+	config.Set("routers:ind2:type", "fake-independent")
+	defer config.Unset("routers:ind1")
+	defer config.Unset("routers:ind2")
+	defer routertest.ResetIndependentRouters()
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddRouter("ind1")
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter("ind2")
+	c.Assert(err, check.IsNil)
+	err = a.RemoveRouter("ind1")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.IndependentRouter("ind1").HasBackend(a.Name), check.Equals, false)
+	c.Assert(routertest.IndependentRouter("ind2").HasBackend(a.Name), check.Equals, true)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	changes, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	c.Assert(changes.Added, check.DeepEquals, []string{units[0].Address.String()})
+	c.Assert(routertest.IndependentRouter("ind2").HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	err = a.RemoveRouter("ind2")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.IndependentRouter("ind2").HasBackend(a.Name), check.Equals, false)
+}
+
+func (s *S) TestRebuildRoutesMultipleRouters(c *check.C) {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(&a)
+	err = a.AddRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	units, err := s.provisioner.AddUnits(&a, 1, "web", nil)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.RemoveRoute(a.Name, units[0].Address)
+	routertest.HCRouter.RemoveRoute(a.Name, units[0].Address)
+	routertest.HCRouter.AddRoute(a.Name, &url.URL{Scheme: "http", Host: "invalid:1234"})
+	changes, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	c.Assert(changes.Added, check.DeepEquals, []string{units[0].Address.String(), units[0].Address.String()})
+	c.Assert(changes.Removed, check.DeepEquals, []string{"http://invalid:1234"})
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(a.Name, "http://invalid:1234"), check.Equals, false)
+}
+
+func (s *S) TestSwapMultipleRouters(c *check.C) {
+	a1 := App{Name: "app1", Routers: []AppRouter{{Name: "fake-hc"}}}
+	a2 := App{Name: "app2"}
+	err := Swap(&a1, &a2, false)
+	c.Assert(err, check.ErrorMatches, "swap is not supported for apps attached to multiple routers")
+}
+
+func (s *S) TestAppMarshalJSONWithRouters(c *check.C) {
+	a := App{
+		Name:    "name",
+		Ip:      "name.fakerouter.com",
+		Plan:    Plan{Router: "fake"},
+		Routers: []AppRouter{{Name: "fake-hc", Address: "name.fakehc.com"}},
+	}
+	data, err := a.MarshalJSON()
+	c.Assert(err, check.IsNil)
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["routers"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"name": "fake", "address": "name.fakerouter.com"},
+		map[string]interface{}{"name": "fake-hc", "address": "name.fakehc.com"},
+	})
+}
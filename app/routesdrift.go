@@ -0,0 +1,155 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/tsuru/tsuru/router"
+)
+
+// RoutesDrift is the difference between the state of the app in one of its
+// routers and the state expected by tsuru: the routable units of the app and
+// its cnames.
+type RoutesDrift struct {
+	App            string   `json:"app"`
+	Router         string   `json:"router"`
+	MissingBackend bool     `json:"missingBackend,omitempty"`
+	MissingRoutes  []string `json:"missingRoutes,omitempty"`
+	ExtraRoutes    []string `json:"extraRoutes,omitempty"`
+	MissingCNames  []string `json:"missingCNames,omitempty"`
+	ExtraCNames    []string `json:"extraCNames,omitempty"`
+}
+
+// Empty returns whether the router matches the expected state.
+func (d *RoutesDrift) Empty() bool {
+	return !d.MissingBackend && len(d.MissingRoutes) == 0 && len(d.ExtraRoutes) == 0 &&
+		len(d.MissingCNames) == 0 && len(d.ExtraCNames) == 0
+}
+
+// RoutesDrift compares the routes and cnames of the app in each of its
+// routers with its routable units and cnames, returning the drift found in
+// the routers that diverge. Sleeping apps are not checked, as their routes
+// point to the wake-up proxy.
+func (app *App) RoutesDrift() ([]RoutesDrift, error) {
+	if app.IdlePolicy != nil && app.IdlePolicy.Asleep {
+		return nil, nil
+	}
+	units, err := Provisioner.RoutableUnits(app)
+	if err != nil {
+		return nil, err
+	}
+	expected := make([]string, len(units))
+	for i, unit := range units {
+		expected[i] = unit.Address.String()
+	}
+	// cnames of swapped apps may be pointing to the other app, they're only
+	// checked for apps that are not swapped.
+	isSwapped, _, err := router.IsSwapped(app.GetName())
+	if err != nil && err != router.ErrBackendNotFound {
+		return nil, err
+	}
+	names, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	var drifts []RoutesDrift
+	for _, name := range names {
+		r, err := router.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		drift := RoutesDrift{App: app.Name, Router: name}
+		routes, err := r.Routes(app.GetName())
+		if err == router.ErrBackendNotFound {
+			drift.MissingBackend = true
+			drift.MissingRoutes = sortedCopy(expected)
+			if !isSwapped {
+				drift.MissingCNames = sortedCopy(app.CName)
+			}
+			drifts = append(drifts, drift)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		drift.MissingRoutes, drift.ExtraRoutes = diffStrings(expected, urlStrings(routes))
+		if !isSwapped {
+			cnames, err := r.CNames(app.GetName())
+			if err != nil {
+				return nil, err
+			}
+			drift.MissingCNames, drift.ExtraCNames = diffStrings(app.CName, urlStrings(cnames))
+		}
+		if !drift.Empty() {
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// FixRoutesDrift rebuilds the routes of the app in the router of the drift
+// and unsets the cnames that point to the app in the router but are no longer
+// set in the app.
+func (app *App) FixRoutesDrift(drift RoutesDrift) error {
+	r, err := router.Get(drift.Router)
+	if err != nil {
+		return err
+	}
+	_, err = app.rebuildRoutesIn(drift.Router, r)
+	if err != nil {
+		return err
+	}
+	for _, cname := range drift.ExtraCNames {
+		err = r.UnsetCName(cname, app.Name)
+		if err != nil && err != router.ErrCNameNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffStrings returns the values in expected that are missing in actual and
+// the values in actual that are not expected, both sorted.
+func diffStrings(expected, actual []string) (missing []string, extra []string) {
+	actualSet := make(map[string]bool, len(actual))
+	for _, v := range actual {
+		actualSet[v] = true
+	}
+	expectedSet := make(map[string]bool, len(expected))
+	for _, v := range expected {
+		expectedSet[v] = true
+		if !actualSet[v] {
+			missing = append(missing, v)
+		}
+	}
+	for _, v := range actual {
+		if !expectedSet[v] {
+			extra = append(extra, v)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+func urlStrings(urls []*url.URL) []string {
+	result := make([]string, len(urls))
+	for i, u := range urls {
+		result[i] = u.String()
+	}
+	return result
+}
+
+func sortedCopy(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	result := make([]string, len(values))
+	copy(result, values)
+	sort.Strings(result)
+	return result
+}
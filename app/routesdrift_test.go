@@ -0,0 +1,90 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"net/url"
+
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newDriftApp(c *check.C) *App {
+	a := App{Name: "myapp", Plan: Plan{Router: "fake"}, CName: []string{"myapp.example.com"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, check.IsNil)
+	_, err = s.provisioner.AddUnits(&a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	return &a
+}
+
+func (s *S) TestRoutesDriftNone(c *check.C) {
+	a := s.newDriftApp(c)
+	defer s.provisioner.Destroy(a)
+	err := routertest.FakeRouter.SetCName("myapp.example.com", a.Name)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+}
+
+func (s *S) TestRoutesDrift(c *check.C) {
+	a := s.newDriftApp(c)
+	defer s.provisioner.Destroy(a)
+	units, err := s.provisioner.RoutableUnits(a)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoute(a.Name, units[0].Address)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.AddRoute(a.Name, &url.URL{Scheme: "http", Host: "10.1.1.1:8080"})
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.SetCName("old.example.com", a.Name)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.DeepEquals, []RoutesDrift{{
+		App:           "myapp",
+		Router:        "fake",
+		MissingRoutes: []string{units[0].Address.String()},
+		ExtraRoutes:   []string{"http://10.1.1.1:8080"},
+		MissingCNames: []string{"myapp.example.com"},
+		ExtraCNames:   []string{"old.example.com"},
+	}})
+}
+
+func (s *S) TestRoutesDriftSleepingApp(c *check.C) {
+	a := s.newDriftApp(c)
+	defer s.provisioner.Destroy(a)
+	a.IdlePolicy = &IdlePolicy{Asleep: true}
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+}
+
+func (s *S) TestFixRoutesDrift(c *check.C) {
+	a := s.newDriftApp(c)
+	defer s.provisioner.Destroy(a)
+	units, err := s.provisioner.RoutableUnits(a)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoute(a.Name, units[0].Address)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.AddRoute(a.Name, &url.URL{Scheme: "http", Host: "10.1.1.1:8080"})
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.SetCName("old.example.com", a.Name)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	err = a.FixRoutesDrift(drifts[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, units[0].Address.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, "http://10.1.1.1:8080"), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasCName("myapp.example.com"), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasCName("old.example.com"), check.Equals, false)
+	drifts, err = a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+}
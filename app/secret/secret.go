@@ -0,0 +1,205 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package secret provides encryption at rest for secret values, like secret
+// environment variables of apps.
+//
+// Values are encrypted with AES-GCM using the keys defined in the "secrets"
+// section of tsuru.conf:
+//
+//	secrets:
+//	  current-key: key2
+//	  keys:
+//	    key1: <base64 encoded 32 bytes key>
+//	    key2: <base64 encoded 32 bytes key>
+//
+// New values are always encrypted with the current key, and the id of the key
+// is stored along with the encrypted value, so values encrypted with older
+// keys can still be decrypted until they're encrypted again with the current
+// key.
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tsuru/config"
+)
+
+const (
+	prefix = "tsuru-secret:v1:"
+
+	// Mask is the text shown in place of secret values.
+	Mask = "*****"
+)
+
+var (
+	ErrNoKeys       = errors.New("secrets are not enabled, please define secrets:current-key and secrets:keys in tsuru.conf")
+	ErrInvalidValue = errors.New("invalid encrypted value")
+)
+
+// ErrUnknownKey is returned when a value is encrypted with a key that is not
+// defined in tsuru.conf.
+type ErrUnknownKey struct {
+	ID string
+}
+
+func (e ErrUnknownKey) Error() string {
+	return fmt.Sprintf("secret key %q not found in tsuru.conf", e.ID)
+}
+
+func currentKeyID() (string, error) {
+	id, err := config.GetString("secrets:current-key")
+	if err != nil || id == "" {
+		return "", ErrNoKeys
+	}
+	return id, nil
+}
+
+func getKey(id string) (cipher.AEAD, error) {
+	encoded, err := config.GetString("secrets:keys:" + id)
+	if err != nil {
+		return nil, ErrUnknownKey{ID: id}
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key %q: %s", id, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key %q: %s", id, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Enabled returns whether a current key is defined in tsuru.conf.
+func Enabled() bool {
+	_, err := currentKeyID()
+	return err == nil
+}
+
+// IsEncrypted returns whether the value was returned by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the id of the key used to encrypt the value.
+func KeyID(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", ErrInvalidValue
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrInvalidValue
+	}
+	return parts[0], nil
+}
+
+// Encrypt encrypts the value using the current key.
+func Encrypt(value string) (string, error) {
+	id, err := currentKeyID()
+	if err != nil {
+		return "", err
+	}
+	aead, err := getKey(id)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(id))
+	return prefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt, using the key it was
+// encrypted with.
+func Decrypt(value string) (string, error) {
+	id, err := KeyID(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := getKey(id)
+	if err != nil {
+		return "", err
+	}
+	encoded := strings.TrimPrefix(value, prefix+id+":")
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidValue
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, []byte(id))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(plain), nil
+}
+
+// Rotate encrypts the value again with the current key, if it was encrypted
+// with another key. The returned bool indicates whether the value changed.
+func Rotate(value string) (string, bool, error) {
+	current, err := currentKeyID()
+	if err != nil {
+		return "", false, err
+	}
+	id, err := KeyID(value)
+	if err != nil {
+		return "", false, err
+	}
+	if id == current {
+		return value, false, nil
+	}
+	plain, err := Decrypt(value)
+	if err != nil {
+		return "", false, err
+	}
+	value, err = Encrypt(plain)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+type maskWriter struct {
+	w      io.Writer
+	values [][]byte
+}
+
+// NewMaskWriter returns a writer that replaces any of the given values by
+// Mask before writing to w. Values split across multiple writes are not
+// masked.
+func NewMaskWriter(w io.Writer, values []string) io.Writer {
+	mw := maskWriter{w: w}
+	for _, v := range values {
+		if v != "" {
+			mw.values = append(mw.values, []byte(v))
+		}
+	}
+	if len(mw.values) == 0 {
+		return w
+	}
+	return &mw
+}
+
+func (w *maskWriter) Write(data []byte) (int, error) {
+	masked := data
+	for _, v := range w.values {
+		masked = bytes.Replace(masked, v, []byte(Mask), -1)
+	}
+	_, err := w.w.Write(masked)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
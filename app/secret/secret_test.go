@@ -0,0 +1,103 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	config.Set("secrets:keys:key2", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("b"), 32)))
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("secrets")
+}
+
+func (s *S) TestEncryptDecrypt(c *check.C) {
+	value, err := Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(IsEncrypted(value), check.Equals, true)
+	c.Assert(strings.Contains(value, "s3cr3t"), check.Equals, false)
+	id, err := KeyID(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(id, check.Equals, "key1")
+	other, err := Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), value)
+	plain, err := Decrypt(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestEncryptNoKeys(c *check.C) {
+	config.Unset("secrets")
+	c.Assert(Enabled(), check.Equals, false)
+	_, err := Encrypt("s3cr3t")
+	c.Assert(err, check.Equals, ErrNoKeys)
+}
+
+func (s *S) TestDecryptInvalidValue(c *check.C) {
+	_, err := Decrypt("s3cr3t")
+	c.Assert(err, check.Equals, ErrInvalidValue)
+	value, err := Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	_, err = Decrypt(value[:len(value)-4] + "AAAA")
+	c.Assert(err, check.Equals, ErrInvalidValue)
+	_, err = Decrypt(strings.Replace(value, "key1", "key2", 1))
+	c.Assert(err, check.Equals, ErrInvalidValue)
+	_, err = Decrypt(strings.Replace(value, "key1", "key3", 1))
+	c.Assert(err, check.Equals, ErrUnknownKey{ID: "key3"})
+}
+
+func (s *S) TestRotate(c *check.C) {
+	value, err := Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	rotated, changed, err := Rotate(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, false)
+	c.Assert(rotated, check.Equals, value)
+	config.Set("secrets:current-key", "key2")
+	rotated, changed, err = Rotate(value)
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, true)
+	id, err := KeyID(rotated)
+	c.Assert(err, check.IsNil)
+	c.Assert(id, check.Equals, "key2")
+	plain, err := Decrypt(rotated)
+	c.Assert(err, check.IsNil)
+	c.Assert(plain, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestMaskWriter(c *check.C) {
+	var buf bytes.Buffer
+	w := NewMaskWriter(&buf, []string{"s3cr3t", "", "p4ss"})
+	n, err := w.Write([]byte("user=admin password=p4ss token=s3cr3t\n"))
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 38)
+	c.Assert(buf.String(), check.Equals, "user=admin password=***** token=*****\n")
+}
+
+func (s *S) TestMaskWriterNoValues(c *check.C) {
+	var buf bytes.Buffer
+	w := NewMaskWriter(&buf, nil)
+	c.Assert(w, check.Equals, &buf)
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/mgo.v2"
@@ -38,9 +39,16 @@ func (e *ErrTeamStillUsed) Error() string {
 }
 
 // Team represents a real world team, a team has one creating user and a name.
+// The quota limits the resources used by apps and service instances owned by
+// the team, a nil quota means that the team is unlimited.
 type Team struct {
 	Name         string `bson:"_id" json:"name"`
 	CreatingUser string
+	Quota        *TeamQuota   `bson:",omitempty" json:",omitempty"`
+	Labels       label.Labels `bson:",omitempty" json:"labels,omitempty"`
+
+	QuotaReservations []teamQuotaReservation `bson:",omitempty" json:"-"`
+	QuotaVersion      int                    `bson:",omitempty" json:"-"`
 }
 
 // AllowedApps returns the apps that the team has access.
@@ -94,6 +102,30 @@ func CreateTeam(name string, user *User) error {
 	return nil
 }
 
+// SetLabels adds the labels in set to the team and removes the labels whose
+// keys are in unset.
+func (t *Team) SetLabels(set label.Labels, unset []string) error {
+	err := set.Validate()
+	if err != nil {
+		return err
+	}
+	labels := t.Labels.Update(set, unset)
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(t.Name, bson.M{"$set": bson.M{"labels": labels}})
+	if err == mgo.ErrNotFound {
+		return ErrTeamNotFound
+	}
+	if err != nil {
+		return err
+	}
+	t.Labels = labels
+	return nil
+}
+
 func isTeamNameValid(name string) bool {
 	return teamNameRegexp.MatchString(name)
 }
@@ -0,0 +1,344 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrTeamQuotaBelowUsage = errors.New("new limit is lesser than the current allocated value")
+
+// UnlimitedTeamQuota is the quota of teams without any resource limit.
+var UnlimitedTeamQuota = TeamQuota{Memory: -1, CPUShare: -1, Apps: -1, ServiceInstances: -1}
+
+// TeamQuota holds the limits of resources that may be consumed by the apps
+// and service instances owned by a team. Negative values mean that the
+// resource is not limited.
+type TeamQuota struct {
+	Memory           int64 `json:"memory"`
+	CPUShare         int   `json:"cpushare"`
+	Apps             int   `json:"apps"`
+	ServiceInstances int   `json:"serviceinstances"`
+}
+
+// TeamUsage represents the amount of resources consumed by a team. It's also
+// used to describe the amount of resources being requested by an operation.
+type TeamUsage struct {
+	Memory           int64 `json:"memory"`
+	CPUShare         int   `json:"cpushare"`
+	Apps             int   `json:"apps"`
+	ServiceInstances int   `json:"serviceinstances"`
+}
+
+// teamQuotaReservationTimeout is the time after which a reservation that was
+// never released, e.g. because the process handling it died, stops holding
+// resources of the team.
+var teamQuotaReservationTimeout = time.Minute
+
+// teamQuotaReservation holds resources of a team between the check of its
+// quota and the moment they're stored in the apps and service instances of
+// the team.
+type teamQuotaReservation struct {
+	ID      bson.ObjectId `bson:"_id"`
+	Usage   TeamUsage
+	Expires time.Time
+}
+
+func (u *TeamUsage) add(other TeamUsage) {
+	u.Memory += other.Memory
+	u.CPUShare += other.CPUShare
+	u.Apps += other.Apps
+	u.ServiceInstances += other.ServiceInstances
+}
+
+// positive returns the usage without the resources being released.
+func (u TeamUsage) positive() TeamUsage {
+	if u.Memory < 0 {
+		u.Memory = 0
+	}
+	if u.CPUShare < 0 {
+		u.CPUShare = 0
+	}
+	if u.Apps < 0 {
+		u.Apps = 0
+	}
+	if u.ServiceInstances < 0 {
+		u.ServiceInstances = 0
+	}
+	return u
+}
+
+// TeamQuotaReport contains the quota and the current usage of a team.
+type TeamQuotaReport struct {
+	Team  string    `json:"team"`
+	Quota TeamQuota `json:"quota"`
+	Usage TeamUsage `json:"usage"`
+}
+
+type TeamQuotaExceededError struct {
+	Team      string
+	Resource  string
+	Requested int64
+	Available int64
+}
+
+func (e *TeamQuotaExceededError) Error() string {
+	return fmt.Sprintf("Quota exceeded for team %q on %s. Available: %d. Requested: %d.",
+		e.Team, e.Resource, e.Available, e.Requested)
+}
+
+// GetQuota returns the quota of the team. Teams created before quotas
+// existed have no limits.
+func (t *Team) GetQuota() TeamQuota {
+	if t.Quota == nil {
+		return UnlimitedTeamQuota
+	}
+	return *t.Quota
+}
+
+// Usage returns the resources currently consumed by the team. Memory and CPU
+// shares are the resources of the plan of each app owned by the team,
+// multiplied by the number of units of the app.
+func (t *Team) Usage() (TeamUsage, error) {
+	var usage TeamUsage
+	conn, err := db.Conn()
+	if err != nil {
+		return usage, err
+	}
+	defer conn.Close()
+	var apps []struct {
+		Plan struct {
+			Memory   int64
+			CpuShare int
+		}
+		Quota struct {
+			InUse int
+		}
+	}
+	query := conn.Apps().Find(bson.M{"teamowner": t.Name})
+	err = query.Select(bson.M{"plan": 1, "quota": 1}).All(&apps)
+	if err != nil {
+		return usage, err
+	}
+	for _, a := range apps {
+		usage.Memory += a.Plan.Memory * int64(a.Quota.InUse)
+		usage.CPUShare += a.Plan.CpuShare * a.Quota.InUse
+	}
+	usage.Apps = len(apps)
+	usage.ServiceInstances, err = conn.ServiceInstances().Find(bson.M{"teamowner": t.Name}).Count()
+	if err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// reservedUsage returns the usage of the team including the resources held
+// by reservations that didn't expire.
+func (t *Team) reservedUsage() (TeamUsage, error) {
+	usage, err := t.Usage()
+	if err != nil {
+		return usage, err
+	}
+	now := time.Now()
+	for _, r := range t.QuotaReservations {
+		if r.Expires.After(now) {
+			usage.add(r.Usage)
+		}
+	}
+	return usage, nil
+}
+
+// CheckQuota returns an error if the team doesn't have enough resources
+// available for the requested ones. It doesn't hold the resources, use
+// ReserveTeamQuota for that.
+func (t *Team) CheckQuota(requested TeamUsage) error {
+	if t.Quota == nil {
+		return nil
+	}
+	usage, err := t.reservedUsage()
+	if err != nil {
+		return err
+	}
+	checks := []struct {
+		resource           string
+		limit, used, asked int64
+	}{
+		{"memory", t.Quota.Memory, usage.Memory, requested.Memory},
+		{"cpushare", int64(t.Quota.CPUShare), int64(usage.CPUShare), int64(requested.CPUShare)},
+		{"apps", int64(t.Quota.Apps), int64(usage.Apps), int64(requested.Apps)},
+		{"serviceinstances", int64(t.Quota.ServiceInstances), int64(usage.ServiceInstances), int64(requested.ServiceInstances)},
+	}
+	for _, check := range checks {
+		if check.limit < 0 || check.asked <= 0 {
+			continue
+		}
+		if check.used+check.asked > check.limit {
+			available := check.limit - check.used
+			if available < 0 {
+				available = 0
+			}
+			return &TeamQuotaExceededError{
+				Team:      t.Name,
+				Resource:  check.resource,
+				Requested: check.asked,
+				Available: available,
+			}
+		}
+	}
+	return nil
+}
+
+// quotaVersionQuery matches the quota version of teams, which is missing in
+// teams that never had resources reserved.
+func quotaVersionQuery(version int) interface{} {
+	if version == 0 {
+		return bson.M{"$in": []interface{}{0, nil}}
+	}
+	return version
+}
+
+// ReserveTeamQuota reserves the requested resources in the quota of the named
+// team, returning an error when they're not available. The check and the
+// reservation are atomic: concurrent reservations of the team are retried,
+// the same way units are reserved in the quota of apps.
+//
+// The returned function releases the reservation, it must be called after
+// the resources are stored in the apps and service instances of the team, or
+// after the operation requesting them fails. It's a no-op for unknown team
+// names, so callers are still responsible for validating the team.
+func ReserveTeamQuota(teamName string, requested TeamUsage) (func(), error) {
+	noop := func() {}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reservation := teamQuotaReservation{ID: bson.NewObjectId(), Usage: requested.positive()}
+	for {
+		team, err := GetTeam(teamName)
+		if err == ErrTeamNotFound {
+			return noop, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if team.Quota == nil || reservation.Usage == (TeamUsage{}) {
+			return noop, nil
+		}
+		err = team.CheckQuota(requested)
+		if err != nil {
+			return nil, err
+		}
+		reservation.Expires = time.Now().Add(teamQuotaReservationTimeout)
+		err = conn.Teams().Update(
+			bson.M{"_id": team.Name, "quotaversion": quotaVersionQuery(team.QuotaVersion)},
+			bson.M{
+				"$push": bson.M{"quotareservations": reservation},
+				"$inc":  bson.M{"quotaversion": 1},
+			},
+		)
+		if err == nil {
+			break
+		}
+		if err != mgo.ErrNotFound {
+			return nil, err
+		}
+	}
+	return func() { releaseTeamQuota(teamName, reservation.ID) }, nil
+}
+
+func releaseTeamQuota(teamName string, id bson.ObjectId) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("Failed to release quota reservation of team %q: %s", teamName, err)
+		return
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(teamName, bson.M{"$pull": bson.M{"quotareservations": bson.M{"_id": id}}})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("Failed to release quota reservation of team %q: %s", teamName, err)
+	}
+	err = conn.Teams().UpdateId(teamName, bson.M{"$pull": bson.M{"quotareservations": bson.M{"expires": bson.M{"$lt": time.Now()}}}})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("Failed to remove expired quota reservations of team %q: %s", teamName, err)
+	}
+}
+
+// ChangeTeamQuota redefines the limits of the team. The new limits must be
+// bigger than or equal to the resources currently used or reserved by the
+// team. Negative
+// limits mean that the resource is unlimited.
+func ChangeTeamQuota(team *Team, quota TeamQuota) error {
+	if quota.Memory < 0 {
+		quota.Memory = -1
+	}
+	if quota.CPUShare < 0 {
+		quota.CPUShare = -1
+	}
+	if quota.Apps < 0 {
+		quota.Apps = -1
+	}
+	if quota.ServiceInstances < 0 {
+		quota.ServiceInstances = -1
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		current, err := GetTeam(team.Name)
+		if err != nil {
+			return err
+		}
+		usage, err := current.reservedUsage()
+		if err != nil {
+			return err
+		}
+		if (quota.Memory >= 0 && quota.Memory < usage.Memory) ||
+			(quota.CPUShare >= 0 && quota.CPUShare < usage.CPUShare) ||
+			(quota.Apps >= 0 && quota.Apps < usage.Apps) ||
+			(quota.ServiceInstances >= 0 && quota.ServiceInstances < usage.ServiceInstances) {
+			return ErrTeamQuotaBelowUsage
+		}
+		err = conn.Teams().Update(
+			bson.M{"_id": team.Name, "quotaversion": quotaVersionQuery(current.QuotaVersion)},
+			bson.M{"$set": bson.M{"quota": quota}, "$inc": bson.M{"quotaversion": 1}},
+		)
+		if err == nil {
+			break
+		}
+		if err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	team.Quota = &quota
+	return nil
+}
+
+// TeamsQuotaReport returns the quota and the current usage of the given
+// teams.
+func TeamsQuotaReport(teams []Team) ([]TeamQuotaReport, error) {
+	reports := make([]TeamQuotaReport, len(teams))
+	for i := range teams {
+		usage, err := teams[i].Usage()
+		if err != nil {
+			return nil, err
+		}
+		reports[i] = TeamQuotaReport{
+			Team:  teams[i].Name,
+			Quota: teams[i].GetQuota(),
+			Usage: usage,
+		}
+	}
+	return reports, nil
+}
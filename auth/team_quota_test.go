@@ -0,0 +1,179 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertQuotaApps(c *check.C, teamName string) {
+	apps := []bson.M{
+		{"name": "app1", "teamowner": teamName, "plan": bson.M{"memory": 100, "cpushare": 2}, "quota": bson.M{"inuse": 3}},
+		{"name": "app2", "teamowner": teamName, "plan": bson.M{"memory": 50, "cpushare": 1}, "quota": bson.M{"inuse": 1}},
+		{"name": "app3", "teamowner": "otherteam", "plan": bson.M{"memory": 500, "cpushare": 10}, "quota": bson.M{"inuse": 5}},
+	}
+	for _, a := range apps {
+		err := s.conn.Apps().Insert(a)
+		c.Assert(err, check.IsNil)
+	}
+	err := s.conn.ServiceInstances().Insert(bson.M{"name": "mysql", "teamowner": teamName})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) removeQuotaApps() {
+	s.conn.Apps().RemoveAll(bson.M{"name": bson.M{"$in": []string{"app1", "app2", "app3"}}})
+	s.conn.ServiceInstances().RemoveAll(bson.M{"name": "mysql"})
+}
+
+func (s *S) TestTeamQuotaExceededError(c *check.C) {
+	err := TeamQuotaExceededError{Team: "cheese", Resource: "memory", Requested: 10, Available: 9}
+	c.Assert(err.Error(), check.Equals, `Quota exceeded for team "cheese" on memory. Available: 9. Requested: 10.`)
+}
+
+func (s *S) TestTeamGetQuota(c *check.C) {
+	team := Team{Name: "cheese"}
+	c.Assert(team.GetQuota(), check.DeepEquals, UnlimitedTeamQuota)
+	team.Quota = &TeamQuota{Memory: 10, CPUShare: 2, Apps: 1, ServiceInstances: -1}
+	c.Assert(team.GetQuota(), check.DeepEquals, *team.Quota)
+}
+
+func (s *S) TestTeamUsage(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	usage, err := s.team.Usage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, TeamUsage{Memory: 350, CPUShare: 7, Apps: 2, ServiceInstances: 1})
+}
+
+func (s *S) TestTeamCheckQuota(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	team := Team{Name: s.team.Name, Quota: &TeamQuota{Memory: 400, CPUShare: -1, Apps: 2, ServiceInstances: 2}}
+	err := team.CheckQuota(TeamUsage{Memory: 50, CPUShare: 100})
+	c.Assert(err, check.IsNil)
+	err = team.CheckQuota(TeamUsage{ServiceInstances: 1})
+	c.Assert(err, check.IsNil)
+	err = team.CheckQuota(TeamUsage{Memory: 100})
+	c.Assert(err, check.DeepEquals, &TeamQuotaExceededError{Team: team.Name, Resource: "memory", Requested: 100, Available: 50})
+	err = team.CheckQuota(TeamUsage{Apps: 1})
+	c.Assert(err, check.DeepEquals, &TeamQuotaExceededError{Team: team.Name, Resource: "apps", Requested: 1, Available: 0})
+}
+
+func (s *S) TestTeamCheckQuotaUnlimited(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	team := Team{Name: s.team.Name}
+	err := team.CheckQuota(TeamUsage{Memory: 1000, CPUShare: 1000, Apps: 10, ServiceInstances: 10})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestReserveTeamQuota(c *check.C) {
+	team := Team{Name: "cheese", Quota: &TeamQuota{Memory: -1, CPUShare: -1, Apps: 0, ServiceInstances: 1}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	_, err = ReserveTeamQuota(team.Name, TeamUsage{Apps: 1})
+	c.Assert(err, check.FitsTypeOf, &TeamQuotaExceededError{})
+	release, err := ReserveTeamQuota(team.Name, TeamUsage{ServiceInstances: 1})
+	c.Assert(err, check.IsNil)
+	_, err = ReserveTeamQuota(team.Name, TeamUsage{ServiceInstances: 1})
+	c.Assert(err, check.DeepEquals, &TeamQuotaExceededError{Team: team.Name, Resource: "serviceinstances", Requested: 1, Available: 0})
+	err = ChangeTeamQuota(&team, TeamQuota{Memory: -1, CPUShare: -1, Apps: 0, ServiceInstances: 0})
+	c.Assert(err, check.Equals, ErrTeamQuotaBelowUsage)
+	release()
+	release, err = ReserveTeamQuota(team.Name, TeamUsage{ServiceInstances: 1})
+	c.Assert(err, check.IsNil)
+	release()
+	dbTeam, err := GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTeam.QuotaReservations, check.HasLen, 0)
+	c.Assert(dbTeam.QuotaVersion, check.Equals, 2)
+	release, err = ReserveTeamQuota("unknown", TeamUsage{Apps: 1})
+	c.Assert(err, check.IsNil)
+	release()
+}
+
+func (s *S) TestReserveTeamQuotaConcurrently(c *check.C) {
+	team := Team{Name: "cheese", Quota: &TeamQuota{Memory: -1, CPUShare: -1, Apps: 5, ServiceInstances: -1}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ReserveTeamQuota(team.Name, TeamUsage{Apps: 1})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var reserved int
+	for err := range errs {
+		if err == nil {
+			reserved++
+		} else {
+			c.Assert(err, check.FitsTypeOf, &TeamQuotaExceededError{})
+		}
+	}
+	c.Assert(reserved, check.Equals, 5)
+}
+
+func (s *S) TestReserveTeamQuotaIgnoresExpiredReservations(c *check.C) {
+	team := Team{Name: "cheese", Quota: &TeamQuota{Memory: -1, CPUShare: -1, Apps: 1, ServiceInstances: -1}}
+	team.QuotaReservations = []teamQuotaReservation{
+		{ID: bson.NewObjectId(), Usage: TeamUsage{Apps: 1}, Expires: time.Now().Add(-time.Second)},
+	}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	release, err := ReserveTeamQuota(team.Name, TeamUsage{Apps: 1})
+	c.Assert(err, check.IsNil)
+	release()
+	dbTeam, err := GetTeam(team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTeam.QuotaReservations, check.HasLen, 0)
+}
+
+func (s *S) TestChangeTeamQuota(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	defer s.conn.Teams().UpdateId(s.team.Name, bson.M{"$unset": bson.M{"quota": ""}})
+	err := ChangeTeamQuota(s.team, TeamQuota{Memory: 1024, CPUShare: -5, Apps: 10, ServiceInstances: 1})
+	c.Assert(err, check.IsNil)
+	expected := TeamQuota{Memory: 1024, CPUShare: -1, Apps: 10, ServiceInstances: 1}
+	c.Assert(*s.team.Quota, check.DeepEquals, expected)
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(*team.Quota, check.DeepEquals, expected)
+}
+
+func (s *S) TestChangeTeamQuotaBelowUsage(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	team := Team{Name: s.team.Name}
+	err := ChangeTeamQuota(&team, TeamQuota{Memory: 100, CPUShare: -1, Apps: -1, ServiceInstances: -1})
+	c.Assert(err, check.Equals, ErrTeamQuotaBelowUsage)
+	c.Assert(team.Quota, check.IsNil)
+}
+
+func (s *S) TestTeamsQuotaReport(c *check.C) {
+	s.insertQuotaApps(c, s.team.Name)
+	defer s.removeQuotaApps()
+	quota := TeamQuota{Memory: 1000, CPUShare: 10, Apps: 5, ServiceInstances: 2}
+	teams := []Team{{Name: s.team.Name, Quota: &quota}, {Name: "otherteam"}}
+	reports, err := TeamsQuotaReport(teams)
+	c.Assert(err, check.IsNil)
+	c.Assert(reports, check.DeepEquals, []TeamQuotaReport{
+		{Team: s.team.Name, Quota: quota, Usage: TeamUsage{Memory: 350, CPUShare: 7, Apps: 2, ServiceInstances: 1}},
+		{Team: "otherteam", Quota: UnlimitedTeamQuota, Usage: TeamUsage{Memory: 2500, CPUShare: 50, Apps: 1}},
+	})
+}
@@ -7,6 +7,7 @@ package auth
 import (
 	"sort"
 
+	"github.com/tsuru/tsuru/label"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -104,6 +105,24 @@ func (s *S) TestGetTeam(c *check.C) {
 	c.Assert(t, check.IsNil)
 }
 
+func (s *S) TestTeamSetLabels(c *check.C) {
+	team := Team{Name: "symfonia", Labels: label.Labels{"tier": "frontend"}}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	err = team.SetLabels(label.Labels{"tsuru.io/area": "sales"}, []string{"tier"})
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Labels, check.DeepEquals, label.Labels{"tsuru.io/area": "sales"})
+	t, err := GetTeam("symfonia")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Labels, check.DeepEquals, label.Labels{"tsuru.io/area": "sales"})
+	err = team.SetLabels(label.Labels{"tier": "front end"}, nil)
+	c.Assert(err, check.NotNil)
+	other := Team{Name: "wat"}
+	err = other.SetLabels(label.Labels{"tier": "frontend"}, nil)
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
 func (s *S) TestRemoveTeam(c *check.C) {
 	team := Team{Name: "atreides"}
 	err := s.conn.Teams().Insert(team)
@@ -29,6 +29,7 @@ func buildManager() *cmd.Manager {
 	m.Register(&tsurudCommand{Command: &migrateCmd{}})
 	m.Register(&tsurudCommand{Command: gandalfSyncCmd{}})
 	m.Register(&tsurudCommand{Command: createRootUserCmd{}})
+	m.Register(&tsurudCommand{Command: secretKeysRotateCmd{}})
 	m.Register(&migrationListCmd{})
 	registerProvisionersCommands(m)
 	return m
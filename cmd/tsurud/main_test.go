@@ -68,6 +68,15 @@ func (s *S) TestGandalfSyncCmdIsRegistered(c *check.C) {
 	c.Assert(sync.Command, check.FitsTypeOf, gandalfSyncCmd{})
 }
 
+func (s *S) TestSecretKeysRotateCmdIsRegistered(c *check.C) {
+	manager := buildManager()
+	cmd, ok := manager.Commands["secret-keys-rotate"]
+	c.Assert(ok, check.Equals, true)
+	rotate, ok := cmd.(*tsurudCommand)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(rotate.Command, check.FitsTypeOf, secretKeysRotateCmd{})
+}
+
 func (s *S) TestShouldRegisterAllCommandsFromProvisioners(c *check.C) {
 	fp := provisiontest.NewFakeProvisioner()
 	p := CommandableProvisioner{FakeProvisioner: *fp}
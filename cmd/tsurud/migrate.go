@@ -44,6 +44,10 @@ func init() {
 	if err != nil {
 		log.Fatalf("unable to register migration: %s", err)
 	}
+	err = migration.Register("migrate-events-unique-id", migrateEventsUniqueID)
+	if err != nil {
+		log.Fatalf("unable to register migration: %s", err)
+	}
 	err = migration.RegisterOptional("migrate-roles", migrateRoles)
 	if err != nil {
 		log.Fatalf("unable to register migration: %s", err)
@@ -209,6 +213,33 @@ func migrateServiceProxyActions() error {
 	return err
 }
 
+// migrateEventsUniqueID sets the unique id of events created before it
+// existed, finished events reuse their own id.
+func migrateEventsUniqueID() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	var evt struct {
+		ID interface{} `bson:"_id"`
+	}
+	iter := coll.Find(bson.M{"uniqueid": bson.M{"$in": []interface{}{nil, ""}}}).Select(bson.M{"_id": 1}).Iter()
+	for iter.Next(&evt) {
+		uniqueID, ok := evt.ID.(bson.ObjectId)
+		if !ok {
+			uniqueID = bson.NewObjectId()
+		}
+		err = coll.UpdateId(evt.ID, bson.M{"$set": bson.M{"uniqueid": uniqueID}})
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
 func createRole(name, contextType string) (permission.Role, error) {
 	role, err := permission.NewRole(name, contextType, "")
 	if err == permission.ErrRoleAlreadyExists {
@@ -85,3 +85,33 @@ func (s *S) TestMigrateBSEnvs(c *check.C) {
 	c.Assert(entries["p2"], check.DeepEquals, expectedP2)
 	c.Assert(entries["p3"], check.DeepEquals, expectedP3)
 }
+
+func (s *S) TestMigrateEventsUniqueID(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	doneID := bson.NewObjectId()
+	err = conn.Events().Insert(bson.M{"_id": doneID, "kind": "app.deploy"})
+	c.Assert(err, check.IsNil)
+	runningID := bson.D{{Name: "name", Value: "app"}, {Name: "value", Value: "myapp"}}
+	err = conn.Events().Insert(bson.M{"_id": runningID, "kind": "app.deploy", "running": true})
+	c.Assert(err, check.IsNil)
+	existingID := bson.NewObjectId()
+	err = conn.Events().Insert(bson.M{"_id": bson.NewObjectId(), "kind": "app.deploy", "uniqueid": existingID})
+	c.Assert(err, check.IsNil)
+	err = migrateEventsUniqueID()
+	c.Assert(err, check.IsNil)
+	var evt struct{ UniqueID bson.ObjectId }
+	err = conn.Events().FindId(doneID).One(&evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.UniqueID, check.Equals, doneID)
+	err = conn.Events().FindId(runningID).One(&evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.UniqueID.Valid(), check.Equals, true)
+	n, err := conn.Events().Find(bson.M{"uniqueid": existingID}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	n, err = conn.Events().Find(bson.M{"uniqueid": bson.M{"$in": []interface{}{nil, ""}}}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event/webhook"
+)
+
+type secretKeysRotateCmd struct{}
+
+func (secretKeysRotateCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	rotated, err := app.RotateSecretEnvs()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d secret environment variables encrypted with the current key.\n", rotated)
+	rotated, err = app.RotateCertificateKeys()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d certificate keys encrypted with the current key.\n", rotated)
+	rotated, err = webhook.RotateSecrets()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d webhook secrets encrypted with the current key.\n", rotated)
+	return nil
+}
+
+func (secretKeysRotateCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "secret-keys-rotate",
+		Usage: "secret-keys-rotate",
+		Desc: `Encrypts again all secret environment variables, certificate keys and
+webhook secrets that were encrypted with keys other than the one defined in
+secrets:current-key. Old keys can be removed from the configuration file after
+running this command.`,
+		MinArgs: 0,
+	}
+}
@@ -220,8 +220,51 @@ func (s *Storage) Limiter() *storage.Collection {
 func (s *Storage) Events() *storage.Collection {
 	ownerIndex := mgo.Index{Key: []string{"owner"}}
 	kindIndex := mgo.Index{Key: []string{"kind"}}
+	uniqueIDIndex := mgo.Index{Key: []string{"uniqueid"}}
 	c := s.Collection("events")
 	c.EnsureIndex(ownerIndex)
 	c.EnsureIndex(kindIndex)
+	c.EnsureIndex(uniqueIDIndex)
+	return c
+}
+
+func (s *Storage) Webhooks() *storage.Collection {
+	teamIndex := mgo.Index{Key: []string{"teamowner"}}
+	c := s.Collection("webhooks")
+	c.EnsureIndex(teamIndex)
+	return c
+}
+
+func (s *Storage) WebhookDeliveries() *storage.Collection {
+	webhookIndex := mgo.Index{Key: []string{"webhook", "-time"}}
+	retryIndex := mgo.Index{Key: []string{"nextattempt"}, Sparse: true}
+	c := s.Collection("webhook_deliveries")
+	c.EnsureIndex(webhookIndex)
+	c.EnsureIndex(retryIndex)
+	return c
+}
+
+func (s *Storage) JobRuns() *storage.Collection {
+	jobIndex := mgo.Index{Key: []string{"app", "job", "-starttime"}}
+	runningIndex := mgo.Index{Key: []string{"running", "deadline"}}
+	c := s.Collection("app_job_runs")
+	c.EnsureIndex(jobIndex)
+	c.EnsureIndex(runningIndex)
+	return c
+}
+
+func (s *Storage) DeployFreezes() *storage.Collection {
+	appIndex := mgo.Index{Key: []string{"app"}}
+	poolIndex := mgo.Index{Key: []string{"pool"}}
+	c := s.Collection("deploy_freezes")
+	c.EnsureIndex(appIndex)
+	c.EnsureIndex(poolIndex)
+	return c
+}
+
+func (s *Storage) DeployRequests() *storage.Collection {
+	appIndex := mgo.Index{Key: []string{"app", "-requestedat"}}
+	c := s.Collection("deploy_requests")
+	c.EnsureIndex(appIndex)
 	return c
 }
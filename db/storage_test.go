@@ -241,3 +241,48 @@ func (s *S) TestRoles(c *check.C) {
 	rolesc := strg.Collection("roles")
 	c.Assert(roles, check.DeepEquals, rolesc)
 }
+
+func (s *S) TestWebhooks(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	webhooks := strg.Webhooks()
+	webhooksc := strg.Collection("webhooks")
+	c.Assert(webhooks, check.DeepEquals, webhooksc)
+}
+
+func (s *S) TestWebhookDeliveries(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	deliveries := strg.WebhookDeliveries()
+	deliveriesc := strg.Collection("webhook_deliveries")
+	c.Assert(deliveries, check.DeepEquals, deliveriesc)
+}
+
+func (s *S) TestJobRuns(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	runs := strg.JobRuns()
+	runsc := strg.Collection("app_job_runs")
+	c.Assert(runs, check.DeepEquals, runsc)
+}
+
+func (s *S) TestDeployFreezes(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	freezes := strg.DeployFreezes()
+	freezesc := strg.Collection("deploy_freezes")
+	c.Assert(freezes, check.DeepEquals, freezesc)
+}
+
+func (s *S) TestDeployRequests(c *check.C) {
+	strg, err := Conn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	requests := strg.DeployRequests()
+	requestsc := strg.Collection("deploy_requests")
+	c.Assert(requests, check.DeepEquals, requestsc)
+}
@@ -0,0 +1,310 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+type EventList struct {
+	fs          *gnuflag.FlagSet
+	targetName  string
+	targetValue string
+	kind        string
+	owner       string
+	running     bool
+	errorOnly   bool
+	since       string
+	until       string
+	skip        int
+	limit       int
+}
+
+func (c *EventList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "event-list",
+		Usage: "event-list [-t/--target <name>] [-v/--target-value <value>] [-k/--kind <kind>] [-o/--owner <owner>] [-r/--running] [-e/--errors] [--since <time>] [--until <time>] [-s/--skip <n>] [-l/--limit <n>]",
+		Desc: `Lists events that may still be running or have already finished.
+
+Times used in --since and --until must be in RFC 3339 format, e.g.
+2016-08-01T15:04:05Z.`,
+	}
+}
+
+func (c *EventList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("event-list", gnuflag.ExitOnError)
+		msg := "Filter events by target name (e.g. app, node)"
+		c.fs.StringVar(&c.targetName, "target", "", msg)
+		c.fs.StringVar(&c.targetName, "t", "", msg)
+		msg = "Filter events by target value (e.g. the app name)"
+		c.fs.StringVar(&c.targetValue, "target-value", "", msg)
+		c.fs.StringVar(&c.targetValue, "v", "", msg)
+		msg = "Filter events by kind name"
+		c.fs.StringVar(&c.kind, "kind", "", msg)
+		c.fs.StringVar(&c.kind, "k", "", msg)
+		msg = "Filter events by owner name"
+		c.fs.StringVar(&c.owner, "owner", "", msg)
+		c.fs.StringVar(&c.owner, "o", "", msg)
+		msg = "Shows only running events"
+		c.fs.BoolVar(&c.running, "running", false, msg)
+		c.fs.BoolVar(&c.running, "r", false, msg)
+		msg = "Shows only events that finished with errors"
+		c.fs.BoolVar(&c.errorOnly, "errors", false, msg)
+		c.fs.BoolVar(&c.errorOnly, "e", false, msg)
+		c.fs.StringVar(&c.since, "since", "", "Shows only events started after the given time")
+		c.fs.StringVar(&c.until, "until", "", "Shows only events started before the given time")
+		msg = "Number of events to skip"
+		c.fs.IntVar(&c.skip, "skip", 0, msg)
+		c.fs.IntVar(&c.skip, "s", 0, msg)
+		msg = "Maximum number of events to show"
+		c.fs.IntVar(&c.limit, "limit", 0, msg)
+		c.fs.IntVar(&c.limit, "l", 0, msg)
+	}
+	return c.fs
+}
+
+func (c *EventList) query() url.Values {
+	qs := url.Values{}
+	if c.targetName != "" {
+		qs.Set("target.name", c.targetName)
+	}
+	if c.targetValue != "" {
+		qs.Set("target.value", c.targetValue)
+	}
+	if c.kind != "" {
+		qs.Set("kind", c.kind)
+	}
+	if c.owner != "" {
+		qs.Set("owner", c.owner)
+	}
+	if c.running {
+		qs.Set("running", "true")
+	}
+	if c.errorOnly {
+		qs.Set("erroronly", "true")
+	}
+	if c.since != "" {
+		qs.Set("since", c.since)
+	}
+	if c.until != "" {
+		qs.Set("until", c.until)
+	}
+	if c.skip > 0 {
+		qs.Set("skip", strconv.Itoa(c.skip))
+	}
+	if c.limit > 0 {
+		qs.Set("limit", strconv.Itoa(c.limit))
+	}
+	return qs
+}
+
+func (c *EventList) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/events?" + c.query().Encode())
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	var evts []Event
+	if rsp.StatusCode == http.StatusOK {
+		err = json.NewDecoder(rsp.Body).Decode(&evts)
+		if err != nil {
+			return err
+		}
+	}
+	tbl := cmd.NewTable()
+	tbl.Headers = cmd.Row{"ID", "Start (duration)", "Success", "Owner", "Kind", "Target"}
+	for i := range evts {
+		evt := &evts[i]
+		tbl.AddRow(cmd.Row{
+			evt.UniqueID.Hex(),
+			formatTimes(evt),
+			formatSuccess(evt),
+			evt.Owner,
+			evt.Kind,
+			fmt.Sprintf("%s: %s", evt.Target.Name, evt.Target.Value),
+		})
+	}
+	context.Stdout.Write(tbl.Bytes())
+	return nil
+}
+
+func formatTimes(evt *Event) string {
+	start := evt.StartTime.Local().Format(time.Stamp)
+	if evt.Running {
+		return fmt.Sprintf("%s (running)", start)
+	}
+	duration := evt.EndTime.Sub(evt.StartTime)
+	return fmt.Sprintf("%s (%v)", start, duration)
+}
+
+func formatSuccess(evt *Event) string {
+	if evt.Running {
+		return "..."
+	}
+	return strconv.FormatBool(evt.Error == "")
+}
+
+type EventInfo struct {
+	fs     *gnuflag.FlagSet
+	follow bool
+}
+
+func (c *EventInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "event-info",
+		Usage: "event-info <event-id> [-f/--follow]",
+		Desc: `Show detailed information about one single event.
+
+When --follow is used and the event is still running, its log is streamed
+until the event finishes.`,
+		MinArgs: 1,
+		MaxArgs: 1,
+	}
+}
+
+func (c *EventInfo) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("event-info", gnuflag.ExitOnError)
+		msg := "Follow the log of a running event until it finishes"
+		c.fs.BoolVar(&c.follow, "follow", false, msg)
+		c.fs.BoolVar(&c.follow, "f", false, msg)
+	}
+	return c.fs
+}
+
+func (c *EventInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/events/" + context.Args[0])
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	var evt Event
+	err = json.NewDecoder(rsp.Body).Decode(&evt)
+	if err != nil {
+		return err
+	}
+	type item struct {
+		label string
+		value string
+	}
+	items := []item{
+		{"ID", evt.UniqueID.Hex()},
+		{"Start", evt.StartTime.Local().Format(time.RFC822)},
+		{"End", ""},
+		{"Target", fmt.Sprintf("%s(%s)", evt.Target.Name, evt.Target.Value)},
+		{"Kind", evt.Kind},
+		{"Owner", evt.Owner},
+		{"Cancelable", strconv.FormatBool(evt.Cancelable)},
+		{"Running", strconv.FormatBool(evt.Running)},
+	}
+	if !evt.Running {
+		items[2].value = fmt.Sprintf("%s (%v)", evt.EndTime.Local().Format(time.RFC822), evt.EndTime.Sub(evt.StartTime))
+		items = append(items, item{"Success", strconv.FormatBool(evt.Error == "")})
+	} else {
+		items[2].value = "..."
+	}
+	if evt.Error != "" {
+		items = append(items, item{"Error", evt.Error})
+	}
+	if evt.CancelInfo.Asked {
+		items = append(items, item{"Cancel Reason", evt.CancelInfo.Reason}, item{"Canceled By", evt.CancelInfo.Owner})
+	}
+	for _, it := range items {
+		fmt.Fprintf(context.Stdout, "%s: %s\n", cmd.Colorfy(it.label, "cyan", "", ""), it.value)
+	}
+	if c.follow && evt.Running {
+		fmt.Fprintf(context.Stdout, "%s:\n", cmd.Colorfy("Log", "cyan", "", ""))
+		return c.followLog(context, client, context.Args[0])
+	}
+	if evt.Log != "" {
+		fmt.Fprintf(context.Stdout, "%s:\n", cmd.Colorfy("Log", "cyan", "", ""))
+		for _, line := range strings.Split(strings.TrimRight(evt.Log, "\n"), "\n") {
+			fmt.Fprintf(context.Stdout, "    %s\n", line)
+		}
+	}
+	return nil
+}
+
+func (c *EventInfo) followLog(context *cmd.Context, client *cmd.Client, id string) error {
+	u, err := cmd.GetURL(fmt.Sprintf("/events/%s/log?follow=1", id))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, err = io.Copy(context.Stdout, rsp.Body)
+	return err
+}
+
+type EventCancel struct {
+	cmd.ConfirmationCommand
+}
+
+func (c *EventCancel) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "event-cancel",
+		Usage:   "event-cancel <event-id> <reason> [-y]",
+		Desc:    "Cancel a running event.",
+		MinArgs: 2,
+	}
+}
+
+func (c *EventCancel) Run(context *cmd.Context, client *cmd.Client) error {
+	if !c.Confirm(context, "Are you sure you want to cancel this event?") {
+		return nil
+	}
+	u, err := cmd.GetURL(fmt.Sprintf("/events/%s/cancel", context.Args[0]))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("reason", strings.Join(context.Args[1:], " "))
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rsp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	fmt.Fprintln(context.Stdout, "Cancellation successfully requested.")
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+type CmdSuite struct{}
+
+var _ = check.Suite(&CmdSuite{})
+
+func (s *CmdSuite) SetUpSuite(c *check.C) {
+	os.Setenv("TSURU_TARGET", "http://localhost")
+}
+
+func (s *CmdSuite) TearDownSuite(c *check.C) {
+	os.Unsetenv("TSURU_TARGET")
+}
+
+func (s *CmdSuite) TestEventListRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{}, Stdout: &buf}
+	body := `[
+{"UniqueID": "57a0d5e8b2ddc72f39d9a5b4", "Target": {"Name": "app", "Value": "myapp"}, "Kind": "app.deploy", "Owner": "me@me.com", "Running": true, "StartTime": "2016-08-01T15:04:05Z"},
+{"UniqueID": "57a0d5e8b2ddc72f39d9a5b5", "Target": {"Name": "node", "Value": "n1"}, "Kind": "node.create", "Owner": "me@me.com", "Error": "err", "StartTime": "2016-08-01T15:04:05Z", "EndTime": "2016-08-01T15:04:07Z"}
+]`
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: body, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/events" && req.Method == "GET" &&
+				req.URL.Query().Get("target.name") == "app" &&
+				req.URL.Query().Get("running") == "true" &&
+				req.URL.Query().Get("limit") == "10"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := EventList{}
+	command.Flags().Parse(true, []string{"-t", "app", "-r", "-l", "10"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	out := buf.String()
+	c.Assert(out, check.Matches, `(?s).*57a0d5e8b2ddc72f39d9a5b4.*\(running\).*app\.deploy.*app: myapp.*`)
+	c.Assert(out, check.Matches, `(?s).*57a0d5e8b2ddc72f39d9a5b5.*\(2s\).*false.*node\.create.*node: n1.*`)
+}
+
+func (s *CmdSuite) TestEventListRunNoContent(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{}, Stdout: &buf}
+	trans := &cmdtest.Transport{Status: http.StatusNoContent}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := EventList{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, `+----+------------------+---------+-------+------+--------+
+| ID | Start (duration) | Success | Owner | Kind | Target |
++----+------------------+---------+-------+------+--------+
++----+------------------+---------+-------+------+--------+
+`)
+}
+
+func (s *CmdSuite) TestEventInfoRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"57a0d5e8b2ddc72f39d9a5b5"}, Stdout: &buf}
+	body := `{"UniqueID": "57a0d5e8b2ddc72f39d9a5b5", "Target": {"Name": "node", "Value": "n1"}, "Kind": "node.create", "Owner": "me@me.com", "Error": "err", "Log": "line1\nline2\n", "StartTime": "2016-08-01T15:04:05Z", "EndTime": "2016-08-01T15:04:07Z"}`
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: body, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/events/57a0d5e8b2ddc72f39d9a5b5" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := EventInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	out := buf.String()
+	c.Assert(out, check.Matches, `(?s).*ID.*: 57a0d5e8b2ddc72f39d9a5b5\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Target.*: node\(n1\)\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Success.*: false\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Error.*: err\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Log.*:\n    line1\n    line2\n$`)
+}
+
+func (s *CmdSuite) TestEventInfoRunFollow(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"57a0d5e8b2ddc72f39d9a5b5"}, Stdout: &buf}
+	body := `{"UniqueID": "57a0d5e8b2ddc72f39d9a5b5", "Target": {"Name": "node", "Value": "n1"}, "Kind": "node.create", "Owner": "me@me.com", "Running": true, "Log": "line1\n", "StartTime": "2016-08-01T15:04:05Z"}`
+	trans := &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: body, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.0/events/57a0d5e8b2ddc72f39d9a5b5" && req.Method == "GET"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "line1\nline2\n", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.0/events/57a0d5e8b2ddc72f39d9a5b5/log" &&
+						req.URL.Query().Get("follow") == "1" && req.Method == "GET"
+				},
+			},
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := EventInfo{}
+	command.Flags().Parse(true, []string{"-f"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	out := buf.String()
+	c.Assert(out, check.Matches, `(?s).*Running.*: true\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Log.*:\nline1\nline2\n$`)
+}
+
+func (s *CmdSuite) TestEventCancelRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"57a0d5e8b2ddc72f39d9a5b5", "my", "reason"},
+		Stdout: &buf,
+		Stdin:  strings.NewReader("y\n"),
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			data, _ := ioutil.ReadAll(req.Body)
+			return req.URL.Path == "/1.0/events/57a0d5e8b2ddc72f39d9a5b5/cancel" &&
+				req.Method == "POST" && string(data) == "reason=my+reason"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := EventCancel{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Are you sure you want to cancel this event? (y/n) Cancellation successfully requested.\n")
+}
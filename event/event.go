@@ -24,7 +24,7 @@ var (
 	lockUpdateInterval = 30 * time.Second
 	lockExpireTimeout  = 5 * time.Minute
 	updater            = lockUpdater{
-		addCh:    make(chan *Target),
+		addCh:    make(chan *Event),
 		removeCh: make(chan *Target),
 		once:     &sync.Once{},
 	}
@@ -37,6 +37,28 @@ var (
 	ErrNoOpts        = ErrValidation("event opts is mandatory")
 )
 
+var doneListeners struct {
+	sync.RWMutex
+	listeners []func(*Event)
+}
+
+// AddDoneListener registers a function to be called every time an event
+// finishes, after the event is stored. Aborted events don't trigger the
+// listeners, and listeners are called synchronously, so they shouldn't block.
+func AddDoneListener(fn func(evt *Event)) {
+	doneListeners.Lock()
+	defer doneListeners.Unlock()
+	doneListeners.listeners = append(doneListeners.listeners, fn)
+}
+
+func notifyDone(evt *Event) {
+	doneListeners.RLock()
+	defer doneListeners.RUnlock()
+	for _, fn := range doneListeners.listeners {
+		fn(evt)
+	}
+}
+
 type ErrValidation string
 
 func (err ErrValidation) Error() string {
@@ -83,7 +105,8 @@ func (id eventId) GetBSON() (interface{}, error) {
 // access to its public fields. (They have to be public for database
 // serializing).
 type eventData struct {
-	ID              eventId `bson:"_id"`
+	ID              eventId `bson:"_id" json:"-"`
+	UniqueID        bson.ObjectId
 	StartTime       time.Time
 	EndTime         time.Time   `bson:",omitempty"`
 	Target          Target      `bson:",omitempty"`
@@ -132,19 +155,100 @@ func (e *Event) String() string {
 	)
 }
 
+type Filter struct {
+	Target    Target
+	KindName  string
+	OwnerName string
+	Since     time.Time
+	Until     time.Time
+	Running   *bool
+	ErrorOnly bool
+	Limit     int
+	Skip      int
+}
+
+func (f *Filter) toQuery() bson.M {
+	query := bson.M{}
+	if f == nil {
+		return query
+	}
+	if f.Target.Name != "" {
+		query["target.name"] = f.Target.Name
+	}
+	if f.Target.Value != "" {
+		query["target.value"] = f.Target.Value
+	}
+	if f.KindName != "" {
+		query["kind"] = f.KindName
+	}
+	if f.OwnerName != "" {
+		query["owner"] = f.OwnerName
+	}
+	timeParts := bson.M{}
+	if !f.Since.IsZero() {
+		timeParts["$gte"] = f.Since
+	}
+	if !f.Until.IsZero() {
+		timeParts["$lte"] = f.Until
+	}
+	if len(timeParts) > 0 {
+		query["starttime"] = timeParts
+	}
+	if f.Running != nil {
+		query["running"] = *f.Running
+	}
+	if f.ErrorOnly {
+		query["error"] = bson.M{"$ne": ""}
+	}
+	return query
+}
+
 func All() ([]Event, error) {
+	return List(nil)
+}
+
+func List(filter *Filter) ([]Event, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
+	query := conn.Events().Find(filter.toQuery()).Sort("-starttime")
+	if filter != nil {
+		if filter.Skip > 0 {
+			query = query.Skip(filter.Skip)
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+	}
 	var allData []eventData
-	err = conn.Events().Find(nil).Sort("-_id").All(&allData)
+	err = query.All(&allData)
+	if err != nil {
+		return nil, err
+	}
 	evts := make([]Event, len(allData))
 	for i := range evts {
 		evts[i].eventData = allData[i]
 	}
-	return evts, err
+	return evts, nil
+}
+
+func GetByID(id bson.ObjectId) (*Event, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var evt Event
+	err = conn.Events().Find(bson.M{"uniqueid": id}).One(&evt.eventData)
+	if err == mgo.ErrNotFound {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &evt, nil
 }
 
 func New(opts *Opts) (*Event, error) {
@@ -170,6 +274,7 @@ func New(opts *Opts) (*Event, error) {
 	now := time.Now().UTC()
 	evt := Event{eventData: eventData{
 		ID:              eventId{target: opts.Target},
+		UniqueID:        bson.NewObjectId(),
 		Target:          opts.Target,
 		StartTime:       now,
 		Kind:            opts.Kind.FullName(),
@@ -183,7 +288,7 @@ func New(opts *Opts) (*Event, error) {
 	for i := 0; i < maxRetries+1; i++ {
 		err = coll.Insert(evt.eventData)
 		if err == nil {
-			updater.addCh <- &opts.Target
+			updater.addCh <- &evt
 			return &evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -224,6 +329,13 @@ func (e *Event) Logf(format string, params ...interface{}) {
 	fmt.Fprintf(&e.logBuffer, format, params...)
 }
 
+func (e *Event) Write(data []byte) (int, error) {
+	if e.logWriter != nil {
+		e.logWriter.Write(data)
+	}
+	return e.logBuffer.Write(data)
+}
+
 func (e *Event) TryCancel(reason, owner string) error {
 	if !e.Cancelable || !e.Running {
 		return ErrNotCancelable
@@ -305,11 +417,16 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 	e.Log = e.logBuffer.String()
 	defer coll.RemoveId(e.ID)
 	e.ID = eventId{objId: bson.NewObjectId()}
-	return coll.Insert(e.eventData)
+	err = coll.Insert(e.eventData)
+	if err != nil {
+		return err
+	}
+	notifyDone(e)
+	return nil
 }
 
 type lockUpdater struct {
-	addCh    chan *Target
+	addCh    chan *Event
 	removeCh chan *Target
 	stopCh   chan struct{}
 	once     *sync.Once
@@ -332,11 +449,11 @@ func (l *lockUpdater) stop() {
 }
 
 func (l *lockUpdater) spin() {
-	set := map[Target]struct{}{}
+	set := map[Target]*Event{}
 	for {
 		select {
 		case added := <-l.addCh:
-			set[*added] = struct{}{}
+			set[added.Target] = added
 		case removed := <-l.removeCh:
 			delete(set, *removed)
 		case <-l.stopCh:
@@ -349,15 +466,17 @@ func (l *lockUpdater) spin() {
 			continue
 		}
 		coll := conn.Events()
-		slice := make([]interface{}, len(set))
-		i := 0
-		for id := range set {
-			slice[i], _ = id.GetBSON()
-			i++
-		}
-		err = coll.Update(bson.M{"_id": bson.M{"$in": slice}}, bson.M{"$set": bson.M{"lockupdatetime": time.Now().UTC()}})
-		if err != nil {
-			log.Errorf("[events] [lock update] error updating: %s", err)
+		now := time.Now().UTC()
+		// The log of running events is saved along with the lock, so it can
+		// be followed before the event is done.
+		for _, evt := range set {
+			err = coll.UpdateId(evt.ID, bson.M{"$set": bson.M{
+				"lockupdatetime": now,
+				"log":            evt.logBuffer.String(),
+			}})
+			if err != nil && err != mgo.ErrNotFound {
+				log.Errorf("[events] [lock update] error updating: %s", err)
+			}
 		}
 		conn.Close()
 	}
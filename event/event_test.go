@@ -7,6 +7,7 @@ package event
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -42,6 +43,7 @@ func (s *S) TestNewDone(c *check.C) {
 	c.Assert(evt.LockUpdateTime.IsZero(), check.Equals, false)
 	expected := &Event{eventData: eventData{
 		ID:             eventId{target: Target{Name: "app", Value: "myapp"}},
+		UniqueID:       evt.UniqueID,
 		Target:         Target{Name: "app", Value: "myapp"},
 		Kind:           "app.update.env.set",
 		Owner:          "me@me.com",
@@ -82,6 +84,7 @@ func (s *S) TestNewCustomDataDone(c *check.C) {
 	c.Assert(evt.LockUpdateTime.IsZero(), check.Equals, false)
 	expected := &Event{eventData: eventData{
 		ID:              eventId{target: Target{Name: "app", Value: "myapp"}},
+		UniqueID:        evt.UniqueID,
 		Target:          Target{Name: "app", Value: "myapp"},
 		Kind:            "app.update.env.set",
 		Owner:           "me@me.com",
@@ -175,6 +178,26 @@ func (s *S) TestUpdaterUpdatesAndStopsUpdating(c *check.C) {
 	c.Assert(t0, check.DeepEquals, t1)
 }
 
+func (s *S) TestUpdaterSavesRunningLog(c *check.C) {
+	updater.stop()
+	oldUpdateInterval := lockUpdateInterval
+	lockUpdateInterval = time.Millisecond
+	defer func() {
+		updater.stop()
+		lockUpdateInterval = oldUpdateInterval
+	}()
+	evt, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	evt.Logf("running log")
+	time.Sleep(100 * time.Millisecond)
+	running, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(running.Running, check.Equals, true)
+	c.Assert(running.Log, check.Equals, "running log\n")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
 func (s *S) TestEventAbort(c *check.C) {
 	evt, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
 	c.Assert(err, check.IsNil)
@@ -198,6 +221,7 @@ func (s *S) TestEventDoneError(c *check.C) {
 	c.Assert(evts[0].EndTime.IsZero(), check.Equals, false)
 	expected := &Event{eventData: eventData{
 		ID:             eventId{objId: evts[0].ID.objId},
+		UniqueID:       evt.UniqueID,
 		Target:         Target{Name: "app", Value: "myapp"},
 		Kind:           "app.update.env.set",
 		Owner:          "me@me.com",
@@ -365,3 +389,104 @@ func (s *S) TestEventDoneLogError(c *check.C) {
 	c.Assert(err, check.ErrorMatches, "no reachable servers")
 	c.Assert(logBuf.String(), check.Matches, `(?s).*\[events\] error marking event as done - .*: no reachable servers.*`)
 }
+
+func (s *S) TestListFilter(c *check.C) {
+	evt1, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	err = evt1.Done(errors.New("myerr"))
+	c.Assert(err, check.IsNil)
+	evt2, err := New(&Opts{Target: Target{Name: "app", Value: "otherapp"}, Kind: permission.PermAppUpdateEnvUnset, Owner: "other@other.com"})
+	c.Assert(err, check.IsNil)
+	evt3, err := New(&Opts{Target: Target{Name: "node", Value: "http://10.0.0.1"}, Kind: permission.PermNodeCreate, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	err = evt3.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err := List(&Filter{Target: Target{Name: "app"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+	evts, err = List(&Filter{Target: Target{Name: "app", Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt1.UniqueID)
+	evts, err = List(&Filter{KindName: "app.update.env.unset"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt2.UniqueID)
+	evts, err = List(&Filter{OwnerName: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+	running := true
+	evts, err = List(&Filter{Running: &running})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt2.UniqueID)
+	evts, err = List(&Filter{ErrorOnly: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt1.UniqueID)
+	evts, err = List(&Filter{Since: time.Now().UTC().Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	evts, err = List(&Filter{Until: time.Now().UTC().Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 3)
+	evts, err = List(&Filter{Limit: 2, Skip: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestGetByID(c *check.C) {
+	evt, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	evt.Logf("hey")
+	result, err := GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Running, check.Equals, true)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	result, err = GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Running, check.Equals, false)
+	c.Assert(result.Log, check.Equals, "hey\n")
+}
+
+func (s *S) TestGetByIDNotFound(c *check.C) {
+	_, err := GetByID(bson.NewObjectId())
+	c.Assert(err, check.Equals, ErrEventNotFound)
+}
+
+func (s *S) TestEventWrite(c *check.C) {
+	evt, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	buf := bytes.Buffer{}
+	evt.SetLogWriter(&buf)
+	fmt.Fprintf(evt, "%s %d\n", "hey", 42)
+	c.Assert(buf.String(), check.Equals, "hey 42\n")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	evts, err := All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Log, check.Equals, "hey 42\n")
+}
+
+func (s *S) TestEventDoneListeners(c *check.C) {
+	defer func() { doneListeners.listeners = nil }()
+	var notified []*Event
+	AddDoneListener(func(evt *Event) {
+		notified = append(notified, evt)
+	})
+	evt, err := New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(errors.New("myerr"))
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 1)
+	c.Assert(notified[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(notified[0].Error, check.Equals, "myerr")
+	c.Assert(notified[0].Running, check.Equals, false)
+	evt, err = New(&Opts{Target: Target{Name: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: "me@me.com"})
+	c.Assert(err, check.IsNil)
+	err = evt.Abort()
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 1)
+}
@@ -0,0 +1,314 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	deliveryTaskName = "webhook-delivery"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = 2 * time.Second
+
+	sendTimeout = time.Minute
+
+	// SignatureHeader is the header holding the HMAC-SHA256 signature of the
+	// payload, in the form "sha256=<hex digest>", computed using the webhook
+	// secret.
+	SignatureHeader = "X-Tsuru-Signature"
+)
+
+// retryInterval is the interval between checks for failed deliveries that
+// must be retried.
+var retryInterval = time.Second
+
+// Delivery is an attempt to deliver an event to a webhook. NextAttempt is set
+// on failed attempts that are going to be retried.
+type Delivery struct {
+	ID          bson.ObjectId `bson:"_id" json:"id"`
+	Webhook     string        `json:"webhook"`
+	EventID     bson.ObjectId `json:"eventid"`
+	EventKind   string        `json:"eventkind"`
+	Attempt     int           `json:"attempt"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration"`
+	StatusCode  int           `json:"statuscode,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Success     bool          `json:"success"`
+	NextAttempt *time.Time    `bson:",omitempty" json:"nextattempt,omitempty"`
+	RetryQueued bool          `json:"-"`
+}
+
+// ListDeliveries returns the most recent delivery attempts of the named
+// webhook. A limit lesser than or equal to zero means no limit.
+func ListDeliveries(name string, limit int) ([]Delivery, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := conn.WebhookDeliveries().Find(bson.M{"webhook": name}).Sort("-time", "-_id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var deliveries []Delivery
+	err = query.All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+type payloadTarget struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type payload struct {
+	ID        string        `json:"id"`
+	Kind      string        `json:"kind"`
+	Target    payloadTarget `json:"target"`
+	Owner     string        `json:"owner"`
+	StartTime time.Time     `json:"starttime"`
+	EndTime   time.Time     `json:"endtime"`
+	Error     string        `json:"error,omitempty"`
+	Success   bool          `json:"success"`
+}
+
+func eventPayload(evt *event.Event) ([]byte, error) {
+	return json.Marshal(payload{
+		ID:        evt.UniqueID.Hex(),
+		Kind:      evt.Kind,
+		Target:    payloadTarget{Name: evt.Target.Name, Value: evt.Target.Value},
+		Owner:     evt.Owner,
+		StartTime: evt.StartTime,
+		EndTime:   evt.EndTime,
+		Error:     evt.Error,
+		Success:   evt.Error == "",
+	})
+}
+
+// Sign returns the signature of the payload using the given secret, as sent
+// in the SignatureHeader.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) send(body []byte, evt *event.Event, deliveryID bson.ObjectId) (int, error) {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tsuru-Event", evt.Kind)
+	req.Header.Set("X-Tsuru-Delivery", deliveryID.Hex())
+	if w.Secret != "" {
+		key, err := w.signingKey()
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set(SignatureHeader, Sign(key, body))
+	}
+	rsp, err := sendClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body)
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.StatusCode, fmt.Errorf("invalid response status: %d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
+
+func deliveryParams(webhookName string, eventID bson.ObjectId, attempt int) monsterqueue.JobParams {
+	return monsterqueue.JobParams{"webhook": webhookName, "event": eventID.Hex(), "attempt": strconv.Itoa(attempt)}
+}
+
+// sendClient returns the client used to send deliveries, which refuses to
+// connect to internal addresses unless webhooks:allow-internal-addresses is
+// set.
+func sendClient() *http.Client {
+	if allowInternalAddresses() {
+		return tsuruNet.Dial5Full60ClientNoKeepAlive
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Dial:                tsuruNet.ExternalDial(5 * time.Second),
+			TLSHandshakeTimeout: 5 * time.Second,
+			DisableKeepAlives:   true,
+		},
+		Timeout: sendTimeout,
+	}
+}
+
+func retryConfig() (int, time.Duration) {
+	maxAttempts, _ := config.GetInt("webhooks:max-attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	backoff := defaultBackoff
+	if seconds, err := config.GetFloat("webhooks:backoff"); err == nil {
+		backoff = time.Duration(seconds * float64(time.Second))
+	}
+	return maxAttempts, backoff
+}
+
+// deliver makes one attempt to send the event to the webhook and stores it in
+// the delivery log. Failed attempts are retried by enqueueRetries after an
+// exponential backoff, until the max number of attempts is reached.
+func deliver(webhookName string, eventID bson.ObjectId, attempt int) error {
+	w, err := Get(webhookName)
+	if err == ErrWebhookNotFound {
+		// The webhook was removed after the delivery was enqueued.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	evt, err := event.GetByID(eventID)
+	if err != nil {
+		return err
+	}
+	body, err := eventPayload(evt)
+	if err != nil {
+		return err
+	}
+	delivery := Delivery{
+		ID:        bson.NewObjectId(),
+		Webhook:   w.Name,
+		EventID:   eventID,
+		EventKind: evt.Kind,
+		Attempt:   attempt,
+		Time:      time.Now().UTC(),
+	}
+	delivery.StatusCode, err = w.send(body, evt, delivery.ID)
+	delivery.Duration = time.Since(delivery.Time)
+	delivery.Success = err == nil
+	if err != nil {
+		delivery.Error = err.Error()
+		maxAttempts, backoff := retryConfig()
+		if attempt < maxAttempts {
+			next := delivery.Time.Add(backoff * time.Duration(1<<uint(attempt-1)))
+			delivery.NextAttempt = &next
+		}
+	}
+	logDelivery(&delivery)
+	return err
+}
+
+// enqueueRetries enqueues the next attempt of failed deliveries whose backoff
+// is over. Each delivery is claimed before being enqueued, so it's retried
+// only once even when there are many API instances.
+func enqueueRetries() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.WebhookDeliveries()
+	query := bson.M{
+		"nextattempt": bson.M{"$lte": time.Now().UTC()},
+		"retryqueued": bson.M{"$ne": true},
+	}
+	change := mgo.Change{Update: bson.M{"$set": bson.M{"retryqueued": true}}}
+	for {
+		var delivery Delivery
+		_, err = coll.Find(query).Apply(change, &delivery)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = q.Enqueue(deliveryTaskName, deliveryParams(delivery.Webhook, delivery.EventID, delivery.Attempt+1))
+		if err != nil {
+			coll.UpdateId(delivery.ID, bson.M{"$set": bson.M{"retryqueued": false}})
+			return err
+		}
+	}
+}
+
+func retryLoop() {
+	for {
+		time.Sleep(retryInterval)
+		err := enqueueRetries()
+		if err != nil {
+			log.Errorf("[webhooks] unable to enqueue delivery retries: %s", err)
+		}
+	}
+}
+
+func logDelivery(delivery *Delivery) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[webhooks] unable to store delivery of event %s to %q: %s", delivery.EventID.Hex(), delivery.Webhook, err)
+		return
+	}
+	defer conn.Close()
+	err = conn.WebhookDeliveries().Insert(delivery)
+	if err != nil {
+		log.Errorf("[webhooks] unable to store delivery of event %s to %q: %s", delivery.EventID.Hex(), delivery.Webhook, err)
+	}
+}
+
+type deliveryTask struct{}
+
+func (t *deliveryTask) Name() string {
+	return deliveryTaskName
+}
+
+func (t *deliveryTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	webhookName, _ := params["webhook"].(string)
+	eventID, _ := params["event"].(string)
+	if !bson.IsObjectIdHex(eventID) {
+		job.Error(fmt.Errorf("invalid event id: %q", eventID))
+		return
+	}
+	attemptParam, _ := params["attempt"].(string)
+	attempt, _ := strconv.Atoi(attemptParam)
+	if attempt < 1 {
+		attempt = 1
+	}
+	err := deliver(webhookName, bson.ObjectIdHex(eventID), attempt)
+	if err != nil {
+		log.Errorf("[webhooks] unable to deliver event %s to %q: %s", eventID, webhookName, err)
+		job.Error(err)
+		return
+	}
+	job.Success(nil)
+}
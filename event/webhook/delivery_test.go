@@ -0,0 +1,194 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+)
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type fakeReceiver struct {
+	sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func (f *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	f.requests = append(f.requests, receivedRequest{header: r.Header, body: body})
+	status := http.StatusOK
+	if len(f.statuses) > 0 {
+		status, f.statuses = f.statuses[0], f.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (s *S) newEvent(c *check.C) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppDeploy,
+		Owner:  "me@me.com",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Done(nil), check.IsNil)
+	return evt
+}
+
+func (s *S) TestSign(c *check.C) {
+	c.Assert(Sign("key", []byte("The quick brown fox jumps over the lazy dog")), check.Equals,
+		"sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+}
+
+func (s *S) TestDeliver(c *check.C) {
+	receiver := &fakeReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{
+		Name:      "deploys",
+		TeamOwner: "myteam",
+		URL:       srv.URL,
+		Secret:    "s3cr3t",
+		Headers:   map[string]string{"X-Token": "abc"},
+	}
+	c.Assert(Create(&w), check.IsNil)
+	evt := s.newEvent(c)
+	err := deliver(w.Name, evt.UniqueID, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(receiver.requests, check.HasLen, 1)
+	req := receiver.requests[0]
+	c.Assert(req.header.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(req.header.Get("X-Token"), check.Equals, "abc")
+	c.Assert(req.header.Get("X-Tsuru-Event"), check.Equals, "app.deploy")
+	c.Assert(req.header.Get(SignatureHeader), check.Equals, Sign("s3cr3t", req.body))
+	var data map[string]interface{}
+	err = json.Unmarshal(req.body, &data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data["id"], check.Equals, evt.UniqueID.Hex())
+	c.Assert(data["kind"], check.Equals, "app.deploy")
+	c.Assert(data["target"], check.DeepEquals, map[string]interface{}{"name": "app", "value": "myapp"})
+	c.Assert(data["owner"], check.Equals, "me@me.com")
+	c.Assert(data["success"], check.Equals, true)
+	deliveries, err := ListDeliveries(w.Name, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].ID.Hex(), check.Equals, req.header.Get("X-Tsuru-Delivery"))
+	c.Assert(deliveries[0].EventID, check.Equals, evt.UniqueID)
+	c.Assert(deliveries[0].EventKind, check.Equals, "app.deploy")
+	c.Assert(deliveries[0].Attempt, check.Equals, 1)
+	c.Assert(deliveries[0].StatusCode, check.Equals, http.StatusOK)
+	c.Assert(deliveries[0].Success, check.Equals, true)
+	c.Assert(deliveries[0].NextAttempt, check.IsNil)
+}
+
+func (s *S) TestDeliverRefusesInternalAddresses(c *check.C) {
+	receiver := &fakeReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL}
+	c.Assert(Create(&w), check.IsNil)
+	config.Set("webhooks:allow-internal-addresses", false)
+	defer config.Set("webhooks:allow-internal-addresses", true)
+	evt := s.newEvent(c)
+	err := deliver(w.Name, evt.UniqueID, 1)
+	c.Assert(err, check.ErrorMatches, ".*address points to an internal network.*")
+	c.Assert(receiver.requests, check.HasLen, 0)
+}
+
+func (s *S) TestDeliverSchedulesRetry(c *check.C) {
+	receiver := &fakeReceiver{statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL}
+	c.Assert(Create(&w), check.IsNil)
+	evt := s.newEvent(c)
+	err := deliver(w.Name, evt.UniqueID, 1)
+	c.Assert(err, check.ErrorMatches, "invalid response status: 500")
+	c.Assert(receiver.requests, check.HasLen, 1)
+	c.Assert(receiver.requests[0].header.Get(SignatureHeader), check.Equals, "")
+	deliveries, err := ListDeliveries(w.Name, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Attempt, check.Equals, 1)
+	c.Assert(deliveries[0].StatusCode, check.Equals, http.StatusInternalServerError)
+	c.Assert(deliveries[0].Error, check.Equals, "invalid response status: 500")
+	c.Assert(deliveries[0].NextAttempt, check.NotNil)
+	c.Assert(deliveries[0].NextAttempt.After(deliveries[0].Time), check.Equals, true)
+}
+
+func (s *S) TestDeliverGivesUp(c *check.C) {
+	receiver := &fakeReceiver{statuses: []int{500}}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL}
+	c.Assert(Create(&w), check.IsNil)
+	evt := s.newEvent(c)
+	err := deliver(w.Name, evt.UniqueID, 3)
+	c.Assert(err, check.ErrorMatches, "invalid response status: 500")
+	deliveries, err := ListDeliveries(w.Name, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Success, check.Equals, false)
+	c.Assert(deliveries[0].NextAttempt, check.IsNil)
+}
+
+func (s *S) TestEnqueueRetries(c *check.C) {
+	receiver := &fakeReceiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: srv.URL}
+	c.Assert(Create(&w), check.IsNil)
+	q, err := queue.Queue()
+	c.Assert(err, check.IsNil)
+	c.Assert(q.RegisterTask(&deliveryTask{}), check.IsNil)
+	evt := s.newEvent(c)
+	err = deliver(w.Name, evt.UniqueID, 1)
+	c.Assert(err, check.NotNil)
+	for attempt := 2; attempt <= 3; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+		err = enqueueRetries()
+		c.Assert(err, check.IsNil)
+		err = queue.TestingWaitQueueTasks(1, 10*time.Second)
+		c.Assert(err, check.IsNil)
+		q, err = queue.Queue()
+		c.Assert(err, check.IsNil)
+		c.Assert(q.RegisterTask(&deliveryTask{}), check.IsNil)
+	}
+	c.Assert(receiver.requests, check.HasLen, 3)
+	deliveries, err := ListDeliveries(w.Name, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 3)
+	c.Assert(deliveries[0].Attempt, check.Equals, 3)
+	c.Assert(deliveries[0].Success, check.Equals, true)
+	c.Assert(deliveries[2].Attempt, check.Equals, 1)
+	c.Assert(deliveries[2].RetryQueued, check.Equals, true)
+	err = enqueueRetries()
+	c.Assert(err, check.IsNil)
+	jobs, err := q.ListJobs()
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.HasLen, 0)
+}
+
+func (s *S) TestDeliverRemovedWebhook(c *check.C) {
+	evt := s.newEvent(c)
+	err := deliver("removed", evt.UniqueID, 1)
+	c.Assert(err, check.IsNil)
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn *db.Storage
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_webhook_tests")
+	config.Set("webhooks:max-attempts", 3)
+	config.Set("webhooks:backoff", 0.001)
+	config.Set("webhooks:allow-internal-addresses", true)
+	config.Set("queue:mongo-database", "tsuru_webhook_queue_tests")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) setSecretKeys() {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	config.Set("secrets:keys:key2", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("b"), 32)))
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.setSecretKeys()
+	queue.ResetQueue()
+	err := dbtest.ClearAllCollections(s.conn.Webhooks().Database)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Teams().Insert(bson.M{"_id": "myteam"}, bson.M{"_id": "otherteam"})
+	c.Assert(err, check.IsNil)
+	err = s.conn.Apps().Insert(
+		bson.M{"name": "myapp", "teamowner": "myteam", "teams": []string{"myteam"}},
+		bson.M{"name": "otherapp", "teamowner": "otherteam", "teams": []string{"otherteam"}},
+	)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.conn.Webhooks().Database.DropDatabase()
+	s.conn.Close()
+	queue.ResetQueue()
+	config.Unset("webhooks")
+	config.Unset("secrets")
+}
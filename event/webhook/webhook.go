@@ -0,0 +1,369 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook implements subscriptions that notify external systems
+// about finished events through HTTP requests.
+package webhook
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrWebhookNotFound      = stderrors.New("webhook not found")
+	ErrWebhookAlreadyExists = stderrors.New("webhook already exists")
+
+	webhookNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]{0,39}$`)
+)
+
+// Webhook is a subscription to the events of the apps owned by a team, or of
+// a single app when App is set. Events are delivered as JSON payloads to the
+// URL, signed with the secret when one is defined. The secret is stored
+// encrypted with the keys defined in the secrets section of tsuru.conf.
+type Webhook struct {
+	Name       string            `bson:"_id" json:"name"`
+	TeamOwner  string            `json:"teamowner"`
+	App        string            `json:"app,omitempty"`
+	URL        string            `json:"url"`
+	EventKinds []string          `json:"eventkinds,omitempty"`
+	Secret     string            `json:"-"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// MatchesKind returns whether the webhook is interested in events of the
+// given kind. Kinds in the webhook filter also match their children, so
+// "app.update" matches "app.update.env.set". An empty filter matches every
+// kind.
+func (w *Webhook) MatchesKind(kind string) bool {
+	if len(w.EventKinds) == 0 {
+		return true
+	}
+	for _, k := range w.EventKinds {
+		if kind == k || strings.HasPrefix(kind, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) validate() error {
+	if !webhookNameRegexp.MatchString(w.Name) {
+		msg := "Invalid webhook name, the name should have at most 40 " +
+			"characters, containing only lower case letters, numbers or dashes, " +
+			"starting with a letter."
+		return &errors.ValidationError{Message: msg}
+	}
+	if w.TeamOwner == "" {
+		return &errors.ValidationError{Message: "team owner is mandatory"}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid webhook url: %q", w.URL)}
+	}
+	if !allowInternalAddresses() && tsuruNet.CheckExternalHost(tsuruNet.URLToHost(w.URL)) == tsuruNet.ErrInternalAddress {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid webhook url: %q points to an internal address", w.URL)}
+	}
+	if w.Secret != "" && !secret.IsEncrypted(w.Secret) && !secret.Enabled() {
+		return &errors.ValidationError{Message: secret.ErrNoKeys.Error()}
+	}
+	for name := range w.Headers {
+		if name == "" || strings.ContainsAny(name, ".$: ") {
+			return &errors.ValidationError{Message: fmt.Sprintf("invalid header name: %q", name)}
+		}
+		if http.CanonicalHeaderKey(name) == "Content-Type" {
+			return &errors.ValidationError{Message: "the Content-Type header cannot be overridden"}
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := conn.Teams().FindId(w.TeamOwner).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &errors.ValidationError{Message: fmt.Sprintf("team %q not found", w.TeamOwner)}
+	}
+	if w.App != "" {
+		n, err = conn.Apps().Find(bson.M{"name": w.App, "teams": w.TeamOwner}).Count()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			msg := fmt.Sprintf("app %q not found or team %q has no access to it", w.App, w.TeamOwner)
+			return &errors.ValidationError{Message: msg}
+		}
+	}
+	return nil
+}
+
+func allowInternalAddresses() bool {
+	allow, _ := config.GetBool("webhooks:allow-internal-addresses")
+	return allow
+}
+
+// encryptSecret encrypts the secret of the webhook, unless it's already
+// encrypted.
+func (w *Webhook) encryptSecret() error {
+	if w.Secret == "" || secret.IsEncrypted(w.Secret) {
+		return nil
+	}
+	encrypted, err := secret.Encrypt(w.Secret)
+	if err != nil {
+		return err
+	}
+	w.Secret = encrypted
+	return nil
+}
+
+// signingKey returns the decrypted secret of the webhook. Secrets stored
+// before being encrypted are used as they are until encrypted by
+// RotateSecrets.
+func (w *Webhook) signingKey() (string, error) {
+	if !secret.IsEncrypted(w.Secret) {
+		return w.Secret, nil
+	}
+	return secret.Decrypt(w.Secret)
+}
+
+// Create validates and stores a new webhook.
+func Create(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	err = w.encryptSecret()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+// Update validates and replaces a stored webhook.
+func Update(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	err = w.encryptSecret()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// Remove removes the webhook and its delivery log.
+func Remove(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.WebhookDeliveries().RemoveAll(bson.M{"webhook": name})
+	return err
+}
+
+// Get returns the named webhook.
+func Get(name string) (*Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var w Webhook
+	err = conn.Webhooks().FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns the webhooks owned by the given teams. A nil list of teams
+// means every webhook.
+func List(teams []string) ([]Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{}
+	if teams != nil {
+		query["teamowner"] = bson.M{"$in": teams}
+	}
+	var webhooks []Webhook
+	err = conn.Webhooks().Find(query).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// RotateSecrets encrypts the secrets of all webhooks again, using the current
+// secret key. It returns the number of secrets that were encrypted with older
+// keys or not encrypted at all.
+func RotateSecrets() (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var webhooks []Webhook
+	err = conn.Webhooks().Find(bson.M{"secret": bson.M{"$nin": []interface{}{nil, ""}}}).Select(bson.M{"secret": 1}).All(&webhooks)
+	if err != nil {
+		return 0, err
+	}
+	var rotated int
+	for _, w := range webhooks {
+		value, changed := w.Secret, true
+		if secret.IsEncrypted(w.Secret) {
+			value, changed, err = secret.Rotate(w.Secret)
+		} else {
+			value, err = secret.Encrypt(w.Secret)
+		}
+		if err != nil {
+			return rotated, fmt.Errorf("unable to rotate secret of webhook %s: %s", w.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		err = conn.Webhooks().UpdateId(w.Name, bson.M{"$set": bson.M{"secret": value}})
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// findForEvent returns the webhooks interested in events of the given target
+// and kind. Only events targeting apps or teams are delivered: app events are
+// delivered to webhooks of the app and of the team owning the app, team
+// events are delivered to the webhooks of the team which aren't bound to an
+// app.
+func findForEvent(target event.Target, kind string) ([]Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var query bson.M
+	switch target.Name {
+	case "app":
+		var a struct{ TeamOwner string }
+		err = conn.Apps().Find(bson.M{"name": target.Value}).Select(bson.M{"teamowner": 1}).One(&a)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		query = bson.M{"$or": []bson.M{
+			{"app": target.Value},
+			{"app": "", "teamowner": a.TeamOwner},
+		}}
+	case "team":
+		query = bson.M{"app": "", "teamowner": target.Value}
+	default:
+		return nil, nil
+	}
+	var all []Webhook
+	err = conn.Webhooks().Find(query).Sort("_id").All(&all)
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []Webhook
+	for _, w := range all {
+		if w.MatchesKind(kind) {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+// Initialize registers the delivery task in the queue, starts listening for
+// finished events and starts retrying failed deliveries.
+func Initialize() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	err = q.RegisterTask(&deliveryTask{})
+	if err != nil {
+		return err
+	}
+	event.AddDoneListener(notify)
+	go retryLoop()
+	return nil
+}
+
+// notify is called when events finish, the webhooks are looked up in
+// background so they don't delay the operation tracked by the event.
+func notify(evt *event.Event) {
+	go dispatch(evt.UniqueID, evt.Target, evt.Kind)
+}
+
+func dispatch(eventID bson.ObjectId, target event.Target, kind string) {
+	webhooks, err := findForEvent(target, kind)
+	if err != nil {
+		log.Errorf("[webhooks] unable to find webhooks for event %s: %s", eventID.Hex(), err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	q, err := queue.Queue()
+	if err != nil {
+		log.Errorf("[webhooks] unable to get queue: %s", err)
+		return
+	}
+	for _, w := range webhooks {
+		_, err = q.Enqueue(deliveryTaskName, deliveryParams(w.Name, eventID, 1))
+		if err != nil {
+			log.Errorf("[webhooks] unable to enqueue delivery of event %s to %q: %s", eventID.Hex(), w.Name, err)
+		}
+	}
+}
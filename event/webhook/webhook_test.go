@@ -0,0 +1,216 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestWebhookMatchesKind(c *check.C) {
+	w := Webhook{}
+	c.Assert(w.MatchesKind("app.deploy"), check.Equals, true)
+	w.EventKinds = []string{"app.deploy", "app.update"}
+	c.Assert(w.MatchesKind("app.deploy"), check.Equals, true)
+	c.Assert(w.MatchesKind("app.update.env.set"), check.Equals, true)
+	c.Assert(w.MatchesKind("app.updated"), check.Equals, false)
+	c.Assert(w.MatchesKind("app.create"), check.Equals, false)
+}
+
+func (s *S) TestCreate(c *check.C) {
+	w := Webhook{
+		Name:       "deploys",
+		TeamOwner:  "myteam",
+		URL:        "http://example.com/hook",
+		EventKinds: []string{"app.deploy"},
+		Secret:     "s3cr3t",
+		Headers:    map[string]string{"X-Token": "abc"},
+	}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	c.Assert(secret.IsEncrypted(w.Secret), check.Equals, true)
+	dbW, err := Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(*dbW, check.DeepEquals, w)
+	key, err := dbW.signingKey()
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "s3cr3t")
+	err = Create(&w)
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+}
+
+func (s *S) TestCreateSecretWithoutKeys(c *check.C) {
+	config.Unset("secrets")
+	defer s.setSecretKeys()
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook", Secret: "s3cr3t"}
+	err := Create(&w)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(err, check.ErrorMatches, "secrets are not enabled.*")
+}
+
+func (s *S) TestCreateInternalURL(c *check.C) {
+	config.Set("webhooks:allow-internal-addresses", false)
+	defer config.Set("webhooks:allow-internal-addresses", true)
+	for _, u := range []string{"http://127.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "https://10.0.0.1", "http://[::1]:8080"} {
+		w := Webhook{Name: "hook", TeamOwner: "myteam", URL: u}
+		err := Create(&w)
+		c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, `invalid webhook url: ".*" points to an internal address`)
+	}
+}
+
+func (s *S) TestUpdateKeepsEncryptedSecret(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook", Secret: "s3cr3t"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	encrypted := w.Secret
+	w.URL = "https://example.com/other"
+	err = Update(&w)
+	c.Assert(err, check.IsNil)
+	dbW, err := Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Secret, check.Equals, encrypted)
+}
+
+func (s *S) TestRotateSecrets(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook", Secret: "s3cr3t"}
+	c.Assert(Create(&w), check.IsNil)
+	err := s.conn.Webhooks().Insert(bson.M{"_id": "plain", "teamowner": "myteam", "url": "http://example.com", "secret": "abc"})
+	c.Assert(err, check.IsNil)
+	config.Set("secrets:current-key", "key2")
+	rotated, err := RotateSecrets()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 2)
+	for name, expected := range map[string]string{"deploys": "s3cr3t", "plain": "abc"} {
+		dbW, err := Get(name)
+		c.Assert(err, check.IsNil)
+		id, err := secret.KeyID(dbW.Secret)
+		c.Assert(err, check.IsNil)
+		c.Assert(id, check.Equals, "key2")
+		key, err := dbW.signingKey()
+		c.Assert(err, check.IsNil)
+		c.Assert(key, check.Equals, expected)
+	}
+	rotated, err = RotateSecrets()
+	c.Assert(err, check.IsNil)
+	c.Assert(rotated, check.Equals, 0)
+}
+
+func (s *S) TestCreateValidation(c *check.C) {
+	tests := []struct {
+		w   Webhook
+		msg string
+	}{
+		{Webhook{Name: "Invalid Name", TeamOwner: "myteam", URL: "http://a.com"}, "Invalid webhook name"},
+		{Webhook{Name: "hook", URL: "http://a.com"}, "team owner is mandatory"},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "ftp://a.com"}, `invalid webhook url: "ftp://a.com"`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://"}, `invalid webhook url: "http://"`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://a.com", Headers: map[string]string{"a.b": "c"}}, `invalid header name: "a.b"`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", URL: "http://a.com", Headers: map[string]string{"content-type": "c"}}, "the Content-Type header cannot be overridden"},
+		{Webhook{Name: "hook", TeamOwner: "unknown", URL: "http://a.com"}, `team "unknown" not found`},
+		{Webhook{Name: "hook", TeamOwner: "myteam", App: "otherapp", URL: "http://a.com"}, `app "otherapp" not found or team "myteam" has no access to it`},
+	}
+	for _, t := range tests {
+		err := Create(&t.w)
+		c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+		c.Assert(err, check.ErrorMatches, t.msg+".*")
+	}
+	webhooks, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 0)
+}
+
+func (s *S) TestUpdate(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	w.App = "myapp"
+	w.URL = "https://example.com/other"
+	err = Update(&w)
+	c.Assert(err, check.IsNil)
+	dbW, err := Get("deploys")
+	c.Assert(err, check.IsNil)
+	c.Assert(*dbW, check.DeepEquals, w)
+}
+
+func (s *S) TestUpdateNotFound(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook"}
+	err := Update(&w)
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestRemove(c *check.C) {
+	w := Webhook{Name: "deploys", TeamOwner: "myteam", URL: "http://example.com/hook"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	err = s.conn.WebhookDeliveries().Insert(Delivery{ID: bson.NewObjectId(), Webhook: "deploys"}, Delivery{ID: bson.NewObjectId(), Webhook: "other"})
+	c.Assert(err, check.IsNil)
+	err = Remove("deploys")
+	c.Assert(err, check.IsNil)
+	_, err = Get("deploys")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	n, err := s.conn.WebhookDeliveries().Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	err = Remove("deploys")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestList(c *check.C) {
+	w1 := Webhook{Name: "hook1", TeamOwner: "myteam", URL: "http://example.com/hook"}
+	w2 := Webhook{Name: "hook2", TeamOwner: "otherteam", URL: "http://example.com/hook"}
+	c.Assert(Create(&w2), check.IsNil)
+	c.Assert(Create(&w1), check.IsNil)
+	webhooks, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.DeepEquals, []Webhook{w1, w2})
+	webhooks, err = List([]string{"otherteam"})
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.DeepEquals, []Webhook{w2})
+	webhooks, err = List([]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 0)
+}
+
+func (s *S) TestFindForEvent(c *check.C) {
+	hooks := []Webhook{
+		{Name: "team-all", TeamOwner: "myteam", URL: "http://a.com"},
+		{Name: "team-deploys", TeamOwner: "myteam", URL: "http://a.com", EventKinds: []string{"app.deploy"}},
+		{Name: "app-updates", TeamOwner: "myteam", App: "myapp", URL: "http://a.com", EventKinds: []string{"app.update"}},
+		{Name: "other-team", TeamOwner: "otherteam", URL: "http://a.com"},
+	}
+	for i := range hooks {
+		c.Assert(Create(&hooks[i]), check.IsNil)
+	}
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  "me@me.com",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Done(nil), check.IsNil)
+	webhooks, err := findForEvent(evt.Target, evt.Kind)
+	c.Assert(err, check.IsNil)
+	var names []string
+	for _, w := range webhooks {
+		names = append(names, w.Name)
+	}
+	c.Assert(names, check.DeepEquals, []string{"app-updates", "team-all"})
+	evt, err = event.New(&event.Opts{
+		Target: event.Target{Name: "node", Value: "10.0.0.1"},
+		Kind:   permission.PermNodeUpdate,
+		Owner:  "me@me.com",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Done(nil), check.IsNil)
+	webhooks, err = findForEvent(evt.Target, evt.Kind)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 0)
+}
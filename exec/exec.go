@@ -7,10 +7,23 @@
 package exec
 
 import (
+	"fmt"
 	"io"
 	"os/exec"
+	"sync/atomic"
+	"time"
 )
 
+// ErrTimeout is returned when a command is killed because it didn't finish
+// within the timeout defined in its options.
+type ErrTimeout struct {
+	Timeout time.Duration
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("command killed after timeout of %v", e.Timeout)
+}
+
 // ExecuteOptions specify parameters to the Execute method.
 type ExecuteOptions struct {
 	Cmd    string
@@ -20,6 +33,9 @@ type ExecuteOptions struct {
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
+	// Timeout is the maximum duration of the command, which is killed when
+	// it expires. Zero means no timeout.
+	Timeout time.Duration
 }
 
 type Executor interface {
@@ -36,5 +52,21 @@ func (OsExecutor) Execute(opts ExecuteOptions) error {
 	c.Stderr = opts.Stderr
 	c.Env = opts.Envs
 	c.Dir = opts.Dir
-	return c.Run()
+	err := c.Start()
+	if err != nil {
+		return err
+	}
+	var timedOut int32
+	if opts.Timeout > 0 {
+		timer := time.AfterFunc(opts.Timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			c.Process.Kill()
+		})
+		defer timer.Stop()
+	}
+	err = c.Wait()
+	if atomic.LoadInt32(&timedOut) == 1 {
+		return ErrTimeout{Timeout: opts.Timeout}
+	}
+	return err
 }
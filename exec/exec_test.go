@@ -7,6 +7,7 @@ package exec
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/tsuru/commandmocker"
 	"gopkg.in/check.v1"
@@ -59,3 +60,34 @@ func (s *S) TestExecuteWithoutArgs(c *check.C) {
 	c.Assert(commandmocker.Parameters(tmpdir), check.IsNil)
 	c.Assert(b.String(), check.Equals, "ok")
 }
+
+func (s *S) TestExecuteTimeout(c *check.C) {
+	var e OsExecutor
+	var b bytes.Buffer
+	opts := ExecuteOptions{
+		Cmd:     "/bin/sh",
+		Args:    []string{"-c", "exec sleep 10"},
+		Stdout:  &b,
+		Stderr:  &b,
+		Timeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	err := e.Execute(opts)
+	c.Assert(err, check.Equals, ErrTimeout{Timeout: 100 * time.Millisecond})
+	c.Assert(time.Since(start) < 5*time.Second, check.Equals, true)
+}
+
+func (s *S) TestExecuteWithinTimeout(c *check.C) {
+	var e OsExecutor
+	var b bytes.Buffer
+	opts := ExecuteOptions{
+		Cmd:     "/bin/sh",
+		Args:    []string{"-c", "echo ok"},
+		Stdout:  &b,
+		Stderr:  &b,
+		Timeout: 10 * time.Second,
+	}
+	err := e.Execute(opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(b.String(), check.Equals, "ok\n")
+}
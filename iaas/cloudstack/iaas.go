@@ -49,6 +49,17 @@ Further params will also be sent to cloudstack's deployVirtualMachine command.
 `
 }
 
+var requiredParams = []iaas.ParamSpec{
+	{Name: "networkids", Description: "Your network uuid", Required: true},
+	{Name: "templateid", Description: "Your template uuid", Required: true},
+	{Name: "serviceofferingid", Description: "Your service offering uuid", Required: true},
+	{Name: "zoneid", Description: "Your zone uuid", Required: true},
+}
+
+func (i *CloudstackIaaS) DescribeParams() []iaas.ParamSpec {
+	return requiredParams
+}
+
 func (i *CloudstackIaaS) HealthCheck() error {
 	var resp ListZonesResponse
 	err := i.do("listZones", map[string]string{}, &resp)
@@ -78,11 +89,10 @@ func (i *CloudstackIaaS) Initialize() error {
 }
 
 func validateParams(params map[string]string) error {
-	mandatory := []string{"networkids", "templateid", "serviceofferingid", "zoneid"}
-	for _, p := range mandatory {
-		_, isPresent := params[p]
+	for _, p := range requiredParams {
+		_, isPresent := params[p.Name]
 		if !isPresent {
-			return fmt.Errorf("param %q is mandatory", p)
+			return fmt.Errorf("param %q is mandatory", p.Name)
 		}
 	}
 	return nil
@@ -150,6 +150,17 @@ func (s *cloudstackSuite) TestCreateMachineValidateParams(c *check.C) {
 	c.Assert(err, check.ErrorMatches, "param \"networkids\" is mandatory")
 }
 
+func (s *cloudstackSuite) TestDescribeParams(c *check.C) {
+	cs := newCloudstackIaaS("cloudstack")
+	specs := cs.(iaas.ParamDescriber).DescribeParams()
+	var names []string
+	for _, spec := range specs {
+		c.Assert(spec.Required, check.Equals, true)
+		names = append(names, spec.Name)
+	}
+	c.Assert(names, check.DeepEquals, []string{"networkids", "templateid", "serviceofferingid", "zoneid"})
+}
+
 func (s *cloudstackSuite) TestBuildUrlToCloudstack(c *check.C) {
 	cs := newCloudstackIaaS("cloudstack")
 	err := (cs.(*CloudstackIaaS)).Initialize()
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -132,6 +133,126 @@ func (i *EC2IaaS) DeleteMachine(m *iaas.Machine) error {
 	return err
 }
 
+// GetMachine returns the current state of the instance, looking for it in the
+// region it was created in.
+func (i *EC2IaaS) GetMachine(id string) (*iaas.Machine, error) {
+	regionOrEndpoint := defaultRegion
+	if m, err := iaas.FindMachineById(id); err == nil {
+		regionOrEndpoint = getRegionOrEndpoint(m.CreationParams, true)
+	}
+	ec2Inst, err := i.createEC2Handler(regionOrEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	input := ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String(id)}}
+	resp, err := ec2Inst.DescribeInstances(&input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "InvalidInstanceID.NotFound" {
+			return nil, iaas.ErrMachineNotFound
+		}
+		return nil, err
+	}
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			if aws.StringValue(instance.InstanceId) == id && !isTerminated(instance) {
+				return instanceToMachine(instance), nil
+			}
+		}
+	}
+	return nil, iaas.ErrMachineNotFound
+}
+
+// ListMachines returns the instances tagged as created by this IaaS, in the
+// regions set in the regions config and the regions of the machines stored
+// in tsuru.
+func (i *EC2IaaS) ListMachines() ([]iaas.Machine, error) {
+	regions, err := i.machineRegions()
+	if err != nil {
+		return nil, err
+	}
+	var machines []iaas.Machine
+	for _, regionOrEndpoint := range regions {
+		ec2Inst, err := i.createEC2Handler(regionOrEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		input := ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{{
+				Name:   aws.String("tag:" + iaas.MachineTag),
+				Values: []*string{aws.String(i.base.IaaSName)},
+			}},
+		}
+		err = ec2Inst.DescribeInstancesPages(&input, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range resp.Reservations {
+				for _, instance := range reservation.Instances {
+					if i.isManaged(instance) && !isTerminated(instance) {
+						machines = append(machines, *instanceToMachine(instance))
+					}
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return machines, nil
+}
+
+func (i *EC2IaaS) machineRegions() ([]string, error) {
+	var regions []string
+	seen := map[string]bool{}
+	addRegion := func(region string) {
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	configRegions, _ := i.base.GetConfigString("regions")
+	for _, region := range strings.Split(configRegions, ",") {
+		addRegion(strings.TrimSpace(region))
+	}
+	machines, err := iaas.ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if m.Iaas == i.base.IaaSName {
+			addRegion(getRegionOrEndpoint(m.CreationParams, true))
+		}
+	}
+	return regions, nil
+}
+
+// isManaged checks the tag of the instance, ensuring machines not created by
+// tsuru are never listed, even if the endpoint ignores the filter.
+func (i *EC2IaaS) isManaged(instance *ec2.Instance) bool {
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == iaas.MachineTag {
+			return aws.StringValue(tag.Value) == i.base.IaaSName
+		}
+	}
+	return false
+}
+
+func isTerminated(instance *ec2.Instance) bool {
+	return instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated
+}
+
+func instanceToMachine(instance *ec2.Instance) *iaas.Machine {
+	m := iaas.Machine{
+		Id:      aws.StringValue(instance.InstanceId),
+		Address: aws.StringValue(instance.PublicDnsName),
+	}
+	if m.Address == "" {
+		m.Address = aws.StringValue(instance.PrivateDnsName)
+	}
+	if instance.State != nil {
+		m.Status = aws.StringValue(instance.State.Name)
+	}
+	return &m
+}
+
 type invalidFieldError struct {
 	fieldName    string
 	convertError error
@@ -307,11 +428,12 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 		return nil, fmt.Errorf("no instance created")
 	}
 	runInst := resp.Instances[0]
+	ec2Tags := []*ec2.Tag{{
+		Key:   aws.String(iaas.MachineTag),
+		Value: aws.String(i.base.IaaSName),
+	}}
 	if tags, ok := params["tags"]; ok {
-		var ec2Tags []*ec2.Tag
-		tagList := strings.Split(tags, ",")
-		ec2Tags = make([]*ec2.Tag, 0, len(tagList))
-		for _, tag := range tagList {
+		for _, tag := range strings.Split(tags, ",") {
 			if strings.Contains(tag, ":") {
 				parts := strings.SplitN(tag, ":", 2)
 				ec2Tags = append(ec2Tags, &ec2.Tag{
@@ -320,16 +442,14 @@ func (i *EC2IaaS) CreateMachine(params map[string]string) (*iaas.Machine, error)
 				})
 			}
 		}
-		if len(ec2Tags) > 0 {
-			input := ec2.CreateTagsInput{
-				Resources: []*string{runInst.InstanceId},
-				Tags:      ec2Tags,
-			}
-			_, err = ec2Inst.CreateTags(&input)
-			if err != nil {
-				log.Errorf("failed to tag EC2 instance: %s", err)
-			}
-		}
+	}
+	input := ec2.CreateTagsInput{
+		Resources: []*string{runInst.InstanceId},
+		Tags:      ec2Tags,
+	}
+	_, err = ec2Inst.CreateTags(&input)
+	if err != nil {
+		log.Errorf("failed to tag EC2 instance: %s", err)
 	}
 	dnsName, err := i.waitForDnsName(ec2Inst, aws.StringValue(runInst.InstanceId), params)
 	if err != nil {
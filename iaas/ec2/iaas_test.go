@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/queue"
 	ec2amz "gopkg.in/amz.v2/ec2"
@@ -329,3 +330,76 @@ func (s *S) TestDeleteMachineValidations(c *check.C) {
 	err = ec2iaas.DeleteMachine(m)
 	c.Assert(err, check.ErrorMatches, `region or endpoint creation param required`)
 }
+
+func (s *S) TestListMachines(c *check.C) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.FormValue("Action"), check.Equals, "DescribeInstances")
+		filters = append(filters, r.FormValue("Filter.1.Name")+"="+r.FormValue("Filter.1.Value.1"))
+		w.Write([]byte(`
+<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2015-10-01/">
+<requestId>xxx</requestId>
+<reservationSet>
+      <item>
+        <reservationId>r-1</reservationId>
+        <instancesSet>
+          <item>
+            <instanceId>i-1</instanceId>
+            <instanceState><code>16</code><name>running</name></instanceState>
+            <dnsName>i-1.example.com</dnsName>
+            <tagSet><item><key>tsuru-iaas</key><value>ec2</value></item></tagSet>
+          </item>
+          <item>
+            <instanceId>i-2</instanceId>
+            <instanceState><code>48</code><name>terminated</name></instanceState>
+            <tagSet><item><key>tsuru-iaas</key><value>ec2</value></item></tagSet>
+          </item>
+          <item>
+            <instanceId>i-3</instanceId>
+            <instanceState><code>16</code><name>running</name></instanceState>
+            <tagSet><item><key>tsuru-iaas</key><value>other</value></item></tagSet>
+          </item>
+          <item>
+            <instanceId>i-4</instanceId>
+            <instanceState><code>16</code><name>running</name></instanceState>
+          </item>
+        </instancesSet>
+      </item>
+</reservationSet>
+</DescribeInstancesResponse>`))
+	}))
+	defer server.Close()
+	config.Set("database:name", "iaas_ec2_tests")
+	defer config.Unset("database:name")
+	config.Set("iaas:ec2:regions", server.URL)
+	defer config.Unset("iaas:ec2:regions")
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	machines, err := ec2iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "i-1", Status: "running", Address: "i-1.example.com"},
+	})
+	c.Assert(filters, check.DeepEquals, []string{"tag:tsuru-iaas=ec2"})
+}
+
+func (s *S) TestGetMachine(c *check.C) {
+	insts := s.srv.NewInstances(1, "m1.small", "ami-x", ec2amz.InstanceState{Code: 16, Name: "running"}, nil)
+	config.Set("database:name", "iaas_ec2_tests")
+	defer config.Unset("database:name")
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	coll := conn.Collection("iaas_machines")
+	err = coll.Insert(iaas.Machine{Id: insts[0], Iaas: "ec2", CreationParams: map[string]string{"endpoint": s.srv.URL()}})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId(insts[0])
+	ec2iaas := newEC2IaaS("ec2").(*EC2IaaS)
+	m, err := ec2iaas.GetMachine(insts[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, insts[0])
+	c.Assert(m.Status, check.Equals, "running")
+	err = ec2iaas.DeleteMachine(&iaas.Machine{Id: insts[0], CreationParams: map[string]string{"endpoint": s.srv.URL()}})
+	c.Assert(err, check.IsNil)
+	_, err = ec2iaas.GetMachine(insts[0])
+	c.Assert(err, check.Equals, iaas.ErrMachineNotFound)
+}
@@ -7,6 +7,7 @@
 package iaas
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -31,10 +32,42 @@ type IaaS interface {
 	DeleteMachine(m *Machine) error
 }
 
+// ErrMachineNotFound is returned by MachineStatusIaaS providers when the
+// machine doesn't exist in the IaaS.
+var ErrMachineNotFound = errors.New("machine not found in the IaaS")
+
+// MachineTag is the key of the tag, or label, that MachineStatusIaaS
+// providers add to the machines they create, with the name of the IaaS as its
+// value.
+const MachineTag = "tsuru-iaas"
+
+// MachineStatusIaaS is implemented by IaaSs able to describe their machines,
+// allowing tsuru to keep the status of the machines in sync and to find
+// machines deleted out-of-band or leaked.
+type MachineStatusIaaS interface {
+	// Called to get the current state of a machine, it must return
+	// ErrMachineNotFound if the machine doesn't exist anymore.
+	GetMachine(id string) (*Machine, error)
+
+	// Called to list the machines created by tsuru in the IaaS. It must
+	// only return machines tagged with MachineTag set to the name of the
+	// IaaS, as the machines returned and unknown to tsuru are considered
+	// leaked and may be destroyed, and the IaaS account may be shared with
+	// machines not managed by tsuru.
+	ListMachines() ([]Machine, error)
+}
+
 type Describer interface {
 	Describe() string
 }
 
+// ParamDescriber is implemented by IaaSs able to describe the params they
+// accept, allowing tsuru to validate the params of a machine, and of the
+// templates of the IaaS, before calling CreateMachine.
+type ParamDescriber interface {
+	DescribeParams() []ParamSpec
+}
+
 type HealthChecker interface {
 	HealthCheck() error
 }
@@ -121,6 +154,31 @@ func getIaasProvider(name string) (IaaS, error) {
 	return instance, nil
 }
 
+// configuredIaaSNames returns the names of the registered IaaSs configured in
+// tsuru.conf, including all custom IaaSs.
+func configuredIaaSNames() []string {
+	iaasConfig, err := config.Get("iaas")
+	if err != nil {
+		return nil
+	}
+	iaases, _ := iaasConfig.(map[interface{}]interface{})
+	var names []string
+	for ifaceName, value := range iaases {
+		name, _ := ifaceName.(string)
+		if name == "custom" {
+			customIaases, _ := value.(map[interface{}]interface{})
+			for customName := range customIaases {
+				names = append(names, fmt.Sprint(customName))
+			}
+			continue
+		}
+		if _, ok := iaasProviders[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func Describe(iaasName ...string) (string, error) {
 	if len(iaasName) == 0 || iaasName[0] == "" {
 		defaultIaaS, err := config.GetString("iaas:default")
@@ -31,16 +31,57 @@ func CreateMachine(params map[string]string) (*Machine, error) {
 }
 
 func CreateMachineForIaaS(iaasName string, params map[string]string) (*Machine, error) {
+	iaas, iaasName, err := prepareMachineParams(iaasName, params)
+	if err != nil {
+		return nil, err
+	}
+	m, err := iaas.CreateMachine(params)
+	if err != nil {
+		return nil, err
+	}
+	params["iaas-id"] = m.Id
+	m.Iaas = iaasName
+	m.CreationParams = params
+	err = m.saveToDB()
+	if err != nil {
+		m.Destroy()
+		return nil, err
+	}
+	return m, nil
+}
+
+// ValidateMachineParams checks the params that would be used to create a
+// machine, expanding the template in them, if any, against the params
+// described by the IaaS and declared by the template. The params are not
+// changed.
+func ValidateMachineParams(iaasName string, params map[string]string) error {
+	paramsCopy := make(map[string]string, len(params))
+	for k, v := range params {
+		paramsCopy[k] = v
+	}
+	_, _, err := prepareMachineParams(iaasName, paramsCopy)
+	return err
+}
+
+// prepareMachineParams merges the params of the template in params into
+// them, sets the IaaS used to create the machine and validates the resulting
+// params, so invalid requests fail before reaching the IaaS.
+func prepareMachineParams(iaasName string, params map[string]string) (IaaS, string, error) {
+	var templateSpecs []ParamSpec
 	templateName := params["template"]
 	if templateName != "" {
 		template, err := FindTemplate(templateName)
 		if err != nil {
-			return nil, err
+			return nil, "", err
+		}
+		expanded, err := template.expand()
+		if err != nil {
+			return nil, "", err
 		}
-		templateParams := template.paramsMap()
+		templateSpecs = expanded.Params
 		delete(params, "template")
 		// User params will override template params
-		for k, v := range templateParams {
+		for k, v := range expanded.paramsMap() {
 			_, isSet := params[k]
 			if !isSet {
 				params[k] = v
@@ -60,21 +101,13 @@ func CreateMachineForIaaS(iaasName string, params map[string]string) (*Machine,
 	params["iaas"] = iaasName
 	iaas, err := getIaasProvider(iaasName)
 	if err != nil {
-		return nil, err
-	}
-	m, err := iaas.CreateMachine(params)
-	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	params["iaas-id"] = m.Id
-	m.Iaas = iaasName
-	m.CreationParams = params
-	err = m.saveToDB()
+	err = validateParams(iaasName, [][]ParamSpec{describeParams(iaas), templateSpecs}, params, true)
 	if err != nil {
-		m.Destroy()
-		return nil, err
+		return nil, "", err
 	}
-	return m, nil
+	return iaas, iaasName, nil
 }
 
 func ListMachines() ([]Machine, error) {
@@ -166,6 +199,20 @@ func (m *Machine) saveToDB() error {
 	return err
 }
 
+func (m *Machine) setStatus(status string) error {
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(m.Id, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return err
+	}
+	m.Status = status
+	return nil
+}
+
 func (m *Machine) removeFromDB() error {
 	coll, err := collection()
 	if err != nil {
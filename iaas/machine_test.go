@@ -134,6 +134,93 @@ func (s *S) TestCreateMachineWithTemplate(c *check.C) {
 	c.Assert(params, check.DeepEquals, expected)
 }
 
+func (s *S) TestCreateMachineWithParentTemplate(c *check.C) {
+	parent := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "key1", Value: "val1"},
+			{Name: "key2", Value: "val2"},
+		},
+	}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "child",
+		Parent: "base",
+		Data: TemplateDataList{
+			{Name: "key2", Value: "child2"},
+			{Name: "key3", Value: "child3"},
+		},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	m, err := CreateMachine(map[string]string{"id": "myid", "template": "child", "key3": "override3"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Iaas, check.Equals, "test-iaas")
+	c.Assert(m.CreationParams, check.DeepEquals, map[string]string{
+		"id":      "myid",
+		"key1":    "val1",
+		"key2":    "child2",
+		"key3":    "override3",
+		"should":  "be in",
+		"iaas-id": "myid",
+		"iaas":    "test-iaas",
+	})
+}
+
+func (s *S) TestCreateMachineInvalidParams(c *check.C) {
+	RegisterIaasProvider("params-iaas", newTestParamDescriberIaaS)
+	_, err := CreateMachineForIaaS("params-iaas", map[string]string{"size": "huge", "zone": "zone-1"})
+	c.Assert(err, check.FitsTypeOf, &InvalidParamsError{})
+	c.Assert(err.(*InvalidParamsError).Errors, check.DeepEquals, []string{
+		`param "id" is required`,
+		`param "size" must be one of: small, large, got "huge"`,
+		`param "zone" must match "zone-[a-z]", got "zone-1"`,
+	})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "id" is required; .*`)
+	provider, err := getIaasProvider("params-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(provider.(*TestParamDescriberIaaS).cmds, check.IsNil)
+	m, err := CreateMachineForIaaS("params-iaas", map[string]string{"id": "myid", "size": "small", "zone": "zone-a"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "myid")
+}
+
+func (s *S) TestCreateMachineInvalidParamsFromTemplate(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Data:     TemplateDataList{{Name: "flavor", Value: "m1"}},
+		Params: []ParamSpec{
+			{Name: "id", Required: true, Regex: "[a-z]+"},
+			{Name: "flavor", Values: []string{"m1", "m2"}},
+		},
+	}
+	err := t.Save()
+	c.Assert(err, check.IsNil)
+	_, err = CreateMachine(map[string]string{"template": "tpl1", "flavor": "m3"})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "test-iaas": param "id" is required; param "flavor" must be one of: m1, m2, got "m3"`)
+	_, err = CreateMachine(map[string]string{"template": "tpl1", "id": "id1"})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "test-iaas": param "id" must match "\[a-z\]\+", got "id1"`)
+	m, err := CreateMachine(map[string]string{"template": "tpl1", "id": "myid"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.CreationParams["flavor"], check.Equals, "m1")
+}
+
+func (s *S) TestValidateMachineParams(c *check.C) {
+	RegisterIaasProvider("params-iaas", newTestParamDescriberIaaS)
+	params := map[string]string{"size": "huge"}
+	err := ValidateMachineParams("params-iaas", params)
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "id" is required; param "size" must be one of: small, large, got "huge"`)
+	c.Assert(params, check.DeepEquals, map[string]string{"size": "huge"})
+	err = ValidateMachineParams("params-iaas", map[string]string{"id": "myid"})
+	c.Assert(err, check.IsNil)
+	machines, err := ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+}
+
 func (s *S) TestListMachines(c *check.C) {
 	_, err := CreateMachineForIaaS("test-iaas", map[string]string{"id": "myid1"})
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,175 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParamSpec describes a param accepted by an IaaS or declared by a template.
+// When Values is set, the param must have one of the listed values, when Regex
+// is set, the whole value of the param must match it. Specs declared by
+// templates can't loosen the specs of the IaaS or of their parents, see
+// paramRule.
+type ParamSpec struct {
+	Name        string
+	Description string
+	Required    bool
+	Values      []string
+	Regex       string
+}
+
+// InvalidParamsError is returned when the params of a machine, or the data of
+// a template, don't satisfy the params described by the IaaS and templates.
+type InvalidParamsError struct {
+	IaaS   string
+	Errors []string
+}
+
+func (e *InvalidParamsError) Error() string {
+	return fmt.Sprintf("invalid params for IaaS %q: %s", e.IaaS, strings.Join(e.Errors, "; "))
+}
+
+func (s *ParamSpec) validate() error {
+	if s.Name == "" {
+		return errors.New("param name cannot be empty")
+	}
+	if s.Regex != "" {
+		_, err := s.regexp()
+		if err != nil {
+			return fmt.Errorf("param %q has an invalid regex: %s", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *ParamSpec) regexp() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + s.Regex + ")$")
+}
+
+// paramRule is the combination of every spec of a param, declared by the
+// IaaS and by a template and its parents. Templates can only narrow the specs
+// of the IaaS and of their parents: the param is required if any spec
+// requires it, its value must be one of the values of every spec listing
+// them, and must match the regex of every spec.
+type paramRule struct {
+	name     string
+	required bool
+	values   []string
+	regexes  []string
+}
+
+func (r *paramRule) add(spec *ParamSpec) error {
+	r.required = r.required || spec.Required
+	if len(spec.Values) > 0 {
+		if r.values == nil {
+			r.values = append([]string{}, spec.Values...)
+		} else {
+			var kept []string
+			for _, v := range r.values {
+				if containsString(spec.Values, v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				return fmt.Errorf("param %q must be one of: %s, which allows none of: %s", r.name, strings.Join(r.values, ", "), strings.Join(spec.Values, ", "))
+			}
+			r.values = kept
+		}
+	}
+	if spec.Regex != "" && !containsString(r.regexes, spec.Regex) {
+		r.regexes = append(r.regexes, spec.Regex)
+	}
+	return nil
+}
+
+// check returns a description of the problem with the value of the param in
+// params, or an empty string if the value is valid.
+func (r *paramRule) check(params map[string]string, checkRequired bool) string {
+	value := params[r.name]
+	if value == "" {
+		if checkRequired && r.required {
+			return fmt.Sprintf("param %q is required", r.name)
+		}
+		return ""
+	}
+	if r.values != nil && !containsString(r.values, value) {
+		return fmt.Sprintf("param %q must be one of: %s, got %q", r.name, strings.Join(r.values, ", "), value)
+	}
+	for _, regex := range r.regexes {
+		spec := ParamSpec{Name: r.name, Regex: regex}
+		re, err := spec.regexp()
+		if err != nil {
+			return fmt.Sprintf("param %q has an invalid regex: %s", r.name, err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Sprintf("param %q must match %q, got %q", r.name, regex, value)
+		}
+	}
+	return ""
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// combineParamSpecs combines lists of specs, the specs in a list can only
+// narrow the specs with the same name in previous lists. An error is
+// returned when the specs of a param allow no value at all.
+func combineParamSpecs(specLists ...[]ParamSpec) ([]paramRule, error) {
+	var rules []paramRule
+	indexes := map[string]int{}
+	for _, specs := range specLists {
+		for i := range specs {
+			idx, ok := indexes[specs[i].Name]
+			if !ok {
+				idx = len(rules)
+				indexes[specs[i].Name] = idx
+				rules = append(rules, paramRule{name: specs[i].Name})
+			}
+			err := rules[idx].add(&specs[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rules, nil
+}
+
+func describeParams(iaas IaaS) []ParamSpec {
+	describer, ok := iaas.(ParamDescriber)
+	if !ok {
+		return nil
+	}
+	return describer.DescribeParams()
+}
+
+// validateParams checks params against the combined specs of the IaaS and
+// of templates. Required params are only checked when checkRequired is true,
+// as templates may set only part of the params of a machine.
+func validateParams(iaasName string, specLists [][]ParamSpec, params map[string]string, checkRequired bool) error {
+	rules, err := combineParamSpecs(specLists...)
+	if err != nil {
+		return &InvalidParamsError{IaaS: iaasName, Errors: []string{err.Error()}}
+	}
+	var errs []string
+	for i := range rules {
+		if msg := rules[i].check(params, checkRequired); msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+	if len(errs) > 0 {
+		return &InvalidParamsError{IaaS: iaasName, Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package plugin provides an IaaS that delegates the management of machines to
+// an external driver, allowing the integration of providers without a
+// dedicated IaaS package in tsuru.
+//
+// The driver is either an executable, set in "iaas:plugin:command", or an HTTP
+// endpoint, set in "iaas:plugin:url". Custom IaaSs based on the plugin
+// provider may use different drivers. Extra headers sent in every request to
+// the endpoint, e.g. for authentication, may be set in "iaas:plugin:headers".
+//
+// Every operation sends a JSON request to the driver, in the standard input
+// of the command, which is called with the action as its only argument, or in
+// the body of a POST request to the endpoint:
+//
+//   {"action": "create-machine", "iaas": "vmware", "params": {...}}
+//   {"action": "delete-machine", "iaas": "vmware", "params": {...},
+//    "machine": {"id": "...", "address": "...", "port": 2375, "status": "..."}}
+//   {"action": "describe", "iaas": "vmware"}
+//   {"action": "healthcheck", "iaas": "vmware"}
+//
+// The params are the ones used to create the machine, including the params of
+// the template, if any, unchanged. The driver must answer with a JSON object,
+// in the standard output of the command or in the body of a 200 response:
+//
+//   {"machine": {"id": "...", "address": "...", "port": 2375, "status": "..."}}
+//   {"description": "..."}
+//   {"error": "..."}
+//
+// The machine is required in the response to create-machine, the description
+// in the response to describe. A non empty error, a command exiting with a non
+// zero status or a response with any other status code fail the operation.
+// Commands running for longer than "iaas:plugin:timeout" seconds are killed.
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/exec"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const (
+	providerName = "plugin"
+
+	defaultCommandTimeout = 300 * time.Second
+)
+
+const (
+	actionCreateMachine = "create-machine"
+	actionDeleteMachine = "delete-machine"
+	actionDescribe      = "describe"
+	actionHealthcheck   = "healthcheck"
+)
+
+func init() {
+	iaas.RegisterIaasProvider(providerName, newPluginIaaS)
+	hc.AddChecker("IaaS plugin", iaas.BuildHealthCheck(providerName))
+}
+
+type machineData struct {
+	Id      string `json:"id"`
+	Address string `json:"address"`
+	Port    int    `json:"port,omitempty"`
+	Status  string `json:"status,omitempty"`
+}
+
+type pluginRequest struct {
+	Action  string            `json:"action"`
+	IaaS    string            `json:"iaas"`
+	Params  map[string]string `json:"params,omitempty"`
+	Machine *machineData      `json:"machine,omitempty"`
+}
+
+type pluginResponse struct {
+	Machine     *machineData `json:"machine,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type pluginIaaS struct {
+	base iaas.NamedIaaS
+}
+
+func newPluginIaaS(name string) iaas.IaaS {
+	return &pluginIaaS{base: iaas.NamedIaaS{BaseIaaSName: providerName, IaaSName: name}}
+}
+
+func (i *pluginIaaS) Initialize() error {
+	command, _ := i.base.GetConfigString("command")
+	endpoint, _ := i.base.GetConfigString("url")
+	if command == "" && endpoint == "" {
+		return fmt.Errorf("plugin IaaS %q requires either command or url to be set", i.base.IaaSName)
+	}
+	if command != "" && endpoint != "" {
+		return fmt.Errorf("plugin IaaS %q can't have both command and url set", i.base.IaaSName)
+	}
+	return nil
+}
+
+func (i *pluginIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	rsp, err := i.call(pluginRequest{Action: actionCreateMachine, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Machine == nil || rsp.Machine.Id == "" {
+		return nil, i.errorf(actionCreateMachine, errors.New("no machine in response"))
+	}
+	return &iaas.Machine{
+		Id:      rsp.Machine.Id,
+		Address: rsp.Machine.Address,
+		Port:    rsp.Machine.Port,
+		Status:  rsp.Machine.Status,
+	}, nil
+}
+
+func (i *pluginIaaS) DeleteMachine(m *iaas.Machine) error {
+	_, err := i.call(pluginRequest{
+		Action: actionDeleteMachine,
+		Params: m.CreationParams,
+		Machine: &machineData{
+			Id:      m.Id,
+			Address: m.Address,
+			Port:    m.Port,
+			Status:  m.Status,
+		},
+	})
+	return err
+}
+
+func (i *pluginIaaS) Describe() string {
+	rsp, err := i.call(pluginRequest{Action: actionDescribe})
+	if err != nil {
+		log.Errorf("unable to describe plugin IaaS %q: %s", i.base.IaaSName, err)
+		return ""
+	}
+	return rsp.Description
+}
+
+func (i *pluginIaaS) HealthCheck() error {
+	_, err := i.call(pluginRequest{Action: actionHealthcheck})
+	return err
+}
+
+func (i *pluginIaaS) errorf(action string, err error) error {
+	return fmt.Errorf("[plugin iaas %s] %s failed: %s", i.base.IaaSName, action, err)
+}
+
+func (i *pluginIaaS) call(req pluginRequest) (*pluginResponse, error) {
+	req.IaaS = i.base.IaaSName
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var output []byte
+	if command, _ := i.base.GetConfigString("command"); command != "" {
+		output, err = i.execute(command, req.Action, data)
+	} else {
+		output, err = i.post(data)
+	}
+	if err != nil {
+		return nil, i.errorf(req.Action, err)
+	}
+	var rsp pluginResponse
+	err = json.Unmarshal(output, &rsp)
+	if err != nil {
+		return nil, i.errorf(req.Action, fmt.Errorf("invalid response %q: %s", output, err))
+	}
+	if rsp.Error != "" {
+		return nil, i.errorf(req.Action, errors.New(rsp.Error))
+	}
+	return &rsp, nil
+}
+
+func (i *pluginIaaS) execute(command, action string, data []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := exec.OsExecutor{}.Execute(exec.ExecuteOptions{
+		Cmd:     command,
+		Args:    []string{action},
+		Stdin:   bytes.NewReader(data),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		Timeout: i.commandTimeout(),
+	})
+	if err != nil {
+		output := stderr.String()
+		if output == "" {
+			output = stdout.String()
+		}
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(output))
+	}
+	return stdout.Bytes(), nil
+}
+
+// commandTimeout returns the maximum duration of a call to the command,
+// matching the timeout of the HTTP driver by default.
+func (i *pluginIaaS) commandTimeout() time.Duration {
+	value, _ := i.base.GetConfigString("timeout")
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return defaultCommandTimeout
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func (i *pluginIaaS) post(data []byte) ([]byte, error) {
+	endpoint, err := i.base.GetConfigString("url")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range i.headers() {
+		req.Header.Set(name, value)
+	}
+	rsp, err := net.Dial5Full300Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid response code %d: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (i *pluginIaaS) headers() map[string]string {
+	rawHeaders, err := config.Get(fmt.Sprintf("iaas:custom:%s:headers", i.base.IaaSName))
+	if err != nil {
+		rawHeaders, _ = config.Get(fmt.Sprintf("iaas:%s:headers", providerName))
+	}
+	headersMap, _ := rawHeaders.(map[interface{}]interface{})
+	headers := make(map[string]string, len(headersMap))
+	for name, value := range headersMap {
+		headers[fmt.Sprint(name)] = fmt.Sprint(value)
+	}
+	return headers
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	dir string
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "iaas_plugin_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	config.Unset("iaas:plugin")
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+// writeCommand writes an executable that stores the request it receives in
+// the test dir, in a file named after the action, and prints the output.
+func (s *S) writeCommand(c *check.C, output string, exitCode int) string {
+	path := filepath.Join(s.dir, "driver")
+	script := fmt.Sprintf("#!/bin/sh\ncat > %s/$1.json\necho '%s'\nexit %d\n", s.dir, output, exitCode)
+	err := ioutil.WriteFile(path, []byte(script), 0755)
+	c.Assert(err, check.IsNil)
+	return path
+}
+
+func (s *S) commandRequest(c *check.C, action string) pluginRequest {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, action+".json"))
+	c.Assert(err, check.IsNil)
+	var req pluginRequest
+	err = json.Unmarshal(data, &req)
+	c.Assert(err, check.IsNil)
+	return req
+}
+
+func (s *S) TestInitializeRequiresDriver(c *check.C) {
+	err := newPluginIaaS("plugin").(*pluginIaaS).Initialize()
+	c.Assert(err, check.ErrorMatches, `plugin IaaS "plugin" requires either command or url to be set`)
+	config.Set("iaas:plugin:command", "/bin/driver")
+	config.Set("iaas:plugin:url", "http://driver.somewhere.com")
+	err = newPluginIaaS("plugin").(*pluginIaaS).Initialize()
+	c.Assert(err, check.ErrorMatches, `plugin IaaS "plugin" can't have both command and url set`)
+}
+
+func (s *S) TestCreateMachineCommand(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{"machine": {"id": "vm-1", "address": "10.0.0.1", "port": 2376, "status": "running"}}`, 0))
+	m, err := newPluginIaaS("plugin").CreateMachine(map[string]string{"datastore": "ds1", "cpus": "2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &iaas.Machine{Id: "vm-1", Address: "10.0.0.1", Port: 2376, Status: "running"})
+	c.Assert(s.commandRequest(c, "create-machine"), check.DeepEquals, pluginRequest{
+		Action: "create-machine",
+		IaaS:   "plugin",
+		Params: map[string]string{"datastore": "ds1", "cpus": "2"},
+	})
+}
+
+func (s *S) TestCreateMachineCommandError(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{"error": "no capacity left"}`, 0))
+	_, err := newPluginIaaS("plugin").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, `\[plugin iaas plugin\] create-machine failed: no capacity left`)
+}
+
+func (s *S) TestCreateMachineCommandFailure(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, "datacenter unreachable", 2))
+	_, err := newPluginIaaS("plugin").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, `\[plugin iaas plugin\] create-machine failed: exit status 2: datacenter unreachable`)
+}
+
+func (s *S) TestCreateMachineCommandWithoutMachine(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{}`, 0))
+	_, err := newPluginIaaS("plugin").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, `\[plugin iaas plugin\] create-machine failed: no machine in response`)
+}
+
+func (s *S) TestDeleteMachineCommand(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{}`, 0))
+	m := iaas.Machine{
+		Id:             "vm-1",
+		Address:        "10.0.0.1",
+		Status:         "running",
+		CreationParams: map[string]string{"datastore": "ds1", "iaas": "plugin"},
+	}
+	err := newPluginIaaS("plugin").DeleteMachine(&m)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.commandRequest(c, "delete-machine"), check.DeepEquals, pluginRequest{
+		Action:  "delete-machine",
+		IaaS:    "plugin",
+		Params:  map[string]string{"datastore": "ds1", "iaas": "plugin"},
+		Machine: &machineData{Id: "vm-1", Address: "10.0.0.1", Status: "running"},
+	})
+}
+
+func (s *S) TestDescribeCommand(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{"description": "VMware pools, params: datastore, cpus"}`, 0))
+	desc := newPluginIaaS("plugin").(iaas.Describer).Describe()
+	c.Assert(desc, check.Equals, "VMware pools, params: datastore, cpus")
+}
+
+func (s *S) TestHealthCheckCommand(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{}`, 0))
+	err := newPluginIaaS("plugin").(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.commandRequest(c, "healthcheck").Action, check.Equals, "healthcheck")
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{"error": "vcenter is down"}`, 0))
+	err = newPluginIaaS("plugin").(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.ErrorMatches, `.*vcenter is down`)
+}
+
+func (s *S) TestHealthCheckCommandTimeout(c *check.C) {
+	path := filepath.Join(s.dir, "driver")
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\nexec sleep 10\n"), 0755)
+	c.Assert(err, check.IsNil)
+	config.Set("iaas:plugin:command", path)
+	config.Set("iaas:plugin:timeout", 0.1)
+	start := time.Now()
+	err = newPluginIaaS("plugin").(iaas.HealthChecker).HealthCheck()
+	c.Assert(err, check.ErrorMatches, `.*healthcheck failed: command killed after timeout of 100ms.*`)
+	c.Assert(time.Since(start) < 5*time.Second, check.Equals, true)
+}
+
+func (s *S) TestCommandTimeout(c *check.C) {
+	i := newPluginIaaS("myplugin").(*pluginIaaS)
+	c.Assert(i.commandTimeout(), check.Equals, defaultCommandTimeout)
+	config.Set("iaas:plugin:timeout", 30)
+	c.Assert(i.commandTimeout(), check.Equals, 30*time.Second)
+	config.Set("iaas:custom:myplugin:timeout", 1.5)
+	defer config.Unset("iaas:custom")
+	c.Assert(i.commandTimeout(), check.Equals, 1500*time.Millisecond)
+}
+
+func (s *S) TestCreateMachineHTTP(c *check.C) {
+	var req pluginRequest
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprint(w, `{"machine": {"id": "bm-7", "address": "10.0.0.7", "status": "provisioned"}}`)
+	}))
+	defer server.Close()
+	config.Set("iaas:custom:baremetal:provider", "plugin")
+	config.Set("iaas:custom:baremetal:url", server.URL)
+	config.Set("iaas:custom:baremetal:headers", map[interface{}]interface{}{"X-Api-Key": "secret"})
+	defer config.Unset("iaas:custom")
+	m, err := newPluginIaaS("baremetal").CreateMachine(map[string]string{"rack": "r12"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &iaas.Machine{Id: "bm-7", Address: "10.0.0.7", Status: "provisioned"})
+	c.Assert(req, check.DeepEquals, pluginRequest{
+		Action: "create-machine",
+		IaaS:   "baremetal",
+		Params: map[string]string{"rack": "r12"},
+	})
+	c.Assert(header.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(header.Get("X-Api-Key"), check.Equals, "secret")
+}
+
+func (s *S) TestCreateMachineHTTPFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of hardware", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	config.Set("iaas:plugin:url", server.URL)
+	_, err := newPluginIaaS("plugin").CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, `\[plugin iaas plugin\] create-machine failed: invalid response code 503: out of hardware`)
+}
+
+func (s *S) TestCreateMachineWithTemplate(c *check.C) {
+	config.Set("iaas:plugin:command", s.writeCommand(c, `{"machine": {"id": "vm-2", "address": "10.0.0.2", "status": "running"}}`, 0))
+	template := iaas.Template{
+		Name:     "vmware-small",
+		IaaSName: "plugin",
+		Data: iaas.TemplateDataList{
+			{Name: "datastore", Value: "ds1"},
+			{Name: "cpus", Value: "2"},
+			{Name: "network", Value: "vlan-10,vlan-20"},
+		},
+	}
+	err := template.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate(template.Name)
+	m, err := iaas.CreateMachineForIaaS("plugin", map[string]string{"template": "vmware-small", "cpus": "4"})
+	c.Assert(err, check.IsNil)
+	defer m.Destroy()
+	c.Assert(s.commandRequest(c, "create-machine").Params, check.DeepEquals, map[string]string{
+		"datastore": "ds1",
+		"cpus":      "4",
+		"network":   "vlan-10,vlan-20",
+		"iaas":      "plugin",
+	})
+}
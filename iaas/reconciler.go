@@ -0,0 +1,332 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	reconcilerEventOwner       = "iaas-reconciler"
+	reconcilerReportCollection = "iaas_machines_drift"
+	reconcilerReportID         = "last"
+)
+
+// Kinds of drift found by the machine reconciler.
+const (
+	// DriftStatus is a machine whose status in the IaaS differs from the
+	// status stored in tsuru. It's always fixed by storing the new status.
+	DriftStatus = "status"
+	// DriftDeleted is a machine stored in tsuru that doesn't exist in the
+	// IaaS anymore.
+	DriftDeleted = "deleted"
+	// DriftLeaked is a machine in the IaaS unknown to tsuru.
+	DriftLeaked = "leaked"
+)
+
+// MachineDrift is a machine whose state in tsuru differs from its state in
+// the IaaS, along with the result of the attempt to fix it.
+type MachineDrift struct {
+	Id        string `json:"id"`
+	Iaas      string `json:"iaas"`
+	Address   string `json:"address"`
+	Kind      string `json:"kind"`
+	OldStatus string `json:"oldStatus,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Fixed     bool   `json:"fixed"`
+	FixError  string `json:"fixError,omitempty"`
+}
+
+// ReconcileError is an error that prevented the machines of an IaaS from
+// being checked.
+type ReconcileError struct {
+	Iaas  string `json:"iaas"`
+	Error string `json:"error"`
+}
+
+// ReconcileReport is the result of a machine reconciliation run.
+type ReconcileReport struct {
+	ID              string           `bson:"_id" json:"-"`
+	Timestamp       time.Time        `json:"timestamp"`
+	CheckedIaaSs    []string         `json:"checkedIaaSs"`
+	CheckedMachines int              `json:"checkedMachines"`
+	Drifts          []MachineDrift   `json:"drifts"`
+	Errors          []ReconcileError `json:"errors,omitempty"`
+}
+
+// LastReconcileReport returns the report of the last machine reconciliation
+// run, or nil if there's none.
+func LastReconcileReport() (*ReconcileReport, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var report ReconcileReport
+	err = conn.Collection(reconcilerReportCollection).FindId(reconcilerReportID).One(&report)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func saveReconcileReport(report *ReconcileReport) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	report.ID = reconcilerReportID
+	_, err = conn.Collection(reconcilerReportCollection).UpsertId(reconcilerReportID, report)
+	return err
+}
+
+// ReconcilerConfig holds the settings for the machine reconciler. It must be
+// created using NewReconcilerConfig.
+type ReconcilerConfig struct {
+	RunInterval   time.Duration
+	RemoveDeleted bool
+	DestroyLeaked bool
+	leader        *leader.Lease
+	done          chan bool
+}
+
+// NewReconcilerConfig creates a new machine reconciler configuration reading
+// its settings from the "iaas:reconciler" section in tsuru.conf.
+func NewReconcilerConfig() *ReconcilerConfig {
+	runInterval, _ := config.GetInt("iaas:reconciler:run-interval")
+	if runInterval <= 0 {
+		runInterval = 300
+	}
+	removeDeleted, _ := config.GetBool("iaas:reconciler:remove-deleted")
+	destroyLeaked, _ := config.GetBool("iaas:reconciler:destroy-leaked")
+	interval := time.Duration(runInterval) * time.Second
+	return &ReconcilerConfig{
+		RunInterval:   interval,
+		RemoveDeleted: removeDeleted,
+		DestroyLeaked: destroyLeaked,
+		leader:        leader.NewLease("iaas-reconciler", 2*interval),
+		done:          make(chan bool),
+	}
+}
+
+// InitializeReconciler starts the machine reconciler if it's enabled in
+// tsuru.conf. The returned ReconcilerConfig can be used to stop it.
+func InitializeReconciler() *ReconcilerConfig {
+	if enabled, _ := config.GetBool("iaas:reconciler:enabled"); !enabled {
+		return nil
+	}
+	cfg := NewReconcilerConfig()
+	go cfg.run()
+	return cfg
+}
+
+func (c *ReconcilerConfig) run() {
+	for {
+		err := c.RunOnce()
+		if err != nil {
+			log.Errorf("[iaas-reconciler] %s", err)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.RunInterval):
+		}
+	}
+}
+
+// Shutdown stops the reconciler.
+func (c *ReconcilerConfig) Shutdown() {
+	c.done <- true
+}
+
+func (c *ReconcilerConfig) String() string {
+	return "iaas machine reconciler"
+}
+
+// RunOnce compares the machines stored in tsuru with the machines in each
+// IaaS implementing MachineStatusIaaS, syncing their status and, depending on
+// the settings, removing machines deleted out-of-band and destroying leaked
+// machines. Only machines reported as leaked in the previous run too are
+// destroyed, so machines being created while the reconciler runs are left
+// alone. Only one tsuru API instance is allowed to do it at a time, the others
+// skip the run while a leader is active.
+func (c *ReconcilerConfig) RunOnce() (retErr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			retErr = fmt.Errorf("recovered panic, we can never stop! panic: %v", r)
+		}
+	}()
+	isLeader, err := c.leader.Acquire()
+	if err != nil {
+		return fmt.Errorf("unable to acquire leadership: %s", err)
+	}
+	if !isLeader {
+		log.Debugf("[iaas-reconciler] skipping run, another instance is the leader")
+		return nil
+	}
+	machines, err := ListMachines()
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %s", err)
+	}
+	lastReport, err := LastReconcileReport()
+	if err != nil {
+		return fmt.Errorf("unable to read last report: %s", err)
+	}
+	previouslyLeaked := map[string]bool{}
+	if lastReport != nil {
+		for _, d := range lastReport.Drifts {
+			if d.Kind == DriftLeaked && !d.Fixed {
+				previouslyLeaked[d.Iaas+"/"+d.Id] = true
+			}
+		}
+	}
+	knownIds := make(map[string]bool, len(machines))
+	byIaaS := map[string][]Machine{}
+	for _, m := range machines {
+		knownIds[m.Id] = true
+		byIaaS[m.Iaas] = append(byIaaS[m.Iaas], m)
+	}
+	iaasNames := configuredIaaSNames()
+	for name := range byIaaS {
+		iaasNames = append(iaasNames, name)
+	}
+	sort.Strings(iaasNames)
+	report := ReconcileReport{Timestamp: time.Now().UTC(), CheckedIaaSs: []string{}, Drifts: []MachineDrift{}}
+	for i, name := range iaasNames {
+		if i > 0 && name == iaasNames[i-1] {
+			continue
+		}
+		provider, err := getIaasProvider(name)
+		if err != nil {
+			log.Errorf("[iaas-reconciler] unable to get IaaS %s: %s", name, err)
+			report.Errors = append(report.Errors, ReconcileError{Iaas: name, Error: err.Error()})
+			continue
+		}
+		if _, ok := provider.(MachineStatusIaaS); !ok {
+			continue
+		}
+		drifts, err := c.reconcileIaaS(name, provider, byIaaS[name], knownIds, previouslyLeaked)
+		if err != nil {
+			log.Errorf("[iaas-reconciler] unable to check machines of IaaS %s: %s", name, err)
+			report.Errors = append(report.Errors, ReconcileError{Iaas: name, Error: err.Error()})
+			continue
+		}
+		report.CheckedIaaSs = append(report.CheckedIaaSs, name)
+		report.CheckedMachines += len(byIaaS[name])
+		report.Drifts = append(report.Drifts, drifts...)
+	}
+	return saveReconcileReport(&report)
+}
+
+func (c *ReconcilerConfig) reconcileIaaS(name string, provider IaaS, machines []Machine, knownIds, previouslyLeaked map[string]bool) ([]MachineDrift, error) {
+	statusProvider := provider.(MachineStatusIaaS)
+	iaasMachines, err := statusProvider.ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	iaasMachinesMap := make(map[string]*Machine, len(iaasMachines))
+	for i := range iaasMachines {
+		iaasMachinesMap[iaasMachines[i].Id] = &iaasMachines[i]
+	}
+	var drifts []MachineDrift
+	for i := range machines {
+		m := &machines[i]
+		current, ok := iaasMachinesMap[m.Id]
+		if !ok {
+			// The machine may be missing from the list only because it's
+			// eventually consistent, so it's confirmed with GetMachine.
+			current, err = statusProvider.GetMachine(m.Id)
+			if err == ErrMachineNotFound {
+				drifts = append(drifts, c.handleDeleted(m))
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if current.Status == m.Status {
+			continue
+		}
+		drift := MachineDrift{
+			Id:        m.Id,
+			Iaas:      name,
+			Address:   m.Address,
+			Kind:      DriftStatus,
+			OldStatus: m.Status,
+			Status:    current.Status,
+		}
+		err = m.setStatus(current.Status)
+		if err != nil {
+			drift.FixError = err.Error()
+		} else {
+			drift.Fixed = true
+		}
+		drifts = append(drifts, drift)
+	}
+	for _, m := range iaasMachines {
+		if knownIds[m.Id] {
+			continue
+		}
+		m.Iaas = name
+		log.Errorf("[iaas-reconciler] machine %s leaked in IaaS %s", m.Id, name)
+		drift := MachineDrift{Id: m.Id, Iaas: name, Address: m.Address, Kind: DriftLeaked, Status: m.Status}
+		if c.DestroyLeaked && previouslyLeaked[name+"/"+m.Id] {
+			err = c.destroyLeaked(&m, provider)
+			if err != nil {
+				log.Errorf("[iaas-reconciler] unable to destroy leaked machine %s in IaaS %s: %s", m.Id, name, err)
+				drift.FixError = err.Error()
+			} else {
+				drift.Fixed = true
+			}
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, nil
+}
+
+func (c *ReconcilerConfig) handleDeleted(m *Machine) MachineDrift {
+	log.Errorf("[iaas-reconciler] machine %s deleted out-of-band from IaaS %s", m.Id, m.Iaas)
+	drift := MachineDrift{Id: m.Id, Iaas: m.Iaas, Address: m.Address, Kind: DriftDeleted, OldStatus: m.Status}
+	if !c.RemoveDeleted {
+		return drift
+	}
+	err := m.removeFromDB()
+	if err != nil {
+		log.Errorf("[iaas-reconciler] unable to remove deleted machine %s: %s", m.Id, err)
+		drift.FixError = err.Error()
+	} else {
+		drift.Fixed = true
+	}
+	return drift
+}
+
+func (c *ReconcilerConfig) destroyLeaked(m *Machine, provider IaaS) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "machine", Value: m.Id},
+		Kind:   permission.PermMachineDelete,
+		Owner:  reconcilerEventOwner,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	evt.Logf("destroying machine %s leaked in IaaS %s, address %q", m.Id, m.Iaas, m.Address)
+	err = provider.DeleteMachine(m)
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iaas
+
+import (
+	"errors"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) statusIaaS(c *check.C) *TestStatusIaaS {
+	RegisterIaasProvider("status-iaas", newTestStatusIaaS)
+	provider, err := getIaasProvider("status-iaas")
+	c.Assert(err, check.IsNil)
+	return provider.(*TestStatusIaaS)
+}
+
+func (s *S) TestNewReconcilerConfig(c *check.C) {
+	config.Set("iaas:reconciler:run-interval", 60)
+	config.Set("iaas:reconciler:remove-deleted", true)
+	defer config.Unset("iaas:reconciler")
+	cfg := NewReconcilerConfig()
+	c.Assert(cfg.RunInterval.Seconds(), check.Equals, float64(60))
+	c.Assert(cfg.RemoveDeleted, check.Equals, true)
+	c.Assert(cfg.DestroyLeaked, check.Equals, false)
+}
+
+func (s *S) TestLastReconcileReportWithoutRuns(c *check.C) {
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report, check.IsNil)
+}
+
+func (s *S) TestReconcilerRunOnceSyncsStatus(c *check.C) {
+	fake := s.statusIaaS(c)
+	_, err := CreateMachineForIaaS("status-iaas", map[string]string{"id": "m1"})
+	c.Assert(err, check.IsNil)
+	_, err = CreateMachineForIaaS("status-iaas", map[string]string{"id": "m2"})
+	c.Assert(err, check.IsNil)
+	m1 := fake.machines["m1"]
+	m1.Status = "stopped"
+	fake.machines["m1"] = m1
+	err = NewReconcilerConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	dbMachine, err := FindMachineById("m1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbMachine.Status, check.Equals, "stopped")
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedIaaSs, check.DeepEquals, []string{"status-iaas"})
+	c.Assert(report.CheckedMachines, check.Equals, 2)
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{{
+		Id:        "m1",
+		Iaas:      "status-iaas",
+		Address:   "m1.somewhere.com",
+		Kind:      DriftStatus,
+		OldStatus: "running",
+		Status:    "stopped",
+		Fixed:     true,
+	}})
+}
+
+func (s *S) TestReconcilerRunOnceDeletedMachine(c *check.C) {
+	fake := s.statusIaaS(c)
+	_, err := CreateMachineForIaaS("status-iaas", map[string]string{"id": "m1"})
+	c.Assert(err, check.IsNil)
+	delete(fake.machines, "m1")
+	cfg := NewReconcilerConfig()
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	_, err = FindMachineById("m1")
+	c.Assert(err, check.IsNil)
+	expected := MachineDrift{
+		Id:        "m1",
+		Iaas:      "status-iaas",
+		Address:   "m1.somewhere.com",
+		Kind:      DriftDeleted,
+		OldStatus: "running",
+	}
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{expected})
+	cfg.RemoveDeleted = true
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	_, err = FindMachineById("m1")
+	c.Assert(err, check.NotNil)
+	report, err = LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	expected.Fixed = true
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{expected})
+	c.Assert(fake.cmds, check.DeepEquals, []string{"create"})
+}
+
+func (s *S) TestReconcilerRunOnceLeakedMachine(c *check.C) {
+	config.Set("iaas:status-iaas:url", "http://status.somewhere.com")
+	defer config.Unset("iaas:status-iaas")
+	fake := s.statusIaaS(c)
+	fake.machines["leaked1"] = Machine{Id: "leaked1", Status: "running", Address: "leaked1.somewhere.com"}
+	cfg := NewReconcilerConfig()
+	cfg.DestroyLeaked = true
+	err := cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	expected := MachineDrift{
+		Id:      "leaked1",
+		Iaas:    "status-iaas",
+		Address: "leaked1.somewhere.com",
+		Kind:    DriftLeaked,
+		Status:  "running",
+	}
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{expected})
+	c.Assert(fake.machines, check.HasLen, 1)
+	err = cfg.RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err = LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	expected.Fixed = true
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{expected})
+	c.Assert(fake.machines, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target:     event.Target{Name: "machine", Value: "leaked1"},
+		Kind:       "machine.delete",
+		Owner:      "iaas-reconciler",
+		LogMatches: `.*leaked in IaaS status-iaas.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestReconcilerRunOnceListError(c *check.C) {
+	fake := s.statusIaaS(c)
+	_, err := CreateMachineForIaaS("status-iaas", map[string]string{"id": "m1"})
+	c.Assert(err, check.IsNil)
+	fake.listErr = errors.New("api is down")
+	err = NewReconcilerConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedIaaSs, check.DeepEquals, []string{})
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{})
+	c.Assert(report.Errors, check.DeepEquals, []ReconcileError{{Iaas: "status-iaas", Error: "api is down"}})
+}
+
+func (s *S) TestReconcilerRunOnceIgnoresIaaSWithoutStatus(c *check.C) {
+	_, err := CreateMachineForIaaS("test-iaas", map[string]string{"id": "m1"})
+	c.Assert(err, check.IsNil)
+	err = NewReconcilerConfig().RunOnce()
+	c.Assert(err, check.IsNil)
+	report, err := LastReconcileReport()
+	c.Assert(err, check.IsNil)
+	c.Assert(report.CheckedIaaSs, check.DeepEquals, []string{})
+	c.Assert(report.CheckedMachines, check.Equals, 0)
+	c.Assert(report.Drifts, check.DeepEquals, []MachineDrift{})
+}
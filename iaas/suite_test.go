@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db/dbtest"
 	"gopkg.in/check.v1"
 )
 
@@ -25,10 +26,7 @@ func (s *S) SetUpTest(c *check.C) {
 	coll, err := collection()
 	c.Assert(err, check.IsNil)
 	defer coll.Close()
-	coll.RemoveAll(nil)
-	tplColl := template_collection()
-	defer tplColl.Close()
-	tplColl.RemoveAll(nil)
+	dbtest.ClearAllCollections(coll.Database)
 }
 
 func (s *S) TearDownSuite(c *check.C) {
@@ -117,3 +115,64 @@ func newTestDescriberIaaS(name string) IaaS {
 func newTestIaaS(name string) IaaS {
 	return &TestIaaS{}
 }
+
+// TestStatusIaaS keeps its machines in memory, they may be changed directly
+// in the machines map to simulate changes made out-of-band.
+type TestStatusIaaS struct {
+	TestIaaS
+	machines map[string]Machine
+	listErr  error
+}
+
+func (i *TestStatusIaaS) CreateMachine(params map[string]string) (*Machine, error) {
+	m, err := i.TestIaaS.CreateMachine(params)
+	if err != nil {
+		return nil, err
+	}
+	i.machines[m.Id] = *m
+	return m, nil
+}
+
+func (i *TestStatusIaaS) DeleteMachine(m *Machine) error {
+	delete(i.machines, m.Id)
+	return i.TestIaaS.DeleteMachine(m)
+}
+
+func (i *TestStatusIaaS) GetMachine(id string) (*Machine, error) {
+	m, ok := i.machines[id]
+	if !ok {
+		return nil, ErrMachineNotFound
+	}
+	return &m, nil
+}
+
+func (i *TestStatusIaaS) ListMachines() ([]Machine, error) {
+	if i.listErr != nil {
+		return nil, i.listErr
+	}
+	var result []Machine
+	for _, m := range i.machines {
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func newTestStatusIaaS(name string) IaaS {
+	return &TestStatusIaaS{machines: map[string]Machine{}}
+}
+
+type TestParamDescriberIaaS struct {
+	TestIaaS
+}
+
+func (i *TestParamDescriberIaaS) DescribeParams() []ParamSpec {
+	return []ParamSpec{
+		{Name: "id", Required: true},
+		{Name: "size", Values: []string{"small", "large"}},
+		{Name: "zone", Regex: "zone-[a-z]"},
+	}
+}
+
+func newTestParamDescriberIaaS(name string) IaaS {
+	return &TestParamDescriberIaaS{}
+}
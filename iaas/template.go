@@ -6,11 +6,15 @@ package iaas
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type TemplateData struct {
@@ -24,10 +28,30 @@ func (l TemplateDataList) Len() int           { return len(l) }
 func (l TemplateDataList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l TemplateDataList) Less(i, j int) bool { return l[i].Name < l[j].Name }
 
+// Template is a named set of params used to create machines. A template may
+// extend a parent template of the same IaaS, inheriting its data and params,
+// and may declare params to be validated when machines are created with it.
+//
+// ClearParent and ClearParams are only used when updating a template, to
+// remove its parent and its params.
 type Template struct {
-	Name     string `bson:"_id"`
-	IaaSName string
-	Data     TemplateDataList
+	Name        string `bson:"_id"`
+	IaaSName    string
+	Data        TemplateDataList
+	Parent      string      `bson:",omitempty"`
+	Params      []ParamSpec `bson:",omitempty"`
+	ClearParent bool        `bson:"-" json:"-"`
+	ClearParams bool        `bson:"-" json:"-"`
+}
+
+// TemplateError is returned when a template is invalid or can't be changed.
+type TemplateError struct {
+	Template string
+	Reason   string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template %q: %s", e.Template, e.Reason)
 }
 
 func FindTemplate(name string) (*Template, error) {
@@ -38,12 +62,23 @@ func FindTemplate(name string) (*Template, error) {
 	return &template, err
 }
 
+func findTemplate(name string, overrides map[string]*Template) (*Template, error) {
+	if tpl, ok := overrides[name]; ok {
+		return tpl, nil
+	}
+	return FindTemplate(name)
+}
+
 func ExpandTemplate(name string) (map[string]string, error) {
 	template, err := FindTemplate(name)
 	if err != nil {
 		return nil, err
 	}
-	return template.paramsMap(), nil
+	expanded, err := template.expand()
+	if err != nil {
+		return nil, err
+	}
+	return expanded.paramsMap(), nil
 }
 
 func ListTemplates() ([]Template, error) {
@@ -57,6 +92,21 @@ func ListTemplates() ([]Template, error) {
 func DestroyTemplate(name string) error {
 	coll := template_collection()
 	defer coll.Close()
+	var children []Template
+	err := coll.Find(bson.M{"parent": name}).Sort("_id").All(&children)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		names := make([]string, len(children))
+		for i, child := range children {
+			names[i] = child.Name
+		}
+		return &TemplateError{
+			Template: name,
+			Reason:   fmt.Sprintf("can't be removed, it's the parent of: %s", strings.Join(names, ", ")),
+		}
+	}
 	return coll.RemoveId(name)
 }
 
@@ -76,6 +126,16 @@ func (t *Template) Update(toMerge *Template) error {
 	for k, v := range currentMap {
 		t.Data = append(t.Data, TemplateData{Name: k, Value: v})
 	}
+	if toMerge.ClearParent {
+		t.Parent = ""
+	} else if toMerge.Parent != "" {
+		t.Parent = toMerge.Parent
+	}
+	if toMerge.ClearParams {
+		t.Params = nil
+	} else if len(toMerge.Params) > 0 {
+		t.Params = toMerge.Params
+	}
 	return t.Save()
 }
 
@@ -83,13 +143,137 @@ func (t *Template) Save() error {
 	if t.Name == "" {
 		return errors.New("template name cannot be empty")
 	}
-	_, err := getIaasProvider(t.IaaSName)
+	if t.IaaSName == "" && t.Parent != "" {
+		parent, err := FindTemplate(t.Parent)
+		if err == nil {
+			t.IaaSName = parent.IaaSName
+		}
+	}
+	iaas, err := getIaasProvider(t.IaaSName)
+	if err != nil {
+		return err
+	}
+	err = t.validate(iaas, nil)
+	if err != nil {
+		return err
+	}
+	err = t.validateChildren()
 	if err != nil {
 		return err
 	}
 	return t.saveToDB()
 }
 
+// validateChildren checks that the templates inheriting from t, directly or
+// not, are still valid with the changes made to t.
+func (t *Template) validateChildren() error {
+	coll := template_collection()
+	defer coll.Close()
+	overrides := map[string]*Template{t.Name: t}
+	parents := []string{t.Name}
+	for len(parents) > 0 {
+		var children []Template
+		err := coll.Find(bson.M{"parent": bson.M{"$in": parents}}).Sort("_id").All(&children)
+		if err != nil {
+			return err
+		}
+		parents = nil
+		for i := range children {
+			child := &children[i]
+			if _, ok := overrides[child.Name]; ok {
+				continue
+			}
+			iaas, err := getIaasProvider(child.IaaSName)
+			if err != nil {
+				return err
+			}
+			err = child.validate(iaas, overrides)
+			if err != nil {
+				return &TemplateError{
+					Template: t.Name,
+					Reason:   fmt.Sprintf("change would invalidate child template %q: %s", child.Name, err),
+				}
+			}
+			overrides[child.Name] = child
+			parents = append(parents, child.Name)
+		}
+	}
+	return nil
+}
+
+// validate checks the params declared in the template and its inheritance
+// chain, and the values set in the template against the params described by
+// the IaaS and inherited from the parents. Templates in overrides are used
+// instead of the ones stored in the database.
+func (t *Template) validate(iaas IaaS, overrides map[string]*Template) error {
+	for i := range t.Params {
+		err := t.Params[i].validate()
+		if err != nil {
+			return &TemplateError{Template: t.Name, Reason: err.Error()}
+		}
+	}
+	expanded, err := t.expandWith(overrides)
+	if err != nil {
+		return err
+	}
+	specs := [][]ParamSpec{describeParams(iaas), expanded.Params}
+	return validateParams(t.IaaSName, specs, expanded.paramsMap(), false)
+}
+
+// expand returns a copy of the template with the data and params inherited
+// from its parents. The data set in a template overrides the inherited data,
+// the params are listed from the root of the chain to the template itself, as
+// the params of a template can only narrow the inherited ones.
+func (t *Template) expand() (*Template, error) {
+	return t.expandWith(nil)
+}
+
+func (t *Template) expandWith(overrides map[string]*Template) (*Template, error) {
+	chain := []*Template{t}
+	visited := map[string]bool{t.Name: true}
+	for current := t; current.Parent != ""; {
+		if visited[current.Parent] {
+			return nil, &TemplateError{
+				Template: t.Name,
+				Reason:   fmt.Sprintf("cyclic inheritance through parent %q", current.Parent),
+			}
+		}
+		parent, err := findTemplate(current.Parent, overrides)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil, &TemplateError{
+					Template: t.Name,
+					Reason:   fmt.Sprintf("parent template %q not found", current.Parent),
+				}
+			}
+			return nil, err
+		}
+		if parent.IaaSName != t.IaaSName {
+			return nil, &TemplateError{
+				Template: t.Name,
+				Reason:   fmt.Sprintf("parent template %q belongs to IaaS %q, not %q", parent.Name, parent.IaaSName, t.IaaSName),
+			}
+		}
+		visited[parent.Name] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+	expanded := Template{Name: t.Name, IaaSName: t.IaaSName, Parent: t.Parent}
+	indexes := map[string]int{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, item := range chain[i].Data {
+			if idx, ok := indexes[item.Name]; ok {
+				expanded.Data[idx] = item
+				continue
+			}
+			indexes[item.Name] = len(expanded.Data)
+			expanded.Data = append(expanded.Data, item)
+		}
+		expanded.Params = append(expanded.Params, chain[i].Params...)
+	}
+	return &expanded, nil
+}
+
 func (t *Template) saveToDB() error {
 	coll := template_collection()
 	defer coll.Close()
@@ -111,6 +111,28 @@ func (s *S) TestUpdateTemplate(c *check.C) {
 	})
 }
 
+func (s *S) TestUpdateTemplateClearParentAndParams(c *check.C) {
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	tpl1 := Template{
+		Name:   "tpl1",
+		Parent: "base",
+		Params: []ParamSpec{{Name: "key1", Required: true}},
+	}
+	err = tpl1.Save()
+	c.Assert(err, check.IsNil)
+	err = tpl1.Update(&Template{Parent: "other"})
+	c.Assert(err, check.ErrorMatches, `template "tpl1": parent template "other" not found`)
+	err = tpl1.Update(&Template{ClearParent: true, ClearParams: true})
+	c.Assert(err, check.IsNil)
+	dbTpl, err := FindTemplate("tpl1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Parent, check.Equals, "")
+	c.Assert(dbTpl.Params, check.IsNil)
+	c.Assert(dbTpl.IaaSName, check.Equals, "test-iaas")
+}
+
 func (s *S) TestParamsMap(c *check.C) {
 	t := Template{
 		Name:     "tpl1",
@@ -193,3 +215,196 @@ func (s *S) TestExpandTemplate(c *check.C) {
 		"iaas": "test-iaas",
 	})
 }
+
+func (s *S) TestExpandTemplateWithParents(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "key1", Value: "val1"},
+			{Name: "key2", Value: "val2"},
+		},
+		Params: []ParamSpec{{Name: "key3", Values: []string{"a", "b"}}},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	middle := Template{
+		Name:     "middle",
+		IaaSName: "test-iaas",
+		Parent:   "base",
+		Data:     TemplateDataList{{Name: "key2", Value: "middle2"}},
+	}
+	err = middle.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "child",
+		Parent: "middle",
+		Data:   TemplateDataList{{Name: "key3", Value: "b"}},
+		Params: []ParamSpec{{Name: "key3", Values: []string{"b", "c"}}},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	c.Assert(child.IaaSName, check.Equals, "test-iaas")
+	data, err := ExpandTemplate("child")
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]string{
+		"key1": "val1",
+		"key2": "middle2",
+		"key3": "b",
+		"iaas": "test-iaas",
+	})
+	expanded, err := child.expand()
+	c.Assert(err, check.IsNil)
+	c.Assert(expanded.Params, check.DeepEquals, []ParamSpec{
+		{Name: "key3", Values: []string{"a", "b"}},
+		{Name: "key3", Values: []string{"b", "c"}},
+	})
+	rules, err := combineParamSpecs(expanded.Params)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []paramRule{{name: "key3", values: []string{"b"}}})
+}
+
+func (s *S) TestTemplateSaveParentNotFound(c *check.C) {
+	t := Template{Name: "tpl1", IaaSName: "test-iaas", Parent: "unknown"}
+	err := t.Save()
+	c.Assert(err, check.FitsTypeOf, &TemplateError{})
+	c.Assert(err, check.ErrorMatches, `template "tpl1": parent template "unknown" not found`)
+}
+
+func (s *S) TestTemplateSaveParentFromOtherIaaS(c *check.C) {
+	RegisterIaasProvider("other-iaas", newTestIaaS)
+	parent := Template{Name: "base", IaaSName: "other-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	t := Template{Name: "tpl1", IaaSName: "test-iaas", Parent: "base"}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": parent template "base" belongs to IaaS "other-iaas", not "test-iaas"`)
+}
+
+func (s *S) TestTemplateSaveCyclicParents(c *check.C) {
+	tpl1 := Template{Name: "tpl1", IaaSName: "test-iaas"}
+	err := tpl1.Save()
+	c.Assert(err, check.IsNil)
+	tpl2 := Template{Name: "tpl2", IaaSName: "test-iaas", Parent: "tpl1"}
+	err = tpl2.Save()
+	c.Assert(err, check.IsNil)
+	tpl1.Parent = "tpl2"
+	err = tpl1.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": cyclic inheritance through parent "tpl1"`)
+	tpl1.Parent = "tpl1"
+	err = tpl1.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": cyclic inheritance through parent "tpl1"`)
+}
+
+func (s *S) TestTemplateSaveInvalidParams(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params:   []ParamSpec{{Name: "key1", Regex: "[a-z"}},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": param "key1" has an invalid regex: .*`)
+	t.Params = []ParamSpec{{Description: "no name"}}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1": param name cannot be empty`)
+}
+
+func (s *S) TestTemplateSaveInvalidData(c *check.C) {
+	RegisterIaasProvider("params-iaas", newTestParamDescriberIaaS)
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "params-iaas",
+		Data: TemplateDataList{
+			{Name: "size", Value: "huge"},
+			{Name: "key1", Value: "val1"},
+		},
+		Params: []ParamSpec{{Name: "key1", Values: []string{"val2"}}},
+	}
+	err := t.Save()
+	c.Assert(err, check.FitsTypeOf, &InvalidParamsError{})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "size" must be one of: small, large, got "huge"; param "key1" must be one of: val2, got "val1"`)
+	t.Data = TemplateDataList{{Name: "size", Value: "small"}, {Name: "key1", Value: "val2"}}
+	err = t.Save()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTemplateParamsOnlyNarrowIaaSParams(c *check.C) {
+	RegisterIaasProvider("params-iaas", newTestParamDescriberIaaS)
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "params-iaas",
+		Data:     TemplateDataList{{Name: "size", Value: "huge"}},
+		Params: []ParamSpec{
+			{Name: "id", Required: false},
+			{Name: "size", Values: []string{"huge", "large"}},
+		},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "size" must be one of: large, got "huge"`)
+	t.Data = TemplateDataList{{Name: "size", Value: "large"}}
+	err = t.Save()
+	c.Assert(err, check.IsNil)
+	_, err = CreateMachine(map[string]string{"template": "tpl1"})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "id" is required`)
+	t.Data = nil
+	t.Params = []ParamSpec{{Name: "size", Values: []string{"huge"}}}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "size" must be one of: small, large, which allows none of: huge`)
+	t.Params = []ParamSpec{{Name: "zone", Regex: "[a-z]+-a"}}
+	err = t.Save()
+	c.Assert(err, check.IsNil)
+	_, err = CreateMachine(map[string]string{"template": "tpl1", "id": "myid", "zone": "zone-b"})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "zone" must match "\[a-z\]\+-a", got "zone-b"`)
+	_, err = CreateMachine(map[string]string{"template": "tpl1", "id": "myid", "zone": "region-a"})
+	c.Assert(err, check.ErrorMatches, `invalid params for IaaS "params-iaas": param "zone" must match "zone-\[a-z\]", got "region-a"`)
+	_, err = CreateMachine(map[string]string{"template": "tpl1", "id": "myid", "zone": "zone-a"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTemplateSaveValidatesChildren(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Params:   []ParamSpec{{Name: "key1", Values: []string{"a", "b"}}},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	middle := Template{Name: "middle", Parent: "base"}
+	err = middle.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "child",
+		Parent: "middle",
+		Data:   TemplateDataList{{Name: "key1", Value: "b"}},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	base.Params = []ParamSpec{{Name: "key1", Values: []string{"a"}}}
+	err = base.Save()
+	c.Assert(err, check.ErrorMatches, `template "base": change would invalidate child template "child": invalid params for IaaS "test-iaas": param "key1" must be one of: a, got "b"`)
+	dbTpl, err := FindTemplate("base")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbTpl.Params, check.DeepEquals, []ParamSpec{{Name: "key1", Values: []string{"a", "b"}}})
+	base.Params = []ParamSpec{{Name: "key1", Values: []string{"b", "c"}}}
+	err = base.Save()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestDestroyTemplateWithChildren(c *check.C) {
+	parent := Template{Name: "base", IaaSName: "test-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	for _, name := range []string{"child2", "child1"} {
+		child := Template{Name: name, Parent: "base"}
+		err = child.Save()
+		c.Assert(err, check.IsNil)
+	}
+	err = DestroyTemplate("base")
+	c.Assert(err, check.ErrorMatches, `template "base": can't be removed, it's the parent of: child1, child2`)
+	err = DestroyTemplate("child1")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("child2")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.IsNil)
+}
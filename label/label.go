@@ -0,0 +1,169 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package label provides key/value labels that can be attached to apps,
+// teams and service instances, and used to select them.
+//
+// Keys and values follow the same rules used by Kubernetes labels: keys are
+// composed by an optional DNS subdomain prefix and a name, separated by a
+// slash, and both names and values must have at most 63 characters, begin
+// and end with an alphanumeric character and contain only alphanumerics,
+// dashes, underscores and dots.
+package label
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	maxNameLength   = 63
+	maxPrefixLength = 253
+)
+
+var (
+	nameRegexp   = regexp.MustCompile(`^[a-zA-Z0-9]([-_.a-zA-Z0-9]*[a-zA-Z0-9])?$`)
+	prefixRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// Labels is a set of labels. Labels are stored in the database as a list of
+// key/value pairs, because label keys may contain dots.
+type Labels map[string]string
+
+type pair struct {
+	Key   string
+	Value string
+}
+
+// GetBSON implements bson.Getter.
+func (l Labels) GetBSON() (interface{}, error) {
+	pairs := make([]pair, 0, len(l))
+	for _, k := range l.Keys() {
+		pairs = append(pairs, pair{Key: k, Value: l[k]})
+	}
+	return pairs, nil
+}
+
+// SetBSON implements bson.Setter.
+func (l *Labels) SetBSON(raw bson.Raw) error {
+	var pairs []pair
+	err := raw.Unmarshal(&pairs)
+	if err != nil {
+		return err
+	}
+	*l = nil
+	if len(pairs) > 0 {
+		*l = make(Labels, len(pairs))
+	}
+	for _, p := range pairs {
+		(*l)[p.Key] = p.Value
+	}
+	return nil
+}
+
+// Keys returns the sorted list of label keys.
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks whether all keys and values are valid.
+func (l Labels) Validate() error {
+	for _, k := range l.Keys() {
+		err := ValidateKey(k)
+		if err != nil {
+			return err
+		}
+		if !validValue(l[k]) {
+			return &errors.ValidationError{Message: fmt.Sprintf("invalid value for label %q: %q", k, l[k])}
+		}
+	}
+	return nil
+}
+
+// Update returns a new set of labels, with the labels in set added and the
+// keys in unset removed.
+func (l Labels) Update(set Labels, unset []string) Labels {
+	result := make(Labels, len(l)+len(set))
+	for k, v := range l {
+		result[k] = v
+	}
+	for k, v := range set {
+		result[k] = v
+	}
+	for _, k := range unset {
+		delete(result, k)
+	}
+	return result
+}
+
+// Matches returns whether the labels contain all the labels in selector.
+func (l Labels) Matches(selector Labels) bool {
+	for k, v := range selector {
+		if value, ok := l[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns the conditions that match documents whose labels, stored in
+// field, contain all the labels in the selector. The conditions should be
+// combined using $and.
+func (l Labels) Query(field string) []bson.M {
+	var conditions []bson.M
+	for _, k := range l.Keys() {
+		conditions = append(conditions, bson.M{field: bson.M{
+			"$elemMatch": bson.M{"key": k, "value": l[k]},
+		}})
+	}
+	return conditions
+}
+
+// ValidateKey checks whether the key is a valid label key.
+func ValidateKey(key string) error {
+	name := key
+	if i := strings.Index(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) == 0 || len(prefix) > maxPrefixLength || !prefixRegexp.MatchString(prefix) {
+			return &errors.ValidationError{Message: fmt.Sprintf("invalid prefix for label %q", key)}
+		}
+	}
+	if len(name) == 0 || len(name) > maxNameLength || !nameRegexp.MatchString(name) {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid name for label %q", key)}
+	}
+	return nil
+}
+
+func validValue(value string) bool {
+	return value == "" || (len(value) <= maxNameLength && nameRegexp.MatchString(value))
+}
+
+// Parse parses a list of labels in the format key=value. It's used to parse
+// labels and label selectors sent to the API.
+func Parse(values []string) (Labels, error) {
+	labels := make(Labels, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, &errors.ValidationError{Message: fmt.Sprintf("invalid label %q, must be in the format key=value", v)}
+		}
+		labels[parts[0]] = parts[1]
+	}
+	err := labels.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package label
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+func (s *S) TestValidateKey(c *check.C) {
+	var data = []struct {
+		key   string
+		valid bool
+	}{
+		{"tier", true},
+		{"app.tier", true},
+		{"tsuru.io/tier", true},
+		{"My_Label-1", true},
+		{"", false},
+		{"-tier", false},
+		{"tier.", false},
+		{"tier name", false},
+		{"/tier", false},
+		{"Tsuru.io/tier", false},
+		{"tsuru.io/", false},
+		{"a/b/c", false},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+	}
+	for _, d := range data {
+		err := ValidateKey(d.key)
+		c.Check(err == nil, check.Equals, d.valid, check.Commentf("key %q", d.key))
+	}
+}
+
+func (s *S) TestValidate(c *check.C) {
+	c.Assert(Labels{"tier": "frontend", "empty": ""}.Validate(), check.IsNil)
+	err := Labels{"tier": "front end"}.Validate()
+	c.Assert(err, check.ErrorMatches, `invalid value for label "tier": "front end"`)
+	err = Labels{"tier": strings.Repeat("a", 64)}.Validate()
+	c.Assert(err, check.NotNil)
+	err = Labels{"-tier": "frontend"}.Validate()
+	c.Assert(err, check.ErrorMatches, `invalid name for label "-tier"`)
+}
+
+func (s *S) TestParse(c *check.C) {
+	labels, err := Parse([]string{"tier=frontend", "tsuru.io/team=admin", "empty="})
+	c.Assert(err, check.IsNil)
+	c.Assert(labels, check.DeepEquals, Labels{"tier": "frontend", "tsuru.io/team": "admin", "empty": ""})
+	_, err = Parse([]string{"tier"})
+	c.Assert(err, check.ErrorMatches, `invalid label "tier", must be in the format key=value`)
+	_, err = Parse([]string{"tier=front end"})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestUpdate(c *check.C) {
+	labels := Labels{"tier": "frontend", "team": "admin"}
+	updated := labels.Update(Labels{"tier": "backend", "env": "prod"}, []string{"team", "unknown"})
+	c.Assert(updated, check.DeepEquals, Labels{"tier": "backend", "env": "prod"})
+	c.Assert(labels, check.DeepEquals, Labels{"tier": "frontend", "team": "admin"})
+}
+
+func (s *S) TestMatches(c *check.C) {
+	labels := Labels{"tier": "frontend", "team": "admin"}
+	c.Assert(labels.Matches(nil), check.Equals, true)
+	c.Assert(labels.Matches(Labels{"tier": "frontend"}), check.Equals, true)
+	c.Assert(labels.Matches(Labels{"tier": "backend"}), check.Equals, false)
+	c.Assert(labels.Matches(Labels{"env": ""}), check.Equals, false)
+}
+
+func (s *S) TestBSON(c *check.C) {
+	doc := struct {
+		Labels Labels `bson:",omitempty"`
+	}{Labels: Labels{"tsuru.io/tier": "frontend", "env": "prod"}}
+	data, err := bson.Marshal(doc)
+	c.Assert(err, check.IsNil)
+	var raw bson.M
+	err = bson.Unmarshal(data, &raw)
+	c.Assert(err, check.IsNil)
+	c.Assert(raw["labels"], check.DeepEquals, []interface{}{
+		bson.M{"key": "env", "value": "prod"},
+		bson.M{"key": "tsuru.io/tier", "value": "frontend"},
+	})
+	doc.Labels = nil
+	err = bson.Unmarshal(data, &doc)
+	c.Assert(err, check.IsNil)
+	c.Assert(doc.Labels, check.DeepEquals, Labels{"tsuru.io/tier": "frontend", "env": "prod"})
+	doc.Labels = nil
+	data, err = bson.Marshal(doc)
+	c.Assert(err, check.IsNil)
+	raw = nil
+	err = bson.Unmarshal(data, &raw)
+	c.Assert(err, check.IsNil)
+	c.Assert(raw, check.HasLen, 0)
+}
+
+func (s *S) TestQuery(c *check.C) {
+	c.Assert(Labels{}.Query("labels"), check.IsNil)
+	c.Assert(Labels{"tier": "frontend", "env": "prod"}.Query("labels"), check.DeepEquals, []bson.M{
+		{"labels": bson.M{"$elemMatch": bson.M{"key": "env", "value": "prod"}}},
+		{"labels": bson.M{"$elemMatch": bson.M{"key": "tier", "value": "frontend"}}},
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package leader provides leases stored in the database, used to elect a
+// single tsuru API instance to run background routines.
+package leader
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const leaseCollection = "leader_leases"
+
+// Lease is a lock stored in the database that expires if it's not renewed in
+// time, allowing another instance to take over when the current leader dies.
+type Lease struct {
+	name     string
+	owner    string
+	duration time.Duration
+}
+
+// NewLease returns a lease identified by name, each background routine must
+// use its own name. The lease expires when not renewed within duration.
+func NewLease(name string, duration time.Duration) *Lease {
+	hostname, _ := os.Hostname()
+	return &Lease{
+		name:     name,
+		owner:    fmt.Sprintf("%s-%s", hostname, bson.NewObjectId().Hex()),
+		duration: duration,
+	}
+}
+
+// Acquire takes or renews the lease, returning whether the current instance
+// is the leader.
+func (l *Lease) Acquire() (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	query := bson.M{
+		"_id": l.name,
+		"$or": []bson.M{
+			{"owner": l.owner},
+			{"expires": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": l.owner, "expires": now.Add(l.duration)}}
+	_, err = conn.Collection(leaseCollection).Upsert(query, update)
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package leader
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAcquire(c *check.C) {
+	lease := NewLease("routine", time.Minute)
+	isLeader, err := lease.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+	isLeader, err = lease.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+}
+
+func (s *S) TestAcquireHeldByOther(c *check.C) {
+	lease := NewLease("routine", time.Minute)
+	isLeader, err := lease.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+	other := NewLease("routine", time.Minute)
+	isLeader, err = other.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, false)
+}
+
+func (s *S) TestAcquireExpired(c *check.C) {
+	lease := NewLease("routine", time.Millisecond)
+	isLeader, err := lease.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	other := NewLease("routine", time.Minute)
+	isLeader, err = other.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+	isLeader, err = lease.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, false)
+}
+
+func (s *S) TestAcquireDifferentNames(c *check.C) {
+	isLeader, err := NewLease("routine1", time.Minute).Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+	isLeader, err = NewLease("routine2", time.Minute).Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(isLeader, check.Equals, true)
+}
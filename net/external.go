@@ -0,0 +1,105 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrInternalAddress is returned when an address supplied by users, like the
+// URL of a webhook, points to a loopback, private, link-local or unspecified
+// address, including cloud metadata endpoints.
+var ErrInternalAddress = errors.New("address points to an internal network")
+
+var internalNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// IsInternalIP returns whether the ip is a loopback, private, shared,
+// link-local, multicast or unspecified address.
+func IsInternalIP(ip net.IP) bool {
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveExternal resolves the host and returns ErrInternalAddress if any of
+// its addresses is internal.
+func resolveExternal(host string) ([]net.IP, error) {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	var addrs []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IP{ip}
+	} else {
+		var err error
+		addrs, err = net.LookupIP(host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, ip := range addrs {
+		if IsInternalIP(ip) {
+			return nil, ErrInternalAddress
+		}
+	}
+	return addrs, nil
+}
+
+// CheckExternalHost resolves the host and returns ErrInternalAddress if any
+// of its addresses is internal.
+func CheckExternalHost(host string) error {
+	_, err := resolveExternal(host)
+	return err
+}
+
+// ExternalDial returns a dial function, to be used as the Dial of an
+// http.Transport, that refuses to connect to internal addresses. The host is
+// resolved and checked before each connection, which is made to the checked
+// address, so hosts that resolve to internal addresses after being validated
+// are refused too.
+func ExternalDial(timeout time.Duration) func(network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return func(network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := resolveExternal(host)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial(network, net.JoinHostPort(addrs[0].String(), port))
+	}
+}
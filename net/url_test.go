@@ -5,7 +5,9 @@
 package net
 
 import (
+	"net"
 	"testing"
+	"time"
 
 	"gopkg.in/check.v1"
 )
@@ -28,3 +30,43 @@ func (s *S) TestURLtoHost(c *check.C) {
 		c.Check(URLToHost(address), check.Equals, host)
 	}
 }
+
+func (s *S) TestIsInternalIP(c *check.C) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"0.0.0.0":         true,
+		"100.64.1.1":      true,
+		"224.0.0.1":       true,
+		"::1":             true,
+		"::ffff:10.0.0.1": true,
+		"fd00::1":         true,
+		"fe80::1":         true,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	}
+	for address, internal := range tests {
+		c.Check(IsInternalIP(net.ParseIP(address)), check.Equals, internal, check.Commentf(address))
+	}
+}
+
+func (s *S) TestCheckExternalHost(c *check.C) {
+	c.Assert(CheckExternalHost("169.254.169.254"), check.Equals, ErrInternalAddress)
+	c.Assert(CheckExternalHost("localhost"), check.Equals, ErrInternalAddress)
+	c.Assert(CheckExternalHost("[::1]"), check.Equals, ErrInternalAddress)
+	c.Assert(CheckExternalHost("8.8.8.8"), check.IsNil)
+}
+
+func (s *S) TestExternalDial(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	_, err = ExternalDial(time.Second)("tcp", l.Addr().String())
+	c.Assert(err, check.Equals, ErrInternalAddress)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	_, err = ExternalDial(time.Second)("tcp", net.JoinHostPort("localhost", port))
+	c.Assert(err, check.Equals, ErrInternalAddress)
+}
@@ -17,33 +17,51 @@ var (
 	PermAppCreate                        = PermissionRegistry.get("app.create")
 	PermAppDelete                        = PermissionRegistry.get("app.delete")
 	PermAppDeploy                        = PermissionRegistry.get("app.deploy")
+	PermAppDeployApprove                 = PermissionRegistry.get("app.deploy.approve")
 	PermAppDeployArchiveUrl              = PermissionRegistry.get("app.deploy.archive-url")
 	PermAppDeployBuild                   = PermissionRegistry.get("app.deploy.build")
 	PermAppDeployGit                     = PermissionRegistry.get("app.deploy.git")
 	PermAppDeployImage                   = PermissionRegistry.get("app.deploy.image")
+	PermAppDeployOverrideFreeze          = PermissionRegistry.get("app.deploy.override-freeze")
 	PermAppDeployRollback                = PermissionRegistry.get("app.deploy.rollback")
 	PermAppDeployUpload                  = PermissionRegistry.get("app.deploy.upload")
 	PermAppRead                          = PermissionRegistry.get("app.read")
 	PermAppReadDeploy                    = PermissionRegistry.get("app.read.deploy")
 	PermAppReadEnv                       = PermissionRegistry.get("app.read.env")
+	PermAppReadJob                       = PermissionRegistry.get("app.read.job")
 	PermAppReadLog                       = PermissionRegistry.get("app.read.log")
+	PermAppReadLogDrain                  = PermissionRegistry.get("app.read.log-drain")
 	PermAppReadMetric                    = PermissionRegistry.get("app.read.metric")
 	PermAppRun                           = PermissionRegistry.get("app.run")
 	PermAppUpdate                        = PermissionRegistry.get("app.update")
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")
+	PermAppUpdateCertificate             = PermissionRegistry.get("app.update.certificate")
+	PermAppUpdateCertificateRemove       = PermissionRegistry.get("app.update.certificate.remove")
+	PermAppUpdateCertificateSet          = PermissionRegistry.get("app.update.certificate.set")
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")
+	PermAppUpdateDeployApproval          = PermissionRegistry.get("app.update.deploy-approval")
+	PermAppUpdateDeployFreeze            = PermissionRegistry.get("app.update.deploy-freeze")
 	PermAppUpdateDescription             = PermissionRegistry.get("app.update.description")
 	PermAppUpdateEnv                     = PermissionRegistry.get("app.update.env")
 	PermAppUpdateEnvSet                  = PermissionRegistry.get("app.update.env.set")
 	PermAppUpdateEnvUnset                = PermissionRegistry.get("app.update.env.unset")
 	PermAppUpdateGrant                   = PermissionRegistry.get("app.update.grant")
+	PermAppUpdateJob                     = PermissionRegistry.get("app.update.job")
+	PermAppUpdateLabels                  = PermissionRegistry.get("app.update.labels")
 	PermAppUpdateLog                     = PermissionRegistry.get("app.update.log")
+	PermAppUpdateLogDrain                = PermissionRegistry.get("app.update.log-drain")
+	PermAppUpdateLogDrainAdd             = PermissionRegistry.get("app.update.log-drain.add")
+	PermAppUpdateLogDrainRemove          = PermissionRegistry.get("app.update.log-drain.remove")
+	PermAppUpdateNodeSelector            = PermissionRegistry.get("app.update.node-selector")
 	PermAppUpdatePlan                    = PermissionRegistry.get("app.update.plan")
 	PermAppUpdatePool                    = PermissionRegistry.get("app.update.pool")
 	PermAppUpdateRestart                 = PermissionRegistry.get("app.update.restart")
 	PermAppUpdateRevoke                  = PermissionRegistry.get("app.update.revoke")
+	PermAppUpdateRouter                  = PermissionRegistry.get("app.update.router")
+	PermAppUpdateRouterAdd               = PermissionRegistry.get("app.update.router.add")
+	PermAppUpdateRouterRemove            = PermissionRegistry.get("app.update.router.remove")
 	PermAppUpdateSleep                   = PermissionRegistry.get("app.update.sleep")
 	PermAppUpdateStart                   = PermissionRegistry.get("app.update.start")
 	PermAppUpdateStop                    = PermissionRegistry.get("app.update.stop")
@@ -52,10 +70,14 @@ var (
 	PermAppUpdateUnbind                  = PermissionRegistry.get("app.update.unbind")
 	PermAppUpdateUnit                    = PermissionRegistry.get("app.update.unit")
 	PermAppUpdateUnitAdd                 = PermissionRegistry.get("app.update.unit.add")
+	PermAppUpdateUnitAutoscale           = PermissionRegistry.get("app.update.unit.autoscale")
 	PermAppUpdateUnitRegister            = PermissionRegistry.get("app.update.unit.register")
 	PermAppUpdateUnitRemove              = PermissionRegistry.get("app.update.unit.remove")
 	PermAppUpdateUnitStatus              = PermissionRegistry.get("app.update.unit.status")
 	PermDebug                            = PermissionRegistry.get("debug")
+	PermEvent                            = PermissionRegistry.get("event")
+	PermEventCancel                      = PermissionRegistry.get("event.cancel")
+	PermEventRead                        = PermissionRegistry.get("event.read")
 	PermHealing                          = PermissionRegistry.get("healing")
 	PermHealingRead                      = PermissionRegistry.get("healing.read")
 	PermHealingUpdate                    = PermissionRegistry.get("healing.update")
@@ -74,6 +96,8 @@ var (
 	PermNodeDelete                       = PermissionRegistry.get("node.delete")
 	PermNodeRead                         = PermissionRegistry.get("node.read")
 	PermNodeUpdate                       = PermissionRegistry.get("node.update")
+	PermNodeUpdateCordon                 = PermissionRegistry.get("node.update.cordon")
+	PermNodeUpdateDrain                  = PermissionRegistry.get("node.update.drain")
 	PermNodecontainer                    = PermissionRegistry.get("nodecontainer")
 	PermNodecontainerCreate              = PermissionRegistry.get("nodecontainer.create")
 	PermNodecontainerDelete              = PermissionRegistry.get("nodecontainer.delete")
@@ -91,6 +115,7 @@ var (
 	PermPoolCreate                       = PermissionRegistry.get("pool.create")
 	PermPoolDelete                       = PermissionRegistry.get("pool.delete")
 	PermPoolUpdate                       = PermissionRegistry.get("pool.update")
+	PermPoolUpdateDeployFreeze           = PermissionRegistry.get("pool.update.deploy-freeze")
 	PermPoolUpdateLogs                   = PermissionRegistry.get("pool.update.logs")
 	PermRole                             = PermissionRegistry.get("role")
 	PermRoleCreate                       = PermissionRegistry.get("role.create")
@@ -111,8 +136,11 @@ var (
 	PermServiceInstanceUpdateBind        = PermissionRegistry.get("service-instance.update.bind")
 	PermServiceInstanceUpdateDescription = PermissionRegistry.get("service-instance.update.description")
 	PermServiceInstanceUpdateGrant       = PermissionRegistry.get("service-instance.update.grant")
+	PermServiceInstanceUpdateLabels      = PermissionRegistry.get("service-instance.update.labels")
+	PermServiceInstanceUpdatePlan        = PermissionRegistry.get("service-instance.update.plan")
 	PermServiceInstanceUpdateProxy       = PermissionRegistry.get("service-instance.update.proxy")
 	PermServiceInstanceUpdateRevoke      = PermissionRegistry.get("service-instance.update.revoke")
+	PermServiceInstanceUpdateRotate      = PermissionRegistry.get("service-instance.update.rotate")
 	PermServiceInstanceUpdateUnbind      = PermissionRegistry.get("service-instance.update.unbind")
 	PermServiceCreate                    = PermissionRegistry.get("service.create")
 	PermServiceDelete                    = PermissionRegistry.get("service.delete")
@@ -127,10 +155,20 @@ var (
 	PermTeam                             = PermissionRegistry.get("team")
 	PermTeamCreate                       = PermissionRegistry.get("team.create")
 	PermTeamDelete                       = PermissionRegistry.get("team.delete")
+	PermTeamRead                         = PermissionRegistry.get("team.read")
+	PermTeamReadQuota                    = PermissionRegistry.get("team.read.quota")
+	PermTeamUpdate                       = PermissionRegistry.get("team.update")
+	PermTeamUpdateLabels                 = PermissionRegistry.get("team.update.labels")
+	PermTeamUpdateQuota                  = PermissionRegistry.get("team.update.quota")
 	PermUser                             = PermissionRegistry.get("user")
 	PermUserCreate                       = PermissionRegistry.get("user.create")
 	PermUserDelete                       = PermissionRegistry.get("user.delete")
 	PermUserUpdate                       = PermissionRegistry.get("user.update")
 	PermUserUpdateQuota                  = PermissionRegistry.get("user.update.quota")
 	PermUserUpdateToken                  = PermissionRegistry.get("user.update.token")
+	PermWebhook                          = PermissionRegistry.get("webhook")
+	PermWebhookCreate                    = PermissionRegistry.get("webhook.create")
+	PermWebhookDelete                    = PermissionRegistry.get("webhook.delete")
+	PermWebhookRead                      = PermissionRegistry.get("webhook.read")
+	PermWebhookUpdate                    = PermissionRegistry.get("webhook.update")
 )
@@ -18,6 +18,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.unit.remove",
 	"app.update.unit.register",
 	"app.update.unit.status",
+	"app.update.unit.autoscale",
+	"app.update.job",
 	"app.update.env.set",
 	"app.update.env.unset",
 	"app.update.restart",
@@ -30,9 +32,19 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.teamowner",
 	"app.update.cname.add",
 	"app.update.cname.remove",
+	"app.update.router.add",
+	"app.update.router.remove",
+	"app.update.certificate.set",
+	"app.update.certificate.remove",
 	"app.update.plan",
 	"app.update.bind",
 	"app.update.unbind",
+	"app.update.labels",
+	"app.update.node-selector",
+	"app.update.log-drain.add",
+	"app.update.log-drain.remove",
+	"app.update.deploy-freeze",
+	"app.update.deploy-approval",
 	"app.deploy",
 	"app.deploy.archive-url",
 	"app.deploy.build",
@@ -40,11 +52,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.deploy.image",
 	"app.deploy.rollback",
 	"app.deploy.upload",
+	"app.deploy.approve",
+	"app.deploy.override-freeze",
 	"app.read",
 	"app.read.deploy",
 	"app.read.env",
 	"app.read.metric",
 	"app.read.log",
+	"app.read.log-drain",
+	"app.read.job",
 	"app.delete",
 	"app.run",
 	"app.admin.unlock",
@@ -56,6 +72,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"node.create",
 	"node.read",
 	"node.update",
+	"node.update.cordon",
+	"node.update.drain",
 	"node.delete",
 	"node.autoscale",
 ).addWithCtx(
@@ -74,6 +92,16 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.create", []contextType{},
 ).add(
 	"team.delete",
+	"team.read.quota",
+	"team.update.quota",
+	"team.update.labels",
+).addWithCtx(
+	"webhook", []contextType{CtxTeam},
+).add(
+	"webhook.create",
+	"webhook.read",
+	"webhook.update",
+	"webhook.delete",
 ).add(
 	"user.create",
 	"user.delete",
@@ -104,6 +132,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"service-instance.update.grant",
 	"service-instance.update.revoke",
 	"service-instance.update.description",
+	"service-instance.update.plan",
+	"service-instance.update.rotate",
+	"service-instance.update.labels",
 ).add(
 	"role.create",
 	"role.delete",
@@ -124,9 +155,13 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"pool.create", []contextType{},
 ).add(
 	"pool.update.logs",
+	"pool.update.deploy-freeze",
 	"pool.delete",
 ).add(
 	"debug",
+).add(
+	"event.read",
+	"event.cancel",
 ).add(
 	"healing.read",
 ).addWithCtx(
@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/config"
@@ -50,6 +51,10 @@ type changeUnitsPipelineArgs struct {
 	provisioner *dockerProvisioner
 	appDestroy  bool
 	exposedPort string
+	// trafficSteps and stepInterval are used by shiftRoutesWeight to move
+	// the traffic from old units to new ones gradually.
+	trafficSteps []int
+	stepInterval time.Duration
 }
 
 type callbackFunc func(*container.Container, chan *container.Container) error
@@ -611,6 +616,157 @@ var removeOldRoutes = action.Action{
 	MinParams: 1,
 }
 
+// shiftRoutesWeight moves the traffic from the old units to the new ones in
+// steps, using the weights of a router.WeightedRouter. The healthcheck of the
+// new units is checked after each step and the old routes are restored if any
+// of them fails.
+var shiftRoutesWeight = action.Action{
+	Name: "shift-routes-weight",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args := ctx.Params[0].(changeUnitsPipelineArgs)
+		newContainers := ctx.Previous.([]container.Container)
+		r, err := getRouterForApp(args.app)
+		if err != nil {
+			return nil, err
+		}
+		wRouter, ok := r.(router.WeightedRouter)
+		if !ok {
+			return nil, fmt.Errorf("router for app %q does not support weighted routes", args.app.GetName())
+		}
+		writer := args.writer
+		if writer == nil {
+			writer = ioutil.Discard
+		}
+		webProcessName, err := getImageWebProcessName(args.imageId)
+		if err != nil {
+			log.Errorf("[WARNING] cannot get the name of the web process: %s", err)
+		}
+		var newRoutes []*url.URL
+		var newWebContainers []container.Container
+		for i, c := range newContainers {
+			if c.ProcessName != webProcessName || !c.ValidAddr() {
+				continue
+			}
+			newRoutes = append(newRoutes, c.Address())
+			newContainers[i].Routable = true
+			newWebContainers = append(newWebContainers, c)
+		}
+		if len(newRoutes) == 0 {
+			return newContainers, nil
+		}
+		oldRoutes := markOldRoutableContainers(args)
+		for _, percent := range args.trafficSteps {
+			fmt.Fprintf(writer, "\n---- Sending %d%% of traffic to new units ----\n", percent)
+			err = wRouter.SetWeightedRoutes(args.app.GetName(), stepWeightedRoutes(oldRoutes, newRoutes, percent))
+			if err == nil {
+				if args.stepInterval > 0 {
+					fmt.Fprintf(writer, " ---> Waiting %s before checking new units\n", args.stepInterval)
+					time.Sleep(args.stepInterval)
+				}
+				for i := range newWebContainers {
+					err = runHealthcheck(&newWebContainers[i], writer)
+					if err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(writer, " ---> Step failed: %s\n", err)
+				restoreOldRoutes(wRouter, args, oldRoutes, newRoutes)
+				return nil, err
+			}
+		}
+		return newContainers, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(changeUnitsPipelineArgs)
+		newContainers := ctx.FWResult.([]container.Container)
+		r, err := getRouterForApp(args.app)
+		if err != nil {
+			log.Errorf("[shift-routes-weight:Backward] Error geting router: %s", err.Error())
+			return
+		}
+		wRouter, ok := r.(router.WeightedRouter)
+		if !ok {
+			return
+		}
+		var newRoutes []*url.URL
+		for _, c := range newContainers {
+			if c.Routable {
+				newRoutes = append(newRoutes, c.Address())
+			}
+		}
+		var oldRoutes []*url.URL
+		for _, c := range args.toRemove {
+			if c.Routable {
+				oldRoutes = append(oldRoutes, c.Address())
+			}
+		}
+		restoreOldRoutes(wRouter, args, oldRoutes, newRoutes)
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+func markOldRoutableContainers(args changeUnitsPipelineArgs) []*url.URL {
+	currentImageName, err := appCurrentImageName(args.app.GetName())
+	if err != nil && err != errNoImagesAvailable {
+		log.Errorf("[WARNING] cannot get the current image of the app: %s", err)
+	}
+	webProcessName, err := getImageWebProcessName(currentImageName)
+	if err != nil {
+		log.Errorf("[WARNING] cannot get the name of the web process for old units: %s", err)
+	}
+	var routes []*url.URL
+	for i, c := range args.toRemove {
+		if c.ProcessName != webProcessName || !c.ValidAddr() {
+			continue
+		}
+		routes = append(routes, c.Address())
+		args.toRemove[i].Routable = true
+	}
+	return routes
+}
+
+// stepWeightedRoutes returns the weights for sending the given percentage of
+// the traffic to the new routes, regardless of the number of routes in each
+// group.
+func stepWeightedRoutes(oldRoutes, newRoutes []*url.URL, percent int) []router.WeightedRoute {
+	oldWeight := (100 - percent) * len(newRoutes)
+	newWeight := percent * len(oldRoutes)
+	if len(oldRoutes) == 0 || len(newRoutes) == 0 {
+		// The traffic can't be split with only one group of routes, they
+		// either receive all of it or nothing.
+		oldWeight, newWeight = 0, 0
+		if percent < 100 {
+			oldWeight = 1
+		}
+		if percent > 0 {
+			newWeight = 1
+		}
+	}
+	routes := make([]router.WeightedRoute, 0, len(oldRoutes)+len(newRoutes))
+	for _, addr := range oldRoutes {
+		routes = append(routes, router.WeightedRoute{Address: addr, Weight: oldWeight})
+	}
+	for _, addr := range newRoutes {
+		routes = append(routes, router.WeightedRoute{Address: addr, Weight: newWeight})
+	}
+	return routes
+}
+
+func restoreOldRoutes(r router.WeightedRouter, args changeUnitsPipelineArgs, oldRoutes, newRoutes []*url.URL) {
+	w := args.writer
+	if w == nil {
+		w = ioutil.Discard
+	}
+	fmt.Fprintf(w, "\n---- Sending all traffic back to old units ----\n")
+	err := r.SetWeightedRoutes(args.app.GetName(), stepWeightedRoutes(oldRoutes, newRoutes, 0))
+	if err != nil {
+		log.Errorf("[shift-routes-weight] Error restoring routes of old units for app %q: %s", args.app.GetName(), err)
+	}
+}
+
 var provisionRemoveOldUnits = action.Action{
 	Name: "provision-remove-old-units",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
@@ -5,6 +5,7 @@
 package docker
 
 import (
+	"bytes"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -813,6 +814,133 @@ func (s *S) TestProvisionAddUnitsToHostBackward(c *check.C) {
 	c.Assert(e.ID, check.Equals, cont.ID)
 }
 
+func (s *S) TestShiftRoutesWeightName(c *check.C) {
+	c.Assert(shiftRoutesWeight.Name, check.Equals, "shift-routes-weight")
+}
+
+func (s *S) TestShiftRoutesWeightForward(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	imageName := "tsuru/app-" + app.GetName()
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "python myapi.py",
+			"worker": "tail -f /dev/null",
+		},
+	}
+	err := saveImageCustomData(imageName, customData)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	old1 := container.Container{ID: "old-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.1", HostPort: "1234"}
+	old2 := container.Container{ID: "old-2", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.2", HostPort: "1234"}
+	new1 := container.Container{ID: "new-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.3", HostPort: "1234"}
+	new2 := container.Container{ID: "new-2", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.4", HostPort: "1234"}
+	worker := container.Container{ID: "new-3", AppName: app.GetName(), ProcessName: "worker", HostAddr: "127.0.0.5", HostPort: "1234"}
+	err = routertest.FakeRouter.AddRoutes(app.GetName(), []*url.URL{old1.Address(), old2.Address()})
+	c.Assert(err, check.IsNil)
+	buf := bytes.Buffer{}
+	args := changeUnitsPipelineArgs{
+		app:          app,
+		toRemove:     []container.Container{old1, old2},
+		provisioner:  s.p,
+		imageId:      imageName,
+		writer:       &buf,
+		trafficSteps: []int{10, 50, 100},
+	}
+	context := action.FWContext{Previous: []container.Container{new1, new2, worker}, Params: []interface{}{args}}
+	r, err := shiftRoutesWeight.Forward(context)
+	c.Assert(err, check.IsNil)
+	containers := r.([]container.Container)
+	c.Assert(containers, check.HasLen, 3)
+	c.Assert(containers[0].Routable, check.Equals, true)
+	c.Assert(containers[1].Routable, check.Equals, true)
+	c.Assert(containers[2].Routable, check.Equals, false)
+	c.Assert(args.toRemove[0].Routable, check.Equals, true)
+	c.Assert(args.toRemove[1].Routable, check.Equals, true)
+	o1, o2, n1, n2 := old1.Address().String(), old2.Address().String(), new1.Address().String(), new2.Address().String()
+	c.Assert(routertest.FakeRouter.WeightHistory(app.GetName()), check.DeepEquals, []map[string]int{
+		{o1: 180, o2: 180, n1: 20, n2: 20},
+		{o1: 100, o2: 100, n1: 100, n2: 100},
+		{n1: 200, n2: 200},
+	})
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), o1), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), n1), check.Equals, true)
+	c.Assert(buf.String(), check.Matches, `(?s).*Sending 10% of traffic to new units.*Sending 100% of traffic to new units.*`)
+}
+
+func (s *S) TestShiftRoutesWeightForwardFailureRestoresOldRoutes(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	imageName := "tsuru/app-" + app.GetName()
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web": "python myapi.py",
+		},
+	}
+	err := saveImageCustomData(imageName, customData)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	old1 := container.Container{ID: "old-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.1", HostPort: "1234"}
+	new1 := container.Container{ID: "new-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.2", HostPort: "1234"}
+	new2 := container.Container{ID: "new-2", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.3", HostPort: "1234"}
+	err = routertest.FakeRouter.AddRoute(app.GetName(), old1.Address())
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.FailForIp(new2.Address().String())
+	defer routertest.FakeRouter.RemoveFailForIp(new2.Address().String())
+	args := changeUnitsPipelineArgs{
+		app:          app,
+		toRemove:     []container.Container{old1},
+		provisioner:  s.p,
+		imageId:      imageName,
+		trafficSteps: []int{100},
+	}
+	context := action.FWContext{Previous: []container.Container{new1, new2}, Params: []interface{}{args}}
+	_, err = shiftRoutesWeight.Forward(context)
+	c.Assert(err, check.Equals, routertest.ErrForcedFailure)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), old1.Address().String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), new1.Address().String()), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), new2.Address().String()), check.Equals, false)
+}
+
+func (s *S) TestShiftRoutesWeightBackward(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	routertest.FakeRouter.AddBackend(app.GetName())
+	defer routertest.FakeRouter.RemoveBackend(app.GetName())
+	old1 := container.Container{ID: "old-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.1", HostPort: "1234", Routable: true}
+	new1 := container.Container{ID: "new-1", AppName: app.GetName(), ProcessName: "web", HostAddr: "127.0.0.2", HostPort: "1234", Routable: true}
+	err := routertest.FakeRouter.AddRoute(app.GetName(), new1.Address())
+	c.Assert(err, check.IsNil)
+	args := changeUnitsPipelineArgs{
+		app:         app,
+		toRemove:    []container.Container{old1},
+		provisioner: s.p,
+	}
+	context := action.BWContext{FWResult: []container.Container{new1}, Params: []interface{}{args}}
+	shiftRoutesWeight.Backward(context)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), old1.Address().String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(app.GetName(), new1.Address().String()), check.Equals, false)
+}
+
+func (s *S) TestStepWeightedRoutes(c *check.C) {
+	old1, _ := url.Parse("http://10.0.0.1:8080")
+	new1, _ := url.Parse("http://10.0.0.2:8080")
+	new2, _ := url.Parse("http://10.0.0.3:8080")
+	routes := stepWeightedRoutes([]*url.URL{old1}, []*url.URL{new1, new2}, 10)
+	c.Assert(routes, check.DeepEquals, []router.WeightedRoute{
+		{Address: old1, Weight: 180},
+		{Address: new1, Weight: 10},
+		{Address: new2, Weight: 10},
+	})
+	routes = stepWeightedRoutes(nil, []*url.URL{new1}, 10)
+	c.Assert(routes, check.DeepEquals, []router.WeightedRoute{
+		{Address: new1, Weight: 1},
+	})
+	routes = stepWeightedRoutes([]*url.URL{old1}, nil, 100)
+	c.Assert(routes, check.DeepEquals, []router.WeightedRoute{
+		{Address: old1, Weight: 0},
+	})
+}
+
 func (s *S) TestProvisionRemoveOldUnitsName(c *check.C) {
 	c.Assert(provisionRemoveOldUnits.Name, check.Equals, "provision-remove-old-units")
 }
@@ -454,8 +454,9 @@ func canRemoveNode(chosenNode *cluster.Node, nodes []*cluster.Node) (bool, error
 func cleanMetadata(n *cluster.Node) map[string]string {
 	// iaas-id is ignored because it wasn't created in previous tsuru versions
 	// and having nodes with and without it would cause unbalanced metadata
-	// errors.
-	ignoredMetadata := []string{"iaas-id"}
+	// errors. cordoned is a transient state of the node, set during
+	// maintenance.
+	ignoredMetadata := []string{"iaas-id", cordonedMetadata}
 	metadata := n.CleanMetadata()
 	for _, val := range ignoredMetadata {
 		delete(metadata, val)
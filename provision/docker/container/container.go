@@ -17,6 +17,7 @@ import (
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/net"
@@ -139,8 +140,12 @@ func (c *Container) Create(args *CreateArgs) error {
 		CPUShares:    int64(args.App.GetCpuShare()),
 		SecurityOpts: securityOpts,
 		User:         user,
+		Labels:       args.App.GetLabels(),
+	}
+	err = c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
+	if err != nil {
+		return err
 	}
-	c.addEnvsToConfig(args, strings.TrimSuffix(c.ExposedPort, "/tcp"), &conf)
 	opts := docker.CreateContainerOptions{Name: c.Name, Config: &conf}
 	var nodeList []string
 	if len(args.DestinationHosts) > 0 {
@@ -183,11 +188,49 @@ func (c *Container) hostToNodeAddress(p DockerProvisioner, host string) (string,
 	return "", fmt.Errorf("Host `%s` not found", host)
 }
 
-func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) {
+// AppEnvs returns the environment variables of the app in the format used by
+// docker, decrypting the values of secret variables.
+func AppEnvs(app provision.App) ([]string, error) {
+	var envs []string
+	for _, envData := range app.Envs() {
+		value := envData.Value
+		if envData.Secret {
+			var err error
+			value, err = secret.Decrypt(value)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decrypt env %s: %s", envData.Name, err)
+			}
+		}
+		envs = append(envs, fmt.Sprintf("%s=%s", envData.Name, value))
+	}
+	return envs, nil
+}
+
+// SecretValues returns the decrypted values of the secret environment
+// variables of the app, so they can be masked in the output of commands.
+func SecretValues(app provision.App) []string {
+	var values []string
+	for _, envData := range app.Envs() {
+		if !envData.Secret {
+			continue
+		}
+		value, err := secret.Decrypt(envData.Value)
+		if err != nil {
+			log.Errorf("unable to decrypt env %s of app %s: %s", envData.Name, app.GetName(), err)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.Config) error {
 	if !args.Deploy {
-		for _, envData := range args.App.Envs() {
-			cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", envData.Name, envData.Value))
+		envs, err := AppEnvs(args.App)
+		if err != nil {
+			return err
 		}
+		cfg.Env = append(cfg.Env, envs...)
 		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s", "TSURU_PROCESSNAME", c.ProcessName))
 	}
 	host, _ := config.GetString("host")
@@ -204,6 +247,7 @@ func (c *Container) addEnvsToConfig(args *CreateArgs, port string, cfg *docker.C
 		}
 		cfg.Env = append(cfg.Env, fmt.Sprintf("TSURU_SHAREDFS_MOUNTPOINT=%s", sharedMount))
 	}
+	return nil
 }
 
 func (c *Container) user() string {
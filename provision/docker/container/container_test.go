@@ -6,6 +6,7 @@ package container
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,6 +25,7 @@ import (
 	"github.com/tsuru/docker-cluster/cluster"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
@@ -84,6 +86,7 @@ func (s *S) TestContainerCreate(c *check.C) {
 	app.CpuShare = 50
 	app.SetEnv(bind.EnvVar{Name: "A", Value: "myenva"})
 	app.SetEnv(bind.EnvVar{Name: "ABCD", Value: "other env"})
+	app.Labels = map[string]string{"tier": "frontend"}
 	routertest.FakeRouter.AddBackend(app.GetName())
 	defer routertest.FakeRouter.RemoveBackend(app.GetName())
 	img := "tsuru/brainfuck:latest"
@@ -117,6 +120,7 @@ func (s *S) TestContainerCreate(c *check.C) {
 	c.Assert(container.Args, check.DeepEquals, []string{"run"})
 	c.Assert(container.Config.Memory, check.Equals, app.Memory)
 	c.Assert(container.Config.MemorySwap, check.Equals, app.Memory+app.Swap)
+	c.Assert(container.Config.Labels, check.DeepEquals, map[string]string{"tier": "frontend"})
 	c.Assert(container.Config.CPUShares, check.Equals, int64(app.CpuShare))
 	sort.Strings(container.Config.Env)
 	c.Assert(container.Config.Env, check.DeepEquals, []string{
@@ -967,3 +971,22 @@ func (s *S) TestContainerValidAddr(c *check.C) {
 	c.Assert((&Container{HostAddr: "1.1.1.1", HostPort: "0"}).ValidAddr(), check.Equals, false)
 	c.Assert((&Container{HostAddr: "1.1.1.1", HostPort: "123"}).ValidAddr(), check.Equals, true)
 }
+
+func (s *S) TestAppEnvsDecryptsSecrets(c *check.C) {
+	config.Set("secrets:current-key", "key1")
+	config.Set("secrets:keys:key1", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("a"), 32)))
+	defer config.Unset("secrets")
+	value, err := secret.Encrypt("s3cr3t")
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.SetEnv(bind.EnvVar{Name: "API_TOKEN", Value: value, Secret: true})
+	a.SetEnv(bind.EnvVar{Name: "HOST", Value: "localhost", Public: true})
+	envs, err := AppEnvs(a)
+	c.Assert(err, check.IsNil)
+	sort.Strings(envs)
+	c.Assert(envs, check.DeepEquals, []string{"API_TOKEN=s3cr3t", "HOST=localhost"})
+	c.Assert(SecretValues(a), check.DeepEquals, []string{"s3cr3t"})
+	a.SetEnv(bind.EnvVar{Name: "API_TOKEN", Value: "not-encrypted", Secret: true})
+	_, err = AppEnvs(a)
+	c.Assert(err, check.ErrorMatches, "unable to decrypt env API_TOKEN: invalid encrypted value")
+}
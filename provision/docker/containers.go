@@ -13,6 +13,7 @@ import (
 	"math"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/tsuru/action"
@@ -22,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/router"
 )
 
 type appLocker struct {
@@ -119,6 +121,53 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 	return pipeline.Result().([]container.Container), nil
 }
 
+// runWeightedReplaceUnitsPipeline replaces the units of the app keeping the
+// old ones alive while the traffic is moved to the new units according to the
+// deploy strategy. Routers without support for weighted routes fall back to
+// the regular replacement.
+func (p *dockerProvisioner) runWeightedReplaceUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, toRemoveContainers []container.Container, imageId string, deploy provision.TsuruYamlDeploy) ([]container.Container, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	steps, err := deploy.TrafficSteps()
+	if err != nil {
+		return nil, err
+	}
+	r, err := getRouterForApp(a)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := r.(router.WeightedRouter); !ok {
+		fmt.Fprintf(w, "\n---- WARNING: router does not support weighted routes, ignoring %q deploy strategy ----\n", deploy.Strategy)
+		return p.runReplaceUnitsPipeline(w, a, toAdd, toRemoveContainers, imageId)
+	}
+	args := changeUnitsPipelineArgs{
+		app:          a,
+		toAdd:        toAdd,
+		toRemove:     toRemoveContainers,
+		writer:       w,
+		imageId:      imageId,
+		provisioner:  p,
+		trafficSteps: steps,
+		stepInterval: time.Duration(deploy.StepInterval) * time.Second,
+	}
+	pipeline := action.NewPipeline(
+		&provisionAddUnitsToHost,
+		&bindAndHealthcheck,
+		&shiftRoutesWeight,
+		&setRouterHealthcheck,
+		&removeOldRoutes,
+		&updateAppImage,
+		&provisionRemoveOldUnits,
+		&provisionUnbindOldUnits,
+	)
+	err = pipeline.Execute(args)
+	if err != nil {
+		return nil, err
+	}
+	return pipeline.Result().([]container.Container), nil
+}
+
 func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App, toAdd map[string]*containersToAdd, imageId, exposedPort string) ([]container.Container, error) {
 	if w == nil {
 		w = ioutil.Discard
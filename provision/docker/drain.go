@@ -0,0 +1,229 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// cordonedMetadata is the node metadata set in cordoned nodes, which are not
+// used by the scheduler for new units.
+const cordonedMetadata = "cordoned"
+
+func isCordoned(node cluster.Node) bool {
+	return node.Metadata[cordonedMetadata] == "true"
+}
+
+// setNodeCordon marks the node as cordoned, or uncordoned, keeping its
+// existing units running.
+func (p *dockerProvisioner) setNodeCordon(address string, cordoned bool) error {
+	value := ""
+	if cordoned {
+		value = "true"
+	}
+	_, err := p.Cluster().UpdateNode(cluster.Node{
+		Address:  address,
+		Metadata: map[string]string{cordonedMetadata: value},
+	})
+	return err
+}
+
+func (s *segregatedScheduler) filterCordoned(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	nodeList := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if isCordoned(node) {
+			ctx.reject(node, "node is cordoned")
+			continue
+		}
+		nodeList = append(nodeList, node)
+	}
+	if len(nodeList) == 0 {
+		return nil, fmt.Errorf("no uncordoned nodes found for container of %q", ctx.app.Name)
+	}
+	return nodeList, nil
+}
+
+type drainOptions struct {
+	// MaxConcurrency is the maximum number of units moved at the same time.
+	MaxConcurrency int
+	// MinAvailable is the number of units of each process of each app that
+	// are kept untouched while other units of the process are moved.
+	MinAvailable int
+	// AppMinAvailable overrides MinAvailable for the named apps.
+	AppMinAvailable map[string]int
+	// Force moves units of processes without more units than their minimum
+	// available, one unit at a time. Otherwise these units are not moved.
+	Force bool
+}
+
+func (o *drainOptions) minAvailable(appName string) int {
+	if value, ok := o.AppMinAvailable[appName]; ok {
+		return value
+	}
+	return o.MinAvailable
+}
+
+// syncWriter serializes writes from the concurrent moves of a drain to the
+// event log.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(data)
+}
+
+type drainResult struct {
+	cont container.Container
+	err  error
+}
+
+func processKey(c container.Container) string {
+	return c.AppName + "/" + c.ProcessName
+}
+
+// drainNode cordons the node and moves all its units to other nodes, chosen
+// by the scheduler. Each unit is replaced by a new one that must pass the
+// healthcheck of the app before the old unit is removed. The progress is
+// recorded in an event with the node as target, owned by owner.
+func (p *dockerProvisioner) drainNode(address string, opts drainOptions, owner string, writer io.Writer) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "node", Value: address},
+		Kind:   permission.PermNodeUpdateDrain,
+		Owner:  owner,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	evt.SetLogWriter(writer)
+	logWriter := &syncWriter{w: evt}
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = 1
+	}
+	err = p.setNodeCordon(address, true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(logWriter, "Node %s cordoned.\n", address)
+	containers, err := p.listContainersByHost(net.URLToHost(address))
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		fmt.Fprintf(logWriter, "No units to move in %s.\n", address)
+		return nil
+	}
+	limits, err := p.drainLimits(containers, opts)
+	if err != nil {
+		return err
+	}
+	var pending, skipped []container.Container
+	for _, c := range containers {
+		if limits[processKey(c)] > 0 {
+			pending = append(pending, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for _, c := range skipped {
+		fmt.Fprintf(logWriter, "Skipping unit %s of %s, the process doesn't have more units than the minimum available of %q (%d).\n",
+			c.ID, processKey(c), c.AppName, opts.minAvailable(c.AppName))
+	}
+	total := len(pending)
+	fmt.Fprintf(logWriter, "Moving %d units from %s, at most %d at a time...\n", total, address, opts.MaxConcurrency)
+	locker := &appLocker{}
+	results := make(chan drainResult)
+	moving := make(map[string]int)
+	var running, moved, failed int
+	for len(pending) > 0 || running > 0 {
+		for i := 0; i < len(pending) && running < opts.MaxConcurrency; {
+			c := pending[i]
+			if moving[processKey(c)] >= limits[processKey(c)] {
+				i++
+				continue
+			}
+			pending = append(pending[:i], pending[i+1:]...)
+			moving[processKey(c)]++
+			running++
+			go func(c container.Container) {
+				moveErrors := make(chan error, 1)
+				p.MoveOneContainer(c, "", moveErrors, nil, logWriter, locker)
+				close(moveErrors)
+				results <- drainResult{cont: c, err: <-moveErrors}
+			}(c)
+		}
+		result := <-results
+		running--
+		moving[processKey(result.cont)]--
+		if result.err != nil {
+			failed++
+			fmt.Fprintf(logWriter, "Error moving unit %s of %q: %s\n", result.cont.ID, result.cont.AppName, result.err)
+		} else {
+			moved++
+		}
+		fmt.Fprintf(logWriter, "Progress: %d/%d units moved, %d failed.\n", moved, total, failed)
+	}
+	if failed > 0 {
+		err = fmt.Errorf("unable to move %d units from %s, the node is still cordoned", failed, address)
+		return err
+	}
+	if len(skipped) > 0 {
+		err = fmt.Errorf("%d units not moved from %s to keep the minimum available units of their apps, the node is still cordoned", len(skipped), address)
+		return err
+	}
+	fmt.Fprintf(logWriter, "Node %s drained.\n", address)
+	return nil
+}
+
+// drainLimits returns the maximum number of units of each process of each app
+// that may be moved at the same time, keeping at least the minimum available
+// units of the app untouched. The limit of processes without more units than
+// the minimum available is zero, their units are not moved, unless the drain
+// is forced, which moves them one unit at a time.
+func (p *dockerProvisioner) drainLimits(containers []container.Container, opts drainOptions) (map[string]int, error) {
+	appSet := make(map[string]bool)
+	var appNames []string
+	for _, c := range containers {
+		if !appSet[c.AppName] {
+			appSet[c.AppName] = true
+			appNames = append(appNames, c.AppName)
+		}
+	}
+	appContainers, err := p.ListContainers(bson.M{"appname": bson.M{"$in": appNames}})
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]int)
+	appNameByKey := make(map[string]string)
+	for _, c := range appContainers {
+		totals[processKey(c)]++
+		appNameByKey[processKey(c)] = c.AppName
+	}
+	limits := make(map[string]int, len(totals))
+	for key, total := range totals {
+		limit := total - opts.minAvailable(appNameByKey[key])
+		if limit < 1 && opts.Force {
+			limit = 1
+		}
+		if limit < 0 {
+			limit = 0
+		}
+		limits[key] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetNodeCordon(c *check.C) {
+	sched := segregatedScheduler{provisioner: s.p}
+	clusterInstance, url1, _, stop := s.startPoolNodes(c, &sched, map[string]string{}, map[string]string{})
+	defer stop()
+	err := s.p.setNodeCordon(url1, true)
+	c.Assert(err, check.IsNil)
+	node, err := clusterInstance.GetNode(url1)
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, true)
+	c.Assert(node.Metadata["pool"], check.Equals, "mypool")
+	err = s.p.setNodeCordon(url1, false)
+	c.Assert(err, check.IsNil)
+	node, err = clusterInstance.GetNode(url1)
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, false)
+	_, ok := node.Metadata[cordonedMetadata]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSchedulerScheduleCordoned(c *check.C) {
+	a := app.App{Name: "skyrim", Pool: "mypool"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	clusterInstance, url1, url2, stop := s.startPoolNodes(c, &sched,
+		map[string]string{cordonedMetadata: "true"}, map[string]string{})
+	defer stop()
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	for i := 0; i < 3; i++ {
+		cont := container.Container{ID: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("unit%d", i), AppName: a.Name}
+		err = contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{Name: cont.Name}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+		c.Assert(err, check.IsNil)
+		c.Assert(node.Address, check.Equals, url2)
+	}
+	err = s.p.setNodeCordon(url2, true)
+	c.Assert(err, check.IsNil)
+	_, err = sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*no uncordoned nodes found for container of "skyrim".*`)
+	explanation, err := sched.explain(&a, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation.Nodes, check.HasLen, 2)
+	for _, n := range explanation.Nodes {
+		c.Assert(n.Accepted, check.Equals, false)
+		c.Assert(n.Reason, check.Equals, "node is cordoned")
+	}
+	err = s.p.setNodeCordon(url1, false)
+	c.Assert(err, check.IsNil)
+	node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, url1)
+}
+
+func (s *S) TestDrainNode(c *check.C) {
+	sched := segregatedScheduler{provisioner: s.p}
+	_, url1, url2, stop := s.startPoolNodes(c, &sched, map[string]string{}, map[string]string{})
+	defer stop()
+	err := s.newFakeImage(s.p, "tsuru/app-myapp", nil)
+	c.Assert(err, check.IsNil)
+	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
+	defer s.p.Destroy(appInstance)
+	s.p.Provision(appInstance)
+	err = s.storage.Apps().Insert(&app.App{Name: appInstance.GetName(), Pool: "mypool"})
+	c.Assert(err, check.IsNil)
+	imageId, err := appCurrentImageName(appInstance.GetName())
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toHost:      net.URLToHost(url2),
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 3}},
+		app:         appInstance,
+		imageId:     imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	err = s.p.drainNode(url2, drainOptions{MaxConcurrency: 2, MinAvailable: 2}, "me@tsuru.io", buf)
+	c.Assert(err, check.IsNil)
+	containers, err := s.p.listContainersByHost(net.URLToHost(url2))
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+	containers, err = s.p.listContainersByHost(net.URLToHost(url1))
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 3)
+	node, err := s.p.Cluster().GetNode(url2)
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, true)
+	c.Assert(buf.String(), check.Matches, `(?s).*Moving 3 units from .*, at most 2 at a time.*Progress: 1/3 units moved, 0 failed.*Progress: 2/3 units moved, 0 failed.*Progress: 3/3 units moved, 0 failed.*`)
+	c.Assert(eventtest.EventDesc{
+		Target:     event.Target{Name: "node", Value: url2},
+		Kind:       "node.update.drain",
+		Owner:      "me@tsuru.io",
+		LogMatches: `(?s).*Node .* drained.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestDrainNodeWithoutUnits(c *check.C) {
+	sched := segregatedScheduler{provisioner: s.p}
+	_, url1, _, stop := s.startPoolNodes(c, &sched, map[string]string{}, map[string]string{})
+	defer stop()
+	buf := safe.NewBuffer(nil)
+	err := s.p.drainNode(url1, drainOptions{}, "me@tsuru.io", buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Matches, `(?s).*No units to move in .*`)
+	node, err := s.p.Cluster().GetNode(url1)
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, true)
+}
+
+func (s *S) TestDrainLimits(c *check.C) {
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	var onNode []container.Container
+	for i, process := range []string{"web", "web", "web", "web", "worker"} {
+		cont := container.Container{ID: fmt.Sprintf("id%d", i), AppName: "skyrim", ProcessName: process, HostAddr: "host1"}
+		err := contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		if i%2 == 0 {
+			onNode = append(onNode, cont)
+		}
+	}
+	limits, err := s.p.drainLimits(onNode, drainOptions{MinAvailable: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, map[string]int{"skyrim/web": 3, "skyrim/worker": 0})
+	limits, err = s.p.drainLimits(onNode, drainOptions{MinAvailable: 1, AppMinAvailable: map[string]int{"skyrim": 4}})
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, map[string]int{"skyrim/web": 0, "skyrim/worker": 0})
+	limits, err = s.p.drainLimits(onNode, drainOptions{MinAvailable: 4, AppMinAvailable: map[string]int{"other": 0}, Force: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, map[string]int{"skyrim/web": 1, "skyrim/worker": 1})
+	limits, err = s.p.drainLimits(onNode, drainOptions{MinAvailable: 4, AppMinAvailable: map[string]int{"skyrim": 0}})
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, map[string]int{"skyrim/web": 4, "skyrim/worker": 1})
+}
+
+func (s *S) TestDrainNodeSkipsProcessesWithoutEnoughUnits(c *check.C) {
+	sched := segregatedScheduler{provisioner: s.p}
+	_, url1, url2, stop := s.startPoolNodes(c, &sched, map[string]string{}, map[string]string{})
+	defer stop()
+	err := s.newFakeImage(s.p, "tsuru/app-myapp", nil)
+	c.Assert(err, check.IsNil)
+	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
+	defer s.p.Destroy(appInstance)
+	s.p.Provision(appInstance)
+	err = s.storage.Apps().Insert(&app.App{Name: appInstance.GetName(), Pool: "mypool"})
+	c.Assert(err, check.IsNil)
+	imageId, err := appCurrentImageName(appInstance.GetName())
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toHost:      net.URLToHost(url2),
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 2}},
+		app:         appInstance,
+		imageId:     imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	opts := drainOptions{MinAvailable: 1, AppMinAvailable: map[string]int{"myapp": 2}}
+	err = s.p.drainNode(url2, opts, "me@tsuru.io", buf)
+	c.Assert(err, check.ErrorMatches, `2 units not moved from .* to keep the minimum available units of their apps, the node is still cordoned`)
+	c.Assert(buf.String(), check.Matches, `(?s).*Skipping unit .* of myapp/web, the process doesn't have more units than the minimum available of "myapp" \(2\).*Moving 0 units from .*`)
+	containers, err := s.p.listContainersByHost(net.URLToHost(url2))
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+	opts.Force = true
+	err = s.p.drainNode(url2, opts, "me@tsuru.io", buf)
+	c.Assert(err, check.IsNil)
+	containers, err = s.p.listContainersByHost(net.URLToHost(url1))
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 2)
+}
@@ -27,6 +27,7 @@ import (
 	_ "github.com/tsuru/tsuru/iaas/cloudstack"
 	_ "github.com/tsuru/tsuru/iaas/digitalocean"
 	_ "github.com/tsuru/tsuru/iaas/ec2"
+	_ "github.com/tsuru/tsuru/iaas/plugin"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
@@ -44,6 +45,9 @@ func init() {
 	api.RegisterHandler("/docker/node", "POST", api.AuthorizationRequiredHandler(addNodeHandler))
 	api.RegisterHandler("/docker/node", "PUT", api.AuthorizationRequiredHandler(updateNodeHandler))
 	api.RegisterHandler("/docker/node/{address:.*}", "DELETE", api.AuthorizationRequiredHandler(removeNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/cordon", "POST", api.AuthorizationRequiredHandler(cordonNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/uncordon", "POST", api.AuthorizationRequiredHandler(uncordonNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/drain", "POST", api.AuthorizationRequiredHandler(drainNodeHandler))
 	api.RegisterHandler("/docker/container/{id}/move", "POST", api.AuthorizationRequiredHandler(moveContainerHandler))
 	api.RegisterHandler("/docker/containers/move", "POST", api.AuthorizationRequiredHandler(moveContainersHandler))
 	api.RegisterHandler("/docker/containers/rebalance", "POST", api.AuthorizationRequiredHandler(rebalanceContainersHandler))
@@ -69,6 +73,10 @@ func init() {
 	api.RegisterHandler("/docker/nodecontainers/{name}/upgrade", "POST", api.AuthorizationRequiredHandler(nodeContainerUpgrade))
 	api.RegisterHandler("/docker/logs", "GET", api.AuthorizationRequiredHandler(logsConfigGetHandler))
 	api.RegisterHandler("/docker/logs", "POST", api.AuthorizationRequiredHandler(logsConfigSetHandler))
+	api.RegisterHandler("/docker/scheduler/config", "GET", api.AuthorizationRequiredHandler(schedulerConfigGet))
+	api.RegisterHandler("/docker/scheduler/config", "POST", api.AuthorizationRequiredHandler(schedulerConfigUpdate))
+	api.RegisterHandler("/docker/scheduler/config", "DELETE", api.AuthorizationRequiredHandler(schedulerConfigDelete))
+	api.RegisterHandler("/docker/scheduler/explain", "GET", api.AuthorizationRequiredHandler(schedulerExplain))
 }
 
 // title: get autoscale config
@@ -223,6 +231,7 @@ type addNodeOptions struct {
 // produce: application/x-json-stream
 // responses:
 //   201: Ok
+//   400: Invalid data
 //   401: Unauthorized
 //   404: Not found
 func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
@@ -237,7 +246,8 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
-	if templateName, ok := params.Metadata["template"]; ok {
+	templateName, hasTemplate := params.Metadata["template"]
+	if hasTemplate {
 		params.Metadata, err = iaas.ExpandTemplate(templateName)
 		if err != nil {
 			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
@@ -257,6 +267,16 @@ func addNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error
 		if !canCreateMachine {
 			return permission.ErrUnauthorized
 		}
+		// Machines are created only with the params of the template, when
+		// there's one, so the template is validated as a whole.
+		machineParams := params.Metadata
+		if hasTemplate {
+			machineParams = map[string]string{"template": templateName}
+		}
+		err = iaas.ValidateMachineParams(params.Metadata["iaas"], machineParams)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
 	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
@@ -1283,3 +1303,249 @@ func nodeContainerUpgrade(w http.ResponseWriter, r *http.Request, t auth.Token)
 	}
 	return nil
 }
+
+func checkPoolPermission(t auth.Token, scheme *permission.PermissionScheme, pool string) error {
+	if pool == "" {
+		if !permission.Check(t, scheme) {
+			return permission.ErrUnauthorized
+		}
+		return nil
+	}
+	if !permission.Check(t, scheme, permission.Context(permission.CtxPool, pool)) {
+		return permission.ErrUnauthorized
+	}
+	return nil
+}
+
+// title: scheduler config
+// path: /docker/scheduler/config
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   401: Unauthorized
+func schedulerConfigGet(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pools, err := listContextValues(t, permission.PermNodeRead, true)
+	if err != nil {
+		return err
+	}
+	configMap, err := loadAllSchedulerConfig()
+	if err != nil {
+		return err
+	}
+	if len(pools) > 0 {
+		allowedPoolSet := map[string]struct{}{}
+		for _, p := range pools {
+			allowedPoolSet[p] = struct{}{}
+		}
+		for k := range configMap {
+			if k == "" {
+				continue
+			}
+			if _, ok := allowedPoolSet[k]; !ok {
+				delete(configMap, k)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(configMap)
+}
+
+// title: scheduler config update
+// path: /docker/scheduler/config
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+func schedulerConfigUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	poolName := r.FormValue("pool")
+	err = checkPoolPermission(t, permission.PermNodeUpdate, poolName)
+	if err != nil {
+		return err
+	}
+	scorers := r.Form["Scorers"]
+	delete(r.Form, "pool")
+	delete(r.Form, "Scorers")
+	var conf SchedulerConfig
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&conf, r.Form)
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("unable to parse fields in scheduler config: %s", err),
+		}
+	}
+	conf.Scorers = scorers
+	err = updateSchedulerConfig(poolName, conf)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+// title: remove scheduler config
+// path: /docker/scheduler/config
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+func schedulerConfigDelete(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	poolName := r.URL.Query().Get("pool")
+	err := checkPoolPermission(t, permission.PermNodeUpdate, poolName)
+	if err != nil {
+		return err
+	}
+	if len(r.URL.Query()["name"]) == 0 {
+		return removeSchedulerConfig(poolName, "")
+	}
+	for _, v := range r.URL.Query()["name"] {
+		err := removeSchedulerConfig(poolName, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// title: scheduler explain
+// path: /docker/scheduler/explain
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func schedulerExplain(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get("app")
+	if appName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "app is required"}
+	}
+	a, err := app.GetByName(appName)
+	if err == app.ErrAppNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	err = checkPoolPermission(t, permission.PermNodeRead, a.Pool)
+	if err != nil {
+		return err
+	}
+	explanation, err := mainDockerProvisioner.scheduler.explain(a, r.URL.Query().Get("process"))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(explanation)
+}
+
+func nodeForUpdate(address string, t auth.Token, scheme *permission.PermissionScheme) (*cluster.Node, error) {
+	node, err := mainDockerProvisioner.Cluster().GetNode(address)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	err = checkPoolPermission(t, scheme, node.Metadata["pool"])
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// title: cordon node
+// path: /docker/node/{address}/cordon
+// method: POST
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Node not found
+func cordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	node, err := nodeForUpdate(r.URL.Query().Get(":address"), t, permission.PermNodeUpdateCordon)
+	if err != nil {
+		return err
+	}
+	return mainDockerProvisioner.setNodeCordon(node.Address, true)
+}
+
+// title: uncordon node
+// path: /docker/node/{address}/uncordon
+// method: POST
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Node not found
+func uncordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	node, err := nodeForUpdate(r.URL.Query().Get(":address"), t, permission.PermNodeUpdateCordon)
+	if err != nil {
+		return err
+	}
+	return mainDockerProvisioner.setNodeCordon(node.Address, false)
+}
+
+// title: drain node
+// path: /docker/node/{address}/drain
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Node not found
+func drainNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	opts := drainOptions{MaxConcurrency: 1, MinAvailable: 1}
+	for name, value := range map[string]*int{"max-concurrency": &opts.MaxConcurrency, "min-available": &opts.MinAvailable} {
+		rawValue := r.FormValue(name)
+		if rawValue == "" {
+			continue
+		}
+		*value, err = strconv.Atoi(rawValue)
+		if err != nil || *value < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid %s: %q", name, rawValue)}
+		}
+	}
+	for _, rawValue := range r.Form["app-min-available"] {
+		parts := strings.SplitN(rawValue, "=", 2)
+		var value int
+		if len(parts) == 2 {
+			value, err = strconv.Atoi(parts[1])
+		}
+		if len(parts) != 2 || parts[0] == "" || err != nil || value < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid app-min-available: %q", rawValue)}
+		}
+		if opts.AppMinAvailable == nil {
+			opts.AppMinAvailable = make(map[string]int)
+		}
+		opts.AppMinAvailable[parts[0]] = value
+	}
+	if rawValue := r.FormValue("force"); rawValue != "" {
+		opts.Force, err = strconv.ParseBool(rawValue)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("invalid force: %q", rawValue)}
+		}
+	}
+	node, err := nodeForUpdate(r.URL.Query().Get(":address"), t, permission.PermNodeUpdateDrain)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = mainDockerProvisioner.drainNode(node.Address, opts, t.GetUserName(), writer)
+	if err != nil {
+		fmt.Fprintf(writer, "Error trying to drain node: %s\n", err.Error())
+	}
+	return nil
+}
@@ -31,6 +31,8 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	tsuruNet "github.com/tsuru/tsuru/net"
@@ -310,6 +312,41 @@ func (s *HandlersSuite) TestAddNodeHandlerCreatingAnIaasMachineExplicit(c *check
 	})
 }
 
+func (s *HandlersSuite) TestAddNodeHandlerInvalidTemplateParams(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{})
+	tpl := iaas.Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Data: iaas.TemplateDataList{
+			{Name: "id", Value: "test1"},
+			{Name: "pool", Value: "pool1"},
+		},
+		Params: []iaas.ParamSpec{{Name: "zone", Required: true}},
+	}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("tpl1")
+	params := addNodeOptions{
+		Register: false,
+		Metadata: map[string]string{"template": "tpl1"},
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/docker/node", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := api.RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Equals, "invalid params for IaaS \"test-iaas\": param \"zone\" is required\n")
+	nodes, err := mainDockerProvisioner.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 0)
+}
+
 func (s *HandlersSuite) TestAddNodeHandlerWithoutCluster(c *check.C) {
 	server, waitQueue := s.startFakeDockerNode(c)
 	defer server.Stop()
@@ -2558,3 +2595,214 @@ func (s *HandlersSuite) TestNodeContainerUpgradeNotFound(c *check.C) {
 	server.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 }
+
+func (s *HandlersSuite) TestSchedulerConfigUpdateRead(c *check.C) {
+	doRequest := func(method, path, body string, code int) map[string]SchedulerConfig {
+		request, err := http.NewRequest(method, path, strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		server := api.RunServer(true)
+		server.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, code, check.Commentf("body: %s", recorder.Body.String()))
+		request, err = http.NewRequest("GET", "/docker/scheduler/config", nil)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder = httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusOK)
+		var configMap map[string]SchedulerConfig
+		err = json.Unmarshal(recorder.Body.Bytes(), &configMap)
+		c.Assert(err, check.IsNil)
+		return configMap
+	}
+	configMap := doRequest("POST", "/docker/scheduler/config", "AntiAffinityKey=zone&Scorers=anti-affinity&Scorers=containers", http.StatusOK)
+	c.Assert(configMap, check.DeepEquals, map[string]SchedulerConfig{
+		"": {AntiAffinityKey: stringPtr("zone"), Scorers: []string{"anti-affinity", "containers"}},
+	})
+	configMap = doRequest("POST", "/docker/scheduler/config", "pool=p1&AntiAffinityHard=true&CPUShareMetadata=cpuShares", http.StatusOK)
+	c.Assert(configMap, check.DeepEquals, map[string]SchedulerConfig{
+		"": {AntiAffinityKey: stringPtr("zone"), Scorers: []string{"anti-affinity", "containers"}},
+		"p1": {
+			AntiAffinityKey:           stringPtr("zone"),
+			AntiAffinityHard:          boolPtr(true),
+			CPUShareMetadata:          stringPtr("cpuShares"),
+			Scorers:                   []string{"anti-affinity", "containers"},
+			AntiAffinityKeyInherited:  true,
+			ScorersInherited:          true,
+			MaxCPUShareRatioInherited: true,
+		},
+	})
+	doRequest("POST", "/docker/scheduler/config", "Scorers=random", http.StatusBadRequest)
+	configMap = doRequest("DELETE", "/docker/scheduler/config?pool=p1&name=CPUShareMetadata", "", http.StatusOK)
+	c.Assert(configMap["p1"].CPUShareMetadata, check.IsNil)
+	c.Assert(configMap["p1"].AntiAffinityHard, check.DeepEquals, boolPtr(true))
+	configMap = doRequest("DELETE", "/docker/scheduler/config?pool=p1", "", http.StatusOK)
+	c.Assert(configMap, check.DeepEquals, map[string]SchedulerConfig{
+		"": {AntiAffinityKey: stringPtr("zone"), Scorers: []string{"anti-affinity", "containers"}},
+	})
+}
+
+func (s *HandlersSuite) TestSchedulerConfigUpdateWithoutPermission(c *check.C) {
+	user := &auth.User{Email: "sched@groundcontrol.com", Password: "123456", Quota: quota.Unlimited}
+	_, err := nativeScheme.Create(user)
+	c.Assert(err, check.IsNil)
+	token := createTokenForUser(user, "node.update", string(permission.CtxPool), "p1", c)
+	request, err := http.NewRequest("POST", "/docker/scheduler/config", strings.NewReader("pool=p2&AntiAffinityKey=zone"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *HandlersSuite) TestSchedulerExplain(c *check.C) {
+	server, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer server.Stop()
+	err = provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	mainDockerProvisioner.cluster, err = cluster.New(mainDockerProvisioner.scheduler, &cluster.MapStorage{},
+		cluster.Node{Address: server.URL(), Metadata: map[string]string{"pool": "pool1"}},
+	)
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Pool: "pool1"}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/docker/scheduler/explain?app=myapp&process=web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var explanation schedulerExplanation
+	err = json.Unmarshal(recorder.Body.Bytes(), &explanation)
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation, check.DeepEquals, schedulerExplanation{
+		App:     "myapp",
+		Process: "web",
+		Pool:    "pool1",
+		Scorers: defaultScorers,
+		Nodes: []nodeExplanation{
+			{Address: server.URL(), Accepted: true, Scores: []int64{0, 0, 0}},
+		},
+		Chosen: server.URL(),
+	})
+}
+
+func (s *HandlersSuite) TestSchedulerExplainAppNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/docker/scheduler/explain?app=unknown", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestCordonNodeHandler(c *check.C) {
+	mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "http://localhost:2375", Metadata: map[string]string{"pool": "pool1"}})
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	node, err := mainDockerProvisioner.Cluster().GetNode("http://localhost:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Metadata, check.DeepEquals, map[string]string{"pool": "pool1", "cordoned": "true"})
+	request, err = http.NewRequest("POST", "/docker/node/http://localhost:2375/uncordon", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	node, err = mainDockerProvisioner.Cluster().GetNode("http://localhost:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Metadata, check.DeepEquals, map[string]string{"pool": "pool1"})
+}
+
+func (s *HandlersSuite) TestCordonNodeHandlerNodeNotFound(c *check.C) {
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestCordonNodeHandlerWithoutPermission(c *check.C) {
+	mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "http://localhost:2375", Metadata: map[string]string{"pool": "pool1"}})
+	user := &auth.User{Email: "cordon@groundcontrol.com", Password: "123456", Quota: quota.Unlimited}
+	_, err := nativeScheme.Create(user)
+	c.Assert(err, check.IsNil)
+	token := createTokenForUser(user, "node.update.cordon", string(permission.CtxPool), "pool2", c)
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	node, err := mainDockerProvisioner.Cluster().GetNode("http://localhost:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, false)
+}
+
+func (s *HandlersSuite) TestDrainNodeHandler(c *check.C) {
+	mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "http://localhost:2375", Metadata: map[string]string{"pool": "pool1"}})
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:2375/drain", strings.NewReader("max-concurrency=2&min-available=1"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	validJson := fmt.Sprintf("[%s]", strings.Replace(strings.Trim(recorder.Body.String(), "\n "), "\n", ",", -1))
+	var result []tsuruIo.SimpleJsonMessage
+	err = json.Unmarshal([]byte(validJson), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, []tsuruIo.SimpleJsonMessage{
+		{Message: "Node http://localhost:2375 cordoned.\n"},
+		{Message: "No units to move in http://localhost:2375.\n"},
+	})
+	node, err := mainDockerProvisioner.Cluster().GetNode("http://localhost:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(isCordoned(node), check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Name: "node", Value: "http://localhost:2375"},
+		Kind:   "node.update.drain",
+		Owner:  s.token.GetUserName(),
+	}, eventtest.HasEvent)
+}
+
+func (s *HandlersSuite) TestDrainNodeHandlerInvalidParams(c *check.C) {
+	mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "http://localhost:2375", Metadata: map[string]string{"pool": "pool1"}})
+	request, err := http.NewRequest("POST", "/docker/node/http://localhost:2375/drain", strings.NewReader("max-concurrency=many"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	api.RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid max-concurrency: \"many\"\n")
+	for body, msg := range map[string]string{
+		"app-min-available=myapp":      "invalid app-min-available: \"myapp\"\n",
+		"app-min-available=myapp%3D-1": "invalid app-min-available: \"myapp=-1\"\n",
+		"force=maybe":                  "invalid force: \"maybe\"\n",
+	} {
+		request, err = http.NewRequest("POST", "/docker/node/http://localhost:2375/drain", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder = httptest.NewRecorder()
+		api.RunServer(true).ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(recorder.Body.String(), check.Equals, msg)
+	}
+}
@@ -15,9 +15,24 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 )
 
+func (p *dockerProvisioner) RunHealthcheck(app provision.App, units []provision.Unit, w io.Writer) error {
+	for _, u := range units {
+		cont, err := p.GetContainer(u.ID)
+		if err != nil {
+			return err
+		}
+		err = runHealthcheck(cont, w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func runHealthcheck(cont *container.Container, w io.Writer) error {
 	yamlData, err := getImageTsuruYamlData(cont.Image)
 	if err != nil {
@@ -0,0 +1,72 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+)
+
+// runDeployHooks runs the deploy hooks of the given stage, one at a time, in
+// new containers created from the image being deployed. It stops at the first
+// failing hook. The output of the hooks is written to w and, along with their
+// exit status, reported to w when it's a provision.DeployHookRecorder.
+func (p *dockerProvisioner) runDeployHooks(a provision.App, imageId, stage string, hooks provision.TsuruYamlDeployHooks, w io.Writer) error {
+	cmds := hooks.Pre
+	if stage == provision.DeployHookPost {
+		cmds = hooks.Post
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+	recorder, _ := w.(provision.DeployHookRecorder)
+	timeout := hooks.HookTimeout()
+	fmt.Fprintf(w, "\n---- Running %s-deploy hooks ----\n", stage)
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, " ---> Running %q\n", cmd)
+		var output bytes.Buffer
+		start := time.Now()
+		env := []string{fmt.Sprintf("TSURU_DEPLOY_HOOK=%s", stage)}
+		exitCode, err := p.runHookContainer(a, imageId, cmd, env, io.MultiWriter(w, &output), timeout)
+		if err == nil && exitCode != 0 {
+			err = fmt.Errorf("exit status %d", exitCode)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s-deploy hook %q failed: %s", stage, cmd, err)
+		}
+		if recorder != nil {
+			result := provision.DeployHookResult{
+				Stage:    stage,
+				Command:  cmd,
+				Output:   output.String(),
+				ExitCode: exitCode,
+				Duration: time.Since(start),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			recorder.RecordDeployHook(result)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *dockerProvisioner) runHookContainer(a provision.App, imageId, cmd string, env []string, w io.Writer, timeout time.Duration) (int, error) {
+	cancel := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(cancel) })
+	defer timer.Stop()
+	exitCode, err := p.runOneOffContainer(a, imageId, cmd, env, w, cancel)
+	if err == provision.ErrJobCanceled {
+		err = fmt.Errorf("timeout after %s", timeout)
+	}
+	return exitCode, err
+}
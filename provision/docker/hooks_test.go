@@ -0,0 +1,118 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+type hookRecorderBuffer struct {
+	bytes.Buffer
+	results []provision.DeployHookResult
+}
+
+func (b *hookRecorderBuffer) RecordDeployHook(result provision.DeployHookResult) {
+	b.results = append(b.results, result)
+}
+
+func (s *S) TestRunDeployHooks(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1", nil)
+	c.Assert(err, check.IsNil)
+	hooks := provision.TsuruYamlDeployHooks{Pre: []string{"./migrate.sh", "./seed.sh"}}
+	var w hookRecorderBuffer
+	err = s.p.runDeployHooks(&a, "tsuru/app-myapp:v1", provision.DeployHookPre, hooks, &w)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.String(), check.Matches, `(?s).*Running pre-deploy hooks.*"./migrate.sh".*"./seed.sh".*`)
+	c.Assert(w.results, check.HasLen, 2)
+	c.Assert(w.results[0].Stage, check.Equals, provision.DeployHookPre)
+	c.Assert(w.results[0].Command, check.Equals, "./migrate.sh")
+	c.Assert(w.results[0].ExitCode, check.Equals, 0)
+	c.Assert(w.results[0].Error, check.Equals, "")
+	c.Assert(w.results[1].Command, check.Equals, "./seed.sh")
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+	w = hookRecorderBuffer{}
+	err = s.p.runDeployHooks(&a, "tsuru/app-myapp:v1", provision.DeployHookPost, hooks, &w)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.results, check.HasLen, 0)
+}
+
+func (s *S) TestRunDeployHooksStopsOnFailure(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1", nil)
+	c.Assert(err, check.IsNil)
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+		var config docker.Config
+		if json.Unmarshal(data, &config) == nil && len(config.Cmd) > 0 && config.Cmd[0] == "./migrate.sh" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	hooks := provision.TsuruYamlDeployHooks{Pre: []string{"./migrate.sh", "./seed.sh"}}
+	var w hookRecorderBuffer
+	err = s.p.runDeployHooks(&a, "tsuru/app-myapp:v1", provision.DeployHookPre, hooks, &w)
+	c.Assert(err, check.ErrorMatches, `pre-deploy hook "./migrate.sh" failed: .*`)
+	c.Assert(w.results, check.HasLen, 1)
+	c.Assert(w.results[0].Error, check.Equals, err.Error())
+}
+
+func (s *S) TestDeployRunsHooksAfterQuotaCheck(c *check.C) {
+	a := app.App{Name: "myapp", Quota: quota.Quota{Limit: 0}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.newFakeImage(s.p, "tsuru/app-myapp:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "python myapp.py"},
+		"hooks": map[string]interface{}{
+			"deploy": map[string]interface{}{"pre": []string{"./migrate.sh"}},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	var w hookRecorderBuffer
+	err = s.p.deploy(&a, "tsuru/app-myapp:v1", true, &w)
+	c.Assert(err, check.ErrorMatches, `Cannot start application units.*`)
+	c.Assert(w.results, check.HasLen, 0)
+}
+
+func (s *S) TestDeployWithoutHooksOnRollback(c *check.C) {
+	a := app.App{Name: "myapp", Quota: quota.Unlimited}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	err = s.newFakeImage(s.p, "tsuru/app-myapp:v1", map[string]interface{}{
+		"processes": map[string]interface{}{"web": "python myapp.py"},
+		"hooks": map[string]interface{}{
+			"deploy": map[string]interface{}{
+				"pre":  []string{"./migrate.sh"},
+				"post": []string{"./notify.sh"},
+			},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	var w hookRecorderBuffer
+	_, err = s.p.Rollback(&a, "tsuru/app-myapp:v1", &w)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.results, check.HasLen, 0)
+	c.Assert(w.String(), check.Matches, `(?s).*Skipping deploy hooks on rollback.*`)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app/secret"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+func (p *dockerProvisioner) DeclaredJobs(app provision.App) ([]provision.TsuruYamlJob, error) {
+	imageName, err := appCurrentImageName(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	yamlData, err := getImageTsuruYamlData(imageName)
+	if err != nil {
+		return nil, err
+	}
+	return yamlData.Jobs, nil
+}
+
+func (p *dockerProvisioner) RunJob(app provision.App, opts provision.JobOptions) (int, error) {
+	imageName, err := appCurrentImageName(app.GetName())
+	if err != nil {
+		return 0, err
+	}
+	env := []string{fmt.Sprintf("TSURU_JOBNAME=%s", opts.Name)}
+	return p.runOneOffContainer(app, imageName, opts.Command, env, opts.Output, opts.Cancel)
+}
+
+// runOneOffContainer runs the command in a new container created from the
+// given image, with the environment of the app, blocking until it finishes or
+// cancel is closed. The container is removed afterwards and the exit status
+// of the command is returned.
+func (p *dockerProvisioner) runOneOffContainer(app provision.App, imageName, cmd string, env []string, w io.Writer, cancel <-chan struct{}) (int, error) {
+	appEnvs, err := container.AppEnvs(app)
+	if err != nil {
+		return 0, err
+	}
+	env = append(env, appEnvs...)
+	createOptions := docker.CreateContainerOptions{
+		Config: &docker.Config{
+			AttachStdout: true,
+			AttachStderr: true,
+			Image:        imageName,
+			Entrypoint:   []string{"/bin/bash", "-c"},
+			Cmd:          []string{cmd},
+			Env:          env,
+			Memory:       app.GetMemory(),
+			MemorySwap:   app.GetMemory() + app.GetSwap(),
+			CPUShares:    int64(app.GetCpuShare()),
+		},
+	}
+	cluster := p.Cluster()
+	schedOpts := &container.SchedulerOpts{
+		AppName:       app.GetName(),
+		ActionLimiter: p.ActionLimiter(),
+	}
+	addr, cont, err := cluster.CreateContainerSchedulerOpts(createOptions, schedOpts, net.StreamInactivityTimeout)
+	hostAddr := net.URLToHost(addr)
+	if schedOpts.LimiterDone != nil {
+		schedOpts.LimiterDone()
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		done := p.ActionLimiter().Start(hostAddr)
+		cluster.RemoveContainer(docker.RemoveContainerOptions{ID: cont.ID, Force: true})
+		done()
+	}()
+	output := secret.NewMaskWriter(w, container.SecretValues(app))
+	attachOptions := docker.AttachToContainerOptions{
+		Container:    cont.ID,
+		OutputStream: output,
+		ErrorStream:  output,
+		Stream:       true,
+		Stdout:       true,
+		Stderr:       true,
+		Success:      make(chan struct{}),
+	}
+	waiter, err := cluster.AttachToContainerNonBlocking(attachOptions)
+	if err != nil {
+		return 0, err
+	}
+	<-attachOptions.Success
+	close(attachOptions.Success)
+	done := p.ActionLimiter().Start(hostAddr)
+	err = cluster.StartContainer(cont.ID, nil)
+	done()
+	if err != nil {
+		return 0, err
+	}
+	finished := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-cancel:
+			killErr := cluster.KillContainer(docker.KillContainerOptions{ID: cont.ID})
+			if killErr != nil {
+				log.Errorf("unable to kill container %s running %q for app %s: %s", cont.ID, cmd, app.GetName(), killErr)
+			}
+			canceled <- true
+		case <-finished:
+			canceled <- false
+		}
+	}()
+	exitCode, err := cluster.WaitContainer(cont.ID)
+	waiter.Wait()
+	close(finished)
+	if <-canceled {
+		return exitCode, provision.ErrJobCanceled
+	}
+	return exitCode, err
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestDeclaredJobs(c *check.C) {
+	a := app.App{Name: "myapp"}
+	customData := map[string]interface{}{
+		"processes": map[string]interface{}{"web": "python myapp.py"},
+		"jobs": []interface{}{
+			map[string]interface{}{
+				"name":               "report",
+				"schedule":           "0 3 * * *",
+				"command":            "./report.sh",
+				"concurrency_policy": "forbid",
+				"timeout":            600,
+			},
+		},
+	}
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1", customData)
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName(a.Name, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	jobs, err := s.p.DeclaredJobs(&a)
+	c.Assert(err, check.IsNil)
+	c.Assert(jobs, check.DeepEquals, []provision.TsuruYamlJob{{
+		Name:              "report",
+		Schedule:          "0 3 * * *",
+		Command:           "./report.sh",
+		ConcurrencyPolicy: "forbid",
+		Timeout:           600,
+	}})
+}
+
+func (s *S) TestRunJobCanceled(c *check.C) {
+	a := app.App{Name: "myapp"}
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1", nil)
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName(a.Name, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	cancel := make(chan struct{})
+	close(cancel)
+	var output safe.Buffer
+	_, err = s.p.RunJob(&a, provision.JobOptions{
+		Name:    "cleanup",
+		Command: "./cleanup.sh",
+		Output:  &output,
+		Cancel:  cancel,
+	})
+	c.Assert(err, check.Equals, provision.ErrJobCanceled)
+	client, err := docker.NewClient(s.server.URL())
+	c.Assert(err, check.IsNil)
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 0)
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+const statsTimeout = 30 * time.Second
+
+func (p *dockerProvisioner) UnitsMetrics(a provision.App, process string) ([]provision.UnitMetric, error) {
+	containers, err := p.listRunnableContainersByApp(a.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var metrics []provision.UnitMetric
+	for i := range containers {
+		c := &containers[i]
+		if process != "" && c.ProcessName != process {
+			continue
+		}
+		metric, err := p.containerMetric(c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get metrics for container %s: %s", c.ShortID(), err)
+		}
+		metrics = append(metrics, *metric)
+	}
+	return metrics, nil
+}
+
+func (p *dockerProvisioner) containerMetric(c *container.Container) (*provision.UnitMetric, error) {
+	node, err := p.getNodeByHost(c.HostAddr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := node.Client()
+	if err != nil {
+		return nil, err
+	}
+	statsCh := make(chan *docker.Stats, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Stats(docker.StatsOptions{
+			ID:                c.ID,
+			Stats:             statsCh,
+			Stream:            false,
+			Timeout:           statsTimeout,
+			InactivityTimeout: statsTimeout,
+		})
+	}()
+	var stats *docker.Stats
+	for s := range statsCh {
+		stats = s
+	}
+	err = <-errCh
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("no stats received")
+	}
+	metric := provision.UnitMetric{ID: c.ID}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+		if cpus == 0 {
+			cpus = 1
+		}
+		metric.CPUPercent = (cpuDelta / systemDelta) * cpus * 100
+	}
+	if stats.MemoryStats.Limit > 0 {
+		metric.MemoryPercent = float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit) * 100
+	}
+	return &metric, nil
+}
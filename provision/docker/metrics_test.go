@@ -0,0 +1,53 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{
+		AppName:     "myapp",
+		ProcessName: "web",
+		Status:      provision.StatusStarted.String(),
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	other, err := s.newContainer(&newContainerOpts{
+		AppName:     "myapp",
+		ProcessName: "worker",
+		Status:      provision.StatusStarted.String(),
+	}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(other)
+	s.server.PrepareStats(cont.ID, func(string) docker.Stats {
+		var stats docker.Stats
+		stats.CPUStats.CPUUsage.TotalUsage = 300
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150}
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.PreCPUStats.CPUUsage.TotalUsage = 200
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.MemoryStats.Usage = 32
+		stats.MemoryStats.Limit = 128
+		return stats
+	})
+	a := app.App{Name: "myapp"}
+	metrics, err := s.p.UnitsMetrics(&a, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetric{
+		{ID: cont.ID, CPUPercent: 20, MemoryPercent: 25},
+	})
+}
+
+func (s *S) TestUnitsMetricsNoContainers(c *check.C) {
+	a := app.App{Name: "myapp"}
+	metrics, err := s.p.UnitsMetrics(&a, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
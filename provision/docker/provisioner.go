@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/app/secret"
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
@@ -34,6 +35,7 @@ import (
 	"github.com/tsuru/tsuru/provision/docker/healer"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
 	"github.com/tsuru/tsuru/router"
+	_ "github.com/tsuru/tsuru/router/api"
 	_ "github.com/tsuru/tsuru/router/galeb"
 	_ "github.com/tsuru/tsuru/router/hipache"
 	_ "github.com/tsuru/tsuru/router/routertest"
@@ -49,12 +51,14 @@ func init() {
 	provision.Register("docker", mainDockerProvisioner)
 }
 
+// getRouterForApp returns a router fanning route, cname and healthcheck
+// changes out to every router the app is attached to.
 func getRouterForApp(app provision.App) (router.Router, error) {
-	routerName, err := app.GetRouter()
+	routerNames, err := app.GetRouters()
 	if err != nil {
 		return nil, err
 	}
-	return router.Get(routerName)
+	return router.GetMulti(routerNames)
 }
 
 type dockerProvisioner struct {
@@ -380,7 +384,7 @@ func (p *dockerProvisioner) Swap(app1, app2 provision.App, cnameOnly bool) error
 }
 
 func (p *dockerProvisioner) Rollback(app provision.App, imageId string, w io.Writer) (string, error) {
-	return imageId, p.deploy(app, imageId, w)
+	return imageId, p.deploy(app, imageId, false, w)
 }
 
 func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, w io.Writer) (string, error) {
@@ -465,7 +469,7 @@ func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, w io.
 		return "", err
 	}
 	app.SetUpdatePlatform(true)
-	return newImage, p.deploy(app, newImage, w)
+	return newImage, p.deploy(app, newImage, true, w)
 }
 
 func (p *dockerProvisioner) ArchiveDeploy(app provision.App, archiveURL string, w io.Writer) (string, error) {
@@ -581,14 +585,22 @@ func (p *dockerProvisioner) UploadDeploy(app provision.App, archiveFile io.ReadC
 }
 
 func (p *dockerProvisioner) deployAndClean(a provision.App, imageId string, w io.Writer) error {
-	err := p.deploy(a, imageId, w)
+	err := p.deploy(a, imageId, true, w)
 	if err != nil {
 		p.cleanImage(a.GetName(), imageId)
 	}
 	return err
 }
 
-func (p *dockerProvisioner) deploy(a provision.App, imageId string, w io.Writer) error {
+// deploy replaces the units of the app with units of the image. Deploy hooks
+// only run when runHooks is true, rollbacks don't run them, as the hooks of
+// the old image, like database migrations, already ran when it was deployed.
+func (p *dockerProvisioner) deploy(a provision.App, imageId string, runHooks bool, w io.Writer) error {
+	recorder, _ := w.(provision.DeployHookRecorder)
+	w = secret.NewMaskWriter(w, container.SecretValues(a))
+	if recorder != nil {
+		w = &hookRecorderWriter{Writer: w, DeployHookRecorder: recorder}
+	}
 	containers, err := p.listContainersByApp(a.GetName())
 	if err != nil {
 		return err
@@ -597,8 +609,13 @@ func (p *dockerProvisioner) deploy(a provision.App, imageId string, w io.Writer)
 	if err != nil {
 		return err
 	}
+	yamlData, err := getImageTsuruYamlData(imageId)
+	if err != nil {
+		return err
+	}
+	var toAdd map[string]*containersToAdd
 	if len(containers) == 0 {
-		toAdd := make(map[string]*containersToAdd, len(imageData.Processes))
+		toAdd = make(map[string]*containersToAdd, len(imageData.Processes))
 		for processName := range imageData.Processes {
 			_, ok := toAdd[processName]
 			if !ok {
@@ -607,19 +624,47 @@ func (p *dockerProvisioner) deploy(a provision.App, imageId string, w io.Writer)
 			}
 			toAdd[processName].Quantity++
 		}
-		if err = setQuota(a, toAdd); err != nil {
+	} else {
+		toAdd = getContainersToAdd(imageData, containers)
+	}
+	if err = setQuota(a, toAdd); err != nil {
+		return err
+	}
+	if runHooks {
+		err = p.runDeployHooks(a, imageId, provision.DeployHookPre, yamlData.Hooks.Deploy, w)
+		if err != nil {
 			return err
 		}
+	} else if len(yamlData.Hooks.Deploy.Pre) > 0 || len(yamlData.Hooks.Deploy.Post) > 0 {
+		fmt.Fprintln(w, " ---> Skipping deploy hooks on rollback")
+	}
+	if len(containers) == 0 {
 		_, err = p.runCreateUnitsPipeline(w, a, toAdd, imageId, imageData.ExposedPort)
 	} else {
-		toAdd := getContainersToAdd(imageData, containers)
-		if err = setQuota(a, toAdd); err != nil {
-			return err
+		if yamlData.Deploy.Weighted() {
+			_, err = p.runWeightedReplaceUnitsPipeline(w, a, toAdd, containers, imageId, yamlData.Deploy)
+		} else {
+			_, err = p.runReplaceUnitsPipeline(w, a, toAdd, containers, imageId)
 		}
-		_, err = p.runReplaceUnitsPipeline(w, a, toAdd, containers, imageId)
 	}
 	routesRebuildOrEnqueue(a.GetName())
-	return err
+	if err != nil {
+		return err
+	}
+	if runHooks {
+		hookErr := p.runDeployHooks(a, imageId, provision.DeployHookPost, yamlData.Hooks.Deploy, w)
+		if hookErr != nil {
+			fmt.Fprintf(w, " ---> %s\n", hookErr)
+		}
+	}
+	return nil
+}
+
+// hookRecorderWriter keeps the deploy hook recorder of the original writer
+// after it's wrapped.
+type hookRecorderWriter struct {
+	io.Writer
+	provision.DeployHookRecorder
 }
 
 func setQuota(app provision.App, toAdd map[string]*containersToAdd) error {
@@ -939,8 +984,9 @@ func (p *dockerProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, app pro
 	if len(containers) == 0 {
 		return provision.ErrEmptyApp
 	}
-	container := containers[0]
-	return container.Exec(p, stdout, stderr, cmd, args...)
+	values := container.SecretValues(app)
+	stdout, stderr = secret.NewMaskWriter(stdout, values), secret.NewMaskWriter(stderr, values)
+	return containers[0].Exec(p, stdout, stderr, cmd, args...)
 }
 
 func (p *dockerProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
@@ -951,6 +997,8 @@ func (p *dockerProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provisi
 	if len(containers) == 0 {
 		return provision.ErrEmptyApp
 	}
+	values := container.SecretValues(app)
+	stdout, stderr = secret.NewMaskWriter(stdout, values), secret.NewMaskWriter(stderr, values)
 	for _, c := range containers {
 		err = c.Exec(p, stdout, stderr, cmd, args...)
 		if err != nil {
@@ -7,7 +7,6 @@ package docker
 import (
 	"errors"
 	"fmt"
-	"math"
 	"strconv"
 	"sync"
 
@@ -48,7 +47,11 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
-	nodes, err = s.filterByMemoryUsage(a, nodes, s.maxMemoryRatio, s.TotalMemoryMetadata)
+	ctx, err := s.newScheduleContext(a, schedOpts.ProcessName, nodes)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
+	nodes, err = s.filterNodes(ctx, nodes)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
@@ -62,33 +65,22 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	return cluster.Node{Address: node}, nil
 }
 
-func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.Node, maxMemoryRatio float32, TotalMemoryMetadata string) ([]cluster.Node, error) {
-	if maxMemoryRatio == 0 || TotalMemoryMetadata == "" {
+func (s *segregatedScheduler) filterByMemoryUsage(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	if s.maxMemoryRatio == 0 || s.TotalMemoryMetadata == "" {
 		return nodes, nil
 	}
-	hosts := make([]string, len(nodes))
-	for i := range nodes {
-		hosts[i] = net.URLToHost(nodes[i].Address)
-	}
-	containers, err := s.provisioner.ListContainers(bson.M{"hostaddr": bson.M{"$in": hosts}, "id": bson.M{"$nin": s.ignoredContainers}})
+	hostReserved, _, err := ctx.reserved(s)
 	if err != nil {
 		return nil, err
 	}
-	hostReserved := make(map[string]int64)
-	for _, cont := range containers {
-		contApp, err := app.GetByName(cont.AppName)
-		if err != nil {
-			return nil, err
-		}
-		hostReserved[cont.HostAddr] += contApp.Plan.Memory
-	}
+	a := ctx.app
 	megabyte := float64(1024 * 1024)
 	nodeList := make([]cluster.Node, 0, len(nodes))
 	for _, node := range nodes {
-		totalMemory, _ := strconv.ParseFloat(node.Metadata[TotalMemoryMetadata], 64)
+		totalMemory, _ := strconv.ParseFloat(node.Metadata[s.TotalMemoryMetadata], 64)
 		shouldAdd := true
 		if totalMemory != 0 {
-			maxMemory := totalMemory * float64(maxMemoryRatio)
+			maxMemory := totalMemory * float64(s.maxMemoryRatio)
 			host := net.URLToHost(node.Address)
 			nodeReserved := hostReserved[host] + a.Plan.Memory
 			if nodeReserved > int64(maxMemory) {
@@ -99,6 +91,8 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 				log.Errorf("Node %q has reached its memory limit. "+
 					"Limit %0.4fMB. Reserved: %0.4fMB. Needed additional %0.4fMB",
 					host, limitMB, reservedMB, tryingToReserveMB)
+				ctx.reject(node, fmt.Sprintf("memory limit reached: limit %0.4fMB, reserved %0.4fMB, needed additional %0.4fMB",
+					limitMB, reservedMB, tryingToReserveMB))
 			}
 		}
 		if shouldAdd {
@@ -113,6 +107,9 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 			// Allow going over quota temporarily because auto-scale will be
 			// able to detect this and automatically add a new nodes.
 			log.Errorf("WARNING: %s. Will ignore memory restrictions.", errMsg)
+			for _, node := range nodes {
+				delete(ctx.rejected, node.Address)
+			}
 			return nodes, nil
 		}
 		return nil, errors.New(errMsg)
@@ -250,10 +247,9 @@ func appGroupCount(hostGroups map[string]int, appCountHost map[string]int) map[s
 	return result
 }
 
-// Find the host with the minimum (good to add a new container) and maximum
-// (good to remove a container) value for the pair [(number of containers for
-// app-process), (number of containers in host)]
-func (s *segregatedScheduler) minMaxNodes(nodes []cluster.Node, appName, process string) (string, string, error) {
+// hostGroups maps each host to the index of its group of nodes with the same
+// metadata, as split by splitMetadata.
+func hostGroups(nodes []cluster.Node) map[string]int {
 	nodesPtr := make([]*cluster.Node, len(nodes))
 	for i := range nodes {
 		nodesPtr[i] = &nodes[i]
@@ -268,32 +264,19 @@ func (s *segregatedScheduler) minMaxNodes(nodes []cluster.Node, appName, process
 			hostGroupMap[net.URLToHost(n.Address)] = i
 		}
 	}
-	hosts, hostsMap := s.nodesToHosts(nodes)
-	hostCountMap, err := s.aggregateContainersByHost(hosts)
-	if err != nil {
-		return "", "", err
-	}
-	appCountMap, err := s.aggregateContainersByHostAppProcess(hosts, appName, process)
+	return hostGroupMap
+}
+
+// Find the host with the minimum (good to add a new container) and maximum
+// (good to remove a container) scores, compared in the order of the scorers
+// configured for the pool of the nodes. By default the scores are [(number of
+// containers for app-process in the metadata group), (number of containers
+// for app-process), (number of containers in host)]
+func (s *segregatedScheduler) minMaxNodes(nodes []cluster.Node, appName, process string) (string, string, error) {
+	scores, err := s.scoreNodes(nodes, appName, process)
 	if err != nil {
 		return "", "", err
 	}
-	priorityEntries := []map[string]int{appGroupCount(hostGroupMap, appCountMap), appCountMap, hostCountMap}
-	var minHost, maxHost string
-	var minScore uint64 = math.MaxUint64
-	var maxScore uint64 = 0
-	for _, host := range hosts {
-		var score uint64
-		for i, e := range priorityEntries {
-			score += uint64(e[host]) << uint((len(priorityEntries)-i-1)*(64/len(priorityEntries)))
-		}
-		if score < minScore {
-			minScore = score
-			minHost = host
-		}
-		if score > maxScore {
-			maxScore = score
-			maxHost = host
-		}
-	}
-	return hostsMap[minHost], hostsMap[maxHost], nil
+	minHost, maxHost := scores.minMax()
+	return minHost, maxHost, nil
 }
@@ -0,0 +1,563 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/label"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/scopedconfig"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const schedulerConfigCollection = "scheduler"
+
+const (
+	scorerAntiAffinity   = "anti-affinity"
+	scorerMetadataGroups = "metadata-groups"
+	scorerAppProcess     = "app-process"
+	scorerContainers     = "containers"
+	scorerMemory         = "memory"
+	scorerCPUShare       = "cpu-share"
+)
+
+var (
+	knownScorers = []string{
+		scorerAntiAffinity,
+		scorerMetadataGroups,
+		scorerAppProcess,
+		scorerContainers,
+		scorerMemory,
+		scorerCPUShare,
+	}
+	defaultScorers = []string{scorerMetadataGroups, scorerAppProcess, scorerContainers}
+)
+
+// SchedulerConfig holds the scheduling policies of a pool, the entry without
+// a pool holds the defaults for all pools.
+//
+// CPUShareMetadata is the node metadata holding the total cpu shares of the
+// node. When set, nodes where the cpu shares of the existing containers, as
+// defined in the plans of their apps, plus the cpu share of the new container
+// go over MaxCPUShareRatio (1.0 by default) of the total are filtered out.
+//
+// AntiAffinityKey is a node metadata whose values define groups of nodes,
+// e.g. availability zones, across which the units of each process of an app
+// are spread. With AntiAffinityHard, nodes without the metadata and nodes in
+// groups already running a unit of the process are filtered out, otherwise
+// the groups are only used by the anti-affinity scorer, which is added as the
+// first scorer when Scorers is not set.
+//
+// Scorers is the list of scores, in order of priority, used to choose among
+// the nodes accepted by the filters. New units are added to the node with the
+// lowest scores and removed from the node with the highest scores.
+type SchedulerConfig struct {
+	CPUShareMetadata          *string
+	MaxCPUShareRatio          *float64
+	AntiAffinityKey           *string
+	AntiAffinityHard          *bool
+	Scorers                   []string
+	CPUShareMetadataInherited bool
+	MaxCPUShareRatioInherited bool
+	AntiAffinityKeyInherited  bool
+	AntiAffinityHardInherited bool
+	ScorersInherited          bool
+}
+
+func (c *SchedulerConfig) cpuShareMetadata() string {
+	if c.CPUShareMetadata == nil {
+		return ""
+	}
+	return *c.CPUShareMetadata
+}
+
+func (c *SchedulerConfig) maxCPUShareRatio() float64 {
+	if c.MaxCPUShareRatio == nil || *c.MaxCPUShareRatio <= 0 {
+		return 1.0
+	}
+	return *c.MaxCPUShareRatio
+}
+
+func (c *SchedulerConfig) antiAffinityKey() string {
+	if c.AntiAffinityKey == nil {
+		return ""
+	}
+	return *c.AntiAffinityKey
+}
+
+func (c *SchedulerConfig) antiAffinityHard() bool {
+	return c.AntiAffinityHard != nil && *c.AntiAffinityHard
+}
+
+func (c *SchedulerConfig) scorers() []string {
+	if len(c.Scorers) > 0 {
+		return c.Scorers
+	}
+	if c.antiAffinityKey() != "" {
+		return append([]string{scorerAntiAffinity}, defaultScorers...)
+	}
+	return defaultScorers
+}
+
+func (c *SchedulerConfig) validate() error {
+	if c.MaxCPUShareRatio != nil && *c.MaxCPUShareRatio <= 0 {
+		return fmt.Errorf("max cpu share ratio must be greater than 0")
+	}
+	for _, scorer := range c.Scorers {
+		var found bool
+		for _, known := range knownScorers {
+			if scorer == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid scorer %q, valid scorers are: %s", scorer, strings.Join(knownScorers, ", "))
+		}
+	}
+	return nil
+}
+
+func schedulerConfig() *scopedconfig.ScopedConfig {
+	conf := scopedconfig.FindScopedConfig(schedulerConfigCollection)
+	conf.AllowEmpty = true
+	return conf
+}
+
+func loadSchedulerConfig(pool string) (SchedulerConfig, error) {
+	var config SchedulerConfig
+	err := schedulerConfig().Load(pool, &config)
+	return config, err
+}
+
+func loadAllSchedulerConfig() (map[string]SchedulerConfig, error) {
+	var entries map[string]SchedulerConfig
+	err := schedulerConfig().LoadAll(&entries)
+	return entries, err
+}
+
+func updateSchedulerConfig(pool string, config SchedulerConfig) error {
+	err := config.validate()
+	if err != nil {
+		return err
+	}
+	return schedulerConfig().SaveMerge(pool, config)
+}
+
+func removeSchedulerConfig(pool, name string) error {
+	conf := schedulerConfig()
+	if name == "" {
+		return conf.Remove(pool)
+	}
+	return conf.RemoveField(pool, name)
+}
+
+// scheduleContext holds the state shared by the filters used to choose the
+// node of a new unit of an app.
+type scheduleContext struct {
+	app      *app.App
+	process  string
+	pool     string
+	nodes    []cluster.Node
+	config   SchedulerConfig
+	rejected map[string]string
+	memory   map[string]int64
+	cpuShare map[string]int64
+}
+
+func (s *segregatedScheduler) newScheduleContext(a *app.App, process string, nodes []cluster.Node) (*scheduleContext, error) {
+	var pool string
+	if len(nodes) > 0 {
+		pool = nodes[0].Metadata["pool"]
+	}
+	config, err := loadSchedulerConfig(pool)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduleContext{
+		app:      a,
+		process:  process,
+		pool:     pool,
+		nodes:    nodes,
+		config:   config,
+		rejected: make(map[string]string),
+	}, nil
+}
+
+func (ctx *scheduleContext) reject(node cluster.Node, reason string) {
+	ctx.rejected[node.Address] = reason
+}
+
+// reserved returns the memory and the cpu shares reserved in each host of the
+// context by the plans of the apps of its containers.
+func (ctx *scheduleContext) reserved(s *segregatedScheduler) (map[string]int64, map[string]int64, error) {
+	if ctx.memory == nil {
+		hosts, _ := s.nodesToHosts(ctx.nodes)
+		memory, cpuShare, err := s.reservedByHost(hosts)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx.memory, ctx.cpuShare = memory, cpuShare
+	}
+	return ctx.memory, ctx.cpuShare, nil
+}
+
+func (s *segregatedScheduler) reservedByHost(hosts []string) (map[string]int64, map[string]int64, error) {
+	containers, err := s.provisioner.ListContainers(bson.M{"hostaddr": bson.M{"$in": hosts}, "id": bson.M{"$nin": s.ignoredContainers}})
+	if err != nil {
+		return nil, nil, err
+	}
+	plans := make(map[string]app.Plan)
+	memory := make(map[string]int64)
+	cpuShare := make(map[string]int64)
+	for _, cont := range containers {
+		plan, ok := plans[cont.AppName]
+		if !ok {
+			contApp, err := app.GetByName(cont.AppName)
+			if err != nil {
+				return nil, nil, err
+			}
+			plan = contApp.Plan
+			plans[cont.AppName] = plan
+		}
+		memory[cont.HostAddr] += plan.Memory
+		cpuShare[cont.HostAddr] += int64(plan.CpuShare)
+	}
+	return memory, cpuShare, nil
+}
+
+// filterNodes runs the filters of the scheduling policies, in order, over the
+// nodes, recording in the context the reason why each node was rejected.
+func (s *segregatedScheduler) filterNodes(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	filters := []func(*scheduleContext, []cluster.Node) ([]cluster.Node, error){
+		s.filterCordoned,
+		s.filterByNodeSelector,
+		s.filterByMemoryUsage,
+		s.filterByCPUShare,
+		s.filterByAntiAffinity,
+	}
+	var err error
+	for _, filter := range filters {
+		nodes, err = filter(ctx, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (s *segregatedScheduler) filterByNodeSelector(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	selector := ctx.app.NodeSelector
+	if len(selector) == 0 {
+		return nodes, nil
+	}
+	nodeList := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !label.Labels(node.Metadata).Matches(selector) {
+			ctx.reject(node, "node metadata doesn't match the node selector of the app")
+			continue
+		}
+		nodeList = append(nodeList, node)
+	}
+	if len(nodeList) == 0 {
+		return nil, fmt.Errorf("no nodes found matching the node selector of %q: %s", ctx.app.Name, selectorString(selector))
+	}
+	return nodeList, nil
+}
+
+func (s *segregatedScheduler) filterByCPUShare(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	metadata := ctx.config.cpuShareMetadata()
+	if metadata == "" {
+		return nodes, nil
+	}
+	_, hostReserved, err := ctx.reserved(s)
+	if err != nil {
+		return nil, err
+	}
+	maxRatio := ctx.config.maxCPUShareRatio()
+	needed := int64(ctx.app.Plan.CpuShare)
+	nodeList := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		totalCPUShare, _ := strconv.ParseFloat(node.Metadata[metadata], 64)
+		if totalCPUShare != 0 {
+			maxCPUShare := totalCPUShare * maxRatio
+			host := net.URLToHost(node.Address)
+			if float64(hostReserved[host]+needed) > maxCPUShare {
+				log.Errorf("Node %q has reached its cpu share limit. Limit %0.2f. Reserved: %d. Needed additional %d",
+					host, maxCPUShare, hostReserved[host], needed)
+				ctx.reject(node, fmt.Sprintf("cpu share limit reached: limit %0.2f, reserved %d, needed additional %d",
+					maxCPUShare, hostReserved[host], needed))
+				continue
+			}
+		}
+		nodeList = append(nodeList, node)
+	}
+	if len(nodeList) == 0 {
+		return nil, fmt.Errorf("no nodes found with enough cpu share for container of %q: %d", ctx.app.Name, needed)
+	}
+	return nodeList, nil
+}
+
+func (s *segregatedScheduler) filterByAntiAffinity(ctx *scheduleContext, nodes []cluster.Node) ([]cluster.Node, error) {
+	key := ctx.config.antiAffinityKey()
+	if key == "" || !ctx.config.antiAffinityHard() {
+		return nodes, nil
+	}
+	groupCount, err := s.antiAffinityGroupCount(ctx.nodes, key, ctx.app.Name, ctx.process)
+	if err != nil {
+		return nil, err
+	}
+	nodeList := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		value := node.Metadata[key]
+		if value == "" {
+			ctx.reject(node, fmt.Sprintf("node has no %q metadata", key))
+			continue
+		}
+		if count := groupCount[value]; count > 0 {
+			ctx.reject(node, fmt.Sprintf("%s=%s already has %d units of process %q", key, value, count, ctx.process))
+			continue
+		}
+		nodeList = append(nodeList, node)
+	}
+	if len(nodeList) == 0 {
+		return nil, fmt.Errorf("no nodes found with a %q metadata without units of app %q process %q", key, ctx.app.Name, ctx.process)
+	}
+	return nodeList, nil
+}
+
+// antiAffinityGroupCount returns the number of units of the process of the
+// app in each value of the metadata key of the nodes.
+func (s *segregatedScheduler) antiAffinityGroupCount(nodes []cluster.Node, key, appName, process string) (map[string]int, error) {
+	hosts, _ := s.nodesToHosts(nodes)
+	appCountMap, err := s.aggregateContainersByHostAppProcess(hosts, appName, process)
+	if err != nil {
+		return nil, err
+	}
+	groupCount := make(map[string]int)
+	for _, node := range nodes {
+		groupCount[node.Metadata[key]] += appCountMap[net.URLToHost(node.Address)]
+	}
+	return groupCount, nil
+}
+
+func selectorString(selector label.Labels) string {
+	parts := make([]string, 0, len(selector))
+	for _, k := range selector.Keys() {
+		parts = append(parts, k+"="+selector[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// nodeScores holds the scores of each host, in the order of the scorers.
+type nodeScores struct {
+	scorers  []string
+	hosts    []string
+	hostsMap map[string]string
+	scores   map[string][]int64
+}
+
+// scoreNodes computes the scores of the nodes for a unit of the process of the
+// app, using the scorers configured for the pool of the nodes.
+func (s *segregatedScheduler) scoreNodes(nodes []cluster.Node, appName, process string) (*nodeScores, error) {
+	var pool string
+	if len(nodes) > 0 {
+		pool = nodes[0].Metadata["pool"]
+	}
+	config, err := loadSchedulerConfig(pool)
+	if err != nil {
+		return nil, err
+	}
+	hosts, hostsMap := s.nodesToHosts(nodes)
+	result := &nodeScores{
+		scorers:  config.scorers(),
+		hosts:    hosts,
+		hostsMap: hostsMap,
+		scores:   make(map[string][]int64, len(hosts)),
+	}
+	var appCountMap map[string]int
+	var memory, cpuShare map[string]int64
+	for _, scorer := range result.scorers {
+		values := make(map[string]int64, len(hosts))
+		switch scorer {
+		case scorerAntiAffinity:
+			key := config.antiAffinityKey()
+			if key == "" {
+				break
+			}
+			groupCount, err := s.antiAffinityGroupCount(s.poolNodes(pool, nodes), key, appName, process)
+			if err != nil {
+				return nil, err
+			}
+			for _, node := range nodes {
+				values[net.URLToHost(node.Address)] = int64(groupCount[node.Metadata[key]])
+			}
+		case scorerMetadataGroups, scorerAppProcess:
+			if appCountMap == nil {
+				appCountMap, err = s.aggregateContainersByHostAppProcess(hosts, appName, process)
+				if err != nil {
+					return nil, err
+				}
+			}
+			counts := appCountMap
+			if scorer == scorerMetadataGroups {
+				counts = appGroupCount(hostGroups(nodes), appCountMap)
+			}
+			for host, count := range counts {
+				values[host] = int64(count)
+			}
+		case scorerContainers:
+			hostCountMap, err := s.aggregateContainersByHost(hosts)
+			if err != nil {
+				return nil, err
+			}
+			for host, count := range hostCountMap {
+				values[host] = int64(count)
+			}
+		case scorerMemory, scorerCPUShare:
+			if memory == nil {
+				memory, cpuShare, err = s.reservedByHost(hosts)
+				if err != nil {
+					return nil, err
+				}
+			}
+			values = memory
+			if scorer == scorerCPUShare {
+				values = cpuShare
+			}
+		}
+		for _, host := range hosts {
+			result.scores[host] = append(result.scores[host], values[host])
+		}
+	}
+	return result, nil
+}
+
+// poolNodes returns all the nodes in the pool, falling back to the given nodes
+// when they can't be listed.
+func (s *segregatedScheduler) poolNodes(pool string, nodes []cluster.Node) []cluster.Node {
+	if pool == "" {
+		return nodes
+	}
+	all, err := s.provisioner.Cluster().NodesForMetadata(map[string]string{"pool": pool})
+	if err != nil {
+		log.Debugf("[scheduler] unable to list nodes in pool %q, using candidate nodes: %s", pool, err)
+		return nodes
+	}
+	return all
+}
+
+// minMax returns the address of the node with the lowest scores and the
+// address of the node with the highest scores. Ties are broken by the order
+// of the nodes.
+func (n *nodeScores) minMax() (string, string) {
+	var minHost, maxHost string
+	var minScore, maxScore []int64
+	for _, host := range n.hosts {
+		score := n.scores[host]
+		if minHost == "" || compareScores(score, minScore) < 0 {
+			minScore = score
+			minHost = host
+		}
+		if compareScores(score, maxScore) > 0 {
+			maxScore = score
+			maxHost = host
+		}
+	}
+	return n.hostsMap[minHost], n.hostsMap[maxHost]
+}
+
+// compareScores compares the scores lexicographically, missing values are
+// considered to be zero.
+func compareScores(a, b []int64) int {
+	size := len(a)
+	if len(b) > size {
+		size = len(b)
+	}
+	for i := 0; i < size; i++ {
+		var va, vb int64
+		if i < len(a) {
+			va = a[i]
+		}
+		if i < len(b) {
+			vb = b[i]
+		}
+		if va < vb {
+			return -1
+		}
+		if va > vb {
+			return 1
+		}
+	}
+	return 0
+}
+
+type nodeExplanation struct {
+	Address  string  `json:"address"`
+	Accepted bool    `json:"accepted"`
+	Reason   string  `json:"reason,omitempty"`
+	Scores   []int64 `json:"scores,omitempty"`
+}
+
+type schedulerExplanation struct {
+	App     string            `json:"app"`
+	Process string            `json:"process"`
+	Pool    string            `json:"pool"`
+	Scorers []string          `json:"scorers"`
+	Nodes   []nodeExplanation `json:"nodes"`
+	Chosen  string            `json:"chosen,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// explain runs the filters and the scorers used to schedule a new unit of the
+// process of the app, without creating it, describing why each node was
+// accepted or rejected and the node that would be chosen.
+func (s *segregatedScheduler) explain(a *app.App, process string) (*schedulerExplanation, error) {
+	nodes, err := s.provisioner.Nodes(a)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := s.newScheduleContext(a, process, nodes)
+	if err != nil {
+		return nil, err
+	}
+	result := &schedulerExplanation{
+		App:     a.Name,
+		Process: process,
+		Pool:    ctx.pool,
+		Scorers: ctx.config.scorers(),
+		Nodes:   make([]nodeExplanation, 0, len(nodes)),
+	}
+	accepted, err := s.filterNodes(ctx, nodes)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	scores := &nodeScores{}
+	if len(accepted) > 0 {
+		s.hostMutex.Lock()
+		scores, err = s.scoreNodes(accepted, a.Name, process)
+		s.hostMutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		result.Chosen, _ = scores.minMax()
+	}
+	for _, node := range nodes {
+		reason := ctx.rejected[node.Address]
+		result.Nodes = append(result.Nodes, nodeExplanation{
+			Address:  node.Address,
+			Accepted: reason == "",
+			Reason:   reason,
+			Scores:   scores.scores[net.URLToHost(node.Address)],
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/label"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// startPoolNodes starts two docker servers, registers them in the pool
+// "mypool" with the given metadata and returns the cluster and the address of
+// both nodes.
+func (s *S) startPoolNodes(c *check.C, sched *segregatedScheduler, meta1, meta2 map[string]string) (*cluster.Cluster, string, string, func()) {
+	err := provision.AddPool(provision.AddPoolOptions{Name: "mypool"})
+	c.Assert(err, check.IsNil)
+	server1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	server2, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	localURL := strings.Replace(server2.URL(), "127.0.0.1", "localhost", -1)
+	meta1["pool"] = "mypool"
+	meta2["pool"] = "mypool"
+	clusterInstance, err := cluster.New(sched, &cluster.MapStorage{},
+		cluster.Node{Address: server1.URL(), Metadata: meta1},
+		cluster.Node{Address: localURL, Metadata: meta2},
+	)
+	c.Assert(err, check.IsNil)
+	s.p.cluster = clusterInstance
+	return clusterInstance, server1.URL(), localURL, func() {
+		server1.Stop()
+		server2.Stop()
+		provision.RemovePool("mypool")
+	}
+}
+
+func (s *S) TestSchedulerScheduleNodeSelector(c *check.C) {
+	a := app.App{Name: "skyrim", Pool: "mypool", NodeSelector: label.Labels{"zone": "b"}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	clusterInstance, _, url2, stop := s.startPoolNodes(c, &sched,
+		map[string]string{"zone": "a"}, map[string]string{"zone": "b"})
+	defer stop()
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	for i := 0; i < 3; i++ {
+		cont := container.Container{ID: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("unit%d", i), AppName: a.Name}
+		err = contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{Name: cont.Name}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+		c.Assert(err, check.IsNil)
+		c.Assert(node.Address, check.Equals, url2)
+	}
+	err = s.storage.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"nodeselector": label.Labels{"zone": "c"}}})
+	c.Assert(err, check.IsNil)
+	_, err = sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*no nodes found matching the node selector of "skyrim": zone=c.*`)
+}
+
+func (s *S) TestSchedulerScheduleCPUShare(c *check.C) {
+	app1 := app.App{Name: "skyrim", Pool: "mypool", Plan: app.Plan{CpuShare: 800}}
+	app2 := app.App{Name: "oblivion", Pool: "mypool", Plan: app.Plan{CpuShare: 300}}
+	err := s.storage.Apps().Insert(app1, app2)
+	c.Assert(err, check.IsNil)
+	err = updateSchedulerConfig("mypool", SchedulerConfig{CPUShareMetadata: stringPtr("cpuShares")})
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	clusterInstance, _, url2, stop := s.startPoolNodes(c, &sched,
+		map[string]string{"cpuShares": "1024"}, map[string]string{"cpuShares": "1024"})
+	defer stop()
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	err = contColl.Insert(container.Container{ID: "pre1", Name: "existing1", AppName: app1.Name, HostAddr: "127.0.0.1"})
+	c.Assert(err, check.IsNil)
+	cont := container.Container{ID: "id1", Name: "unit1", AppName: app2.Name}
+	err = contColl.Insert(cont)
+	c.Assert(err, check.IsNil)
+	node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{Name: cont.Name}, &container.SchedulerOpts{AppName: app2.Name, ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, url2)
+	cont = container.Container{ID: "id2", Name: "unit2", AppName: app2.Name}
+	err = contColl.Insert(cont)
+	c.Assert(err, check.IsNil)
+	node, err = sched.Schedule(clusterInstance, docker.CreateContainerOptions{Name: cont.Name}, &container.SchedulerOpts{AppName: app2.Name, ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, url2)
+	_, err = sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: app1.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*no nodes found with enough cpu share for container of "skyrim": 800.*`)
+}
+
+func (s *S) TestChooseNodeAntiAffinity(c *check.C) {
+	err := updateSchedulerConfig("", SchedulerConfig{AntiAffinityKey: stringPtr("zone")})
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a", "disk": "ssd"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"zone": "a", "disk": "hdd"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"zone": "b", "disk": "hdd"}},
+	}
+	sched := segregatedScheduler{provisioner: s.p}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		cont := container.Container{Name: fmt.Sprintf("unit%d", i), AppName: "anomander", ProcessName: "rake"}
+		err = contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.chooseNodeToAdd(nodes, cont.Name, "anomander", "rake")
+		c.Assert(err, check.IsNil)
+		hosts = append(hosts, node)
+	}
+	c.Assert(hosts[0] == "http://server3:1234" || hosts[1] == "http://server3:1234", check.Equals, true,
+		check.Commentf("hosts: %v", hosts))
+	c.Assert(hosts[0], check.Not(check.Equals), hosts[1])
+}
+
+func (s *S) TestSchedulerScheduleAntiAffinityHard(c *check.C) {
+	a := app.App{Name: "skyrim", Pool: "mypool"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = updateSchedulerConfig("mypool", SchedulerConfig{AntiAffinityKey: stringPtr("zone"), AntiAffinityHard: boolPtr(true)})
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	clusterInstance, url1, url2, stop := s.startPoolNodes(c, &sched,
+		map[string]string{"zone": "a"}, map[string]string{"zone": "b"})
+	defer stop()
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		cont := container.Container{ID: fmt.Sprintf("id%d", i), Name: fmt.Sprintf("unit%d", i), AppName: a.Name, ProcessName: "web"}
+		err = contColl.Insert(cont)
+		c.Assert(err, check.IsNil)
+		node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{Name: cont.Name}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+		c.Assert(err, check.IsNil)
+		addrs = append(addrs, node.Address)
+	}
+	c.Assert(addrs, check.HasLen, 2)
+	c.Assert(addrs[0], check.Not(check.Equals), addrs[1])
+	c.Assert(addrs[0] == url1 || addrs[0] == url2, check.Equals, true)
+	c.Assert(addrs[1] == url1 || addrs[1] == url2, check.Equals, true)
+	_, err = sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*no nodes found with a "zone" metadata without units of app "skyrim" process "web".*`)
+	node, err := sched.Schedule(clusterInstance, docker.CreateContainerOptions{}, &container.SchedulerOpts{AppName: a.Name, ProcessName: "worker"})
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Not(check.Equals), "")
+}
+
+func (s *S) TestChooseNodeScorersFromConfig(c *check.C) {
+	err := updateSchedulerConfig("", SchedulerConfig{Scorers: []string{scorerContainers}})
+	c.Assert(err, check.IsNil)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234"},
+	}
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	err = contColl.Insert(
+		container.Container{Name: "other1", AppName: "other", HostAddr: "server1"},
+		container.Container{Name: "other2", AppName: "other", HostAddr: "server1"},
+		container.Container{Name: "mine1", AppName: "anomander", HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	node, err := sched.chooseNodeToAdd(nodes, "", "anomander", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server2:1234")
+	err = removeSchedulerConfig("", "")
+	c.Assert(err, check.IsNil)
+	node, err = sched.chooseNodeToAdd(nodes, "", "anomander", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server1:1234")
+}
+
+func (s *S) TestSchedulerExplain(c *check.C) {
+	a := app.App{Name: "skyrim", Pool: "mypool", NodeSelector: label.Labels{"zone": "b"}}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	sched := segregatedScheduler{provisioner: s.p}
+	_, url1, url2, stop := s.startPoolNodes(c, &sched,
+		map[string]string{"zone": "a"}, map[string]string{"zone": "b"})
+	defer stop()
+	explanation, err := sched.explain(&a, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation.App, check.Equals, "skyrim")
+	c.Assert(explanation.Process, check.Equals, "web")
+	c.Assert(explanation.Pool, check.Equals, "mypool")
+	c.Assert(explanation.Scorers, check.DeepEquals, defaultScorers)
+	c.Assert(explanation.Chosen, check.Equals, url2)
+	c.Assert(explanation.Error, check.Equals, "")
+	nodes := map[string]nodeExplanation{}
+	for _, n := range explanation.Nodes {
+		nodes[n.Address] = n
+	}
+	c.Assert(nodes, check.DeepEquals, map[string]nodeExplanation{
+		url1: {Address: url1, Reason: "node metadata doesn't match the node selector of the app"},
+		url2: {Address: url2, Accepted: true, Scores: []int64{0, 0, 0}},
+	})
+	a.NodeSelector = label.Labels{"zone": "c"}
+	explanation, err = sched.explain(&a, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(explanation.Chosen, check.Equals, "")
+	c.Assert(explanation.Error, check.Equals, `no nodes found matching the node selector of "skyrim": zone=c`)
+	c.Assert(explanation.Nodes[0].Accepted, check.Equals, false)
+	c.Assert(explanation.Nodes[1].Accepted, check.Equals, false)
+}
+
+func (s *S) TestSchedulerConfigScorers(c *check.C) {
+	var conf SchedulerConfig
+	c.Assert(conf.scorers(), check.DeepEquals, defaultScorers)
+	conf.AntiAffinityKey = stringPtr("zone")
+	c.Assert(conf.scorers(), check.DeepEquals, []string{scorerAntiAffinity, scorerMetadataGroups, scorerAppProcess, scorerContainers})
+	conf.Scorers = []string{scorerMemory}
+	c.Assert(conf.scorers(), check.DeepEquals, []string{scorerMemory})
+}
+
+func (s *S) TestSchedulerConfigValidate(c *check.C) {
+	conf := SchedulerConfig{Scorers: []string{scorerMemory, scorerCPUShare}, MaxCPUShareRatio: floatPtr(0.9)}
+	c.Assert(conf.validate(), check.IsNil)
+	conf.Scorers = []string{"random"}
+	c.Assert(conf.validate(), check.ErrorMatches, `invalid scorer "random", valid scorers are: .*`)
+	conf = SchedulerConfig{MaxCPUShareRatio: floatPtr(0)}
+	c.Assert(conf.validate(), check.ErrorMatches, "max cpu share ratio must be greater than 0")
+}
+
+func (s *S) TestCompareScores(c *check.C) {
+	c.Assert(compareScores([]int64{1, 2}, []int64{1, 2}), check.Equals, 0)
+	c.Assert(compareScores([]int64{0, 5}, []int64{1, 0}), check.Equals, -1)
+	c.Assert(compareScores([]int64{1, 3}, []int64{1, 2}), check.Equals, 1)
+	c.Assert(compareScores([]int64{0, 0}, nil), check.Equals, 0)
+	c.Assert(compareScores([]int64{0, 1}, nil), check.Equals, 1)
+}
@@ -22,6 +22,7 @@ import (
 var (
 	ErrInvalidStatus = errors.New("invalid status")
 	ErrEmptyApp      = errors.New("no units for this app")
+	ErrJobCanceled   = errors.New("job canceled")
 )
 
 type UnitNotFoundError struct {
@@ -191,6 +192,10 @@ type App interface {
 
 	GetRouter() (string, error)
 
+	// GetRouters returns the names of every router the app is attached to,
+	// the first one is the router of its plan.
+	GetRouters() ([]string, error)
+
 	GetPool() string
 
 	GetTeamOwner() string
@@ -205,6 +210,8 @@ type App interface {
 	GetIp() string
 
 	GetLock() AppLock
+
+	GetLabels() map[string]string
 }
 
 type AppLock interface {
@@ -379,6 +386,57 @@ type NodeCheckResult struct {
 	Successful bool
 }
 
+// UnitMetric holds the resource usage of a single unit, as a percentage of
+// the limits available to it.
+type UnitMetric struct {
+	ID            string
+	CPUPercent    float64
+	MemoryPercent float64
+}
+
+// MetricsProvisioner is a provisioner that is able to report the current
+// resource usage of the units of an app.
+type MetricsProvisioner interface {
+	// UnitsMetrics returns the usage of the units running the given process
+	// of the app.
+	UnitsMetrics(app App, process string) ([]UnitMetric, error)
+}
+
+// JobOptions is the set of options used when running a job in the
+// JobProvisioner.
+type JobOptions struct {
+	// Name is the name of the job being executed.
+	Name string
+	// Command is the command line executed in the job unit.
+	Command string
+	// Output receives both the stdout and the stderr of the command.
+	Output io.Writer
+	// Cancel interrupts the execution of the job when closed, killing its
+	// unit.
+	Cancel <-chan struct{}
+}
+
+// JobProvisioner is a provisioner able to run scheduled jobs, each run
+// happening in a new unit created from the current image of the app.
+type JobProvisioner interface {
+	// RunJob runs the command in a new unit, blocking until it finishes or is
+	// canceled, and returns the exit status of the command. The unit is
+	// removed after the command finishes.
+	RunJob(app App, opts JobOptions) (int, error)
+
+	// DeclaredJobs returns the jobs declared in the tsuru.yaml of the
+	// current image of the app.
+	DeclaredJobs(app App) ([]TsuruYamlJob, error)
+}
+
+// HealthcheckProvisioner is a provisioner able to run the healthcheck
+// declared in the tsuru.yaml of the app against its units.
+type HealthcheckProvisioner interface {
+	// RunHealthcheck checks each of the given units of the app, writing the
+	// progress to w. It returns an error if any unit fails the healthcheck.
+	RunHealthcheck(app App, units []Unit, w io.Writer) error
+}
+
 // PlatformOptions is the set of options provided to PlatformAdd and
 // PlatformUpdate, in the ExtensibleProvisioner.
 type PlatformOptions struct {
@@ -443,9 +501,56 @@ type TsuruYamlRestartHooks struct {
 	After  []string
 }
 
+// DefaultDeployHookTimeout is the maximum duration of each deploy hook when
+// no timeout is set in tsuru.yaml.
+const DefaultDeployHookTimeout = 10 * time.Minute
+
+const (
+	DeployHookPre  = "pre"
+	DeployHookPost = "post"
+)
+
+// TsuruYamlDeployHooks are commands executed once per deploy, each one in a
+// new unit created from the image being deployed. Pre hooks run before any
+// traffic is moved to the new units and a failure aborts the deploy, keeping
+// the previous units running. Post hooks run after the router is updated,
+// a failure is reported but doesn't revert the deploy. Hooks don't run on
+// rollbacks. Timeout, in seconds, limits the execution of each hook.
+type TsuruYamlDeployHooks struct {
+	Pre     []string
+	Post    []string
+	Timeout int
+}
+
+// HookTimeout returns the maximum duration of each hook.
+func (h TsuruYamlDeployHooks) HookTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultDeployHookTimeout
+	}
+	return time.Duration(h.Timeout) * time.Second
+}
+
 type TsuruYamlHooks struct {
 	Restart TsuruYamlRestartHooks
 	Build   []string
+	Deploy  TsuruYamlDeployHooks
+}
+
+// DeployHookResult is the outcome of the execution of a deploy hook.
+type DeployHookResult struct {
+	Stage    string
+	Command  string
+	Output   string
+	ExitCode int
+	Duration time.Duration
+	Error    string `bson:",omitempty"`
+}
+
+// DeployHookRecorder may be implemented by the writers given to the deploy
+// methods of provisioners, to receive the results of the deploy hooks besides
+// their output.
+type DeployHookRecorder interface {
+	RecordDeployHook(DeployHookResult)
 }
 
 type TsuruYamlHealthcheck struct {
@@ -471,7 +576,69 @@ func (hc TsuruYamlHealthcheck) ToRouterHC() router.HealthcheckData {
 	}
 }
 
+const (
+	DeployStrategyReplace   = "replace"
+	DeployStrategyBlueGreen = "blue-green"
+	DeployStrategyCanary    = "canary"
+)
+
+var defaultCanarySteps = []int{10, 50, 100}
+
+// TsuruYamlDeploy configures how traffic is moved from the units running the
+// previous image to the new ones during a deploy.
+type TsuruYamlDeploy struct {
+	Strategy     string
+	Steps        []int
+	StepInterval int `json:"step_interval" bson:"step_interval"`
+}
+
+// Weighted returns whether the strategy keeps the previous units alive while
+// gradually moving traffic to the new ones.
+func (d TsuruYamlDeploy) Weighted() bool {
+	return d.Strategy == DeployStrategyBlueGreen || d.Strategy == DeployStrategyCanary
+}
+
+// TrafficSteps returns the percentages of traffic sent to the new units in
+// each step of the deploy, the last step is always 100.
+func (d TsuruYamlDeploy) TrafficSteps() ([]int, error) {
+	switch d.Strategy {
+	case "", DeployStrategyReplace, DeployStrategyBlueGreen:
+		return []int{100}, nil
+	case DeployStrategyCanary:
+	default:
+		return nil, fmt.Errorf("invalid deploy strategy %q", d.Strategy)
+	}
+	if len(d.Steps) == 0 {
+		return defaultCanarySteps, nil
+	}
+	var steps []int
+	last := 0
+	for _, step := range d.Steps {
+		if step <= last || step > 100 {
+			return nil, fmt.Errorf("invalid deploy steps %v, steps must be increasing percentages", d.Steps)
+		}
+		steps = append(steps, step)
+		last = step
+	}
+	if last != 100 {
+		steps = append(steps, 100)
+	}
+	return steps, nil
+}
+
+// TsuruYamlJob is a scheduled job declared in the jobs section of tsuru.yaml.
+// Timeout is expressed in seconds.
+type TsuruYamlJob struct {
+	Name              string
+	Schedule          string
+	Command           string
+	ConcurrencyPolicy string `json:"concurrency_policy" bson:"concurrency_policy"`
+	Timeout           int
+}
+
 type TsuruYamlData struct {
 	Hooks       TsuruYamlHooks
 	Healthcheck TsuruYamlHealthcheck
+	Deploy      TsuruYamlDeploy
+	Jobs        []TsuruYamlJob
 }
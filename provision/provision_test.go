@@ -8,6 +8,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"gopkg.in/check.v1"
 )
@@ -123,3 +124,34 @@ func (ProvisionSuite) TestUnitNotFoundError(c *check.C) {
 	var err error = &UnitNotFoundError{ID: "some unit"}
 	c.Assert(err.Error(), check.Equals, `unit "some unit" not found`)
 }
+
+func (ProvisionSuite) TestTsuruYamlDeployTrafficSteps(c *check.C) {
+	var tests = []struct {
+		deploy   TsuruYamlDeploy
+		expected []int
+		err      string
+	}{
+		{TsuruYamlDeploy{}, []int{100}, ""},
+		{TsuruYamlDeploy{Strategy: DeployStrategyBlueGreen}, []int{100}, ""},
+		{TsuruYamlDeploy{Strategy: DeployStrategyCanary}, []int{10, 50, 100}, ""},
+		{TsuruYamlDeploy{Strategy: DeployStrategyCanary, Steps: []int{5, 25}}, []int{5, 25, 100}, ""},
+		{TsuruYamlDeploy{Strategy: DeployStrategyCanary, Steps: []int{20, 100}}, []int{20, 100}, ""},
+		{TsuruYamlDeploy{Strategy: DeployStrategyCanary, Steps: []int{50, 20}}, nil, `invalid deploy steps \[50 20\].*`},
+		{TsuruYamlDeploy{Strategy: DeployStrategyCanary, Steps: []int{0, 20}}, nil, `invalid deploy steps \[0 20\].*`},
+		{TsuruYamlDeploy{Strategy: "rolling"}, nil, `invalid deploy strategy "rolling"`},
+	}
+	for _, t := range tests {
+		steps, err := t.deploy.TrafficSteps()
+		if t.err != "" {
+			c.Check(err, check.ErrorMatches, t.err)
+			continue
+		}
+		c.Check(err, check.IsNil)
+		c.Check(steps, check.DeepEquals, t.expected)
+	}
+}
+
+func (ProvisionSuite) TestTsuruYamlDeployHooksTimeout(c *check.C) {
+	c.Assert(TsuruYamlDeployHooks{}.HookTimeout(), check.Equals, DefaultDeployHookTimeout)
+	c.Assert(TsuruYamlDeployHooks{Timeout: 30}.HookTimeout(), check.Equals, 30*time.Second)
+}
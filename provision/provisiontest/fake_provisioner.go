@@ -55,6 +55,7 @@ type FakeApp struct {
 	UpdatePlatform bool
 	TeamOwner      string
 	Teams          []string
+	Labels         map[string]string
 	quota.Quota
 }
 
@@ -257,6 +258,9 @@ func (a *FakeApp) SetEnv(env bind.EnvVar) {
 }
 
 func (a *FakeApp) SetEnvs(setEnvs bind.SetEnvApp, w io.Writer) error {
+	for _, name := range setEnvs.UnsetVariableNames {
+		delete(a.env, name)
+	}
 	for _, env := range setEnvs.Envs {
 		a.SetEnv(env)
 	}
@@ -278,6 +282,10 @@ func (a *FakeApp) GetLock() provision.AppLock {
 	return nil
 }
 
+func (a *FakeApp) GetLabels() map[string]string {
+	return a.Labels
+}
+
 func (a *FakeApp) GetUnits() ([]bind.Unit, error) {
 	units := make([]bind.Unit, len(a.units))
 	for i := range a.units {
@@ -324,6 +332,10 @@ func (app *FakeApp) GetRouter() (string, error) {
 	return "fake", nil
 }
 
+func (app *FakeApp) GetRouters() ([]string, error) {
+	return []string{"fake"}, nil
+}
+
 func (app *FakeApp) GetTeamsName() []string {
 	return app.Teams
 }
@@ -349,16 +361,19 @@ type FakeProvisioner struct {
 	cmdMut   sync.Mutex
 	outputs  chan []byte
 	failures chan failure
+	exits    chan int
 	apps     map[string]provisionedApp
 	mut      sync.RWMutex
 	shells   map[string][]provision.ShellOptions
 	shellMut sync.Mutex
+	hooks    []provision.DeployHookResult
 }
 
 func NewFakeProvisioner() *FakeProvisioner {
 	p := FakeProvisioner{}
 	p.outputs = make(chan []byte, 8)
 	p.failures = make(chan failure, 8)
+	p.exits = make(chan int, 8)
 	p.apps = make(map[string]provisionedApp)
 	p.shells = make(map[string][]provision.ShellOptions)
 	return &p
@@ -485,6 +500,7 @@ func (p *FakeProvisioner) Reset() {
 
 	p.mut.Lock()
 	p.apps = make(map[string]provisionedApp)
+	p.hooks = nil
 	p.mut.Unlock()
 
 	p.shellMut.Lock()
@@ -495,12 +511,35 @@ func (p *FakeProvisioner) Reset() {
 		select {
 		case <-p.outputs:
 		case <-p.failures:
+		case <-p.exits:
 		default:
 			return
 		}
 	}
 }
 
+// PrepareDeployHooks prepares the deploy hook results reported by the next
+// deploy, in the order they're given.
+func (p *FakeProvisioner) PrepareDeployHooks(results ...provision.DeployHookResult) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.hooks = results
+}
+
+// recordDeployHooks reports the prepared deploy hook results to the writer,
+// when it's a provision.DeployHookRecorder. The caller must hold p.mut.
+func (p *FakeProvisioner) recordDeployHooks(w io.Writer) {
+	hooks := p.hooks
+	p.hooks = nil
+	recorder, ok := w.(provision.DeployHookRecorder)
+	if !ok {
+		return
+	}
+	for _, result := range hooks {
+		recorder.RecordDeployHook(result)
+	}
+}
+
 func (p *FakeProvisioner) Swap(app1, app2 provision.App, cnameOnly bool) error {
 	return routertest.FakeRouter.Swap(app1.GetName(), app2.GetName(), cnameOnly)
 }
@@ -516,6 +555,7 @@ func (p *FakeProvisioner) ArchiveDeploy(app provision.App, archiveURL string, w
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Archive deploy called"))
+	p.recordDeployHooks(w)
 	pApp.lastArchive = archiveURL
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
@@ -532,6 +572,7 @@ func (p *FakeProvisioner) UploadDeploy(app provision.App, file io.ReadCloser, fi
 		return "", errNotProvisioned
 	}
 	w.Write([]byte("Upload deploy called"))
+	p.recordDeployHooks(w)
 	pApp.lastFile = file
 	p.apps[app.GetName()] = pApp
 	return "app-image", nil
@@ -549,6 +590,7 @@ func (p *FakeProvisioner) ImageDeploy(app provision.App, img string, w io.Writer
 	}
 	pApp.image = img
 	w.Write([]byte("Image deploy called"))
+	p.recordDeployHooks(w)
 	p.apps[app.GetName()] = pApp
 	return img, nil
 }
@@ -673,6 +715,12 @@ func (p *FakeProvisioner) Start(app provision.App, process string) error {
 		return errNotProvisioned
 	}
 	pApp.starts[process]++
+	for i, u := range pApp.units {
+		if process == "" || u.ProcessName == process {
+			u.Status = provision.StatusStarted
+			pApp.units[i] = u
+		}
+	}
 	p.apps[app.GetName()] = pApp
 	return nil
 }
@@ -1048,6 +1096,76 @@ func (p *FakeProvisioner) Shell(opts provision.ShellOptions) error {
 	return nil
 }
 
+// SetDeclaredJobs defines the jobs returned by DeclaredJobs for the given
+// app, as if they were declared in its tsuru.yaml.
+func (p *FakeProvisioner) SetDeclaredJobs(app provision.App, jobs []provision.TsuruYamlJob) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	a, ok := p.apps[app.GetName()]
+	if !ok {
+		return errNotProvisioned
+	}
+	a.jobs = jobs
+	p.apps[app.GetName()] = a
+	return nil
+}
+
+func (p *FakeProvisioner) DeclaredJobs(app provision.App) ([]provision.TsuruYamlJob, error) {
+	if err := p.getError("DeclaredJobs"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	a, ok := p.apps[app.GetName()]
+	if !ok {
+		return nil, errNotProvisioned
+	}
+	return a.jobs, nil
+}
+
+// PrepareExitCode prepares the exit status returned by the next call to
+// RunJob, which returns 0 when no exit status is prepared.
+func (p *FakeProvisioner) PrepareExitCode(code int) {
+	p.exits <- code
+}
+
+// RunJob records the command as a Cmd, writes any prepared output to the
+// job output and returns the prepared exit status.
+func (p *FakeProvisioner) RunJob(app provision.App, opts provision.JobOptions) (int, error) {
+	if err := p.getError("RunJob"); err != nil {
+		return 0, err
+	}
+	if !p.Provisioned(app) {
+		return 0, errNotProvisioned
+	}
+	p.cmdMut.Lock()
+	p.cmds = append(p.cmds, Cmd{Cmd: opts.Command, App: app})
+	p.cmdMut.Unlock()
+	select {
+	case output := <-p.outputs:
+		opts.Output.Write(output)
+	default:
+	}
+	select {
+	case code := <-p.exits:
+		return code, nil
+	default:
+	}
+	return 0, nil
+}
+
+// RunHealthcheck fails if a failure is prepared, otherwise it reports every
+// unit as healthy.
+func (p *FakeProvisioner) RunHealthcheck(app provision.App, units []provision.Unit, w io.Writer) error {
+	if err := p.getError("RunHealthcheck"); err != nil {
+		return err
+	}
+	for _, u := range units {
+		fmt.Fprintf(w, " ---> healthcheck successful(%s)\n", u.ID)
+	}
+	return nil
+}
+
 func (p *FakeProvisioner) ValidAppImages(appName string) ([]string, error) {
 	if err := p.getError("ValidAppImages"); err != nil {
 		return nil, err
@@ -1184,6 +1302,7 @@ type provisionedApp struct {
 	unitLen     int
 	lastData    map[string]interface{}
 	image       string
+	jobs        []provision.TsuruYamlJob
 }
 
 type provisionedPlatform struct {
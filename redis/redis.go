@@ -28,6 +28,7 @@ type baseClient interface {
 	Ping() *redis.StatusCmd
 	LRange(key string, start, stop int64) *redis.StringSliceCmd
 	LRem(key string, count int64, value interface{}) *redis.IntCmd
+	LTrim(key string, start, stop int64) *redis.StatusCmd
 	Auth(password string) *redis.StatusCmd
 	Select(index int64) *redis.StatusCmd
 	Keys(pattern string) *redis.StringSliceCmd
@@ -0,0 +1,398 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package api provides a router implementation that manages backends through
+// a REST API, allowing the integration of load balancers without a dedicated
+// router package in tsuru.
+//
+// It does not provide any exported type, in order to use the router, you must
+// import this package and get the router instance using the function
+// router.Get.
+//
+// In order to use this router, you need to define the "routers:<name>:type =
+// api" and "routers:<name>:api-url" in your config. Extra headers sent in
+// every request, e.g. for authentication, may be set in
+// "routers:<name>:headers".
+//
+// The API must implement the following contract, request and response bodies
+// are JSON encoded:
+//
+//   GET    /healthcheck                      200 when the API is working
+//   POST   /backend/{name}                   201, 409 if it already exists
+//   GET    /backend/{name}                   200 with {"address": "..."}, 404
+//   DELETE /backend/{name}                   200, also removing routes and
+//                                            cnames of the backend, 404
+//   PUT    /backend/{name}/healthcheck       200, with {"path": "...",
+//                                            "status": 200, "body": "..."}
+//   GET    /backend/{name}/routes            200 with {"addresses": [...]}
+//   POST   /backend/{name}/routes            200, with {"addresses": [...]},
+//                                            ignoring existing ones
+//   POST   /backend/{name}/routes/remove     200, with {"addresses": [...]},
+//                                            ignoring missing ones
+//   GET    /backend/{name}/cnames            200 with {"cnames": [...]}
+//   POST   /backend/{name}/cnames/{cname}    201, 409 if it already exists
+//   DELETE /backend/{name}/cnames/{cname}    200, 404
+//   POST   /backend/{name}/swap              200, with {"target": "...",
+//                                            "cnameOnly": false}, exchanging
+//                                            the routes, or only the cnames,
+//                                            of both backends
+//
+// Requests to backends that don't exist must return 404 for all endpoints.
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/hc"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/router"
+)
+
+const routerType = "api"
+
+type apiRouter struct {
+	routerName string
+	endpoint   string
+	domain     string
+	headers    http.Header
+	client     *http.Client
+}
+
+type routesReq struct {
+	Addresses []string `json:"addresses"`
+}
+
+type cnamesResp struct {
+	CNames []string `json:"cnames"`
+}
+
+type backendResp struct {
+	Address string `json:"address"`
+}
+
+type swapReq struct {
+	Target    string `json:"target"`
+	CNameOnly bool   `json:"cnameOnly"`
+}
+
+type healthcheckReq struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+func init() {
+	router.Register(routerType, createRouter)
+	hc.AddChecker("Router api", router.BuildHealthCheck(routerType))
+}
+
+func createRouter(routerName, configPrefix string) (router.Router, error) {
+	endpoint, err := config.GetString(configPrefix + ":api-url")
+	if err != nil {
+		return nil, err
+	}
+	domain, _ := config.GetString(configPrefix + ":domain")
+	headers := http.Header{}
+	rawHeaders, _ := config.Get(configPrefix + ":headers")
+	if headersMap, ok := rawHeaders.(map[interface{}]interface{}); ok {
+		for name, value := range headersMap {
+			headers.Set(fmt.Sprint(name), fmt.Sprint(value))
+		}
+	}
+	r := &apiRouter{
+		routerName: routerName,
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		domain:     domain,
+		headers:    headers,
+		client:     tsuruNet.Dial5Full60ClientNoKeepAlive,
+	}
+	return r, nil
+}
+
+func (r *apiRouter) do(method, path string, params interface{}) (int, []byte, error) {
+	var body io.Reader
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, r.endpoint+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	for name, values := range r.headers {
+		req.Header[name] = values
+	}
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := r.client.Do(req)
+	if err != nil {
+		return 0, nil, &router.RouterError{Op: method + " " + path, Err: err}
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return 0, nil, &router.RouterError{Op: method + " " + path, Err: err}
+	}
+	return rsp.StatusCode, data, nil
+}
+
+// doExpect sends the request and checks its status code, mapping 404 and 409
+// to the given errors. The response body is decoded into result, if it's not
+// nil.
+func (r *apiRouter) doExpect(method, path string, params, result interface{}, notFound, conflict error) error {
+	status, data, err := r.do(method, path, params)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == http.StatusNotFound && notFound != nil:
+		return notFound
+	case status == http.StatusConflict && conflict != nil:
+		return conflict
+	case status < 200 || status >= 300:
+		return &router.RouterError{
+			Op:  method + " " + path,
+			Err: fmt.Errorf("invalid response code %d: %s", status, strings.TrimSpace(string(data))),
+		}
+	}
+	if result != nil {
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return &router.RouterError{Op: method + " " + path, Err: fmt.Errorf("invalid response %q: %s", data, err)}
+		}
+	}
+	return nil
+}
+
+func backendPath(backendName string, parts ...string) string {
+	path := "/backend/" + url.QueryEscape(backendName)
+	for _, p := range parts {
+		path += "/" + p
+	}
+	return path
+}
+
+func (r *apiRouter) AddBackend(name string) error {
+	err := r.doExpect("POST", backendPath(name), nil, nil, nil, router.ErrBackendExists)
+	if err != nil {
+		return err
+	}
+	return router.Store(name, name, r.routerName, routerType)
+}
+
+func (r *apiRouter) RemoveBackend(name string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if backendName != name {
+		return router.ErrBackendSwapped
+	}
+	err = r.doExpect("DELETE", backendPath(backendName), nil, nil, router.ErrBackendNotFound, nil)
+	if err != nil {
+		return err
+	}
+	return router.Remove(backendName, r.routerName, routerType)
+}
+
+func (r *apiRouter) routes(backendName string) ([]string, error) {
+	var rsp routesReq
+	err := r.doExpect("GET", backendPath(backendName, "routes"), nil, &rsp, router.ErrBackendNotFound, nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Addresses, nil
+}
+
+func (r *apiRouter) AddRoute(name string, address *url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes, err := r.routes(backendName)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if route == address.String() {
+			return router.ErrRouteExists
+		}
+	}
+	return r.addRoutes(backendName, []*url.URL{address})
+}
+
+func (r *apiRouter) AddRoutes(name string, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	return r.addRoutes(backendName, addresses)
+}
+
+func (r *apiRouter) addRoutes(backendName string, addresses []*url.URL) error {
+	req := routesReq{Addresses: urlStrings(addresses)}
+	return r.doExpect("POST", backendPath(backendName, "routes"), req, nil, router.ErrBackendNotFound, nil)
+}
+
+func (r *apiRouter) RemoveRoute(name string, address *url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	routes, err := r.routes(backendName)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if route == address.String() {
+			return r.removeRoutes(backendName, []*url.URL{address})
+		}
+	}
+	return router.ErrRouteNotFound
+}
+
+func (r *apiRouter) RemoveRoutes(name string, addresses []*url.URL) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	return r.removeRoutes(backendName, addresses)
+}
+
+func (r *apiRouter) removeRoutes(backendName string, addresses []*url.URL) error {
+	req := routesReq{Addresses: urlStrings(addresses)}
+	return r.doExpect("POST", backendPath(backendName, "routes", "remove"), req, nil, router.ErrBackendNotFound, nil)
+}
+
+func (r *apiRouter) Routes(name string) ([]*url.URL, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := r.routes(backendName)
+	if err != nil {
+		return nil, err
+	}
+	return parseURLs(routes)
+}
+
+func (r *apiRouter) SetCName(cname, name string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if r.domain != "" && !router.ValidCName(cname, r.domain) {
+		return router.ErrCNameNotAllowed
+	}
+	return r.doExpect("POST", backendPath(backendName, "cnames", url.QueryEscape(cname)), nil, nil, router.ErrBackendNotFound, router.ErrCNameExists)
+}
+
+func (r *apiRouter) UnsetCName(cname, name string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	return r.doExpect("DELETE", backendPath(backendName, "cnames", url.QueryEscape(cname)), nil, nil, router.ErrCNameNotFound, nil)
+}
+
+func (r *apiRouter) CNames(name string) ([]*url.URL, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	var rsp cnamesResp
+	err = r.doExpect("GET", backendPath(backendName, "cnames"), nil, &rsp, router.ErrBackendNotFound, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseURLs(rsp.CNames)
+}
+
+func (r *apiRouter) Addr(name string) (string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	var rsp backendResp
+	err = r.doExpect("GET", backendPath(backendName), nil, &rsp, router.ErrBackendNotFound, nil)
+	if err != nil {
+		return "", err
+	}
+	return rsp.Address, nil
+}
+
+// Swap asks the API to exchange the routes, or the cnames, of both backends,
+// the names of the backends are then swapped in tsuru, as done by
+// router.Swap.
+func (r *apiRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
+	name1, err := router.Retrieve(backend1)
+	if err != nil {
+		return err
+	}
+	name2, err := router.Retrieve(backend2)
+	if err != nil {
+		return err
+	}
+	req := swapReq{Target: name2, CNameOnly: cnameOnly}
+	err = r.doExpect("POST", backendPath(name1, "swap"), req, nil, router.ErrBackendNotFound, nil)
+	if err != nil {
+		return err
+	}
+	if cnameOnly {
+		return nil
+	}
+	return router.SwapBackendName(backend1, backend2)
+}
+
+func (r *apiRouter) SetHealthcheck(name string, data router.HealthcheckData) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	req := healthcheckReq{Path: data.Path, Status: data.Status, Body: data.Body}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	return r.doExpect("PUT", backendPath(backendName, "healthcheck"), req, nil, router.ErrBackendNotFound, nil)
+}
+
+func (r *apiRouter) HealthCheck() error {
+	return r.doExpect("GET", "/healthcheck", nil, nil, nil, nil)
+}
+
+func (r *apiRouter) StartupMessage() (string, error) {
+	return fmt.Sprintf("api router %q with API URL %q.", r.routerName, r.endpoint), nil
+}
+
+func urlStrings(urls []*url.URL) []string {
+	result := make([]string, len(urls))
+	for i, u := range urls {
+		result[i] = u.String()
+	}
+	return result
+}
+
+func parseURLs(values []string) ([]*url.URL, error) {
+	result := make([]*url.URL, len(values))
+	for i, v := range values {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = u
+	}
+	return result, nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type fakeBackend struct {
+	routes      []string
+	cnames      []string
+	healthcheck healthcheckReq
+}
+
+type fakeAPIServer struct {
+	sync.Mutex
+	domain   string
+	backends map[string]*fakeBackend
+	headers  []http.Header
+	router   *mux.Router
+}
+
+func newFakeAPIServer(domain string) *fakeAPIServer {
+	s := &fakeAPIServer{domain: domain, backends: make(map[string]*fakeBackend)}
+	r := mux.NewRouter()
+	r.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {})
+	r.HandleFunc("/backend/{name}", s.addBackend).Methods("POST")
+	r.HandleFunc("/backend/{name}", s.getBackend).Methods("GET")
+	r.HandleFunc("/backend/{name}", s.removeBackend).Methods("DELETE")
+	r.HandleFunc("/backend/{name}/healthcheck", s.setHealthcheck).Methods("PUT")
+	r.HandleFunc("/backend/{name}/routes", s.getRoutes).Methods("GET")
+	r.HandleFunc("/backend/{name}/routes", s.addRoutes).Methods("POST")
+	r.HandleFunc("/backend/{name}/routes/remove", s.removeRoutes).Methods("POST")
+	r.HandleFunc("/backend/{name}/cnames", s.getCNames).Methods("GET")
+	r.HandleFunc("/backend/{name}/cnames/{cname}", s.setCName).Methods("POST")
+	r.HandleFunc("/backend/{name}/cnames/{cname}", s.unsetCName).Methods("DELETE")
+	r.HandleFunc("/backend/{name}/swap", s.swap).Methods("POST")
+	s.router = r
+	return s
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.headers = append(s.headers, r.Header)
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *fakeAPIServer) backend(w http.ResponseWriter, r *http.Request) *fakeBackend {
+	backend := s.backends[mux.Vars(r)["name"]]
+	if backend == nil {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	return backend
+}
+
+func (s *fakeAPIServer) addBackend(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := s.backends[name]; ok {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	s.backends[name] = &fakeBackend{routes: []string{}, cnames: []string{}}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *fakeAPIServer) getBackend(w http.ResponseWriter, r *http.Request) {
+	if s.backend(w, r) == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(backendResp{Address: mux.Vars(r)["name"] + "." + s.domain})
+}
+
+func (s *fakeAPIServer) removeBackend(w http.ResponseWriter, r *http.Request) {
+	if s.backend(w, r) == nil {
+		return
+	}
+	delete(s.backends, mux.Vars(r)["name"])
+}
+
+func (s *fakeAPIServer) setHealthcheck(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	json.NewDecoder(r.Body).Decode(&backend.healthcheck)
+}
+
+func (s *fakeAPIServer) getRoutes(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(routesReq{Addresses: backend.routes})
+}
+
+func (s *fakeAPIServer) addRoutes(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	var req routesReq
+	json.NewDecoder(r.Body).Decode(&req)
+	for _, addr := range req.Addresses {
+		if indexOf(backend.routes, addr) < 0 {
+			backend.routes = append(backend.routes, addr)
+		}
+	}
+}
+
+func (s *fakeAPIServer) removeRoutes(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	var req routesReq
+	json.NewDecoder(r.Body).Decode(&req)
+	for _, addr := range req.Addresses {
+		if i := indexOf(backend.routes, addr); i >= 0 {
+			backend.routes = append(backend.routes[:i], backend.routes[i+1:]...)
+		}
+	}
+}
+
+func (s *fakeAPIServer) getCNames(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(cnamesResp{CNames: backend.cnames})
+}
+
+func (s *fakeAPIServer) setCName(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	cname := mux.Vars(r)["cname"]
+	for _, b := range s.backends {
+		if indexOf(b.cnames, cname) >= 0 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+	backend.cnames = append(backend.cnames, cname)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *fakeAPIServer) unsetCName(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	i := indexOf(backend.cnames, mux.Vars(r)["cname"])
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	backend.cnames = append(backend.cnames[:i], backend.cnames[i+1:]...)
+}
+
+func (s *fakeAPIServer) swap(w http.ResponseWriter, r *http.Request) {
+	backend := s.backend(w, r)
+	if backend == nil {
+		return
+	}
+	var req swapReq
+	json.NewDecoder(r.Body).Decode(&req)
+	target := s.backends[req.Target]
+	if target == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.CNameOnly {
+		backend.cnames, target.cnames = target.cnames, backend.cnames
+	} else {
+		backend.routes, target.routes = target.routes, backend.routes
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func init() {
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc: func(c *check.C) {
+			config.Set("routers:apirouter:type", "api")
+			config.Set("routers:apirouter:domain", "apirouter.com")
+			config.Set("database:url", "127.0.0.1:27017")
+			config.Set("database:name", "router_api_tests")
+		},
+	}
+	var server *httptest.Server
+	var fakeServer *fakeAPIServer
+	suite.SetUpTestFunc = func(c *check.C) {
+		fakeServer = newFakeAPIServer("apirouter.com")
+		server = httptest.NewServer(fakeServer)
+		config.Set("routers:apirouter:api-url", server.URL)
+		r, err := createRouter("apirouter", "routers:apirouter")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+		conn, err := db.Conn()
+		c.Assert(err, check.IsNil)
+		defer conn.Close()
+		dbtest.ClearAllCollections(conn.Collection("router_api_tests").Database)
+	}
+	suite.TearDownTestFunc = func(c *check.C) {
+		server.Close()
+		c.Check(fakeServer.backends, check.DeepEquals, map[string]*fakeBackend{})
+	}
+	check.Suite(suite)
+}
+
+type S struct {
+	server     *httptest.Server
+	fakeServer *fakeAPIServer
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.fakeServer = newFakeAPIServer("apirouter.com")
+	s.server = httptest.NewServer(s.fakeServer)
+	config.Set("routers:apirouter:type", "api")
+	config.Set("routers:apirouter:api-url", s.server.URL)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.server.Close()
+	config.Unset("routers")
+}
+
+func (s *S) TestCreateRouterRequiresURL(c *check.C) {
+	config.Unset("routers:apirouter:api-url")
+	_, err := createRouter("apirouter", "routers:apirouter")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestHeaders(c *check.C) {
+	config.Set("routers:apirouter:headers", map[interface{}]interface{}{"X-Api-Token": "secret"})
+	r, err := router.Get("apirouter")
+	c.Assert(err, check.IsNil)
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.fakeServer.headers, check.HasLen, 1)
+	c.Assert(s.fakeServer.headers[0].Get("X-Api-Token"), check.Equals, "secret")
+}
+
+func (s *S) TestHealthCheckFailure(c *check.C) {
+	s.server.Close()
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	config.Set("routers:apirouter:api-url", s.server.URL)
+	r, err := router.Get("apirouter")
+	c.Assert(err, check.IsNil)
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.ErrorMatches, `\[router GET /healthcheck\] invalid response code 500: broken`)
+}
@@ -102,7 +102,7 @@ func (r *galebRouter) AddBackend(name string) error {
 	if err != nil {
 		return err
 	}
-	return router.Store(name, name, routerType)
+	return router.Store(name, name, r.routerName, routerType)
 }
 
 func (r *galebRouter) AddRoute(name string, address *url.URL) error {
@@ -262,6 +262,64 @@ func (r *galebRouter) Routes(name string) ([]*url.URL, error) {
 	return urls, nil
 }
 
+// SetWeightedRoutes relies on the weight property of galeb targets, the
+// balance policy of the pools must take it into account.
+func (r *galebRouter) SetWeightedRoutes(name string, routes []router.WeightedRoute) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	poolName := r.poolName(backendName)
+	routes = router.ReduceWeights(routes)
+	weights := make(map[string]int, len(routes))
+	for _, route := range routes {
+		weights[route.Address.String()] = route.Weight
+	}
+	targets, err := r.client.FindTargetsByParent(poolName)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	var toRemove []string
+	for _, target := range targets {
+		if _, ok := weights[target.Name]; ok {
+			existing[target.Name] = true
+		} else {
+			toRemove = append(toRemove, target.FullId())
+		}
+	}
+	var toAdd []*url.URL
+	for _, route := range routes {
+		if !existing[route.Address.String()] {
+			toAdd = append(toAdd, route.Address)
+		}
+	}
+	if len(toAdd) > 0 {
+		err = r.client.AddBackends(toAdd, poolName)
+		if err != nil {
+			return err
+		}
+		targets, err = r.client.FindTargetsByParent(poolName)
+		if err != nil {
+			return err
+		}
+	}
+	for _, target := range targets {
+		weight, ok := weights[target.Name]
+		if !ok {
+			continue
+		}
+		err = r.client.UpdateTargetProperties(target.FullId(), galebClient.TargetProperties{Weight: weight})
+		if err != nil {
+			return err
+		}
+	}
+	if len(toRemove) == 0 {
+		return nil
+	}
+	return r.client.RemoveBackendsByIDs(toRemove)
+}
+
 func (r *galebRouter) StartupMessage() (string, error) {
 	return fmt.Sprintf("galeb router %q with API URL %q.", r.domain, r.client.ApiUrl), nil
 }
@@ -308,7 +366,7 @@ func (r *galebRouter) RemoveBackend(name string) error {
 	if err != nil {
 		return err
 	}
-	return router.Remove(backendName)
+	return router.Remove(backendName, r.routerName, routerType)
 }
 
 func (r *galebRouter) SetHealthcheck(name string, data router.HealthcheckData) error {
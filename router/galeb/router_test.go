@@ -58,6 +58,7 @@ func NewFakeGalebServer() (*fakeGalebServer, error) {
 	r.HandleFunc("/api/target", server.createTarget).Methods("POST")
 	r.HandleFunc("/api/pool", server.createPool).Methods("POST")
 	r.HandleFunc("/api/pool/{id}", server.updatePool).Methods("PATCH")
+	r.HandleFunc("/api/target/{id}", server.updateTarget).Methods("PATCH")
 	r.HandleFunc("/api/rule", server.createRule).Methods("POST")
 	r.HandleFunc("/api/virtualhost", server.createVirtualhost).Methods("POST")
 	r.HandleFunc("/api/{item}/{id}", server.findItem).Methods("GET")
@@ -198,6 +199,19 @@ func (s *fakeGalebServer) updatePool(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *fakeGalebServer) updateTarget(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var target galebClient.Target
+	json.NewDecoder(r.Body).Decode(&target)
+	existingTarget, ok := s.targets[id].(*galebClient.Target)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	existingTarget.Properties = target.Properties
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *fakeGalebServer) createRule(w http.ResponseWriter, r *http.Request) {
 	var rule galebClient.Rule
 	rule.Status = "OK"
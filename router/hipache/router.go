@@ -43,7 +43,7 @@ func init() {
 }
 
 func createRouter(routerName, configPrefix string) (router.Router, error) {
-	return &hipacheRouter{prefix: configPrefix}, nil
+	return &hipacheRouter{routerName: routerName, prefix: configPrefix}, nil
 }
 
 func (r *hipacheRouter) connect() (tsuruRedis.Client, error) {
@@ -78,7 +78,8 @@ func (r *hipacheRouter) connect() (tsuruRedis.Client, error) {
 }
 
 type hipacheRouter struct {
-	prefix string
+	routerName string
+	prefix     string
 }
 
 func (r *hipacheRouter) AddBackend(name string) error {
@@ -102,7 +103,7 @@ func (r *hipacheRouter) AddBackend(name string) error {
 	if err != nil {
 		return &router.RouterError{Op: "add", Err: err}
 	}
-	return router.Store(name, name, routerType)
+	return router.Store(name, name, r.routerName, routerType)
 }
 
 func (r *hipacheRouter) RemoveBackend(name string) error {
@@ -126,7 +127,7 @@ func (r *hipacheRouter) RemoveBackend(name string) error {
 	if err != nil {
 		return &router.RouterError{Op: "remove", Err: err}
 	}
-	err = router.Remove(backendName)
+	err = router.Remove(backendName, r.routerName, routerType)
 	if err != nil {
 		return &router.RouterError{Op: "remove", Err: err}
 	}
@@ -517,16 +518,68 @@ func (r *hipacheRouter) Routes(name string) ([]*url.URL, error) {
 		return nil, router.ErrBackendNotFound
 	}
 	routes = routes[1:]
-	result := make([]*url.URL, len(routes))
-	for i, route := range routes {
-		result[i], err = url.Parse(route)
+	// Weighted routes are stored as repeated entries, each address must be
+	// listed only once.
+	seen := make(map[string]bool, len(routes))
+	result := make([]*url.URL, 0, len(routes))
+	for _, route := range routes {
+		if seen[route] {
+			continue
+		}
+		seen[route] = true
+		u, err := url.Parse(route)
 		if err != nil {
 			return nil, err
 		}
+		result = append(result, u)
 	}
 	return result, nil
 }
 
+// SetWeightedRoutes stores each route as many times as its weight, as hipache
+// balances requests between the entries of a frontend using round robin.
+func (r *hipacheRouter) SetWeightedRoutes(name string, routes []router.WeightedRoute) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	domain, err := config.GetString(r.prefix + ":domain")
+	if err != nil {
+		return &router.RouterError{Op: "setWeightedRoutes", Err: err}
+	}
+	var entries []string
+	for _, route := range router.ReduceWeights(routes) {
+		for i := 0; i < route.Weight; i++ {
+			entries = append(entries, route.Address.String())
+		}
+	}
+	cnames, err := r.getCNames(backendName)
+	if err != nil {
+		return err
+	}
+	frontends := []string{"frontend:" + backendName + "." + domain}
+	for _, cname := range cnames {
+		frontends = append(frontends, "frontend:"+cname)
+	}
+	conn, err := r.connect()
+	if err != nil {
+		return &router.RouterError{Op: "setWeightedRoutes", Err: err}
+	}
+	pipe := conn.Pipeline()
+	defer pipe.Close()
+	for _, frontend := range frontends {
+		pipe.LTrim(frontend, 0, 0)
+		if len(entries) > 0 {
+			pipe.RPush(frontend, entries...)
+		}
+	}
+	_, err = pipe.Exec()
+	if err != nil {
+		return &router.RouterError{Op: "setWeightedRoutes", Err: err}
+	}
+	return nil
+}
+
 func (r *hipacheRouter) removeElement(name, address string) (int, error) {
 	conn, err := r.connect()
 	if err != nil {
@@ -592,3 +645,33 @@ func (r *hipacheRouter) SetHealthcheck(name string, data router.HealthcheckData)
 	}
 	return nil
 }
+
+func (r *hipacheRouter) AddCertificate(cname, certificate, key string) error {
+	conn, err := r.connect()
+	if err != nil {
+		return &router.RouterError{Op: "addCertificate", Err: err}
+	}
+	err = conn.HMSetMap("tls:"+cname, map[string]string{
+		"certificate": certificate,
+		"key":         key,
+	}).Err()
+	if err != nil {
+		return &router.RouterError{Op: "addCertificate", Err: err}
+	}
+	return nil
+}
+
+func (r *hipacheRouter) RemoveCertificate(cname string) error {
+	conn, err := r.connect()
+	if err != nil {
+		return &router.RouterError{Op: "removeCertificate", Err: err}
+	}
+	count, err := conn.Del("tls:" + cname).Result()
+	if err != nil {
+		return &router.RouterError{Op: "removeCertificate", Err: err}
+	}
+	if count == 0 {
+		return router.ErrCertificateNotFound
+	}
+	return nil
+}
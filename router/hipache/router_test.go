@@ -684,3 +684,41 @@ func (s *S) TestAddRouteAfterCorruptedRedis(c *check.C) {
 	err = r.AddRoute(backend1, addr1)
 	c.Assert(err, check.Equals, router.ErrBackendNotFound)
 }
+
+func (s *S) TestSetWeightedRoutes(c *check.C) {
+	r := hipacheRouter{prefix: "hipache"}
+	err := r.AddBackend("tip")
+	c.Assert(err, check.IsNil)
+	defer r.RemoveBackend("tip")
+	err = r.SetCName("mycname.com", "tip")
+	c.Assert(err, check.IsNil)
+	addr1, _ := url.Parse("http://10.10.10.10:8080")
+	addr2, _ := url.Parse("http://10.10.10.11:8080")
+	err = r.AddRoute("tip", addr1)
+	c.Assert(err, check.IsNil)
+	err = r.SetWeightedRoutes("tip", []router.WeightedRoute{
+		{Address: addr1, Weight: 90},
+		{Address: addr2, Weight: 30},
+	})
+	c.Assert(err, check.IsNil)
+	conn, err := r.connect()
+	c.Assert(err, check.IsNil)
+	expected := []string{"tip", addr1.String(), addr1.String(), addr1.String(), addr2.String()}
+	entries, err := conn.LRange("frontend:tip.golang.org", 0, -1).Result()
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.DeepEquals, expected)
+	entries, err = conn.LRange("frontend:mycname.com", 0, -1).Result()
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.DeepEquals, expected)
+	routes, err := r.Routes("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{addr1, addr2})
+	err = r.SetWeightedRoutes("tip", []router.WeightedRoute{
+		{Address: addr1, Weight: 0},
+		{Address: addr2, Weight: 1},
+	})
+	c.Assert(err, check.IsNil)
+	routes, err = r.Routes("tip")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{addr2})
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrSwapMultipleRouters = errors.New("swap is not supported for apps attached to multiple routers")
+
+// GetMulti returns a router fanning changes out to all the named routers.
+// Queries, like Addr, Routes and CNames, are answered by the first router.
+//
+// The returned router implements CustomHealthcheckRouter, setting the
+// healthcheck on the routers supporting it, and implements WeightedRouter only
+// if all the named routers implement it.
+func GetMulti(names []string) (Router, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no routers given")
+	}
+	if len(names) == 1 {
+		return Get(names[0])
+	}
+	m := &multiRouter{names: names}
+	weighted := true
+	for _, name := range names {
+		r, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.(WeightedRouter); !ok {
+			weighted = false
+		}
+		m.routers = append(m.routers, r)
+	}
+	if weighted {
+		return &weightedMultiRouter{multiRouter: m}, nil
+	}
+	return m, nil
+}
+
+type multiRouter struct {
+	names   []string
+	routers []Router
+}
+
+// MultiRouterError is returned when a change fails in more than one of the
+// routers of an app, holding the error of each router by name.
+type MultiRouterError struct {
+	Errors map[string]error
+}
+
+func (e *MultiRouterError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("router %q: %s", name, e.Errors[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// each applies the change to all the routers, even when it fails in some of
+// them, so a failure in one router doesn't leave the others half updated. The
+// error of a single failed router is returned as is.
+func (m *multiRouter) each(fn func(r Router) error) error {
+	var errs map[string]error
+	var lastErr error
+	for i, r := range m.routers {
+		err := fn(r)
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[m.names[i]] = err
+			lastErr = err
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return lastErr
+	}
+	return &MultiRouterError{Errors: errs}
+}
+
+// AddBackend adds the backend to the routers missing it, returning
+// ErrBackendExists only if all of them already had it.
+func (m *multiRouter) AddBackend(name string) error {
+	existing := 0
+	err := m.each(func(r Router) error {
+		err := r.AddBackend(name)
+		if err == ErrBackendExists {
+			existing++
+			return nil
+		}
+		return err
+	})
+	if err == nil && existing == len(m.routers) {
+		return ErrBackendExists
+	}
+	return err
+}
+
+func (m *multiRouter) RemoveBackend(name string) error {
+	return m.each(func(r Router) error {
+		return r.RemoveBackend(name)
+	})
+}
+
+func (m *multiRouter) AddRoute(name string, address *url.URL) error {
+	return m.each(func(r Router) error {
+		return r.AddRoute(name, address)
+	})
+}
+
+func (m *multiRouter) AddRoutes(name string, addresses []*url.URL) error {
+	return m.each(func(r Router) error {
+		return r.AddRoutes(name, addresses)
+	})
+}
+
+func (m *multiRouter) RemoveRoute(name string, address *url.URL) error {
+	return m.each(func(r Router) error {
+		return r.RemoveRoute(name, address)
+	})
+}
+
+func (m *multiRouter) RemoveRoutes(name string, addresses []*url.URL) error {
+	return m.each(func(r Router) error {
+		return r.RemoveRoutes(name, addresses)
+	})
+}
+
+func (m *multiRouter) SetCName(cname, name string) error {
+	return m.each(func(r Router) error {
+		return r.SetCName(cname, name)
+	})
+}
+
+func (m *multiRouter) UnsetCName(cname, name string) error {
+	return m.each(func(r Router) error {
+		return r.UnsetCName(cname, name)
+	})
+}
+
+func (m *multiRouter) Addr(name string) (string, error) {
+	return m.routers[0].Addr(name)
+}
+
+func (m *multiRouter) CNames(name string) ([]*url.URL, error) {
+	return m.routers[0].CNames(name)
+}
+
+func (m *multiRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
+	return ErrSwapMultipleRouters
+}
+
+func (m *multiRouter) Routes(name string) ([]*url.URL, error) {
+	return m.routers[0].Routes(name)
+}
+
+func (m *multiRouter) SetHealthcheck(name string, data HealthcheckData) error {
+	return m.each(func(r Router) error {
+		if hcRouter, ok := r.(CustomHealthcheckRouter); ok {
+			return hcRouter.SetHealthcheck(name, data)
+		}
+		return nil
+	})
+}
+
+type weightedMultiRouter struct {
+	*multiRouter
+}
+
+func (m *weightedMultiRouter) SetWeightedRoutes(name string, routes []WeightedRoute) error {
+	return m.each(func(r Router) error {
+		return r.(WeightedRouter).SetWeightedRoutes(name, routes)
+	})
+}
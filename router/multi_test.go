@@ -0,0 +1,109 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package router_test
+
+import (
+	"net/url"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *ExternalSuite) TestGetMultiSingleRouter(c *check.C) {
+	r, err := router.GetMulti([]string{"fake"})
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.Equals, &routertest.FakeRouter)
+	_, err = router.GetMulti(nil)
+	c.Assert(err, check.NotNil)
+}
+
+func (s *ExternalSuite) TestMultiRouterFansOut(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	defer routertest.FakeRouter.Reset()
+	defer routertest.HCRouter.Reset()
+	r, err := router.GetMulti([]string{"fake", "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("multi")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("multi"), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasBackend("multi"), check.Equals, true)
+	err = r.AddBackend("multi")
+	c.Assert(err, check.Equals, router.ErrBackendExists)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.AddRoutes("multi", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute("multi", addr.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute("multi", addr.String()), check.Equals, true)
+	err = r.SetCName("multi.example.com", "multi")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasCName("multi.example.com"), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasCName("multi.example.com"), check.Equals, true)
+	hcRouter, ok := r.(router.CustomHealthcheckRouter)
+	c.Assert(ok, check.Equals, true)
+	hc := router.HealthcheckData{Path: "/healthcheck", Status: 200}
+	err = hcRouter.SetHealthcheck("multi", hc)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.GetHealthcheck("multi"), check.DeepEquals, hc)
+	c.Assert(routertest.HCRouter.GetHealthcheck("multi"), check.DeepEquals, hc)
+	err = r.RemoveRoutes("multi", []*url.URL{addr})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute("multi", addr.String()), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasRoute("multi", addr.String()), check.Equals, false)
+	err = r.RemoveBackend("multi")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("multi"), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasBackend("multi"), check.Equals, false)
+}
+
+func (s *ExternalSuite) TestMultiRouterWeighted(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	r, err := router.GetMulti([]string{"fake", "fake-hc"})
+	c.Assert(err, check.IsNil)
+	wRouter, ok := r.(router.WeightedRouter)
+	c.Assert(ok, check.Equals, true)
+	defer routertest.FakeRouter.Reset()
+	defer routertest.HCRouter.Reset()
+	err = r.AddBackend("multi")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = wRouter.SetWeightedRoutes("multi", []router.WeightedRoute{{Address: addr, Weight: 1}})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute("multi", addr.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute("multi", addr.String()), check.Equals, true)
+}
+
+func (s *ExternalSuite) TestMultiRouterSwap(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	r, err := router.GetMulti([]string{"fake", "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = r.Swap("b1", "b2", false)
+	c.Assert(err, check.Equals, router.ErrSwapMultipleRouters)
+}
+
+func (s *ExternalSuite) TestMultiRouterCollectsErrors(c *check.C) {
+	config.Set("routers:fake-hc:type", "fake-hc")
+	defer config.Unset("routers:fake-hc")
+	defer routertest.FakeRouter.Reset()
+	defer routertest.HCRouter.Reset()
+	r, err := router.GetMulti([]string{"fake", "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("multi")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	routertest.FakeRouter.FailForIp(addr.String())
+	err = r.AddRoute("multi", addr)
+	c.Assert(err, check.Equals, routertest.ErrForcedFailure)
+	c.Assert(routertest.FakeRouter.HasRoute("multi", addr.String()), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasRoute("multi", addr.String()), check.Equals, true)
+	routertest.HCRouter.FailForIp(addr.String())
+	err = r.RemoveRoute("multi", addr)
+	c.Assert(err, check.FitsTypeOf, &router.MultiRouterError{})
+	c.Assert(err.Error(), check.Equals, `router "fake": Forced failure; router "fake-hc": Forced failure`)
+}
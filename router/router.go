@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -24,14 +25,15 @@ import (
 type routerFactory func(routerName, configPrefix string) (Router, error)
 
 var (
-	ErrBackendExists   = errors.New("Backend already exists")
-	ErrBackendNotFound = errors.New("Backend not found")
-	ErrBackendSwapped  = errors.New("Backend is swapped cannot remove")
-	ErrRouteExists     = errors.New("Route already exists")
-	ErrRouteNotFound   = errors.New("Route not found")
-	ErrCNameExists     = errors.New("CName already exists")
-	ErrCNameNotFound   = errors.New("CName not found")
-	ErrCNameNotAllowed = errors.New("CName as router subdomain not allowed")
+	ErrBackendExists       = errors.New("Backend already exists")
+	ErrBackendNotFound     = errors.New("Backend not found")
+	ErrBackendSwapped      = errors.New("Backend is swapped cannot remove")
+	ErrRouteExists         = errors.New("Route already exists")
+	ErrRouteNotFound       = errors.New("Route not found")
+	ErrCNameExists         = errors.New("CName already exists")
+	ErrCNameNotFound       = errors.New("CName not found")
+	ErrCNameNotAllowed     = errors.New("CName as router subdomain not allowed")
+	ErrCertificateNotFound = errors.New("Certificate not found")
 )
 
 var routers = make(map[string]routerFactory)
@@ -94,6 +96,36 @@ type CustomHealthcheckRouter interface {
 	SetHealthcheck(name string, data HealthcheckData) error
 }
 
+// WeightedRouter is a router able to split the traffic of a backend between
+// its routes proportionally to the weight of each route.
+type WeightedRouter interface {
+	// SetWeightedRoutes replaces the routes of the backend with the given
+	// ones. Routes with weight zero are removed from the backend.
+	SetWeightedRoutes(name string, routes []WeightedRoute) error
+}
+
+type WeightedRoute struct {
+	Address *url.URL
+	Weight  int
+}
+
+// TrafficRouter is a router able to report when a backend last received a
+// request, used to detect idle apps.
+type TrafficRouter interface {
+	// LastRequest returns the time of the last request routed to the
+	// backend, or the zero time if it never received requests.
+	LastRequest(name string) (time.Time, error)
+}
+
+// TLSRouter is a router able to terminate TLS connections to the cnames of
+// its backends.
+type TLSRouter interface {
+	// AddCertificate sets the PEM encoded certificate and private key used
+	// for the cname, replacing any previous one.
+	AddCertificate(cname, certificate, key string) error
+	RemoveCertificate(cname string) error
+}
+
 type HealthChecker interface {
 	HealthCheck() error
 }
@@ -121,20 +153,34 @@ func collection() (*storage.Collection, error) {
 	return conn.Collection("routers"), nil
 }
 
-// Store stores the app name related with the
-// router name.
-func Store(appName, routerName, kind string) error {
+// Store stores the name of the backend of the app in the named router, of the
+// given kind. An app attached to several routers has one record for each of
+// them, including routers of the same kind.
+func Store(appName, backendName, routerName, kind string) error {
 	coll, err := collection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
 	data := map[string]string{
-		"app":    appName,
-		"router": routerName,
-		"kind":   kind,
+		"app":        appName,
+		"router":     backendName,
+		"routername": routerName,
+		"kind":       kind,
 	}
-	return coll.Insert(&data)
+	_, err = coll.Upsert(recordQuery(appName, routerName, kind), bson.M{"$set": data})
+	return err
+}
+
+// recordQuery matches the record of the app in the named router. Records
+// stored before they were keyed by the router name are matched by the kind of
+// the router, and records stored before kind existed belong to hipache.
+func recordQuery(appName, routerName, kind string) bson.M {
+	legacy := bson.M{"routername": bson.M{"$exists": false}, "kind": kind}
+	if kind == "hipache" {
+		legacy["kind"] = bson.M{"$in": []interface{}{kind, "", nil}}
+	}
+	return bson.M{"app": appName, "$or": []bson.M{{"routername": routerName}, legacy}}
 }
 
 func retrieveRouterData(appName string) (map[string]string, error) {
@@ -164,16 +210,20 @@ func Retrieve(appName string) (string, error) {
 	return data["router"], nil
 }
 
-func Remove(appName string) error {
+// Remove removes the record of the app in the named router, of the given
+// kind, keeping the records of the other routers the app is attached to.
+func Remove(appName, routerName, kind string) error {
 	coll, err := collection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
-	return coll.Remove(bson.M{"app": appName})
+	return coll.Remove(recordQuery(appName, routerName, kind))
 }
 
-func swapBackendName(backend1, backend2 string) error {
+// SwapBackendName exchanges the backend names stored for both apps. It's used
+// by Swap and by routers that swap the routes of the backends by themselves.
+func SwapBackendName(backend1, backend2 string) error {
 	coll, err := collection()
 	if err != nil {
 		return err
@@ -188,12 +238,13 @@ func swapBackendName(backend1, backend2 string) error {
 		return err
 	}
 	update := bson.M{"$set": bson.M{"router": router2}}
-	err = coll.Update(bson.M{"app": backend1}, update)
+	_, err = coll.UpdateAll(bson.M{"app": backend1}, update)
 	if err != nil {
 		return err
 	}
 	update = bson.M{"$set": bson.M{"router": router1}}
-	return coll.Update(bson.M{"app": backend2}, update)
+	_, err = coll.UpdateAll(bson.M{"app": backend2}, update)
+	return err
 }
 
 func swapCnames(r Router, backend1, backend2 string) error {
@@ -253,7 +304,7 @@ func swapBackends(r Router, backend1, backend2 string) error {
 	if err != nil {
 		return err
 	}
-	return swapBackendName(backend1, backend2)
+	return SwapBackendName(backend1, backend2)
 
 }
 
@@ -324,3 +375,46 @@ func IsSwapped(name string) (bool, string, error) {
 	}
 	return name != backendName, backendName, nil
 }
+
+// maxWeightsSum is the maximum sum of the weights returned by ReduceWeights,
+// routers that replicate routes to achieve the weights rely on it to keep the
+// number of replicas small.
+const maxWeightsSum = 100
+
+// ReduceWeights returns the given routes, without the ones with weight zero,
+// with the smallest weights keeping the same traffic proportions. When the
+// sum of the weights is still larger than 100 they're scaled down, possibly
+// losing some precision.
+func ReduceWeights(routes []WeightedRoute) []WeightedRoute {
+	result := make([]WeightedRoute, 0, len(routes))
+	var divisor, sum int
+	for _, r := range routes {
+		if r.Weight <= 0 {
+			continue
+		}
+		result = append(result, r)
+		divisor = gcd(divisor, r.Weight)
+		sum += r.Weight
+	}
+	if divisor == 0 {
+		return result
+	}
+	sum /= divisor
+	for i := range result {
+		result[i].Weight /= divisor
+		if sum > maxWeightsSum {
+			result[i].Weight = result[i].Weight * maxWeightsSum / sum
+			if result[i].Weight == 0 {
+				result[i].Weight = 1
+			}
+		}
+	}
+	return result
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -6,6 +6,7 @@ package router
 
 import (
 	"errors"
+	"net/url"
 
 	"github.com/tsuru/config"
 	"gopkg.in/check.v1"
@@ -61,28 +62,95 @@ func (s *S) TestRegisterAndGetCustomNamedRouter(c *check.C) {
 }
 
 func (s *S) TestStore(c *check.C) {
-	err := Store("appname", "routername", "fake")
+	err := Store("appname", "routername", "fake", "fake")
 	c.Assert(err, check.IsNil)
 	name, err := Retrieve("appname")
 	c.Assert(err, check.IsNil)
 	c.Assert(name, check.Equals, "routername")
-	err = Remove("appname")
+	err = Remove("appname", "fake", "fake")
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestStoreMultipleKinds(c *check.C) {
+	err := Store("multiapp", "multiapp", "fake", "fake")
+	c.Assert(err, check.IsNil)
+	err = Store("multiapp", "multiapp", "fake-hc", "fake-hc")
+	c.Assert(err, check.IsNil)
+	err = Store("multiapp", "multiapp", "fake", "fake")
+	c.Assert(err, check.IsNil)
+	count, err := s.conn.Collection("routers").Find(map[string]string{"app": "multiapp"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+	err = Remove("multiapp", "fake", "fake")
+	c.Assert(err, check.IsNil)
+	data, err := retrieveRouterData("multiapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(data["kind"], check.Equals, "fake-hc")
+	err = Remove("multiapp", "fake-hc", "fake-hc")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("multiapp")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestRemoveWithoutKind(c *check.C) {
+	err := s.conn.Collection("routers").Insert(map[string]string{"app": "legacyapp", "router": "legacyapp"})
+	c.Assert(err, check.IsNil)
+	err = Remove("legacyapp", "hipache", "hipache")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("legacyapp")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
 func (s *S) TestRetrieveWithoutKind(c *check.C) {
-	err := Store("appname", "routername", "")
+	err := Store("appname", "routername", "hipache", "")
 	c.Assert(err, check.IsNil)
 	data, err := retrieveRouterData("appname")
 	c.Assert(err, check.IsNil)
 	delete(data, "_id")
 	c.Assert(data, check.DeepEquals, map[string]string{
-		"app":    "appname",
-		"router": "routername",
-		"kind":   "hipache",
+		"app":        "appname",
+		"router":     "routername",
+		"routername": "hipache",
+		"kind":       "hipache",
 	})
 }
 
+func (s *S) TestStoreSameKindDifferentRouters(c *check.C) {
+	err := Store("sameapp", "sameapp", "router1", "fake")
+	c.Assert(err, check.IsNil)
+	err = Store("sameapp", "sameapp", "router2", "fake")
+	c.Assert(err, check.IsNil)
+	count, err := s.conn.Collection("routers").Find(map[string]string{"app": "sameapp"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+	err = Remove("sameapp", "router1", "fake")
+	c.Assert(err, check.IsNil)
+	data, err := retrieveRouterData("sameapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(data["routername"], check.Equals, "router2")
+	err = Remove("sameapp", "router2", "fake")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("sameapp")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestStoreKeysLegacyRecordByRouterName(c *check.C) {
+	err := s.conn.Collection("routers").Insert(map[string]string{"app": "legacyapp", "router": "legacyapp", "kind": "fake"})
+	c.Assert(err, check.IsNil)
+	err = Store("legacyapp", "legacyapp", "router1", "fake")
+	c.Assert(err, check.IsNil)
+	count, err := s.conn.Collection("routers").Find(map[string]string{"app": "legacyapp"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	data, err := retrieveRouterData("legacyapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(data["routername"], check.Equals, "router1")
+	err = Remove("legacyapp", "router1", "fake")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("legacyapp")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
 func (s *S) TestRetireveNotFound(c *check.C) {
 	name, err := Retrieve("notfound")
 	c.Assert(err, check.Not(check.IsNil))
@@ -90,13 +158,13 @@ func (s *S) TestRetireveNotFound(c *check.C) {
 }
 
 func (s *S) TestSwapBackendName(c *check.C) {
-	err := Store("appname", "routername", "fake")
+	err := Store("appname", "routername", "fake", "fake")
 	c.Assert(err, check.IsNil)
-	defer Remove("appname")
-	err = Store("appname2", "routername2", "fake")
+	defer Remove("appname", "fake", "fake")
+	err = Store("appname2", "routername2", "fake", "fake")
 	c.Assert(err, check.IsNil)
-	defer Remove("appname2")
-	err = swapBackendName("appname", "appname2")
+	defer Remove("appname2", "fake", "fake")
+	err = SwapBackendName("appname", "appname2")
 	name, err := Retrieve("appname")
 	c.Assert(err, check.IsNil)
 	c.Assert(name, check.Equals, "routername2")
@@ -153,3 +221,31 @@ func (s *S) TestRouteError(c *check.C) {
 	err = &RouterError{Op: "del", Err: errors.New("Fatal error.")}
 	c.Assert(err.Error(), check.Equals, "[router del] Fatal error.")
 }
+
+func (s *S) TestReduceWeights(c *check.C) {
+	addr1, _ := url.Parse("http://10.0.0.1:8080")
+	addr2, _ := url.Parse("http://10.0.0.2:8080")
+	addr3, _ := url.Parse("http://10.0.0.3:8080")
+	routes := ReduceWeights([]WeightedRoute{
+		{Address: addr1, Weight: 180},
+		{Address: addr2, Weight: 20},
+		{Address: addr3, Weight: 0},
+	})
+	c.Assert(routes, check.DeepEquals, []WeightedRoute{
+		{Address: addr1, Weight: 9},
+		{Address: addr2, Weight: 1},
+	})
+}
+
+func (s *S) TestReduceWeightsLimitsSum(c *check.C) {
+	addr1, _ := url.Parse("http://10.0.0.1:8080")
+	addr2, _ := url.Parse("http://10.0.0.2:8080")
+	routes := ReduceWeights([]WeightedRoute{
+		{Address: addr1, Weight: 999},
+		{Address: addr2, Weight: 1},
+	})
+	c.Assert(routes, check.DeepEquals, []WeightedRoute{
+		{Address: addr1, Weight: 99},
+		{Address: addr2, Weight: 1},
+	})
+}
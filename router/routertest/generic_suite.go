@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -519,3 +520,55 @@ func (s *RouterSuite) TestSetHealthcheck(c *check.C) {
 	err = s.Router.RemoveBackend("mybackend")
 	c.Assert(err, check.IsNil)
 }
+
+func (s *RouterSuite) TestAddRemoveCertificate(c *check.C) {
+	tlsRouter, ok := s.Router.(router.TLSRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement TLSRouter", s.Router))
+	}
+	cert, key, err := NewCertificate("myapp.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = tlsRouter.AddCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	err = tlsRouter.AddCertificate("myapp.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	err = tlsRouter.RemoveCertificate("myapp.example.com")
+	c.Assert(err, check.IsNil)
+	err = tlsRouter.RemoveCertificate("myapp.example.com")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *RouterSuite) TestSetWeightedRoutes(c *check.C) {
+	wRouter, ok := s.Router.(router.WeightedRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement WeightedRouter", s.Router))
+	}
+	name := "backend1"
+	err := s.Router.AddBackend(name)
+	c.Assert(err, check.IsNil)
+	addr1, err := url.Parse("http://10.10.10.10:8080")
+	c.Assert(err, check.IsNil)
+	addr2, err := url.Parse("http://10.10.10.11:8080")
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddRoute(name, addr1)
+	c.Assert(err, check.IsNil)
+	err = wRouter.SetWeightedRoutes(name, []router.WeightedRoute{
+		{Address: addr1, Weight: 90},
+		{Address: addr2, Weight: 10},
+	})
+	c.Assert(err, check.IsNil)
+	routes, err := s.Router.Routes(name)
+	c.Assert(err, check.IsNil)
+	sort.Sort(URLList(routes))
+	c.Assert(routes, check.DeepEquals, []*url.URL{addr1, addr2})
+	err = wRouter.SetWeightedRoutes(name, []router.WeightedRoute{
+		{Address: addr1, Weight: 0},
+		{Address: addr2, Weight: 100},
+	})
+	c.Assert(err, check.IsNil)
+	routes, err = s.Router.Routes(name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{addr2})
+	err = s.Router.RemoveBackend(name)
+	c.Assert(err, check.IsNil)
+}
@@ -9,19 +9,26 @@ import (
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/tsuru/tsuru/router"
 )
 
 var FakeRouter = newFakeRouter()
 
-var HCRouter = hcRouter{fakeRouter: newFakeRouter()}
+var HCRouter = newHCRouter()
 
 var ErrForcedFailure = errors.New("Forced failure")
 
+var (
+	independentRouters   = make(map[string]*fakeRouter)
+	independentRoutersMu sync.Mutex
+)
+
 func init() {
 	router.Register("fake", createRouter)
 	router.Register("fake-hc", createHCRouter)
+	router.Register("fake-independent", createIndependentRouter)
 }
 
 func createRouter(name, prefix string) (router.Router, error) {
@@ -32,15 +39,50 @@ func createHCRouter(name, prefix string) (router.Router, error) {
 	return &HCRouter, nil
 }
 
+func createIndependentRouter(name, prefix string) (router.Router, error) {
+	return IndependentRouter(name), nil
+}
+
+// IndependentRouter returns the fake router of the named router configured
+// with the type "fake-independent". Unlike FakeRouter, which is shared by all
+// the routers of type "fake", each name gets its own router and its own
+// backend records, like real routers do.
+func IndependentRouter(name string) *fakeRouter {
+	independentRoutersMu.Lock()
+	defer independentRoutersMu.Unlock()
+	r, ok := independentRouters[name]
+	if !ok {
+		fake := newFakeRouter()
+		fake.kind = "fake-independent"
+		fake.name = name
+		r = &fake
+		independentRouters[name] = r
+	}
+	return r
+}
+
+// ResetIndependentRouters removes all the routers returned by
+// IndependentRouter.
+func ResetIndependentRouters() {
+	independentRoutersMu.Lock()
+	defer independentRoutersMu.Unlock()
+	independentRouters = make(map[string]*fakeRouter)
+}
+
 func newFakeRouter() fakeRouter {
-	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), mutex: &sync.Mutex{}}
+	return fakeRouter{kind: "fake", cnames: make(map[string]string), certificates: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), weights: make(map[string][]map[string]int), lastRequests: make(map[string]time.Time), mutex: &sync.Mutex{}}
 }
 
 type fakeRouter struct {
+	kind         string
+	name         string
 	backends     map[string][]string
 	cnames       map[string]string
+	certificates map[string]string
 	failuresByIp map[string]bool
 	healthcheck  map[string]router.HealthcheckData
+	weights      map[string][]map[string]int
+	lastRequests map[string]time.Time
 	mutex        *sync.Mutex
 }
 
@@ -117,7 +159,16 @@ func (r *fakeRouter) AddBackend(name string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.backends[name] = nil
-	return router.Store(name, name, "fake")
+	return router.Store(name, name, r.routerName(), r.kind)
+}
+
+// routerName returns the name the backend records of the router are stored
+// with. The shared routers are stored by their kind.
+func (r *fakeRouter) routerName() string {
+	if r.name != "" {
+		return r.name
+	}
+	return r.kind
 }
 
 func (r *fakeRouter) RemoveBackend(name string) error {
@@ -139,7 +190,7 @@ func (r *fakeRouter) RemoveBackend(name string) error {
 		}
 	}
 	delete(r.backends, backendName)
-	return router.Remove(backendName)
+	return router.Remove(backendName, r.routerName(), r.kind)
 }
 
 func (r *fakeRouter) AddRoutes(name string, addresses []*url.URL) error {
@@ -306,7 +357,10 @@ func (r *fakeRouter) Reset() {
 	r.backends = make(map[string][]string)
 	r.failuresByIp = make(map[string]bool)
 	r.cnames = make(map[string]string)
+	r.certificates = make(map[string]string)
 	r.healthcheck = make(map[string]router.HealthcheckData)
+	r.weights = make(map[string][]map[string]int)
+	r.lastRequests = make(map[string]time.Time)
 }
 
 func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
@@ -327,6 +381,63 @@ func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
 	return result, nil
 }
 
+func (r *fakeRouter) SetWeightedRoutes(name string, routes []router.WeightedRoute) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !r.HasBackend(backendName) {
+		return router.ErrBackendNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, route := range routes {
+		if route.Weight > 0 && r.failuresByIp[route.Address.String()] {
+			return ErrForcedFailure
+		}
+	}
+	weights := make(map[string]int)
+	var addresses []string
+	for _, route := range routes {
+		if route.Weight <= 0 {
+			continue
+		}
+		weights[route.Address.String()] = route.Weight
+		addresses = append(addresses, route.Address.String())
+	}
+	r.backends[backendName] = addresses
+	r.weights[backendName] = append(r.weights[backendName], weights)
+	return nil
+}
+
+// WeightHistory returns the weights set for each route of the backend, one
+// entry for each call to SetWeightedRoutes.
+func (r *fakeRouter) WeightHistory(name string) []map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.weights[name]
+}
+
+// SetLastRequest sets the time returned by LastRequest for the backend.
+func (r *fakeRouter) SetLastRequest(name string, t time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastRequests[name] = t
+}
+
+func (r *fakeRouter) LastRequest(name string) (time.Time, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return time.Time{}, router.ErrBackendNotFound
+	}
+	return r.lastRequests[backendName], nil
+}
+
 func (r *fakeRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
 	return router.Swap(r, backend1, backend2, cnameOnly)
 }
@@ -336,6 +447,12 @@ type hcRouter struct {
 	err error
 }
 
+func newHCRouter() hcRouter {
+	r := hcRouter{fakeRouter: newFakeRouter()}
+	r.kind = "fake-hc"
+	return r
+}
+
 func (r *hcRouter) SetErr(err error) {
 	r.err = err
 }
@@ -354,3 +471,28 @@ func (r *fakeRouter) SetHealthcheck(name string, data router.HealthcheckData) er
 	r.healthcheck[backendName] = data
 	return nil
 }
+
+func (r *fakeRouter) AddCertificate(cname, certificate, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.certificates[cname] = certificate
+	return nil
+}
+
+func (r *fakeRouter) RemoveCertificate(cname string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.certificates[cname]; !ok {
+		return router.ErrCertificateNotFound
+	}
+	delete(r.certificates, cname)
+	return nil
+}
+
+// Certificate returns the certificate set for the cname, or an empty string
+// if there's none.
+func (r *fakeRouter) Certificate(cname string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.certificates[cname]
+}
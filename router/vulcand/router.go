@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/hc"
@@ -21,15 +23,21 @@ import (
 
 const routerName = "vulcand"
 
+var (
+	lastRequests    = map[string]time.Time{}
+	lastRequestsMut sync.Mutex
+)
+
 func init() {
 	router.Register(routerName, createRouter)
 	hc.AddChecker("Router vulcand", router.BuildHealthCheck("vulcand"))
 }
 
 type vulcandRouter struct {
-	client *api.Client
-	prefix string
-	domain string
+	client     *api.Client
+	routerName string
+	prefix     string
+	domain     string
 }
 
 func createRouter(routerName, configPrefix string) (router.Router, error) {
@@ -43,9 +51,10 @@ func createRouter(routerName, configPrefix string) (router.Router, error) {
 	}
 	client := api.NewClient(vURL, registry.GetRegistry())
 	vRouter := &vulcandRouter{
-		client: client,
-		prefix: configPrefix,
-		domain: domain,
+		client:     client,
+		routerName: routerName,
+		prefix:     configPrefix,
+		domain:     domain,
 	}
 	return vRouter, nil
 }
@@ -103,7 +112,7 @@ func (r *vulcandRouter) AddBackend(name string) error {
 		r.client.DeleteBackend(backendKey)
 		return &router.RouterError{Err: err, Op: "add-backend"}
 	}
-	return router.Store(name, name, routerName)
+	return router.Store(name, name, r.routerName, routerName)
 }
 
 func (r *vulcandRouter) RemoveBackend(name string) error {
@@ -151,7 +160,7 @@ func (r *vulcandRouter) RemoveBackend(name string) error {
 		}
 		return &router.RouterError{Err: err, Op: "remove-backend"}
 	}
-	return router.Remove(usedName)
+	return router.Remove(usedName, r.routerName, routerName)
 }
 
 func (r *vulcandRouter) AddRoute(name string, address *url.URL) error {
@@ -215,6 +224,10 @@ func (r *vulcandRouter) RemoveRoute(name string, address *url.URL) error {
 		}
 		return &router.RouterError{Err: err, Op: "remove-route"}
 	}
+	err = r.removeReplicas(serverKey.BackendKey, []*url.URL{address})
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "remove-route"}
+	}
 	return nil
 }
 
@@ -236,6 +249,10 @@ func (r *vulcandRouter) RemoveRoutes(name string, addresses []*url.URL) error {
 			return &router.RouterError{Err: err, Op: "remove-route"}
 		}
 	}
+	err = r.removeReplicas(engine.BackendKey{Id: r.backendName(usedName)}, addresses)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "remove-route"}
+	}
 	return nil
 }
 
@@ -332,14 +349,135 @@ func (r *vulcandRouter) Routes(name string) ([]*url.URL, error) {
 	if err != nil {
 		return nil, &router.RouterError{Err: err, Op: "routes"}
 	}
-	routes := make([]*url.URL, len(servers))
-	for i, server := range servers {
-		parsedUrl, _ := url.Parse(server.URL)
-		routes[i] = parsedUrl
+	seen := make(map[string]bool, len(servers))
+	routes := make([]*url.URL, 0, len(servers))
+	for _, server := range servers {
+		parsedUrl, err := url.Parse(server.URL)
+		if err != nil {
+			return nil, &router.RouterError{Err: err, Op: "routes"}
+		}
+		parsedUrl.Path = ""
+		if seen[parsedUrl.String()] {
+			continue
+		}
+		seen[parsedUrl.String()] = true
+		routes = append(routes, parsedUrl)
 	}
 	return routes, nil
 }
 
+// SetWeightedRoutes registers each route as many servers as its weight.
+// Vulcand identifies servers by their URL, so the replicas of a route are
+// registered with distinct paths, which are ignored when proxying requests.
+func (r *vulcandRouter) SetWeightedRoutes(name string, routes []router.WeightedRoute) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	backendKey := engine.BackendKey{Id: r.backendName(usedName)}
+	wanted := map[string]string{}
+	for _, route := range router.ReduceWeights(routes) {
+		for i := 0; i < route.Weight; i++ {
+			id, address := r.replica(route.Address, i)
+			wanted[id] = address
+		}
+	}
+	for id, address := range wanted {
+		server, err := engine.NewServer(id, address)
+		if err != nil {
+			return &router.RouterError{Err: err, Op: "set-weighted-routes"}
+		}
+		err = r.client.UpsertServer(backendKey, *server, engine.NoTTL)
+		if err != nil {
+			return &router.RouterError{Err: err, Op: "set-weighted-routes"}
+		}
+	}
+	servers, err := r.client.GetServers(backendKey)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "set-weighted-routes"}
+	}
+	for _, server := range servers {
+		if _, ok := wanted[server.Id]; ok {
+			continue
+		}
+		err = r.client.DeleteServer(engine.ServerKey{Id: server.Id, BackendKey: backendKey})
+		if err != nil {
+			if _, ok := err.(*engine.NotFoundError); ok {
+				continue
+			}
+			return &router.RouterError{Err: err, Op: "set-weighted-routes"}
+		}
+	}
+	return nil
+}
+
+func (r *vulcandRouter) replica(address *url.URL, i int) (string, string) {
+	if i == 0 {
+		return r.serverName(address.String()), address.String()
+	}
+	replicaURL := *address
+	replicaURL.Path = fmt.Sprintf("/%d", i)
+	return fmt.Sprintf("%s_%d", r.serverName(address.String()), i), replicaURL.String()
+}
+
+func (r *vulcandRouter) removeReplicas(backendKey engine.BackendKey, addresses []*url.URL) error {
+	prefixes := make([]string, len(addresses))
+	for i, addr := range addresses {
+		prefixes[i] = r.serverName(addr.String()) + "_"
+	}
+	servers, err := r.client.GetServers(backendKey)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(server.Id, prefix) {
+				continue
+			}
+			err = r.client.DeleteServer(engine.ServerKey{Id: server.Id, BackendKey: backendKey})
+			if err != nil {
+				if _, ok := err.(*engine.NotFoundError); !ok {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LastRequest returns the last time the frontends of the backend were seen
+// receiving requests. Vulcand only keeps statistics of a short rolling
+// window, so they're sampled on each call and the time is kept in memory. The
+// first sample of a backend counts as a request, apps are only reported idle
+// after being watched without traffic for a while.
+func (r *vulcandRouter) LastRequest(name string) (time.Time, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	backendKey := engine.BackendKey{Id: r.backendName(usedName)}
+	frontends, err := r.client.TopFrontends(&backendKey, 0)
+	if err != nil {
+		return time.Time{}, &router.RouterError{Err: err, Op: "last-request"}
+	}
+	now := time.Now().UTC()
+	key := r.routerName + "/" + backendKey.Id
+	lastRequestsMut.Lock()
+	defer lastRequestsMut.Unlock()
+	last, ok := lastRequests[key]
+	if !ok {
+		last = now
+	}
+	for _, f := range frontends {
+		if f.Stats != nil && f.Stats.Counters.Total > 0 {
+			last = now
+			break
+		}
+	}
+	lastRequests[key] = last
+	return last, nil
+}
+
 func (r *vulcandRouter) StartupMessage() (string, error) {
 	message := fmt.Sprintf("vulcand router %q with API at %q", r.domain, r.client.Addr)
 	return message, nil
@@ -348,3 +486,32 @@ func (r *vulcandRouter) StartupMessage() (string, error) {
 func (r *vulcandRouter) HealthCheck() error {
 	return r.client.GetStatus()
 }
+
+// AddCertificate registers a vulcand host for the cname with the key pair,
+// vulcand uses it to terminate TLS connections to the cname.
+func (r *vulcandRouter) AddCertificate(cname, certificate, key string) error {
+	keyPair, err := engine.NewKeyPair([]byte(certificate), []byte(key))
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-certificate"}
+	}
+	host, err := engine.NewHost(cname, engine.HostSettings{KeyPair: keyPair})
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-certificate"}
+	}
+	err = r.client.UpsertHost(*host)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-certificate"}
+	}
+	return nil
+}
+
+func (r *vulcandRouter) RemoveCertificate(cname string) error {
+	err := r.client.DeleteHost(engine.HostKey{Name: cname})
+	if err != nil {
+		if _, ok := err.(*engine.NotFoundError); ok {
+			return router.ErrCertificateNotFound
+		}
+		return &router.RouterError{Err: err, Op: "remove-certificate"}
+	}
+	return nil
+}
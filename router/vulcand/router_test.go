@@ -34,9 +34,34 @@ func Test(t *testing.T) {
 type S struct {
 	conn          *db.Storage
 	engine        engine.Engine
+	stats         *fakeStats
 	vulcandServer *httptest.Server
 }
 
+// fakeStats reports the number of requests set in the test as the stats of
+// every frontend of a backend.
+type fakeStats struct {
+	*supervisor.Supervisor
+	engine   engine.Engine
+	requests map[string]int64
+}
+
+func (f *fakeStats) TopFrontends(key *engine.BackendKey) ([]engine.Frontend, error) {
+	frontends, err := f.engine.GetFrontends()
+	if err != nil {
+		return nil, err
+	}
+	var result []engine.Frontend
+	for _, frontend := range frontends {
+		if key != nil && frontend.BackendId != key.Id {
+			continue
+		}
+		frontend.Stats = &engine.RoundTripStats{Counters: engine.Counters{Total: f.requests[frontend.BackendId]}}
+		result = append(result, frontend)
+	}
+	return result, nil
+}
+
 var _ = check.Suite(&S{})
 
 func init() {
@@ -68,9 +93,11 @@ func (s *S) SetUpTest(c *check.C) {
 	s.conn, err = db.Conn()
 	c.Assert(err, check.IsNil)
 	dbtest.ClearAllCollections(s.conn.Collection("router_vulcand_tests").Database)
+	lastRequests = map[string]time.Time{}
 	s.engine = memng.New(registry.GetRegistry())
+	s.stats = &fakeStats{Supervisor: &supervisor.Supervisor{}, engine: s.engine, requests: map[string]int64{}}
 	scrollApp := scroll.NewApp()
-	api.InitProxyController(s.engine, &supervisor.Supervisor{}, scrollApp)
+	api.InitProxyController(s.engine, s.stats, scrollApp)
 	s.vulcandServer = httptest.NewServer(scrollApp.GetHandler())
 	config.Set("routers:vulcand:api-url", s.vulcandServer.URL)
 }
@@ -422,6 +449,65 @@ func (s *S) TestRoutes(c *check.C) {
 	c.Assert(routes, check.DeepEquals, []*url.URL{u1, u2})
 }
 
+func (s *S) TestSetWeightedRoutes(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	u1, _ := url.Parse("http://1.1.1.1:111")
+	u2, _ := url.Parse("http://2.2.2.2:222")
+	err = vRouter.AddRoute("myapp", u1)
+	c.Assert(err, check.IsNil)
+	err = vRouter.(router.WeightedRouter).SetWeightedRoutes("myapp", []router.WeightedRoute{
+		{Address: u1, Weight: 10},
+		{Address: u2, Weight: 30},
+	})
+	c.Assert(err, check.IsNil)
+	servers, err := s.engine.GetServers(engine.BackendKey{Id: "tsuru_myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(servers, check.HasLen, 4)
+	routes, err := vRouter.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+	err = vRouter.RemoveRoute("myapp", u2)
+	c.Assert(err, check.IsNil)
+	servers, err = s.engine.GetServers(engine.BackendKey{Id: "tsuru_myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(servers, check.HasLen, 1)
+	c.Assert(servers[0].URL, check.Equals, u1.String())
+}
+
+func (s *S) TestLastRequest(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	trafficRouter, ok := vRouter.(router.TrafficRouter)
+	c.Assert(ok, check.Equals, true)
+	before := time.Now()
+	first, err := trafficRouter.LastRequest("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(first.Before(before), check.Equals, false)
+	last, err := trafficRouter.LastRequest("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.Equal(first), check.Equals, true)
+	s.stats.requests["tsuru_myapp"] = 3
+	last, err = trafficRouter.LastRequest("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.After(first), check.Equals, true)
+	s.stats.requests["tsuru_myapp"] = 0
+	idle, err := trafficRouter.LastRequest("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(idle.Equal(last), check.Equals, true)
+}
+
+func (s *S) TestLastRequestBackendNotFound(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	_, err = vRouter.(router.TrafficRouter).LastRequest("unknown")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
 func (s *S) TestStartupMessage(c *check.C) {
 	got, err := router.Get("vulcand")
 	c.Assert(err, check.IsNil)
@@ -455,3 +541,20 @@ func (s *S) TestHealthCheckFailure(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 	c.Assert(hcRouter.HealthCheck(), check.ErrorMatches, ".* connection refused")
 }
+
+func (s *S) TestAddCertificate(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	cert, key, err := routertest.NewCertificate("myapp.cname.example.com", time.Now().Add(24*time.Hour))
+	c.Assert(err, check.IsNil)
+	err = vRouter.(router.TLSRouter).AddCertificate("myapp.cname.example.com", cert, key)
+	c.Assert(err, check.IsNil)
+	host, err := s.engine.GetHost(engine.HostKey{Name: "myapp.cname.example.com"})
+	c.Assert(err, check.IsNil)
+	c.Assert(host.Settings.KeyPair, check.NotNil)
+	c.Assert(string(host.Settings.KeyPair.Cert), check.Equals, cert)
+	err = vRouter.(router.TLSRouter).RemoveCertificate("myapp.cname.example.com")
+	c.Assert(err, check.IsNil)
+	_, err = s.engine.GetHost(engine.HostKey{Name: "myapp.cname.example.com"})
+	c.Assert(err, check.NotNil)
+}
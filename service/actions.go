@@ -72,11 +72,15 @@ var createServiceInstance = action.Action{
 
 // insertServiceInstance is an action that inserts an instance in the database.
 //
-// The first argument in the context must be a Service Instance.
+// The second argument in the context must be a Service Instance. The instance
+// returned by the previous action, if any, takes precedence over it.
 var insertServiceInstance = action.Action{
 	Name: "insert-service-instance",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
-		instance, ok := ctx.Params[1].(ServiceInstance)
+		instance, ok := ctx.Previous.(ServiceInstance)
+		if !ok {
+			instance, ok = ctx.Params[1].(ServiceInstance)
+		}
 		if !ok {
 			return nil, errors.New("Second parameter must be a ServiceInstance.")
 		}
@@ -26,8 +26,28 @@ var (
 	ErrInstanceAlreadyExistsInAPI = errors.New("instance already exists in the service API")
 	ErrInstanceNotFoundInAPI      = errors.New("instance does not exist in the service API")
 	ErrInstanceNotReady           = errors.New("instance is not ready yet")
+	ErrPlanUpdateNotSupported     = errors.New("the service API does not support plan updates")
+	ErrRotationNotSupported       = errors.New("the service API does not support credentials rotation")
 )
 
+// ServiceClient is the interface implemented by clients of service APIs. The
+// kind of the service endpoint defines which implementation is used.
+type ServiceClient interface {
+	Create(instance *ServiceInstance, user, requestID string) error
+	Destroy(instance *ServiceInstance, requestID string) error
+	UpdatePlan(instance *ServiceInstance, plan, requestID string) error
+	BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error)
+	BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	UnbindApp(instance *ServiceInstance, app bind.App) error
+	RotateCredentials(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error)
+	UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	Status(instance *ServiceInstance, requestID string) (string, error)
+	Info(instance *ServiceInstance, requestID string) ([]map[string]string, error)
+	Plans(requestID string) ([]Plan, error)
+	Proxy(path string, w http.ResponseWriter, r *http.Request) error
+}
+
+// Client is a client of the tsuru service API.
 type Client struct {
 	endpoint string
 	username string
@@ -142,6 +162,11 @@ func (c *Client) Destroy(instance *ServiceInstance, requestID string) error {
 	return err
 }
 
+// UpdatePlan is not supported by the tsuru service API.
+func (c *Client) UpdatePlan(instance *ServiceInstance, plan, requestID string) error {
+	return ErrPlanUpdateNotSupported
+}
+
 func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
 	log.Debugf("Calling bind of instance %q and %q app at %q API",
 		instance.Name, app.GetName(), instance.ServiceName)
@@ -234,6 +259,43 @@ func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App) error {
 	return err
 }
 
+// RotateCredentials asks the service API to replace the credentials of the
+// app bound to the instance, returning the new environment variables.
+// The api should be prepared to receive the request,
+// like below:
+// POST /resources/<name>/rotate-credentials
+func (c *Client) RotateCredentials(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
+	log.Debugf("Calling credentials rotation of instance %q and %q app at %q API",
+		instance.Name, app.GetName(), instance.ServiceName)
+	params := map[string][]string{
+		"app-host":  {app.GetIp()},
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/rotate-credentials", "POST", params)
+	if err != nil {
+		log.Errorf(`Failed to rotate credentials of app %q in service instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, err)
+		return nil, fmt.Errorf("%s api is down.", instance.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		var result map[string]string
+		err = c.jsonFromResponse(resp, &result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusPreconditionFailed:
+		return nil, ErrInstanceNotReady
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, ErrRotationNotSupported
+	}
+	msg := fmt.Sprintf(`Failed to rotate credentials of the instance "%s/%s" for the app %q: %s`, instance.ServiceName, instance.Name, app.GetName(), c.buildErrorMessage(err, resp))
+	log.Error(msg)
+	return nil, errors.New(msg)
+}
+
 func (c *Client) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
 	log.Debugf("Calling unbind of service instance %q and unit %q at %q", instance.Name, unit.GetIp(), instance.ServiceName)
 	var resp *http.Response
@@ -396,6 +396,56 @@ func (s *S) TestBindUnitInstanceNotFound(c *check.C) {
 	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
 }
 
+func (s *S) TestRotateCredentials(c *check.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	envs, err := client.RotateCredentials(&instance, a, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]string{
+		"MYSQL_DATABASE_NAME": "CHICO",
+		"MYSQL_HOST":          "localhost",
+		"MYSQL_PORT":          "3306",
+	})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.url, check.Equals, "/resources/her-redis/rotate-credentials")
+	c.Assert(h.method, check.Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	c.Assert(map[string][]string(v), check.DeepEquals, map[string][]string{"app-host": {a.GetIp()}})
+}
+
+func (s *S) TestRotateCredentialsErrors(c *check.C) {
+	var status int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	tests := []struct {
+		status int32
+		err    error
+	}{
+		{http.StatusNotFound, ErrRotationNotSupported},
+		{http.StatusMethodNotAllowed, ErrRotationNotSupported},
+		{http.StatusPreconditionFailed, ErrInstanceNotReady},
+	}
+	for _, t := range tests {
+		atomic.StoreInt32(&status, t.status)
+		_, err := client.RotateCredentials(&instance, a, "")
+		c.Assert(err, check.Equals, t.err)
+	}
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	_, err := client.RotateCredentials(&instance, a, "")
+	c.Assert(err, check.ErrorMatches, `Failed to rotate credentials of the instance "redis/her-redis" for the app "her-app".*`)
+}
+
 func (s *S) TestUnbindApp(c *check.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
@@ -0,0 +1,604 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	osbAPIVersion = "2.11"
+
+	// osbStatusUnprocessableEntity is returned by brokers when an operation
+	// is already in progress for the instance or binding.
+	osbStatusUnprocessableEntity = 422
+
+	osbStateInProgress = "in progress"
+	osbStateSucceeded  = "succeeded"
+	osbStateFailed     = "failed"
+)
+
+var (
+	ErrProxyNotSupported      = errors.New("the service API does not support proxied requests")
+	ErrServiceNotInCatalog    = errors.New("service not found in the broker catalog")
+	ErrPlanNotInCatalog       = errors.New("plan not found in the broker catalog")
+	osbInvalidEnvCharsRegexp  = regexp.MustCompile(`[^A-Z0-9_]`)
+	osbEnvStartsWithNumRegexp = regexp.MustCompile(`^[0-9]`)
+)
+
+// BrokerOperation is an asynchronous operation started by an Open Service
+// Broker and not finished yet. PlanName is the plan an update operation moves
+// the instance to, stored in the instance only once the operation succeeds.
+type BrokerOperation struct {
+	Kind     string
+	Token    string `bson:",omitempty"`
+	PlanName string `bson:",omitempty"`
+}
+
+// BrokerOperationError is returned when the broker reports that the last
+// asynchronous operation of an instance failed. The operation is removed
+// from the instance, so it's reported only once.
+type BrokerOperationError struct {
+	Instance    string
+	Kind        string
+	Description string
+}
+
+func (e *BrokerOperationError) Error() string {
+	msg := fmt.Sprintf("the %s operation of the instance %q failed in the broker", e.Kind, e.Instance)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// OSBClient is a client of service brokers implementing the Open Service
+// Broker API. Tsuru services are matched to broker services by name and
+// service instances are identified in the broker by an UUID derived from the
+// names of the service and the instance.
+type OSBClient struct {
+	endpoint    string
+	username    string
+	password    string
+	serviceName string
+}
+
+type osbCatalog struct {
+	Services []osbService `json:"services"`
+}
+
+type osbService struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Bindable       bool      `json:"bindable"`
+	PlanUpdateable bool      `json:"plan_updateable"`
+	Plans          []osbPlan `json:"plans"`
+}
+
+type osbPlan struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type osbError struct {
+	Error       string `json:"error"`
+	Description string `json:"description"`
+}
+
+type osbOperationResponse struct {
+	Operation string `json:"operation"`
+}
+
+type osbLastOperation struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+type osbBindResponse struct {
+	Credentials map[string]interface{} `json:"credentials"`
+}
+
+// osbUUID returns a name based UUID (version 5) for the given name.
+func osbUUID(name string) string {
+	sum := sha1.Sum([]byte(name))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func (c *OSBClient) instanceID(instance *ServiceInstance) string {
+	return osbUUID(instance.ServiceName + "/" + instance.Name)
+}
+
+// bindingID returns the ID of the binding of the app in the broker. Apps whose
+// credentials were rotated have their binding ID stored in the instance.
+func (c *OSBClient) bindingID(instance *ServiceInstance, app bind.App) string {
+	if id, ok := instance.Bindings[app.GetName()]; ok {
+		return id
+	}
+	return osbUUID(c.instanceID(instance) + "/" + app.GetName())
+}
+
+func (c *OSBClient) issueRequest(path, method string, query url.Values, body interface{}, requestID string) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	url := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(path, "/")
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		log.Errorf("Got error while creating request: %s", err)
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Broker-API-Version", osbAPIVersion)
+	requestIDHeader, err := config.GetString("request-id-header")
+	if err == nil && requestIDHeader != "" && requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Close = true
+	return net.Dial5Full300ClientNoKeepAlive.Do(req)
+}
+
+func (c *OSBClient) decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *OSBClient) buildError(action string, resp *http.Response) error {
+	var brokerErr osbError
+	c.decodeResponse(resp, &brokerErr)
+	msg := fmt.Sprintf("Failed to %s: broker returned status %d", action, resp.StatusCode)
+	if brokerErr.Description != "" {
+		msg += ": " + brokerErr.Description
+	} else if brokerErr.Error != "" {
+		msg += ": " + brokerErr.Error
+	}
+	log.Error(msg)
+	return errors.New(msg)
+}
+
+func (c *OSBClient) service(requestID string) (*osbService, error) {
+	resp, err := c.issueRequest("/v2/catalog", "GET", nil, nil, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.buildError("get the broker catalog", resp)
+	}
+	var catalog osbCatalog
+	err = c.decodeResponse(resp, &catalog)
+	if err != nil {
+		return nil, err
+	}
+	for i := range catalog.Services {
+		if catalog.Services[i].Name == c.serviceName {
+			return &catalog.Services[i], nil
+		}
+	}
+	return nil, ErrServiceNotInCatalog
+}
+
+// plan returns the plan in the catalog with the given name, or the first plan
+// of the service when name is empty.
+func (s *osbService) plan(name string) (*osbPlan, error) {
+	if len(s.Plans) == 0 {
+		return nil, ErrPlanNotInCatalog
+	}
+	if name == "" {
+		return &s.Plans[0], nil
+	}
+	for i := range s.Plans {
+		if s.Plans[i].Name == name {
+			return &s.Plans[i], nil
+		}
+	}
+	return nil, ErrPlanNotInCatalog
+}
+
+func (c *OSBClient) setOperation(instance *ServiceInstance, kind string, resp *http.Response) {
+	var operation osbOperationResponse
+	c.decodeResponse(resp, &operation)
+	instance.Operation = &BrokerOperation{Kind: kind, Token: operation.Operation}
+}
+
+// lastOperation polls the broker for the state of the pending operation of
+// the instance. Once the operation finishes, successfully or not, it's
+// removed from the instance, and the plan of a successful update is stored.
+func (c *OSBClient) lastOperation(instance *ServiceInstance, requestID string) (*osbLastOperation, error) {
+	query := url.Values{}
+	if instance.Operation.Token != "" {
+		query.Set("operation", instance.Operation.Token)
+	}
+	resp, err := c.issueRequest("/v2/service_instances/"+c.instanceID(instance)+"/last_operation", "GET", query, nil, requestID)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		resp.Body.Close()
+		return nil, ErrInstanceNotFoundInAPI
+	default:
+		return nil, c.buildError("get the last operation of the instance "+instance.Name, resp)
+	}
+	var last osbLastOperation
+	err = c.decodeResponse(resp, &last)
+	if err != nil {
+		return nil, err
+	}
+	if last.State == osbStateSucceeded || last.State == osbStateFailed {
+		update := bson.M{"$unset": bson.M{"operation": ""}}
+		if last.State == osbStateSucceeded && instance.Operation.PlanName != "" {
+			instance.PlanName = instance.Operation.PlanName
+			update["$set"] = bson.M{"plan_name": instance.PlanName}
+		}
+		instance.Operation = nil
+		err = instance.update(update)
+		if err != nil {
+			log.Errorf("[osb] unable to clear the operation of instance %q: %s", instance.Name, err)
+		}
+	}
+	return &last, nil
+}
+
+// waitOperation returns ErrInstanceNotReady if the instance has an operation
+// still in progress in the broker, and a BrokerOperationError if the
+// operation failed.
+func (c *OSBClient) waitOperation(instance *ServiceInstance, requestID string) error {
+	if instance.Operation == nil {
+		return nil
+	}
+	kind := instance.Operation.Kind
+	last, err := c.lastOperation(instance, requestID)
+	if err != nil {
+		return err
+	}
+	switch last.State {
+	case osbStateSucceeded:
+		return nil
+	case osbStateFailed:
+		return &BrokerOperationError{Instance: instance.Name, Kind: kind, Description: last.Description}
+	}
+	return ErrInstanceNotReady
+}
+
+// Create provisions a new instance in the broker. Brokers may provision
+// instances asynchronously, in this case the instance keeps the pending
+// operation until the broker reports it as finished.
+func (c *OSBClient) Create(instance *ServiceInstance, user, requestID string) error {
+	service, err := c.service(requestID)
+	if err != nil {
+		return err
+	}
+	plan, err := service.plan(instance.PlanName)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"service_id":        service.ID,
+		"plan_id":           plan.ID,
+		"organization_guid": instance.TeamOwner,
+		"space_guid":        instance.TeamOwner,
+		"context": map[string]string{
+			"platform": "tsuru",
+			"team":     instance.TeamOwner,
+			"user":     user,
+		},
+	}
+	query := url.Values{"accepts_incomplete": {"true"}}
+	log.Debugf("Attempting to call provisioning of service instance %q at %q broker", instance.Name, instance.ServiceName)
+	resp, err := c.issueRequest("/v2/service_instances/"+c.instanceID(instance), "PUT", query, body, requestID)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		resp.Body.Close()
+		return nil
+	case http.StatusAccepted:
+		c.setOperation(instance, "provision", resp)
+		return nil
+	case http.StatusConflict:
+		resp.Body.Close()
+		return ErrInstanceAlreadyExistsInAPI
+	}
+	return c.buildError("create the instance "+instance.Name, resp)
+}
+
+// Destroy deprovisions the instance in the broker. Asynchronous
+// deprovisioning is accepted, but not tracked.
+func (c *OSBClient) Destroy(instance *ServiceInstance, requestID string) error {
+	service, err := c.service(requestID)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"service_id": {service.ID}, "accepts_incomplete": {"true"}}
+	if plan, err := service.plan(instance.PlanName); err == nil {
+		query.Set("plan_id", plan.ID)
+	}
+	log.Debugf("Attempting to call deprovisioning of service instance %q at %q broker", instance.Name, instance.ServiceName)
+	resp, err := c.issueRequest("/v2/service_instances/"+c.instanceID(instance), "DELETE", query, nil, requestID)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		resp.Body.Close()
+		return nil
+	case http.StatusGone:
+		resp.Body.Close()
+		return ErrInstanceNotFoundInAPI
+	}
+	return c.buildError("destroy the instance "+instance.Name, resp)
+}
+
+// UpdatePlan changes the plan of the instance in the broker, provided the
+// service allows plan updates. When the broker updates the instance
+// asynchronously, the new plan is kept in the operation until it succeeds.
+func (c *OSBClient) UpdatePlan(instance *ServiceInstance, plan, requestID string) error {
+	err := c.waitOperation(instance, requestID)
+	if err != nil {
+		return err
+	}
+	service, err := c.service(requestID)
+	if err != nil {
+		return err
+	}
+	if !service.PlanUpdateable {
+		return ErrPlanUpdateNotSupported
+	}
+	newPlan, err := service.plan(plan)
+	if err != nil {
+		return err
+	}
+	previous := map[string]string{"service_id": service.ID}
+	if oldPlan, err := service.plan(instance.PlanName); err == nil {
+		previous["plan_id"] = oldPlan.ID
+	}
+	body := map[string]interface{}{
+		"service_id":      service.ID,
+		"plan_id":         newPlan.ID,
+		"previous_values": previous,
+	}
+	query := url.Values{"accepts_incomplete": {"true"}}
+	resp, err := c.issueRequest("/v2/service_instances/"+c.instanceID(instance), "PATCH", query, body, requestID)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil
+	case http.StatusAccepted:
+		c.setOperation(instance, "update", resp)
+		instance.Operation.PlanName = plan
+		return nil
+	case osbStatusUnprocessableEntity:
+		resp.Body.Close()
+		return ErrInstanceNotReady
+	}
+	return c.buildError("update the plan of the instance "+instance.Name, resp)
+}
+
+// BindApp creates a binding for the app in the broker, returning the binding
+// credentials as environment variables.
+func (c *OSBClient) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
+	return c.bindApp(instance, app, c.bindingID(instance, app))
+}
+
+func (c *OSBClient) bindApp(instance *ServiceInstance, app bind.App, bindingID string) (map[string]string, error) {
+	err := c.waitOperation(instance, "")
+	if err != nil {
+		return nil, err
+	}
+	service, err := c.service("")
+	if err != nil {
+		return nil, err
+	}
+	plan, err := service.plan(instance.PlanName)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"service_id":    service.ID,
+		"plan_id":       plan.ID,
+		"app_guid":      app.GetName(),
+		"bind_resource": map[string]string{"app_guid": app.GetName()},
+	}
+	log.Debugf("Calling bind of instance %q and %q app at %q broker", instance.Name, app.GetName(), instance.ServiceName)
+	path := "/v2/service_instances/" + c.instanceID(instance) + "/service_bindings/" + bindingID
+	resp, err := c.issueRequest(path, "PUT", nil, body, "")
+	if err != nil {
+		log.Errorf(`Failed to bind app %q to service instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, err)
+		return nil, fmt.Errorf("%s api is down.", instance.Name)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var result osbBindResponse
+		err = c.decodeResponse(resp, &result)
+		if err != nil {
+			return nil, err
+		}
+		return credentialsToEnvs(result.Credentials), nil
+	case osbStatusUnprocessableEntity:
+		resp.Body.Close()
+		return nil, ErrInstanceNotReady
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, ErrInstanceNotFoundInAPI
+	}
+	return nil, c.buildError(fmt.Sprintf(`bind the instance "%s/%s" to the app %q`, instance.ServiceName, instance.Name, app.GetName()), resp)
+}
+
+// BindUnit is a no-op, brokers only know about app bindings.
+func (c *OSBClient) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+// UnbindApp removes the binding of the app from the broker.
+func (c *OSBClient) UnbindApp(instance *ServiceInstance, app bind.App) error {
+	return c.unbindApp(instance, app, c.bindingID(instance, app))
+}
+
+func (c *OSBClient) unbindApp(instance *ServiceInstance, app bind.App, bindingID string) error {
+	service, err := c.service("")
+	if err != nil {
+		return err
+	}
+	query := url.Values{"service_id": {service.ID}}
+	if plan, err := service.plan(instance.PlanName); err == nil {
+		query.Set("plan_id", plan.ID)
+	}
+	log.Debugf("Calling unbind of service instance %q and app %q at %q broker", instance.Name, app.GetName(), instance.ServiceName)
+	path := "/v2/service_instances/" + c.instanceID(instance) + "/service_bindings/" + bindingID
+	resp, err := c.issueRequest(path, "DELETE", query, nil, "")
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil
+	case http.StatusGone:
+		resp.Body.Close()
+		return ErrInstanceNotFoundInAPI
+	}
+	return c.buildError(fmt.Sprintf(`unbind the instance "%s/%s" from the app %q`, instance.ServiceName, instance.Name, app.GetName()), resp)
+}
+
+// RotateCredentials replaces the binding of the app in the broker, which
+// issues new credentials for it. The new binding is created before the old
+// one is removed, so the app keeps valid credentials if the broker fails to
+// bind.
+func (c *OSBClient) RotateCredentials(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
+	oldID := c.bindingID(instance, app)
+	newID := osbUUID(oldID + "/" + strconv.FormatInt(time.Now().UnixNano(), 10))
+	envs, err := c.bindApp(instance, app, newID)
+	if err != nil {
+		return nil, err
+	}
+	err = instance.setBindingID(app.GetName(), newID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.unbindApp(instance, app, oldID)
+	if err != nil && err != ErrInstanceNotFoundInAPI {
+		log.Errorf(`Failed to remove the old binding of app %q from service instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, err)
+	}
+	return envs, nil
+}
+
+// UnbindUnit is a no-op, brokers only know about app bindings.
+func (c *OSBClient) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+// Status reports the state of the pending operation of the instance, if any.
+// Instances without pending operations are up.
+func (c *OSBClient) Status(instance *ServiceInstance, requestID string) (string, error) {
+	if instance.Operation == nil {
+		return "up", nil
+	}
+	last, err := c.lastOperation(instance, requestID)
+	if err != nil {
+		return "", err
+	}
+	switch last.State {
+	case osbStateInProgress:
+		return "pending", nil
+	case osbStateSucceeded:
+		return "up", nil
+	case osbStateFailed:
+		if last.Description != "" {
+			return "failed: " + last.Description, nil
+		}
+		return "failed", nil
+	}
+	return last.State, nil
+}
+
+// Info is not supported by the Open Service Broker API, it always returns
+// nil.
+func (c *OSBClient) Info(instance *ServiceInstance, requestID string) ([]map[string]string, error) {
+	return nil, nil
+}
+
+// Plans returns the plans of the service in the broker catalog.
+func (c *OSBClient) Plans(requestID string) ([]Plan, error) {
+	service, err := c.service(requestID)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]Plan, len(service.Plans))
+	for i, p := range service.Plans {
+		plans[i] = Plan{Name: p.Name, Description: p.Description}
+	}
+	return plans, nil
+}
+
+// Proxy is not supported by the Open Service Broker API.
+func (c *OSBClient) Proxy(path string, w http.ResponseWriter, r *http.Request) error {
+	return ErrProxyNotSupported
+}
+
+// credentialsToEnvs converts the credentials of a binding to environment
+// variables. Names are upper cased and values that are not strings are
+// encoded as JSON.
+func credentialsToEnvs(credentials map[string]interface{}) map[string]string {
+	envs := make(map[string]string, len(credentials))
+	for key, value := range credentials {
+		name := osbInvalidEnvCharsRegexp.ReplaceAllString(strings.ToUpper(key), "_")
+		if osbEnvStartsWithNumRegexp.MatchString(name) {
+			name = "_" + name
+		}
+		switch v := value.(type) {
+		case string:
+			envs[name] = v
+		default:
+			data, _ := json.Marshal(v)
+			envs[name] = string(data)
+		}
+	}
+	return envs
+}
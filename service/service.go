@@ -14,11 +14,22 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+const (
+	// EndpointKindTsuru identifies services implementing the tsuru service
+	// API.
+	EndpointKindTsuru = "tsuru"
+
+	// EndpointKindOSB identifies services implementing the Open Service
+	// Broker API.
+	EndpointKindOSB = "osb"
+)
+
 type Service struct {
 	Name         string `bson:"_id"`
 	Username     string
 	Password     string
 	Endpoint     map[string]string
+	EndpointKind string   `bson:"endpoint_kind,omitempty"`
 	OwnerTeams   []string `bson:"owner_teams"`
 	Teams        []string
 	Doc          string
@@ -27,8 +38,19 @@ type Service struct {
 
 var (
 	ErrServiceAlreadyExists = errors.New("Service already exists.")
+	ErrInvalidEndpointKind  = errors.New("invalid endpoint kind, it must be either tsuru or osb")
 )
 
+// ValidEndpointKind returns whether the kind of the service endpoint is
+// known. An empty kind means the tsuru service API.
+func (s *Service) ValidEndpointKind() bool {
+	switch s.EndpointKind {
+	case "", EndpointKindTsuru, EndpointKindOSB:
+		return true
+	}
+	return false
+}
+
 func (s *Service) Get() error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -74,16 +96,21 @@ func (s *Service) Delete() error {
 	return err
 }
 
-func (s *Service) getClient(endpoint string) (cli *Client, err error) {
-	if e, ok := s.Endpoint[endpoint]; ok {
-		if p, _ := regexp.MatchString("^https?://", e); !p {
-			e = "http://" + e
-		}
-		cli = &Client{endpoint: e, username: s.GetUsername(), password: s.Password}
-	} else {
-		err = errors.New("Unknown endpoint: " + endpoint)
+func (s *Service) getClient(endpoint string) (ServiceClient, error) {
+	e, ok := s.Endpoint[endpoint]
+	if !ok {
+		return nil, errors.New("Unknown endpoint: " + endpoint)
+	}
+	if p, _ := regexp.MatchString("^https?://", e); !p {
+		e = "http://" + e
+	}
+	switch s.EndpointKind {
+	case "", EndpointKindTsuru:
+		return &Client{endpoint: e, username: s.GetUsername(), password: s.Password}, nil
+	case EndpointKindOSB:
+		return &OSBClient{endpoint: e, username: s.GetUsername(), password: s.Password, serviceName: s.Name}, nil
 	}
-	return
+	return nil, ErrInvalidEndpointKind
 }
 
 func (s *Service) GetUsername() string {
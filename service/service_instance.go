@@ -15,7 +15,10 @@ import (
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/label"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -44,6 +47,9 @@ type ServiceInstance struct {
 	Teams       []string
 	TeamOwner   string
 	Description string
+	Operation   *BrokerOperation  `bson:",omitempty"`
+	Labels      label.Labels      `bson:",omitempty"`
+	Bindings    map[string]string `bson:",omitempty"`
 }
 
 // DeleteInstance deletes the service instance from the database.
@@ -85,6 +91,7 @@ func (si *ServiceInstance) MarshalJSON() ([]byte, error) {
 		"ServiceName": si.ServiceName,
 		"Info":        info,
 		"TeamOwner":   si.TeamOwner,
+		"Labels":      si.Labels,
 	}
 	return json.Marshal(&data)
 }
@@ -146,6 +153,19 @@ func (si *ServiceInstance) update(update bson.M) error {
 	return conn.ServiceInstances().Update(bson.M{"name": si.Name, "service_name": si.ServiceName}, update)
 }
 
+// setBindingID stores the broker binding ID of the app.
+func (si *ServiceInstance) setBindingID(appName, id string) error {
+	err := si.update(bson.M{"$set": bson.M{"bindings." + appName: id}})
+	if err != nil {
+		return err
+	}
+	if si.Bindings == nil {
+		si.Bindings = make(map[string]string)
+	}
+	si.Bindings[appName] = id
+	return nil
+}
+
 // BindApp makes the bind between the service instance and an app.
 func (si *ServiceInstance) BindApp(app bind.App, shouldRestart bool, writer io.Writer) error {
 	args := bindPipelineArgs{
@@ -254,6 +274,86 @@ func (si *ServiceInstance) Status(requestID string) (string, error) {
 	return endpoint.Status(si, requestID)
 }
 
+// UpdatePlan changes the plan of the service instance. Only services whose
+// API supports plan updates accept it.
+func (si *ServiceInstance) UpdatePlan(plan, requestID string) error {
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return err
+	}
+	err = endpoint.UpdatePlan(si, plan, requestID)
+	if err != nil {
+		return err
+	}
+	if si.Operation != nil {
+		// The plan is stored by the endpoint once the operation succeeds.
+		return si.update(bson.M{"$set": bson.M{"operation": si.Operation}})
+	}
+	si.PlanName = plan
+	return si.update(bson.M{"$set": bson.M{"plan_name": plan}, "$unset": bson.M{"operation": ""}})
+}
+
+// SetLabels adds the labels in set to the service instance and removes the
+// labels whose keys are in unset.
+func (si *ServiceInstance) SetLabels(set label.Labels, unset []string) error {
+	err := set.Validate()
+	if err != nil {
+		return err
+	}
+	labels := si.Labels.Update(set, unset)
+	err = si.update(bson.M{"$set": bson.M{"labels": labels}})
+	if err == mgo.ErrNotFound {
+		return ErrServiceInstanceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	si.Labels = labels
+	return nil
+}
+
+// RotateCredentials asks the service API for new credentials for each one of
+// the given apps, which must be bound to the instance. The environment
+// variables of the instance and TSURU_SERVICES are replaced in each app in a
+// single write, followed by a single restart of the app. The rotation is recorded as an event owned by
+// the given user.
+func (si *ServiceInstance) RotateCredentials(apps []bind.App, owner string, writer io.Writer, requestID string) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Name: "service-instance", Value: si.ServiceName + "/" + si.Name},
+		Kind:   permission.PermServiceInstanceUpdateRotate,
+		Owner:  owner,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	evt.SetLogWriter(writer)
+	endpoint, err := si.Service().getClient("production")
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		if si.FindApp(app.GetName()) < 0 {
+			return ErrAppNotBound
+		}
+		evt.Logf("---- Rotating credentials of app %q ----", app.GetName())
+		var envs map[string]string
+		envs, err = endpoint.RotateCredentials(si, app, requestID)
+		if err != nil {
+			return err
+		}
+		err = app.AddInstance(bind.InstanceApp{
+			ServiceName:   si.ServiceName,
+			Instance:      bind.ServiceInstance{Name: si.Name, Envs: envs},
+			ShouldRestart: true,
+		}, evt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (si *ServiceInstance) Grant(teamName string) error {
 	team, err := auth.GetTeam(teamName)
 	if err != nil {
@@ -311,6 +411,11 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 	if instance.TeamOwner == "" {
 		return ErrTeamMandatory
 	}
+	releaseQuota, err := auth.ReserveTeamQuota(instance.TeamOwner, auth.TeamUsage{ServiceInstances: 1})
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	instance.Teams = []string{instance.TeamOwner}
 	actions := []*action.Action{&createServiceInstance, &insertServiceInstance}
 	pipeline := action.NewPipeline(actions...)
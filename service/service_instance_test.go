@@ -22,6 +22,10 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/label"
+	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
@@ -267,6 +271,7 @@ func (s *InstanceSuite) TestMarshalJSON(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        map[string]interface{}{"key": "value"},
 		"TeamOwner":   "",
+		"Labels":      nil,
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
@@ -291,6 +296,7 @@ func (s *InstanceSuite) TestMarshalJSONWithoutInfo(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        nil,
 		"TeamOwner":   "",
+		"Labels":      nil,
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
@@ -315,10 +321,29 @@ func (s *InstanceSuite) TestMarshalJSONWithoutEndpoint(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        nil,
 		"TeamOwner":   "",
+		"Labels":      nil,
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
 
+func (s *InstanceSuite) TestSetLabels(c *check.C) {
+	si := ServiceInstance{Name: "ql", ServiceName: "mysql", Labels: label.Labels{"tier": "db", "team": "admin"}}
+	err := s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	err = si.SetLabels(label.Labels{"tsuru.io/env": "prod"}, []string{"team"})
+	c.Assert(err, check.IsNil)
+	expected := label.Labels{"tier": "db", "tsuru.io/env": "prod"}
+	c.Assert(si.Labels, check.DeepEquals, expected)
+	instance, err := GetServiceInstance("mysql", "ql")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.Labels, check.DeepEquals, expected)
+	err = si.SetLabels(label.Labels{"-tier": "db"}, nil)
+	c.Assert(err, check.ErrorMatches, `invalid name for label "-tier"`)
+	other := ServiceInstance{Name: "unknown", ServiceName: "mysql"}
+	err = other.SetLabels(label.Labels{"tier": "db"}, nil)
+	c.Assert(err, check.Equals, ErrServiceInstanceNotFound)
+}
+
 func (s *InstanceSuite) TestDeleteInstance(c *check.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
@@ -969,3 +994,85 @@ func (s *InstanceSuite) TestUnbindAppMultipleApps(c *check.C) {
 	sort.Strings(siDB.Apps)
 	c.Assert(siDB.Apps, check.DeepEquals, []string{})
 }
+
+func (s *InstanceSuite) TestRotateCredentials(c *check.C) {
+	var reqs []*http.Request
+	var mut sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		reqs = append(reqs, r)
+		r.ParseForm()
+		w.Write([]byte(`{"PASSWORD": "new-` + r.Form.Get("app-host") + `"}`))
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Apps:        []string{"myapp", "otherapp"},
+		Teams:       []string{s.team.Name},
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	a1 := provisiontest.NewFakeApp("myapp", "static", 1)
+	a2 := provisiontest.NewFakeApp("otherapp", "static", 1)
+	var buf bytes.Buffer
+	err = si.RotateCredentials([]bind.App{a1, a2}, s.user.Email, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(reqs, check.HasLen, 2)
+	for _, r := range reqs {
+		c.Assert(r.Method, check.Equals, "POST")
+		c.Assert(r.URL.Path, check.Equals, "/resources/my-mysql/rotate-credentials")
+	}
+	c.Assert(a1.GetInstances("mysql"), check.DeepEquals, []bind.ServiceInstance{
+		{Name: "my-mysql", Envs: map[string]string{"PASSWORD": "new-" + a1.GetIp()}},
+	})
+	c.Assert(a2.GetInstances("mysql"), check.DeepEquals, []bind.ServiceInstance{
+		{Name: "my-mysql", Envs: map[string]string{"PASSWORD": "new-" + a2.GetIp()}},
+	})
+	c.Assert(buf.String(), check.Matches, `(?s).*Rotating credentials of app "myapp".*Rotating credentials of app "otherapp".*`)
+	c.Assert(eventtest.EventDesc{
+		Target:     event.Target{Name: "service-instance", Value: "mysql/my-mysql"},
+		Owner:      s.user.Email,
+		Kind:       permission.PermServiceInstanceUpdateRotate.FullName(),
+		LogMatches: `Rotating credentials of app "otherapp"`,
+	}, eventtest.HasEvent)
+}
+
+func (s *InstanceSuite) TestRotateCredentialsNotSupported(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Apps: []string{"myapp"}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	err = si.RotateCredentials([]bind.App{a}, s.user.Email, nil, "")
+	c.Assert(err, check.Equals, ErrRotationNotSupported)
+	c.Assert(a.GetInstances("mysql"), check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target:       event.Target{Name: "service-instance", Value: "mysql/my-mysql"},
+		Owner:        s.user.Email,
+		Kind:         permission.PermServiceInstanceUpdateRotate.FullName(),
+		ErrorMatches: ErrRotationNotSupported.Error(),
+	}, eventtest.HasEvent)
+}
+
+func (s *InstanceSuite) TestRotateCredentialsAppNotBound(c *check.C) {
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1234"}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	err = si.RotateCredentials([]bind.App{a}, s.user.Email, nil, "")
+	c.Assert(err, check.Equals, ErrAppNotBound)
+}
@@ -101,7 +101,7 @@ func (s *S) TestGetClientWithouHTTP(c *check.C) {
 	service := Service{Name: "redis", Endpoint: endpoints}
 	cli, err := service.getClient("production")
 	c.Assert(err, check.IsNil)
-	c.Assert(cli.endpoint, check.Equals, "http://mysql.api.com")
+	c.Assert(cli.(*Client).endpoint, check.Equals, "http://mysql.api.com")
 }
 
 func (s *S) TestGetClientWithHTTPS(c *check.C) {
@@ -111,7 +111,33 @@ func (s *S) TestGetClientWithHTTPS(c *check.C) {
 	service := Service{Name: "redis", Endpoint: endpoints}
 	cli, err := service.getClient("production")
 	c.Assert(err, check.IsNil)
-	c.Assert(cli.endpoint, check.Equals, "https://mysql.api.com")
+	c.Assert(cli.(*Client).endpoint, check.Equals, "https://mysql.api.com")
+}
+
+func (s *S) TestGetClientOSB(c *check.C) {
+	endpoints := map[string]string{
+		"production": "http://broker.api.com",
+	}
+	service := Service{Name: "redis", Password: "abcde", Endpoint: endpoints, EndpointKind: EndpointKindOSB}
+	cli, err := service.getClient("production")
+	c.Assert(err, check.IsNil)
+	c.Assert(cli, check.DeepEquals, &OSBClient{
+		endpoint:    "http://broker.api.com",
+		username:    "redis",
+		password:    "abcde",
+		serviceName: "redis",
+	})
+}
+
+func (s *S) TestGetClientInvalidKind(c *check.C) {
+	endpoints := map[string]string{
+		"production": "http://mysql.api.com",
+	}
+	service := Service{Name: "redis", Endpoint: endpoints, EndpointKind: "soap"}
+	c.Assert(service.ValidEndpointKind(), check.Equals, false)
+	cli, err := service.getClient("production")
+	c.Assert(err, check.Equals, ErrInvalidEndpointKind)
+	c.Assert(cli, check.IsNil)
 }
 
 func (s *S) TestGetClientWithUnknownEndpoint(c *check.C) {